@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// httpDurationBuckets are the upper bounds, in seconds, of the request
+// latency histogram: Prometheus' defaults.
+var httpDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// unmatchedRoute labels requests that matched no API route, including those
+// rejected before routing, so arbitrary paths cannot grow the metrics.
+const unmatchedRoute = "unmatched"
+
+type AccessLogConfig struct {
+	Enabled bool `json:"enabled"`
+	// Path, when set, appends the access log to a file instead of stderr.
+	Path string `json:"path,omitempty"`
+}
+
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Route      string    `json:"route"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	DurationMs float64   `json:"durationMs"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Principal  string    `json:"principal,omitempty"`
+	RequestID  string    `json:"requestId,omitempty"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+}
+
+// requestInfo is filled in by the innermost handler, which sees the matched
+// route and the authenticated principal, for the outermost one to log.
+type requestInfo struct {
+	route     string
+	principal string
+}
+
+type requestInfoKey struct{}
+
+type httpRequestKey struct {
+	method, route string
+}
+
+type httpCodeKey struct {
+	method, route string
+	code          int
+}
+
+type httpHistogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// httpStats counts the API's requests for /metrics.
+type httpStats struct {
+	mu        sync.Mutex
+	inFlight  int
+	codes     map[httpCodeKey]uint64
+	durations map[httpRequestKey]*httpHistogram
+}
+
+func newHTTPStats() *httpStats {
+	return &httpStats{codes: make(map[httpCodeKey]uint64), durations: make(map[httpRequestKey]*httpHistogram)}
+}
+
+func (s *httpStats) observe(method, route string, code int, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight--
+	s.codes[httpCodeKey{method, route, code}]++
+	key := httpRequestKey{method, route}
+	h := s.durations[key]
+	if h == nil {
+		h = &httpHistogram{counts: make([]uint64, len(httpDurationBuckets))}
+		s.durations[key] = h
+	}
+	secs := d.Seconds()
+	for i, le := range httpDurationBuckets {
+		if secs <= le {
+			h.counts[i]++
+		}
+	}
+	h.sum += secs
+	h.count++
+}
+
+func (s *httpStats) write(mw *metricsWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mw.gauge("http_requests_in_flight", "API requests being served.", float64(s.inFlight))
+
+	codes := make([]httpCodeKey, 0, len(s.codes))
+	for k := range s.codes {
+		codes = append(codes, k)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		a, b := codes[i], codes[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.code < b.code
+	})
+	for _, k := range codes {
+		mw.sample("http_requests_total", "counter", "API requests served since the monitor started, by route and status code.",
+			float64(s.codes[k]), "method", k.method, "route", k.route, "code", strconv.Itoa(k.code))
+	}
+
+	keys := make([]httpRequestKey, 0, len(s.durations))
+	for k := range s.durations {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		return keys[i].method < keys[j].method
+	})
+	for _, k := range keys {
+		h := s.durations[k]
+		mw.histogram("http_request_duration_seconds", "Time to serve API requests, by route.",
+			httpDurationBuckets, h.counts, h.sum, h.count, "method", k.method, "route", k.route)
+	}
+}
+
+// statusRecorder captures the status code and size of a response. It
+// passes Hijack through for the WebSocket endpoints.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response does not support hijacking")
+	}
+	w.status = http.StatusSwitchingProtocols
+	return hj.Hijack()
+}
+
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// routeRecorder wraps the API routes to report the matched route and the
+// principal to accessMiddleware.
+func routeRecorder(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r)
+		info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo)
+		if !ok {
+			return
+		}
+		if _, route, ok := strings.Cut(r.Pattern, " "); ok {
+			info.route = route
+		}
+		if p, ok := principalFromContext(r.Context()); ok {
+			info.principal = p.Name
+		}
+	})
+}
+
+// accessMiddleware records every request's latency and status code for
+// /metrics and, when accessLog is set, writes an access log line for it.
+func accessMiddleware(stats *httpStats, accessLog *accessLogger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		stats.mu.Lock()
+		stats.inFlight++
+		stats.mu.Unlock()
+
+		info := &requestInfo{}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)))
+
+		d := time.Since(start)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		route := info.route
+		if route == "" {
+			route = unmatchedRoute
+		}
+		stats.observe(r.Method, route, rec.status, d)
+		if accessLog != nil {
+			accessLog.write(accessLogEntry{
+				Time:       start,
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				Route:      route,
+				Status:     rec.status,
+				Bytes:      rec.bytes,
+				DurationMs: float64(d.Microseconds()) / 1000,
+				RemoteAddr: r.RemoteAddr,
+				Principal:  info.principal,
+				RequestID:  r.Header.Get(requestIDHeader),
+				UserAgent:  r.UserAgent(),
+			})
+		}
+	})
+}
+
+type accessLogger struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newAccessLogger(cfg AccessLogConfig) (*accessLogger, error) {
+	var out io.Writer = os.Stderr
+	if cfg.Path != "" {
+		f, err := os.OpenFile(cfg.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		out = f
+	}
+	return &accessLogger{enc: json.NewEncoder(out)}, nil
+}
+
+func (l *accessLogger) write(e accessLogEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.enc.Encode(e); err != nil {
+		log.Printf("Access log write failed: %v", err)
+	}
+}
@@ -0,0 +1,536 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultAuditRetention = 365 * 24 * time.Hour
+
+// Audited actions.
+const (
+	AuditSubgraphAdd    = "subgraph.add"
+	AuditSubgraphRemove = "subgraph.remove"
+	AuditHistoryReset   = "subgraph.history_reset"
+	AuditSilenceCreate  = "silence.create"
+	AuditSilenceDelete  = "silence.delete"
+	AuditConfigReload   = "config.reload"
+	AuditSubgraphCheck  = "subgraph.check"
+	AuditHeadPush       = "chain.head_push"
+)
+
+type AuditConfig struct {
+	Retention Duration `json:"retention"`
+	// Path, when set, appends every entry to a JSON lines file that is
+	// never rewritten. Read at startup.
+	Path string `json:"path,omitempty"`
+}
+
+// AuditEntry records one management change: who made it, through which
+// credential, and what it changed.
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// Actor is the credential name for API requests, or the config source
+	// for reloads.
+	Actor string `json:"actor"`
+	// Method is the authentication method: basic, token, oidc, signature,
+	// slack for the Slack bot, or none when authentication is disabled.
+	// Empty for reloads.
+	Method     string        `json:"method,omitempty"`
+	RemoteAddr string        `json:"remoteAddr,omitempty"`
+	Action     string        `json:"action"`
+	Target     string        `json:"target,omitempty"`
+	Tenant     string        `json:"tenant,omitempty"`
+	Diff       []AuditChange `json:"diff,omitempty"`
+}
+
+// AuditChange is one changed field; Before or After is absent when the
+// field was added or removed. Credentials are redacted.
+type AuditChange struct {
+	Path   string      `json:"path"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+type AuditFilter struct {
+	Since  time.Time
+	Actor  string
+	Action string
+	Target string
+	Tenant string
+}
+
+func (f AuditFilter) match(e AuditEntry) bool {
+	return !e.Time.Before(f.Since) &&
+		(f.Actor == "" || e.Actor == f.Actor) &&
+		(f.Action == "" || e.Action == f.Action) &&
+		(f.Target == "" || e.Target == f.Target) &&
+		(f.Tenant == "" || e.Tenant == f.Tenant)
+}
+
+// AuditLog keeps the audit entries for retention, like EventLog does for
+// transitions.
+type AuditLog struct {
+	mu        sync.RWMutex
+	retention time.Duration
+	entries   []AuditEntry
+	file      *os.File
+	enc       *json.Encoder
+}
+
+func NewAuditLog(retention time.Duration) *AuditLog {
+	return &AuditLog{retention: retention}
+}
+
+func (l *AuditLog) Add(e AuditEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = append(l.entries, e)
+	cutoff := e.Time.Add(-l.retention)
+	drop := sort.Search(len(l.entries), func(i int) bool { return !l.entries[i].Time.Before(cutoff) })
+	if drop > 0 {
+		l.entries = append(l.entries[:0:0], l.entries[drop:]...)
+	}
+
+	if l.enc != nil {
+		if err := l.enc.Encode(e); err != nil {
+			log.Printf("Audit log write to %s failed, persistence disabled: %v", l.file.Name(), err)
+			l.file.Close()
+			l.file, l.enc = nil, nil
+		}
+	}
+}
+
+// Open loads the entries in path that are within retention and appends
+// every further entry to it.
+func (l *AuditLog) Open(path string) error {
+	entries, err := readAuditLogFile(path, time.Now().Add(-l.retention))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(entries, l.entries...)
+	l.file, l.enc = f, json.NewEncoder(f)
+	return nil
+}
+
+func readAuditLogFile(path string, since time.Time) ([]AuditEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e AuditEntry
+		if json.Unmarshal(scanner.Bytes(), &e) != nil || e.Time.Before(since) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// Query returns a copy of the matching entries, oldest first.
+func (l *AuditLog) Query(f AuditFilter) []AuditEntry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	out := []AuditEntry{}
+	start := sort.Search(len(l.entries), func(i int) bool { return !l.entries[i].Time.Before(f.Since) })
+	for _, e := range l.entries[start:] {
+		if f.match(e) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// audit records a change made through the API. before and after are the
+// changed object's state, nil when it did not exist.
+func (m *Monitor) audit(r *http.Request, action, target, tenant string, before, after interface{}) {
+	e := AuditEntry{
+		Time:       time.Now(),
+		Actor:      principalName(r),
+		Method:     "none",
+		RemoteAddr: r.RemoteAddr,
+		Action:     action,
+		Target:     target,
+		Tenant:     tenant,
+		Diff:       diffJSON(before, after),
+	}
+	if p, ok := principalFromContext(r.Context()); ok {
+		e.Method = p.Method
+	}
+	m.store.SaveAudit(e)
+}
+
+// auditSlack records an action taken through the Slack bot by actor.
+func (m *Monitor) auditSlack(actor, action, target string, before, after interface{}) {
+	m.store.SaveAudit(AuditEntry{
+		Time:   time.Now(),
+		Actor:  actor,
+		Method: "slack",
+		Action: action,
+		Target: target,
+		Tenant: m.Snapshot().subgraphTenant(target),
+		Diff:   diffJSON(before, after),
+	})
+}
+
+// diffJSON compares the JSON forms of before and after field by field.
+// Objects are compared key by key and lists of named objects (subgraphs,
+// notifiers, ...) by name; anything else changed is reported whole.
+func diffJSON(before, after interface{}) []AuditChange {
+	var changes []AuditChange
+	diffValues("", toJSONValue(before), toJSONValue(after), redactNone, &changes)
+	return changes
+}
+
+// redaction is how a config value is shown in the audit log.
+type redaction int
+
+const (
+	redactNone redaction = iota
+	// redactURL keeps a URL's scheme and host only, as credentials are
+	// often part of its user info, path (RPC API keys, Slack webhook
+	// paths) or query.
+	redactURL
+	redactSecret
+)
+
+// keyRedaction is the redaction of the value of key in an object whose
+// own redaction is parent.
+func keyRedaction(key string, parent redaction) redaction {
+	switch {
+	case parent == redactSecret || isSecretKey(key):
+		return redactSecret
+	case isURLKey(key):
+		return redactURL
+	}
+	return parent
+}
+
+func toJSONValue(v interface{}) interface{} {
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Pointer && reflect.ValueOf(v).IsNil() {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var out interface{}
+	json.Unmarshal(data, &out)
+	return out
+}
+
+func diffValues(path string, a, b interface{}, redact redaction, out *[]AuditChange) {
+	if reflect.DeepEqual(a, b) {
+		return
+	}
+	am, aok := a.(map[string]interface{})
+	bm, bok := b.(map[string]interface{})
+	// An added or removed object is listed field by field.
+	if aok && b == nil {
+		bm, bok = map[string]interface{}{}, true
+	}
+	if bok && a == nil {
+		am, aok = map[string]interface{}{}, true
+	}
+	if aok && bok {
+		keys := make(map[string]bool)
+		for k := range am {
+			keys[k] = true
+		}
+		for k := range bm {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			diffValues(joinAuditPath(path, k), am[k], bm[k], keyRedaction(k, redact), out)
+		}
+		return
+	}
+	al, aok := a.([]interface{})
+	bl, bok := b.([]interface{})
+	if aok && b == nil || bok && a == nil {
+		aok, bok = true, true
+	}
+	if aok && bok {
+		if an, bn := namedItems(al), namedItems(bl); an != nil && bn != nil {
+			var names []string
+			for _, v := range al {
+				names = append(names, itemName(v))
+			}
+			for _, v := range bl {
+				if _, ok := an[itemName(v)]; !ok {
+					names = append(names, itemName(v))
+				}
+			}
+			for _, name := range names {
+				diffValues(path+"["+name+"]", an[name], bn[name], redact, out)
+			}
+			return
+		}
+	}
+	*out = append(*out, AuditChange{Path: path, Before: redactJSON(a, redact), After: redactJSON(b, redact)})
+}
+
+func joinAuditPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// namedItems indexes a list by the name of its objects, or returns nil if
+// any item is not an object with a unique name.
+func namedItems(items []interface{}) map[string]interface{} {
+	byName := make(map[string]interface{}, len(items))
+	for _, v := range items {
+		name := itemName(v)
+		if name == "" {
+			return nil
+		}
+		if _, dup := byName[name]; dup {
+			return nil
+		}
+		byName[name] = v
+	}
+	return byName
+}
+
+func itemName(v interface{}) string {
+	obj, _ := v.(map[string]interface{})
+	name, _ := obj["name"].(string)
+	return name
+}
+
+// isSecretKey reports whether a config key holds a credential, e.g.
+// password, token or secretAccessKey. Header values are treated as
+// credentials since they usually carry API keys.
+func isSecretKey(key string) bool {
+	k := strings.ToLower(key)
+	for _, s := range []string{"password", "secret", "token", "apikey", "accesskey", "accesskeyid", "authorization", "headers"} {
+		if strings.HasSuffix(k, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// isURLKey reports whether a config key holds endpoint URLs, e.g. url,
+// rpcUrl, fallbackRpcUrls or replicas.
+func isURLKey(key string) bool {
+	k := strings.ToLower(key)
+	return strings.HasSuffix(k, "url") || strings.HasSuffix(k, "urls") || k == "replicas"
+}
+
+func redactJSON(v interface{}, redact redaction) interface{} {
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			out[k] = redactJSON(e, keyRedaction(k, redact))
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, e := range t {
+			out[i] = redactJSON(e, redact)
+		}
+		return out
+	case string:
+		if redact == redactURL {
+			return redactURLString(t)
+		}
+	}
+	if redact == redactSecret {
+		return "[redacted]"
+	}
+	return v
+}
+
+// redactURLString reduces a URL to its scheme and host, marking a dropped
+// path or query with "/[redacted]".
+func redactURLString(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return "[redacted]"
+	}
+	out := u.Scheme + "://" + u.Host
+	if strings.Trim(u.Path, "/") != "" || u.RawQuery != "" || u.Opaque != "" {
+		out += "/[redacted]"
+	}
+	return out
+}
+
+func (m *Monitor) handleAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := AuditFilter{
+		Since:  time.Now().Add(-7 * 24 * time.Hour),
+		Actor:  q.Get("actor"),
+		Action: q.Get("action"),
+		Target: q.Get("target"),
+		Tenant: viewTenant(r),
+	}
+	if v := q.Get("since"); v != "" {
+		since, err := parseSince(v, time.Now())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid since: "+err.Error())
+			return
+		}
+		f.Since = since
+	}
+	writeJSON(w, http.StatusOK, m.store.LoadAudit(f))
+}
+
+// runAudit implements "audit": it lists the audit log file or, with
+// -server, a running monitor's audit log.
+func runAudit(args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file (for audit.path)")
+	logPath := fs.String("log", "", "audit log file to read (default: audit.path from the config)")
+	server := fs.String("server", "", "base URL of a running monitor's HTTP API to query instead of a file")
+	token := fs.String("token", os.Getenv("SUBGRAPH_MONITOR_TOKEN"), "bearer token for -server (default $SUBGRAPH_MONITOR_TOKEN)")
+	since := fs.String("since", "7d", "how far back to list, e.g. 24h or 30d, or an RFC 3339 time")
+	actor := fs.String("actor", "", "only list changes by this actor")
+	action := fs.String("action", "", "only list this action, e.g. subgraph.add or config.reload")
+	target := fs.String("target", "", "only list changes to this subgraph")
+	format := fs.String("format", FormatAuto, "output format: auto (table on a terminal, json otherwise), table, or json (one entry per line)")
+	asJSON := fs.Bool("json", false, "print the entries as JSON lines, like -format json")
+	fs.Parse(args)
+	if *asJSON {
+		*format = "json"
+	}
+	out, err := outputFormat(*format, "table", "json")
+	if err != nil {
+		return err
+	}
+
+	from, err := parseSince(*since, time.Now())
+	if err != nil {
+		return fmt.Errorf("invalid -since %q", *since)
+	}
+	filter := AuditFilter{Since: from, Actor: *actor, Action: *action, Target: *target}
+
+	var entries []AuditEntry
+	if *server != "" {
+		entries, err = fetchAudit(*server, *token, *since, filter)
+		if err != nil {
+			return err
+		}
+	} else {
+		path := *logPath
+		if path == "" && *configPath != "" {
+			cfg, err := loadConfigFile(*configPath)
+			if err != nil {
+				return err
+			}
+			path = cfg.Audit.Path
+		}
+		if path == "" {
+			return fmt.Errorf("no audit log: set audit.path in the config, pass -log or -server")
+		}
+		all, err := readAuditLogFile(path, from)
+		if err != nil {
+			return fmt.Errorf("read audit log failed: %v", err)
+		}
+		for _, e := range all {
+			if filter.match(e) {
+				entries = append(entries, e)
+			}
+		}
+	}
+
+	if out == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(entries) == 0 {
+		fmt.Printf("No audit entries since %s\n", from.Format("2006-01-02 15:04"))
+		return nil
+	}
+	for _, e := range entries {
+		target := e.Target
+		if target == "" {
+			target = "-"
+		}
+		fmt.Printf("%s %-22s %-25s by %s\n", e.Time.Local().Format("2006-01-02 15:04:05"), e.Action, target, e.Actor)
+		for _, c := range e.Diff {
+			fmt.Printf("    %s: %s -> %s\n", c.Path, formatAuditValue(c.Before), formatAuditValue(c.After))
+		}
+	}
+	return nil
+}
+
+func formatAuditValue(v interface{}) string {
+	if v == nil {
+		return "(none)"
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func fetchAudit(server, token, since string, f AuditFilter) ([]AuditEntry, error) {
+	q := url.Values{"since": {since}}
+	for k, v := range map[string]string{"actor": f.Actor, "action": f.Action, "target": f.Target} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(server, "/")+"/api/v1/audit?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var entries []AuditEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("JSON error: %v", err)
+	}
+	return entries, nil
+}
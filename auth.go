@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	authRealm               = "subgraph-monitor"
+	tokensFileCheckInterval = 30 * time.Second
+
+	// ScopeRead grants access to status endpoints; ScopeWrite additionally
+	// allows mutating operations such as adding subgraphs or silencing alerts.
+	// ScopeHeads only allows pushing chain heads, for block listeners.
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeHeads = "heads"
+)
+
+type AuthConfig struct {
+	Users      []BasicUser   `json:"users"`
+	Tokens     []BearerToken `json:"tokens"`
+	TokensFile string        `json:"tokensFile"`
+	OIDC       *OIDCConfig   `json:"oidc"`
+	// Webhooks accept requests signed with a shared secret in place of
+	// credentials.
+	Webhooks []WebhookSecret `json:"webhooks"`
+}
+
+// Credentials with a Tenant only see and manage that tenant's subgraphs.
+type BasicUser struct {
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	Scopes   []string `json:"scopes"`
+	Tenant   string   `json:"tenant,omitempty"`
+}
+
+type BearerToken struct {
+	Name   string   `json:"name"`
+	Token  string   `json:"token"`
+	Scopes []string `json:"scopes"`
+	Tenant string   `json:"tenant,omitempty"`
+}
+
+func (a *AuthConfig) Enabled() bool {
+	return len(a.Users) > 0 || len(a.Tokens) > 0 || a.TokensFile != "" || a.OIDC != nil || len(a.Webhooks) > 0
+}
+
+func (a *AuthConfig) validate() error {
+	for i, u := range a.Users {
+		if u.Username == "" || u.Password == "" {
+			return fmt.Errorf("server.auth.users[%d]: username and password are required", i)
+		}
+		if err := validateScopes(u.Scopes); err != nil {
+			return fmt.Errorf("server.auth.users[%d]: %v", i, err)
+		}
+	}
+	if err := validateTokens(a.Tokens); err != nil {
+		return fmt.Errorf("server.auth.%v", err)
+	}
+	for i, h := range a.Webhooks {
+		if h.Name == "" || h.Secret == "" {
+			return fmt.Errorf("server.auth.webhooks[%d]: name and secret are required", i)
+		}
+		if err := validateScopes(h.Scopes); err != nil {
+			return fmt.Errorf("server.auth.webhooks[%d]: %v", i, err)
+		}
+	}
+	if a.OIDC != nil {
+		if a.OIDC.Issuer == "" || a.OIDC.Audience == "" {
+			return fmt.Errorf("server.auth.oidc: issuer and audience are required")
+		}
+		if err := validateScopes(a.OIDC.Scopes); err != nil {
+			return fmt.Errorf("server.auth.oidc: %v", err)
+		}
+	}
+	return nil
+}
+
+func validateTokens(tokens []BearerToken) error {
+	for i, t := range tokens {
+		if t.Name == "" || t.Token == "" {
+			return fmt.Errorf("tokens[%d]: name and token are required", i)
+		}
+		if err := validateScopes(t.Scopes); err != nil {
+			return fmt.Errorf("tokens[%d]: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func validateScopes(scopes []string) error {
+	for _, s := range scopes {
+		if s != ScopeRead && s != ScopeWrite && s != ScopeHeads {
+			return fmt.Errorf("unknown scope %q", s)
+		}
+	}
+	return nil
+}
+
+type Principal struct {
+	Name   string   `json:"name"`
+	Method string   `json:"method"`
+	Scopes []string `json:"scopes"`
+	Tenant string   `json:"tenant,omitempty"`
+}
+
+// HasScope reports whether the principal may perform operations requiring
+// scope. Write implies read and heads; credentials without explicit scopes
+// are read-only. Chain heads are shared by every tenant, so only principals
+// without a tenant may push them.
+func (p Principal) HasScope(scope string) bool {
+	if scope == ScopeHeads && p.Tenant != "" {
+		return false
+	}
+	scopes := p.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{ScopeRead}
+	}
+	for _, s := range scopes {
+		if s == scope || s == ScopeWrite {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+func principalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+type authenticator struct {
+	cfg     AuthConfig
+	tenants map[string]TenantConfig
+	oidc    *oidcVerifier
+	seen    signatureCache
+
+	mu            sync.Mutex
+	fileTokens    []BearerToken
+	fileModTime   time.Time
+	fileCheckedAt time.Time
+}
+
+func newAuthenticator(cfg AuthConfig, tenants map[string]TenantConfig) (*authenticator, error) {
+	a := &authenticator{cfg: cfg, tenants: tenants}
+	if cfg.OIDC != nil {
+		a.oidc = newOIDCVerifier(*cfg.OIDC)
+	}
+	if cfg.TokensFile != "" {
+		if err := a.reloadTokensFile(); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// tokens returns the configured tokens plus those from the tokens file,
+// re-reading the file when it changed so tokens can be rotated without a
+// restart.
+func (a *authenticator) tokens() []BearerToken {
+	if a.cfg.TokensFile == "" {
+		return a.cfg.Tokens
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if time.Since(a.fileCheckedAt) >= tokensFileCheckInterval {
+		if err := a.reloadTokensFileLocked(); err != nil {
+			log.Printf("Tokens file error, keeping previous tokens: %v", err)
+		}
+	}
+	return append(append([]BearerToken(nil), a.cfg.Tokens...), a.fileTokens...)
+}
+
+func (a *authenticator) reloadTokensFile() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.reloadTokensFileLocked()
+}
+
+func (a *authenticator) reloadTokensFileLocked() error {
+	a.fileCheckedAt = time.Now()
+	info, err := os.Stat(a.cfg.TokensFile)
+	if err != nil {
+		return fmt.Errorf("stat tokens file failed: %v", err)
+	}
+	if info.ModTime().Equal(a.fileModTime) {
+		return nil
+	}
+	data, err := os.ReadFile(a.cfg.TokensFile)
+	if err != nil {
+		return fmt.Errorf("read tokens file failed: %v", err)
+	}
+	var tokens []BearerToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return fmt.Errorf("parse tokens file failed: %v", err)
+	}
+	if err := validateTokens(tokens); err != nil {
+		return fmt.Errorf("tokens file: %v", err)
+	}
+	if err := validateTokenTenants(tokens, a.tenants); err != nil {
+		return fmt.Errorf("tokens file: %v", err)
+	}
+	a.fileTokens = tokens
+	a.fileModTime = info.ModTime()
+	log.Printf("Loaded %d tokens from %s", len(tokens), a.cfg.TokensFile)
+	return nil
+}
+
+func (a *authenticator) authenticate(r *http.Request) (Principal, error) {
+	if r.Header.Get(signatureHeader) != "" && len(a.cfg.Webhooks) > 0 {
+		h, err := verifySignature(r, a.cfg.Webhooks, &a.seen, time.Now())
+		if err != nil {
+			return Principal{}, err
+		}
+		return Principal{Name: h.Name, Method: "signature", Scopes: h.Scopes, Tenant: h.Tenant}, nil
+	}
+	scheme, credentials, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	switch {
+	case strings.EqualFold(scheme, "Basic") && len(a.cfg.Users) > 0:
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			return Principal{}, fmt.Errorf("malformed basic credentials")
+		}
+		for _, u := range a.cfg.Users {
+			if secureCompare(u.Username, username) && secureCompare(u.Password, password) {
+				return Principal{Name: u.Username, Method: "basic", Scopes: u.Scopes, Tenant: u.Tenant}, nil
+			}
+		}
+		return Principal{}, fmt.Errorf("invalid username or password")
+	case strings.EqualFold(scheme, "Bearer") && credentials != "":
+		for _, t := range a.tokens() {
+			if secureCompare(t.Token, credentials) {
+				return Principal{Name: t.Name, Method: "token", Scopes: t.Scopes, Tenant: t.Tenant}, nil
+			}
+		}
+		if a.oidc != nil {
+			claims, err := a.oidc.Verify(r.Context(), credentials)
+			if err != nil {
+				return Principal{}, err
+			}
+			p := Principal{Name: claims.identity(), Method: "oidc", Scopes: a.cfg.OIDC.Scopes}
+			if claim := a.cfg.OIDC.TenantClaim; claim != "" {
+				if claims.Tenant == "" {
+					return Principal{}, fmt.Errorf("token has no %s claim", claim)
+				}
+				if _, ok := a.tenants[claims.Tenant]; !ok {
+					return Principal{}, fmt.Errorf("unknown tenant %q in %s claim", claims.Tenant, claim)
+				}
+				p.Tenant = claims.Tenant
+			}
+			return p, nil
+		}
+		return Principal{}, fmt.Errorf("invalid bearer token")
+	}
+	return Principal{}, fmt.Errorf("missing credentials")
+}
+
+func (a *authenticator) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := a.authenticate(r)
+		if err != nil {
+			log.Printf("Auth failed for %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+			if len(a.cfg.Users) > 0 {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", authRealm))
+			} else {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q", authRealm))
+			}
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	})
+}
+
+// requireScope rejects requests whose principal lacks scope. Requests
+// without a principal only reach it when authentication is disabled.
+func requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if p, ok := principalFromContext(r.Context()); ok && !p.HasScope(scope) {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("%q scope required", scope))
+			return
+		}
+		next(w, r)
+	}
+}
+
+func secureCompare(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func isLoopbackListen(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// TransitionAvailability marks transitions of a subgraph endpoint's
+	// query availability (From and To are its availability status), which
+	// is tracked apart from sync lag.
+	TransitionAvailability = "availability"
+
+	DefaultAvailabilityWindow    = 20
+	DefaultAvailabilityWarnBelow = 0.95
+	DefaultAvailabilityCritBelow = 0.8
+	// availabilityMinChecks is how many checks the window needs before
+	// availability is alerted on.
+	availabilityMinChecks = 5
+)
+
+// AvailabilityConfig sets when a subgraph endpoint counts as unavailable:
+// when the share of its last Window checks answered without a transport
+// error or HTTP 5xx drops below WarnBelow or CritBelow. Zero disables a
+// threshold.
+type AvailabilityConfig struct {
+	Window    int     `json:"window"`
+	WarnBelow float64 `json:"warnBelow"`
+	CritBelow float64 `json:"critBelow"`
+}
+
+func (c *AvailabilityConfig) validate() error {
+	if c.Window < availabilityMinChecks {
+		return fmt.Errorf("window must be at least %d checks", availabilityMinChecks)
+	}
+	if c.WarnBelow < 0 || c.WarnBelow > 1 || c.CritBelow < 0 || c.CritBelow > 1 {
+		return fmt.Errorf("warnBelow and critBelow must be in [0, 1]")
+	}
+	if c.WarnBelow > 0 && c.CritBelow > c.WarnBelow {
+		return fmt.Errorf("critBelow must not be above warnBelow")
+	}
+	return nil
+}
+
+// endpointError is a subgraph query that got no usable HTTP response: a
+// transport error (Status 0) or a status other than 200.
+type endpointError struct {
+	Status int
+	Body   string
+	Err    error
+}
+
+func (e *endpointError) Error() string {
+	if e.Status == 0 {
+		return fmt.Sprintf("HTTP error: %v", e.Err)
+	}
+	return fmt.Sprintf("HTTP %d: %s", e.Status, e.Body)
+}
+
+func (e *endpointError) Unwrap() error {
+	return e.Err
+}
+
+// isUnavailable reports whether err means consumers could not query the
+// endpoint either: it failed to answer or answered with a server or
+// gateway error. GraphQL errors and 4xx responses are answers.
+func isUnavailable(err error) bool {
+	var ee *endpointError
+	return errors.As(err, &ee) && (ee.Status == 0 || ee.Status >= 500)
+}
+
+// recordAvailability adds the outcome of a query to the subgraph's
+// availability window. Rate limited checks are not queries that reached the
+// endpoint and are left out.
+func recordAvailability(sg *SubgraphInfo, err error) {
+	if isRateLimited(err) {
+		return
+	}
+	available := !isUnavailable(err)
+	if !available {
+		sg.LastUnavailable = err.Error()
+	}
+	sg.AvailabilityChecks = append(sg.AvailabilityChecks, available)
+	if window := sg.Availability.Window; len(sg.AvailabilityChecks) > window {
+		sg.AvailabilityChecks = sg.AvailabilityChecks[len(sg.AvailabilityChecks)-window:]
+	}
+}
+
+// availability returns the share of the window's checks the endpoint
+// answered and how many checks that is; 1 with none, which classifies as
+// OK but is reported as unknown.
+func availability(sg *SubgraphInfo) (float64, int) {
+	if len(sg.AvailabilityChecks) == 0 {
+		return 1, 0
+	}
+	ok := 0
+	for _, available := range sg.AvailabilityChecks {
+		if available {
+			ok++
+		}
+	}
+	return float64(ok) / float64(len(sg.AvailabilityChecks)), len(sg.AvailabilityChecks)
+}
+
+// availabilityRatio returns the subgraph's availability, or nil before its
+// endpoint has been queried, e.g. while it is batched through an index node.
+func availabilityRatio(sg *SubgraphInfo) *float64 {
+	ratio, checks := availability(sg)
+	if checks == 0 {
+		return nil
+	}
+	return &ratio
+}
+
+func classifyAvailability(sg *SubgraphInfo) Status {
+	ratio, checks := availability(sg)
+	switch {
+	case checks < availabilityMinChecks:
+		return StatusOK
+	case ratio < sg.Availability.CritBelow:
+		return StatusCrit
+	case ratio < sg.Availability.WarnBelow:
+		return StatusWarn
+	}
+	return StatusOK
+}
+
+// updateAvailability classifies the subgraph's availability and returns a
+// transition when it changed. Must be called with mu held, after the check.
+func (m *Monitor) updateAvailability(sg *SubgraphInfo, cycleID string, now time.Time) (StateTransition, bool) {
+	from := sg.AvailabilityStatus
+	if from == StatusUnknown {
+		from = StatusOK
+	}
+	to := classifyAvailability(sg)
+	sg.AvailabilityStatus = to
+	if to == from {
+		return StateTransition{}, false
+	}
+	ratio, checks := availability(sg)
+	trigger := fmt.Sprintf("availability %.0f%% over %d checks", ratio*100, checks)
+	switch to {
+	case StatusCrit:
+		trigger += fmt.Sprintf(" < critBelow %.0f%%, last: %s", sg.Availability.CritBelow*100, sg.LastUnavailable)
+	case StatusWarn:
+		trigger += fmt.Sprintf(" < warnBelow %.0f%%, last: %s", sg.Availability.WarnBelow*100, sg.LastUnavailable)
+	}
+	if m.isSilenced(sg.Name, now) {
+		logCheck(sg, "Subgraph %s: availability %s -> %s (silenced): %s", sg.Name, from, to, trigger)
+		return StateTransition{}, false
+	}
+	return StateTransition{
+		Kind:     TransitionAvailability,
+		Time:     sg.CheckedAt,
+		CycleID:  cycleID,
+		CheckID:  sg.CheckID,
+		Subgraph: sg.Name,
+		Chain:    sg.Chain,
+		From:     from,
+		To:       to,
+		Context:  newSubgraphStatus(sg),
+		Trigger:  trigger,
+	}, true
+}
+
+func availabilityLevel(s Status) float64 {
+	switch s {
+	case StatusCrit:
+		return 2
+	case StatusWarn:
+		return 1
+	}
+	return 0
+}
+
+func formatAvailability(prefix string, t StateTransition) string {
+	if t.To == StatusOK {
+		return fmt.Sprintf("%s%s (%s): endpoint available again, %s (check %s)", prefix, t.Subgraph, t.Chain, t.Trigger, t.CheckID)
+	}
+	return fmt.Sprintf("%s%s (%s): endpoint availability %s, %s (check %s)", prefix, t.Subgraph, t.Chain, t.To, t.Trigger, t.CheckID)
+}
+
+func printAvailability(sg *SubgraphInfo) {
+	status := classifyAvailability(sg)
+	if status == StatusOK {
+		return
+	}
+	ratio, checks := availability(sg)
+	fmt.Printf("  availability %s: %.0f%% of the last %d checks answered (last: %s)\n", status, ratio*100, checks, sg.LastUnavailable)
+}
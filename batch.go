@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+const DefaultIndexNodeMetaInterval = time.Hour
+
+// IndexNodeConfig with Batch set checks the subgraphs that have an
+// indexNodeUrl and no replicas with one indexingStatuses query per index
+// node per cycle, instead of one _meta query per subgraph. Each subgraph's
+// own endpoint is still queried every MetaInterval, and whenever the index
+// node cannot answer for it, to pick up redeploys, query errors and latency.
+type IndexNodeConfig struct {
+	Batch        bool     `json:"batch"`
+	MetaInterval Duration `json:"metaInterval"`
+}
+
+func (c *IndexNodeConfig) validate() error {
+	if c.Batch && c.MetaInterval.Duration <= 0 {
+		return fmt.Errorf("indexNode.metaInterval must be positive")
+	}
+	return nil
+}
+
+// batchIndexingStatuses queries each index node once for the deployments of
+// the subgraphs that can be checked through it. Subgraphs missing from the
+// result, or whose index node failed, are checked with _meta as usual.
+func batchIndexingStatuses(cycleID string, subgraphs []*SubgraphInfo, cfg IndexNodeConfig) map[*SubgraphInfo]*indexingStatus {
+	batched := make(map[*SubgraphInfo]*indexingStatus)
+	if !cfg.Batch {
+		return batched
+	}
+	now := time.Now()
+	byNode := make(map[string][]*SubgraphInfo)
+	for _, sg := range subgraphs {
+		if sg.IndexNodeURL == "" || sg.Deployment == "" || len(sg.Replicas) > 0 || now.Sub(sg.MetaCheckedAt) >= cfg.MetaInterval.Duration {
+			continue
+		}
+		byNode[sg.IndexNodeURL] = append(byNode[sg.IndexNodeURL], sg)
+	}
+
+	for url, sgs := range byNode {
+		var ids []string
+		seen := make(map[string]bool)
+		for _, sg := range sgs {
+			if !seen[sg.Deployment] {
+				seen[sg.Deployment] = true
+				ids = append(ids, sg.Deployment)
+			}
+		}
+		statuses, err := fetchIndexingStatuses(url, ids, cycleID)
+		if err != nil {
+			log.Printf("[%s] Index node %s batch query failed, checking its %d subgraphs one by one: %v", cycleID, url, len(sgs), err)
+			continue
+		}
+		byID := make(map[string]*indexingStatus, len(statuses))
+		for i := range statuses {
+			byID[statuses[i].Subgraph] = &statuses[i]
+		}
+		n := 0
+		for _, sg := range sgs {
+			// A failed deployment is left to _meta, whose error carries
+			// the failure reason.
+			if st := byID[sg.Deployment]; st != nil && st.Health != "failed" && len(st.Chains) > 0 && st.Chains[0].LatestBlock != nil {
+				batched[sg] = st
+				n++
+			}
+		}
+		log.Printf("[%s] Index node %s: %d of %d subgraphs checked in one query", cycleID, url, n, len(sgs))
+	}
+	return batched
+}
+
+// batchedMeta reads what a _meta query would return from the deployment's
+// indexing status. Latency is not measured, so the last one is kept.
+func batchedMeta(sg *SubgraphInfo, st *indexingStatus) subgraphMeta {
+	return subgraphMeta{
+		Block:             st.Chains[0].LatestBlock.Number,
+		Deployment:        st.Subgraph,
+		HasIndexingErrors: st.Health != "healthy",
+		Latency:           sg.QueryLatency,
+	}
+}
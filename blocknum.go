@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// maxQuantity is the largest block number or timestamp the monitor accepts,
+// the largest int64. Lags of non-negative blocks fit in an int64; speeds,
+// times behind and metrics are derived in float64 and sums of lags
+// saturate. Larger values, and malformed ones, are reported instead of
+// being truncated or wrapped.
+const maxQuantity = math.MaxInt64
+
+// parseHexQuantity parses a JSON-RPC quantity such as "0x1b4"; what names
+// the value in errors.
+func parseHexQuantity(what, s string) (int64, error) {
+	digits, ok := strings.CutPrefix(s, "0x")
+	if !ok {
+		digits, ok = strings.CutPrefix(s, "0X")
+	}
+	if !ok {
+		return 0, fmt.Errorf("invalid %s %q: expected a 0x-prefixed hex quantity", what, s)
+	}
+	return parseQuantityDigits(what, s, digits, 16)
+}
+
+// parseDecimalQuantity parses a non-negative decimal integer.
+func parseDecimalQuantity(what, s string) (int64, error) {
+	if digits, ok := strings.CutPrefix(s, "-"); ok && digits != "" && strings.Trim(digits, "0123456789") == "" {
+		return 0, fmt.Errorf("%s %s is negative", what, s)
+	}
+	return parseQuantityDigits(what, s, s, 10)
+}
+
+// parseQuantity parses a hex quantity when s has a 0x prefix and a decimal
+// integer otherwise.
+func parseQuantity(what, s string) (int64, error) {
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		return parseHexQuantity(what, s)
+	}
+	return parseDecimalQuantity(what, s)
+}
+
+func parseQuantityDigits(what, s, digits string, base int) (int64, error) {
+	valid := "0123456789"
+	if base == 16 {
+		valid += "abcdefABCDEF"
+	}
+	if digits == "" || strings.Trim(digits, valid) != "" {
+		return 0, fmt.Errorf("invalid %s %q", what, s)
+	}
+	n, _ := new(big.Int).SetString(digits, base)
+	if n.Cmp(big.NewInt(maxQuantity)) > 0 {
+		if base == 16 {
+			return 0, fmt.Errorf("%s %s (%s) is out of range, the maximum is %d", what, s, n, maxQuantity)
+		}
+		return 0, fmt.Errorf("%s %s is out of range, the maximum is %d", what, s, maxQuantity)
+	}
+	return n.Int64(), nil
+}
+
+// isIntegerLiteral reports whether a JSON value is an integer number
+// literal, which may be too large for int64.
+func isIntegerLiteral(s string) bool {
+	digits := strings.TrimPrefix(s, "-")
+	return digits != "" && strings.Trim(digits, "0123456789") == ""
+}
+
+// addBlocks adds block counts, saturating at maxQuantity instead of wrapping.
+func addBlocks(a, b int64) int64 {
+	if b > 0 && a > maxQuantity-b {
+		return maxQuantity
+	}
+	return a + b
+}
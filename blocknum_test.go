@@ -0,0 +1,68 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseQuantity(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		parse func(what, s string) (int64, error)
+		in    string
+		want  int64
+		err   string
+	}{
+		{"hex", parseHexQuantity, "0x1b4", 436, ""},
+		{"hex upper prefix", parseHexQuantity, "0X1B4", 436, ""},
+		{"hex zero", parseHexQuantity, "0x0", 0, ""},
+		{"hex max", parseHexQuantity, "0x7fffffffffffffff", math.MaxInt64, ""},
+		{"hex above int64", parseHexQuantity, "0x8000000000000000", 0, "out of range"},
+		{"hex above uint64", parseHexQuantity, "0x1ffffffffffffffff", 0, "out of range"},
+		{"hex without prefix", parseHexQuantity, "1b4", 0, "0x-prefixed"},
+		{"hex empty digits", parseHexQuantity, "0x", 0, "invalid"},
+		{"hex empty", parseHexQuantity, "", 0, "0x-prefixed"},
+		{"hex negative", parseHexQuantity, "-0x1", 0, "0x-prefixed"},
+		{"hex bad digit", parseHexQuantity, "0x1g", 0, "invalid"},
+		{"decimal", parseDecimalQuantity, "21000000", 21000000, ""},
+		{"decimal max", parseDecimalQuantity, "9223372036854775807", math.MaxInt64, ""},
+		{"decimal above int64", parseDecimalQuantity, "9223372036854775808", 0, "out of range"},
+		{"decimal negative", parseDecimalQuantity, "-5", 0, "negative"},
+		{"decimal empty", parseDecimalQuantity, "", 0, "invalid"},
+		{"decimal minus only", parseDecimalQuantity, "-", 0, "invalid"},
+		{"decimal fraction", parseDecimalQuantity, "1.5", 0, "invalid"},
+		{"decimal hex", parseDecimalQuantity, "0x10", 0, "invalid"},
+		{"either hex", parseQuantity, "0x10", 16, ""},
+		{"either decimal", parseQuantity, "10", 10, ""},
+		{"either empty", parseQuantity, "", 0, "invalid"},
+	} {
+		got, err := tc.parse("block", tc.in)
+		switch {
+		case tc.err == "" && err != nil:
+			t.Errorf("%s: parse(%q) failed: %v", tc.name, tc.in, err)
+		case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+			t.Errorf("%s: parse(%q) error = %v, want one containing %q", tc.name, tc.in, err, tc.err)
+		case got != tc.want:
+			t.Errorf("%s: parse(%q) = %d, want %d", tc.name, tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestAddBlocks(t *testing.T) {
+	for _, tc := range []struct {
+		a, b, want int64
+	}{
+		{1, 2, 3},
+		{0, 0, 0},
+		{5, -3, 2},
+		{math.MaxInt64 - 1, 1, math.MaxInt64},
+		{math.MaxInt64, 1, math.MaxInt64},
+		{math.MaxInt64 - 10, math.MaxInt64, math.MaxInt64},
+		{math.MaxInt64, -1, math.MaxInt64 - 1},
+	} {
+		if got := addBlocks(tc.a, tc.b); got != tc.want {
+			t.Errorf("addBlocks(%d, %d) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
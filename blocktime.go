@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	DefaultBlockTimeSampleInterval = 10 * time.Minute
+	// blockTimeWindow is the number of blocks the average block time is
+	// measured over.
+	blockTimeWindow = 1000
+)
+
+// sampleBlockTimes measures the average block time of each chain over its
+// last blockTimeWindow blocks from the block timestamps, once per
+// blockTimeSampleInterval. Chains keep their previous measurement when
+// sampling fails.
+func sampleBlockTimes(cycleID string, chains map[string]*ChainInfo) {
+	for name, info := range chains {
+		if info.LatestBlock <= 1 || time.Since(info.BlockTimeSampledAt) < info.BlockTimeSampleInterval.Duration {
+			continue
+		}
+		info.BlockTimeSampledAt = time.Now()
+		head := info.LatestBlock
+		from := max(head-blockTimeWindow, 1)
+		headTime, err := getBlockTimestamp(info.RpcURL, head, cycleID)
+		if err != nil {
+			log.Printf("[%s] Chain %s block time sampling failed: %v", cycleID, name, err)
+			continue
+		}
+		fromTime, err := getBlockTimestamp(info.RpcURL, from, cycleID)
+		if err != nil {
+			log.Printf("[%s] Chain %s block time sampling failed: %v", cycleID, name, err)
+			continue
+		}
+		if !headTime.After(fromTime) {
+			log.Printf("[%s] Chain %s block time sampling failed: block %d is not newer than block %d", cycleID, name, head, from)
+			continue
+		}
+		info.BlockTime = headTime.Sub(fromTime) / time.Duration(head-from)
+		log.Printf("[%s] Chain %s block time: %s over %d blocks", cycleID, name, info.BlockTime.Round(time.Millisecond), head-from)
+	}
+}
+
+func getBlockTimestamp(rpcURL string, block int64, requestID string) (time.Time, error) {
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_getBlockByNumber",
+		"params":  []interface{}{fmt.Sprintf("0x%x", block), false},
+		"id":      1,
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	resp, err := post(rpcURL, "application/json", reqBody, requestID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Result *struct {
+			Timestamp string `json:"timestamp"`
+		} `json:"result"`
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	body, err := readBody(resp)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("read response failed: %v", err)
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return time.Time{}, err
+	}
+	if result.Error.Message != "" {
+		return time.Time{}, fmt.Errorf("RPC error: %s", result.Error.Message)
+	}
+	if result.Result == nil {
+		return time.Time{}, fmt.Errorf("block %d not found", block)
+	}
+
+	ts, err := parseHexQuantity("timestamp", result.Result.Timestamp)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(ts, 0), nil
+}
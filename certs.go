@@ -0,0 +1,240 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultCertWarnBefore = 14 * 24 * time.Hour
+	// certForgetAfter drops hosts no longer connected to, e.g. after a
+	// config reload removed them.
+	certForgetAfter = 24 * time.Hour
+)
+
+// TransitionCertExpiry marks transitions of an HTTPS endpoint's certificate
+// entering the warning window (To WARN), expiring (To CRIT) or being renewed
+// (To OK). They carry the host in Endpoint and no subgraph.
+const TransitionCertExpiry = "cert_expiry"
+
+// CertificatesConfig warns about endpoint certificates that expire within
+// WarnBefore; zero only reports expired ones.
+type CertificatesConfig struct {
+	WarnBefore Duration `json:"warnBefore"`
+}
+
+func (c *CertificatesConfig) validate() error {
+	if c.WarnBefore.Duration < 0 {
+		return fmt.Errorf("certificates.warnBefore must not be negative")
+	}
+	return nil
+}
+
+// CertInfo is the certificate expiring first in the chain an HTTPS host last
+// presented.
+type CertInfo struct {
+	Host      string    `json:"host"`
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	NotAfter  time.Time `json:"notAfter"`
+	ExpiresIn float64   `json:"expiresInSeconds"`
+	Status    Status    `json:"status"`
+	SeenAt    time.Time `json:"seenAt"`
+}
+
+// certificates holds the last certificate per host. Like rateLimits, it
+// outlives transport replacements on config reloads.
+var certificates = struct {
+	mu    sync.Mutex
+	hosts map[string]CertInfo
+}{hosts: make(map[string]CertInfo)}
+
+// certTransport records the certificates of the HTTPS endpoints it talks
+// to, including ones rejected for having expired.
+type certTransport struct {
+	base http.RoundTripper
+}
+
+func (t *certTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && resp.TLS != nil {
+		recordCertificate(req.URL.Host, resp.TLS.PeerCertificates)
+	}
+	var invalid x509.CertificateInvalidError
+	if errors.As(err, &invalid) && invalid.Reason == x509.Expired {
+		recordCertificate(req.URL.Host, []*x509.Certificate{invalid.Cert})
+	}
+	return resp, err
+}
+
+func (t *certTransport) CloseIdleConnections() {
+	if c, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+func recordCertificate(host string, chain []*x509.Certificate) {
+	var first *x509.Certificate
+	for _, c := range chain {
+		if c != nil && (first == nil || c.NotAfter.Before(first.NotAfter)) {
+			first = c
+		}
+	}
+	if first == nil {
+		return
+	}
+	certificates.mu.Lock()
+	certificates.hosts[host] = CertInfo{
+		Host:     host,
+		Subject:  first.Subject.String(),
+		Issuer:   first.Issuer.String(),
+		NotAfter: first.NotAfter,
+		SeenAt:   time.Now(),
+	}
+	certificates.mu.Unlock()
+}
+
+// certificateInfos returns the certificates seen within certForgetAfter,
+// soonest expiry first, classified against warnBefore.
+func certificateInfos(warnBefore time.Duration, now time.Time) []CertInfo {
+	certificates.mu.Lock()
+	out := make([]CertInfo, 0, len(certificates.hosts))
+	for host, c := range certificates.hosts {
+		if now.Sub(c.SeenAt) > certForgetAfter {
+			delete(certificates.hosts, host)
+			continue
+		}
+		c.ExpiresIn = c.NotAfter.Sub(now).Seconds()
+		c.Status = certStatus(c.NotAfter, warnBefore, now)
+		out = append(out, c)
+	}
+	certificates.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].NotAfter.Equal(out[j].NotAfter) {
+			return out[i].NotAfter.Before(out[j].NotAfter)
+		}
+		return out[i].Host < out[j].Host
+	})
+	return out
+}
+
+func certStatus(notAfter time.Time, warnBefore time.Duration, now time.Time) Status {
+	switch {
+	case !now.Before(notAfter):
+		return StatusCrit
+	case warnBefore > 0 && notAfter.Sub(now) <= warnBefore:
+		return StatusWarn
+	}
+	return StatusOK
+}
+
+// checkCertificates returns a transition for each host whose certificate
+// status changed since the previous cycle. Hosts first seen with a valid
+// certificate are not reported. Must be called with mu held.
+func (m *Monitor) checkCertificates(cycleID string, now time.Time) []StateTransition {
+	var transitions []StateTransition
+	seen := make(map[string]Status)
+	for _, c := range certificateInfos(m.cfg.Certificates.WarnBefore.Duration, now) {
+		seen[c.Host] = c.Status
+		prev, ok := m.certStatuses[c.Host]
+		if prev == c.Status || !ok && c.Status == StatusOK || !m.shard.reportsCertificate(m.cfg, c.Host) {
+			continue
+		}
+		transitions = append(transitions, StateTransition{
+			Kind:     TransitionCertExpiry,
+			Time:     now,
+			CycleID:  cycleID,
+			CheckID:  cycleID,
+			Endpoint: c.Host,
+			From:     prev,
+			To:       c.Status,
+			Trigger:  certTrigger(c),
+			Context:  SubgraphStatus{Status: c.Status, CheckedAt: now},
+		})
+	}
+	m.certStatuses = seen
+	return transitions
+}
+
+func certTrigger(c CertInfo) string {
+	if c.Status == StatusCrit {
+		return fmt.Sprintf("certificate %s expired %s", c.Subject, c.NotAfter.UTC().Format(time.RFC3339))
+	}
+	return fmt.Sprintf("certificate %s expires %s", c.Subject, c.NotAfter.UTC().Format(time.RFC3339))
+}
+
+func formatCertExpiry(prefix string, t StateTransition) string {
+	switch t.To {
+	case StatusCrit:
+		return fmt.Sprintf("%sCertificate of %s has expired: %s (cycle %s)", prefix, t.Endpoint, t.Trigger, t.CycleID)
+	case StatusWarn:
+		return fmt.Sprintf("%sCertificate of %s expires soon: %s (cycle %s)", prefix, t.Endpoint, t.Trigger, t.CycleID)
+	}
+	return fmt.Sprintf("%sCertificate of %s was renewed: %s (cycle %s)", prefix, t.Endpoint, t.Trigger, t.CycleID)
+}
+
+// formatExpiringCertificates lists the certificates that need attention for
+// the line below the fleet summary, or returns "" when there are none.
+func formatExpiringCertificates(certs []CertInfo) string {
+	var parts []string
+	for _, c := range certs {
+		switch c.Status {
+		case StatusCrit:
+			parts = append(parts, c.Host+" expired")
+		case StatusWarn:
+			parts = append(parts, c.Host+" expires in "+formatETADuration(time.Duration(c.ExpiresIn*float64(time.Second))))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// tenantHosts returns the hosts of the tenant's subgraph endpoints and
+// notifiers, the certificates a tenant may see. Must be called with mu held.
+func (m *Monitor) tenantHosts() map[string]map[string]bool {
+	hosts := make(map[string]map[string]bool)
+	add := func(tenant string, urls ...string) {
+		for _, raw := range urls {
+			u, err := url.Parse(raw)
+			if err != nil || u.Host == "" {
+				continue
+			}
+			if hosts[tenant] == nil {
+				hosts[tenant] = make(map[string]bool)
+			}
+			hosts[tenant][u.Host] = true
+		}
+	}
+	for _, sg := range m.subgraphs {
+		if sg.Tenant != "" {
+			add(sg.Tenant, sg.endpointURLs()...)
+		}
+	}
+	for name, t := range m.cfg.Tenants {
+		for _, n := range t.Notifiers {
+			add(name, n.URL)
+		}
+	}
+	return hosts
+}
+
+func (m *Monitor) handleCertificates(w http.ResponseWriter, r *http.Request) {
+	snap := m.Snapshot()
+	certs := certificateInfos(snap.Config.Certificates.WarnBefore.Duration, time.Now())
+	if view := viewTenant(r); view != "" {
+		visible := []CertInfo{}
+		for _, c := range certs {
+			if snap.TenantHosts[view][c.Host] {
+				visible = append(visible, c)
+			}
+		}
+		certs = visible
+	}
+	writeJSON(w, http.StatusOK, certs)
+}
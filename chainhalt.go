@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// TransitionChainHalt marks transitions that report a chain halting (To
+// CRIT) or producing blocks again (To OK). They carry no subgraph.
+const TransitionChainHalt = "chain_halt"
+
+// checkChainHalts reads the timestamp of each chain's latest block and marks
+// chains whose latest block is older than haltAfter as halted. A halted
+// chain makes every subgraph on it look in sync, so this is tracked
+// separately from the RPC being unreachable: chains without a fresh head
+// keep their state. Safe and finalized heads trail the latest block by
+// design, so under those policies the latest block is read separately.
+func checkChainHalts(cycleID string, chains map[string]*ChainInfo) {
+	for name, info := range chains {
+		if info.HaltAfter.Duration <= 0 || info.LatestBlock == 0 || info.HeadSource == HeadSourceStale {
+			continue
+		}
+		head := info.LatestBlock
+		if info.HeadPolicy != HeadPolicyLatest {
+			if info.pushedHeadFresh() {
+				head = info.PushedBlock
+			} else {
+				var err error
+				if head, err = getLatestBlockFromChain(info.RpcURL, cycleID); err != nil {
+					log.Printf("[%s] Chain %s latest block error: %v", cycleID, name, err)
+					continue
+				}
+			}
+		}
+		headTime, err := getBlockTimestamp(info.RpcURL, head, cycleID)
+		if err != nil {
+			log.Printf("[%s] Chain %s head timestamp error: %v", cycleID, name, err)
+			continue
+		}
+		info.HeadTime = headTime
+		info.HaltBlock = head
+		info.Halted = time.Since(headTime) > info.HaltAfter.Duration
+	}
+}
+
+func chainHeadAge(info *ChainInfo) time.Duration {
+	if info.HeadTime.IsZero() {
+		return 0
+	}
+	return time.Since(info.HeadTime)
+}
+
+func newChainHaltTransition(cycleID string, info *ChainInfo, now time.Time) StateTransition {
+	from, to := StatusOK, StatusCrit
+	if !info.Halted {
+		from, to = StatusCrit, StatusOK
+	}
+	return StateTransition{
+		Kind:    TransitionChainHalt,
+		Time:    now,
+		CycleID: cycleID,
+		CheckID: cycleID,
+		Chain:   info.Name,
+		From:    from,
+		To:      to,
+		Trigger: chainHaltTrigger(info),
+		Context: SubgraphStatus{
+			Chain:        info.Name,
+			Status:       to,
+			ChainBlock:   info.HaltBlock,
+			ChainHalted:  info.Halted,
+			ChainHeadAge: chainHeadAge(info).Seconds(),
+			CheckedAt:    now,
+		},
+	}
+}
+
+func chainHaltTrigger(info *ChainInfo) string {
+	op := "<="
+	if info.Halted {
+		op = ">"
+	}
+	return fmt.Sprintf("head age %s %s haltAfter %s", chainHeadAge(info).Round(time.Second), op, info.HaltAfter.Duration)
+}
+
+func formatChainHalt(prefix string, t StateTransition) string {
+	age := time.Duration(t.Context.ChainHeadAge * float64(time.Second)).Round(time.Second)
+	if t.Context.ChainHalted {
+		return fmt.Sprintf("%sChain %s halted: head block %d is %s old (cycle %s)", prefix, t.Chain, t.Context.ChainBlock, age, t.CycleID)
+	}
+	return fmt.Sprintf("%sChain %s is producing blocks again: head block %d is %s old (cycle %s)", prefix, t.Chain, t.Context.ChainBlock, age, t.CycleID)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// commands are the subcommands accepted as the first argument. Without one
+// the monitor runs.
+var commands = map[string]func(args []string) error{
+	"reset-history": runResetHistory,
+	"predict":       runPredict,
+	"resync-cost":   runResyncCost,
+	"report":        runReport,
+	"heatmap":       runHeatmap,
+	"events":        runEvents,
+	"audit":         runAudit,
+	"debug":         runDebug,
+	"wait":          runWait,
+	"export":        runExport,
+	"export-state":  runExportState,
+	"import-state":  runImportState,
+	"notify-test":   runNotifyTest,
+	"simulate":      runSimulate,
+	"init":          runInit,
+	"list":          runList,
+	"config":        runConfig,
+	"completion":    runCompletion,
+	"version":       runVersion,
+}
+
+// runResetHistory implements "reset-history": it asks a running monitor to
+// discard the speed/ETA samples of a subgraph.
+func runResetHistory(args []string) error {
+	fs := flag.NewFlagSet("reset-history", flag.ExitOnError)
+	server := fs.String("server", "http://127.0.0.1:8080", "base URL of the monitor's HTTP API")
+	token := fs.String("token", os.Getenv("SUBGRAPH_MONITOR_TOKEN"), "bearer token (default $SUBGRAPH_MONITOR_TOKEN)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s reset-history [flags] <subgraph>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	u := strings.TrimSuffix(*server, "/") + "/api/v1/subgraphs/" + url.PathEscape(fs.Arg(0)) + "/history/reset"
+	req, err := http.NewRequest(http.MethodPost, u, nil)
+	if err != nil {
+		return err
+	}
+	if *token != "" {
+		req.Header.Set("Authorization", "Bearer "+*token)
+	}
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	fmt.Printf("Sync history of %s reset\n", fs.Arg(0))
+	return nil
+}
+
+// runPredict implements "predict": it asks a running monitor when a
+// subgraph will reach a block.
+func runPredict(args []string) error {
+	fs := flag.NewFlagSet("predict", flag.ExitOnError)
+	server := fs.String("server", "http://127.0.0.1:8080", "base URL of the monitor's HTTP API")
+	token := fs.String("token", os.Getenv("SUBGRAPH_MONITOR_TOKEN"), "bearer token (default $SUBGRAPH_MONITOR_TOKEN)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s predict [flags] <subgraph> <block>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	u := strings.TrimSuffix(*server, "/") + "/api/v1/subgraphs/" + url.PathEscape(fs.Arg(0)) + "/predict?block=" + url.QueryEscape(fs.Arg(1))
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	if *token != "" {
+		req.Header.Set("Authorization", "Bearer "+*token)
+	}
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var p Prediction
+	if err := json.Unmarshal(body, &p); err != nil {
+		return fmt.Errorf("JSON error: %v", err)
+	}
+
+	if p.Reached {
+		fmt.Printf("%s has already indexed block %d (current block %d)\n", p.Subgraph, p.TargetBlock, p.CurrentBlock)
+		return nil
+	}
+	fmt.Printf("%s will reach block %d at %s (in %s, limited by %s)\n",
+		p.Subgraph, p.TargetBlock, p.PredictedAt.Local().Format("2006-01-02 15:04:05 MST"),
+		(time.Duration(p.ETASeconds) * time.Second).String(), p.LimitedBy)
+	fmt.Printf("current block %d, chain head %d, indexing %.2f blocks/min, chain %.2f blocks/min\n",
+		p.CurrentBlock, p.ChainBlock, p.SyncSpeed, p.ChainSpeed)
+	return nil
+}
+
+// runResyncCost implements "resync-cost": it asks a running monitor how long
+// indexing a subgraph from scratch, or from a graft block, would take.
+func runResyncCost(args []string) error {
+	fs := flag.NewFlagSet("resync-cost", flag.ExitOnError)
+	server := fs.String("server", "http://127.0.0.1:8080", "base URL of the monitor's HTTP API")
+	token := fs.String("token", os.Getenv("SUBGRAPH_MONITOR_TOKEN"), "bearer token (default $SUBGRAPH_MONITOR_TOKEN)")
+	from := fs.Int64("from", -1, "block to re-sync from, e.g. a graft block (default: the subgraph's startBlock)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s resync-cost [flags] <subgraph>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	u := strings.TrimSuffix(*server, "/") + "/api/v1/subgraphs/" + url.PathEscape(fs.Arg(0)) + "/resync-estimate"
+	if *from >= 0 {
+		u += "?from=" + strconv.FormatInt(*from, 10)
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	if *token != "" {
+		req.Header.Set("Authorization", "Bearer "+*token)
+	}
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var e ResyncEstimate
+	if err := json.Unmarshal(body, &e); err != nil {
+		return fmt.Errorf("JSON error: %v", err)
+	}
+
+	fmt.Printf("Re-syncing %s from block %d: %d blocks to chain head %d\n", e.Subgraph, e.FromBlock, e.Blocks, e.ChainBlock)
+	if e.Unknown != "" {
+		fmt.Printf("Estimated duration: unknown, %s\n", e.Unknown)
+	} else {
+		fmt.Printf("Estimated duration: %s\n", (time.Duration(e.DurationSeconds) * time.Second).String())
+	}
+	fmt.Printf("Based on %d checks between %s and %s (%s): indexing %.2f blocks/min, chain %.2f blocks/min\n",
+		e.Samples, e.WindowFrom.Local().Format("2006-01-02 15:04"), e.WindowTo.Local().Format("2006-01-02 15:04"),
+		e.Basis, e.SyncSpeed, e.ChainSpeed)
+	if e.Basis == "in-sync" {
+		fmt.Println("The subgraph was never behind in this window, so its real indexing speed is unknown and this is an upper bound.")
+	}
+	return nil
+}
+
+// runNotifyTest implements "notify-test": it sends a synthetic transition
+// through every configured notifier and reports which deliveries failed.
+func runNotifyTest(args []string) error {
+	fs := flag.NewFlagSet("notify-test", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	kubeConfigMap := fs.String("k8s-configmap", "", "load config from a ConfigMap ([namespace/]name)")
+	kubeSecret := fs.String("k8s-secret", "", "load config from a Secret ([namespace/]name)")
+	kubeKey := fs.String("k8s-key", defaultKubeDataKey, "ConfigMap/Secret data key holding the config")
+	only := fs.String("notifier", "", "only test the notifier with this name (<tenant>/<name> for tenant notifiers)")
+	fs.Parse(args)
+
+	cfg, _, err := loadConfig(*configPath, *kubeConfigMap, *kubeSecret, *kubeKey)
+	if err != nil {
+		return err
+	}
+	applyHTTPConfig(cfg)
+
+	// Tenant notifiers are named <tenant>/<name>.
+	type namedNotifier struct {
+		name string
+		n    *NotifierConfig
+	}
+	var notifiers []namedNotifier
+	for i := range cfg.Notifiers {
+		notifiers = append(notifiers, namedNotifier{cfg.Notifiers[i].Name, &cfg.Notifiers[i]})
+	}
+	for _, tenant := range cfg.tenantNames() {
+		tn := cfg.Tenants[tenant].Notifiers
+		for i := range tn {
+			notifiers = append(notifiers, namedNotifier{tenant + "/" + tn[i].Name, &tn[i]})
+		}
+	}
+
+	t := newTestTransition()
+	tested, failed := 0, 0
+	for _, nn := range notifiers {
+		if *only != "" && nn.name != *only {
+			continue
+		}
+		tested++
+		if err := nn.n.Notify(t); err != nil {
+			failed++
+			fmt.Printf("FAIL %-20s %-8s %v\n", nn.name, nn.n.Type, err)
+			continue
+		}
+		fmt.Printf("OK   %-20s %s\n", nn.name, nn.n.Type)
+	}
+	switch {
+	case tested == 0 && *only != "":
+		return fmt.Errorf("no notifier named %q", *only)
+	case tested == 0:
+		return fmt.Errorf("no notifiers configured")
+	case failed > 0:
+		return fmt.Errorf("%d of %d notifiers failed", failed, tested)
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+// Package client is a typed Go client for the subgraph-monitor HTTP API,
+// described by the openapi.json document the monitor serves at
+// /api/v1/openapi.json.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls a monitor's API. Set Token for bearer authentication,
+// Username/Password for basic authentication or Secret to sign requests
+// with a server.auth.webhooks secret. Tenant narrows the view of
+// admin credentials to one tenant; tenant credentials are always limited to
+// their own.
+type Client struct {
+	BaseURL    string
+	Token      string
+	Username   string
+	Password   string
+	Secret     string
+	Tenant     string
+	HTTPClient *http.Client
+}
+
+// New returns a client for the monitor at baseURL, e.g.
+// "http://127.0.0.1:8080" (including server.basePath if one is set).
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), HTTPClient: http.DefaultClient}
+}
+
+// APIError is returned for non-2xx responses.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+// Status returns every subgraph's status. sortBy may be "" (config order) or
+// "health" (least healthy first).
+func (c *Client) Status(ctx context.Context, sortBy string) ([]SubgraphStatus, error) {
+	q := url.Values{}
+	if sortBy != "" {
+		q.Set("sort", sortBy)
+	}
+	var out []SubgraphStatus
+	return out, c.do(ctx, http.MethodGet, "/api/v1/status", q, nil, &out)
+}
+
+// Transitions returns the logged transitions since a duration ("24h", "7d")
+// or time, oldest first. subgraph, chain and kind may be "" for all.
+func (c *Client) Transitions(ctx context.Context, since, subgraph, chain, kind string) ([]StateTransition, error) {
+	q := url.Values{}
+	for k, v := range map[string]string{"since": since, "subgraph": subgraph, "chain": chain, "kind": kind} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	var out []StateTransition
+	return out, c.do(ctx, http.MethodGet, "/api/v1/transitions", q, nil, &out)
+}
+
+// Audit returns the audit log since a duration ("24h", "7d") or time,
+// oldest first. actor, action and target may be "" for all.
+func (c *Client) Audit(ctx context.Context, since, actor, action, target string) ([]AuditEntry, error) {
+	q := url.Values{}
+	for k, v := range map[string]string{"since": since, "actor": actor, "action": action, "target": target} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	var out []AuditEntry
+	return out, c.do(ctx, http.MethodGet, "/api/v1/audit", q, nil, &out)
+}
+
+func (c *Client) Changes(ctx context.Context) (*CycleChanges, error) {
+	var out CycleChanges
+	return &out, c.do(ctx, http.MethodGet, "/api/v1/changes", nil, nil, &out)
+}
+
+func (c *Client) Firehose(ctx context.Context) ([]FirehoseStatus, error) {
+	var out []FirehoseStatus
+	return out, c.do(ctx, http.MethodGet, "/api/v1/firehose", nil, nil, &out)
+}
+
+// Summary returns the fleet summary: subgraph counts by status and the
+// worst subgraph, also as a one-line Text for chat-ops.
+func (c *Client) Summary(ctx context.Context) (*FleetSummary, error) {
+	var out FleetSummary
+	return &out, c.do(ctx, http.MethodGet, "/api/v1/summary", nil, nil, &out)
+}
+
+// Chains returns a rollup of the subgraphs on each chain.
+func (c *Client) Chains(ctx context.Context) ([]ChainSummary, error) {
+	var out []ChainSummary
+	return out, c.do(ctx, http.MethodGet, "/api/v1/chains", nil, nil, &out)
+}
+
+// Nodes returns the load of each index node and suggested deployment
+// reassignments.
+func (c *Client) Nodes(ctx context.Context) (*ClusterLoad, error) {
+	var out ClusterLoad
+	return &out, c.do(ctx, http.MethodGet, "/api/v1/nodes", nil, nil, &out)
+}
+
+// Certificates returns the certificates of the HTTPS endpoints the monitor
+// connects to, soonest expiry first.
+func (c *Client) Certificates(ctx context.Context) ([]CertInfo, error) {
+	var out []CertInfo
+	return out, c.do(ctx, http.MethodGet, "/api/v1/certificates", nil, nil, &out)
+}
+
+// Warnings returns the config warnings: chains without subgraphs and
+// subgraphs on chains that are not configured.
+func (c *Client) Warnings(ctx context.Context) ([]ConfigWarning, error) {
+	var out []ConfigWarning
+	return out, c.do(ctx, http.MethodGet, "/api/v1/warnings", nil, nil, &out)
+}
+
+// PushChainHead reports the latest block of chain. It needs the heads or
+// write scope.
+func (c *Client) PushChainHead(ctx context.Context, chain string, block int64) error {
+	body := map[string]int64{"block": block}
+	return c.do(ctx, http.MethodPost, "/api/v1/chains/"+url.PathEscape(chain)+"/head", nil, body, nil)
+}
+
+// AddSubgraph starts monitoring sg and returns it with defaults applied.
+func (c *Client) AddSubgraph(ctx context.Context, sg SubgraphConfig) (*SubgraphConfig, error) {
+	var out SubgraphConfig
+	return &out, c.do(ctx, http.MethodPost, "/api/v1/subgraphs", nil, sg, &out)
+}
+
+func (c *Client) RemoveSubgraph(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/api/v1/subgraphs/"+url.PathEscape(name), nil, nil, nil)
+}
+
+// History returns the subgraph's time series between from and to, in
+// step-wide buckets. Zero values use the server defaults.
+func (c *Client) History(ctx context.Context, name string, from, to time.Time, step time.Duration) (*History, error) {
+	q := url.Values{}
+	if !from.IsZero() {
+		q.Set("from", from.Format(time.RFC3339))
+	}
+	if !to.IsZero() {
+		q.Set("to", to.Format(time.RFC3339))
+	}
+	if step > 0 {
+		q.Set("step", step.String())
+	}
+	var out History
+	return &out, c.do(ctx, http.MethodGet, "/api/v1/subgraphs/"+url.PathEscape(name)+"/history", q, nil, &out)
+}
+
+func (c *Client) ResetHistory(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodPost, "/api/v1/subgraphs/"+url.PathEscape(name)+"/history/reset", nil, nil, nil)
+}
+
+// Predict returns when the subgraph is expected to index block.
+func (c *Client) Predict(ctx context.Context, name string, block int64) (*Prediction, error) {
+	q := url.Values{"block": {strconv.FormatInt(block, 10)}}
+	var out Prediction
+	return &out, c.do(ctx, http.MethodGet, "/api/v1/subgraphs/"+url.PathEscape(name)+"/predict", q, nil, &out)
+}
+
+// ResyncEstimate estimates a re-sync from fromBlock, or from the subgraph's
+// startBlock when fromBlock is negative.
+func (c *Client) ResyncEstimate(ctx context.Context, name string, fromBlock int64) (*ResyncEstimate, error) {
+	q := url.Values{}
+	if fromBlock >= 0 {
+		q.Set("from", strconv.FormatInt(fromBlock, 10))
+	}
+	var out ResyncEstimate
+	return &out, c.do(ctx, http.MethodGet, "/api/v1/subgraphs/"+url.PathEscape(name)+"/resync-estimate", q, nil, &out)
+}
+
+func (c *Client) Silences(ctx context.Context) ([]Silence, error) {
+	var out []Silence
+	return out, c.do(ctx, http.MethodGet, "/api/v1/silences", nil, nil, &out)
+}
+
+func (c *Client) CreateSilence(ctx context.Context, subgraph string, d time.Duration, reason string) (*Silence, error) {
+	body := map[string]string{"subgraph": subgraph, "duration": d.String(), "reason": reason}
+	var out Silence
+	return &out, c.do(ctx, http.MethodPost, "/api/v1/silences", nil, body, &out)
+}
+
+func (c *Client) DeleteSilence(ctx context.Context, subgraph string) error {
+	return c.do(ctx, http.MethodDelete, "/api/v1/silences/"+url.PathEscape(subgraph), nil, nil, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	u := c.BaseURL + path
+	if c.Tenant != "" {
+		if query == nil {
+			query = url.Values{}
+		}
+		query.Set("tenant", c.Tenant)
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var data []byte
+	var body io.Reader
+	if in != nil {
+		var err error
+		if data, err = json.Marshal(in); err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	switch {
+	case c.Token != "":
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	case c.Username != "":
+		req.SetBasicAuth(c.Username, c.Password)
+	case c.Secret != "":
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(c.Secret))
+		mac.Write([]byte(timestamp + "." + method + "." + req.URL.RequestURI() + "."))
+		mac.Write(data)
+		req.Header.Set("X-Subgraph-Monitor-Timestamp", timestamp)
+		req.Header.Set("X-Subgraph-Monitor-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		var e struct {
+			Error string `json:"error"`
+		}
+		msg := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &e) == nil && e.Error != "" {
+			msg = e.Error
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: msg}
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
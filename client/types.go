@@ -0,0 +1,340 @@
+package client
+
+import "time"
+
+// Types mirror the schemas of the monitor's openapi.json.
+
+type Status string
+
+const (
+	StatusUnknown     Status = ""
+	StatusOK          Status = "OK"
+	StatusWarn        Status = "WARN"
+	StatusCrit        Status = "CRIT"
+	StatusError       Status = "ERROR"
+	StatusFailed      Status = "FAILED"
+	StatusRateLimited Status = "RATE_LIMITED"
+)
+
+type GraftInfo struct {
+	Base          string `json:"base"`
+	Block         int64  `json:"block"`
+	BaseAvailable bool   `json:"baseAvailable"`
+}
+
+type ReindexInfo struct {
+	FromBlock      int64     `json:"fromBlock"`
+	HighWaterBlock int64     `json:"highWaterBlock"`
+	DetectedAt     time.Time `json:"detectedAt"`
+	Progress       float64   `json:"progress"`
+	ETASeconds     float64   `json:"etaSeconds"`
+}
+
+type BlockRange struct {
+	From   int64   `json:"from"`
+	To     int64   `json:"to"`
+	Weight float64 `json:"weight"`
+}
+
+type NetworkProgress struct {
+	Network      string `json:"network"`
+	ChainHead    int64  `json:"chainHead"`
+	LatestBlock  int64  `json:"latestBlock"`
+	BlocksBehind int64  `json:"blocksBehind"`
+}
+
+type ReplicaStatus struct {
+	URL        string    `json:"url"`
+	Active     bool      `json:"active"`
+	Healthy    bool      `json:"healthy"`
+	LatencyMs  float64   `json:"latencyMs"`
+	Block      int64     `json:"block,omitempty"`
+	Deployment string    `json:"deployment,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	CheckedAt  time.Time `json:"checkedAt"`
+}
+
+type RemediationInfo struct {
+	Count  int       `json:"count"`
+	LastAt time.Time `json:"lastAt"`
+	DryRun bool      `json:"dryRun,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+type SLOStatus struct {
+	Target             float64            `json:"target"`
+	BurnRates          map[string]float64 `json:"burnRates"`
+	BudgetRemaining    float64            `json:"budgetRemaining"`
+	ExhaustedInSeconds float64            `json:"exhaustedInSeconds,omitempty"`
+	Alert              string             `json:"alert,omitempty"`
+}
+
+type SubgraphStatus struct {
+	Name                 string            `json:"name"`
+	Chain                string            `json:"chain"`
+	Tenant               string            `json:"tenant,omitempty"`
+	URL                  string            `json:"url"`
+	Status               Status            `json:"status"`
+	ChainBlock           int64             `json:"chainBlock"`
+	ChainHeadSource      string            `json:"chainHeadSource,omitempty"`
+	ChainHeadPolicy      string            `json:"chainHeadPolicy,omitempty"`
+	StartBlock           int64             `json:"startBlock"`
+	CurrentBlock         int64             `json:"currentBlock"`
+	BlocksBehind         int64             `json:"blocksBehind"`
+	SyncSpeed            float64           `json:"syncSpeed"`
+	ChainSpeed           float64           `json:"chainSpeed"`
+	BlockTimeSeconds     float64           `json:"blockTimeSeconds,omitempty"`
+	TimeBehindSeconds    float64           `json:"timeBehindSeconds,omitempty"`
+	ChainHeadAgeSeconds  float64           `json:"chainHeadAgeSeconds,omitempty"`
+	ChainHalted          bool              `json:"chainHalted,omitempty"`
+	BlocksIndexed        int64             `json:"blocksIndexed"`
+	BlocksIndexedSeconds float64           `json:"blocksIndexedSeconds"`
+	BlocksIndexedTotal   int64             `json:"blocksIndexedTotal"`
+	ETASeconds           float64           `json:"etaSeconds"`
+	ETARanges            []BlockRange      `json:"etaRanges,omitempty"`
+	Progress             float64           `json:"progress"`
+	ProgressBaseline     string            `json:"progressBaseline,omitempty"`
+	Deployment           string            `json:"deployment,omitempty"`
+	Graft                *GraftInfo        `json:"graft,omitempty"`
+	Reindex              *ReindexInfo      `json:"reindex,omitempty"`
+	Node                 string            `json:"node,omitempty"`
+	NodeChainHead        int64             `json:"nodeChainHead,omitempty"`
+	Networks             []NetworkProgress `json:"networks,omitempty"`
+	NodeError            string            `json:"nodeError,omitempty"`
+	LagCause             string            `json:"lagCause,omitempty"`
+	HealthScore          float64           `json:"healthScore"`
+	SLO                  *SLOStatus        `json:"slo,omitempty"`
+	HasIndexingErrors    bool              `json:"hasIndexingErrors"`
+	QueryLatencyMs       float64           `json:"queryLatencyMs"`
+	ActiveURL            string            `json:"activeUrl,omitempty"`
+	Replicas             []ReplicaStatus   `json:"replicas,omitempty"`
+	ReplicaDivergence    string            `json:"replicaDivergence,omitempty"`
+	StalledSeconds       float64           `json:"stalledSeconds,omitempty"`
+	ExpectedSyncSpeed    float64           `json:"expectedSyncSpeed,omitempty"`
+	SlowSync             bool              `json:"slowSync,omitempty"`
+	Availability         *float64          `json:"availability,omitempty"`
+	AvailabilityChecks   int               `json:"availabilityChecks"`
+	AvailabilityStatus   Status            `json:"availabilityStatus,omitempty"`
+	InhibitedBy          string            `json:"inhibitedBy,omitempty"`
+	Remediation          *RemediationInfo  `json:"remediation,omitempty"`
+	ConsecutiveFailures  int               `json:"consecutiveFailures,omitempty"`
+	Unknown              []string          `json:"unknown,omitempty"`
+	Stale                bool              `json:"stale,omitempty"`
+	StaleSeconds         float64           `json:"staleSeconds,omitempty"`
+	Error                string            `json:"error,omitempty"`
+	ErrorKind            string            `json:"errorKind,omitempty"`
+	CheckedAt            time.Time         `json:"checkedAt"`
+	CheckID              string            `json:"checkId,omitempty"`
+}
+
+// StateTransition is a logged status change, burn rate alert (Kind
+// "burn_rate"), chain halt (Kind "chain_halt", no Subgraph), expiring
+// endpoint certificate (Kind "cert_expiry", no Subgraph or Chain), slow
+// catch-up alert (Kind "slow_sync"), endpoint availability change (Kind
+// "availability", From and To are the availability status) or upstream
+// outage (Kind "upstream", no Subgraph, Endpoint names the upstream).
+type StateTransition struct {
+	Kind     string         `json:"kind,omitempty"`
+	Time     time.Time      `json:"time"`
+	CycleID  string         `json:"cycleId"`
+	CheckID  string         `json:"checkId"`
+	Subgraph string         `json:"subgraph"`
+	Chain    string         `json:"chain"`
+	Endpoint string         `json:"endpoint,omitempty"`
+	From     Status         `json:"from"`
+	To       Status         `json:"to"`
+	Context  SubgraphStatus `json:"context"`
+	Trigger  string         `json:"trigger,omitempty"`
+	Silenced bool           `json:"silenced,omitempty"`
+	// Inhibited names the upstream whose outage the transition is part of.
+	Inhibited string `json:"inhibited,omitempty"`
+	Test      bool   `json:"test,omitempty"`
+}
+
+type AuditEntry struct {
+	Time       time.Time     `json:"time"`
+	Actor      string        `json:"actor"`
+	Method     string        `json:"method,omitempty"`
+	RemoteAddr string        `json:"remoteAddr,omitempty"`
+	Action     string        `json:"action"`
+	Target     string        `json:"target,omitempty"`
+	Tenant     string        `json:"tenant,omitempty"`
+	Diff       []AuditChange `json:"diff,omitempty"`
+}
+
+type AuditChange struct {
+	Path   string      `json:"path"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+type ConfigWarning struct {
+	Kind     string `json:"kind"`
+	Chain    string `json:"chain"`
+	Subgraph string `json:"subgraph,omitempty"`
+	Tenant   string `json:"tenant,omitempty"`
+	Message  string `json:"message"`
+}
+
+type CertInfo struct {
+	Host             string    `json:"host"`
+	Subject          string    `json:"subject"`
+	Issuer           string    `json:"issuer"`
+	NotAfter         time.Time `json:"notAfter"`
+	ExpiresInSeconds float64   `json:"expiresInSeconds"`
+	Status           Status    `json:"status"`
+	SeenAt           time.Time `json:"seenAt"`
+}
+
+type StatusChange struct {
+	Subgraph string         `json:"subgraph"`
+	Silenced bool           `json:"silenced"`
+	Before   SubgraphStatus `json:"before"`
+	After    SubgraphStatus `json:"after"`
+}
+
+type CycleChanges struct {
+	CycleID         string         `json:"cycleId,omitempty"`
+	CycleAt         time.Time      `json:"cycleAt"`
+	PreviousCycleAt time.Time      `json:"previousCycleAt"`
+	Changes         []StatusChange `json:"changes"`
+}
+
+type FleetSummary struct {
+	Subgraphs int            `json:"subgraphs"`
+	Counts    map[Status]int `json:"counts"`
+	Worst     *FleetWorst    `json:"worst,omitempty"`
+	Text      string         `json:"text"`
+}
+
+type FleetWorst struct {
+	Name         string  `json:"name"`
+	Chain        string  `json:"chain"`
+	Status       Status  `json:"status"`
+	BlocksBehind int64   `json:"blocksBehind"`
+	ETASeconds   float64 `json:"etaSeconds,omitempty"`
+}
+
+type ChainSummary struct {
+	Chain           string  `json:"chain"`
+	Subgraphs       int     `json:"subgraphs"`
+	Healthy         int     `json:"healthy"`
+	Behind          int     `json:"behind"`
+	Failed          int     `json:"failed"`
+	RateLimited     int     `json:"rateLimited"`
+	MaxBlocksBehind int64   `json:"maxBlocksBehind"`
+	MedianSyncSpeed float64 `json:"medianSyncSpeed"`
+	LagUnknown      int     `json:"lagUnknown,omitempty"`
+}
+
+type NodeLoad struct {
+	Node            string `json:"node"`
+	Deployments     int    `json:"deployments"`
+	Lagging         int    `json:"lagging"`
+	BlocksBehind    int64  `json:"blocksBehind"`
+	MaxBlocksBehind int64  `json:"maxBlocksBehind"`
+	Overloaded      bool   `json:"overloaded"`
+}
+
+type Reassignment struct {
+	Subgraph     string `json:"subgraph"`
+	Deployment   string `json:"deployment"`
+	From         string `json:"from"`
+	To           string `json:"to"`
+	BlocksBehind int64  `json:"blocksBehind"`
+}
+
+type ClusterLoad struct {
+	Nodes       []NodeLoad     `json:"nodes"`
+	Suggestions []Reassignment `json:"suggestions"`
+}
+
+type FirehoseStatus struct {
+	Name         string    `json:"name"`
+	Chain        string    `json:"chain"`
+	URL          string    `json:"url"`
+	Status       Status    `json:"status"`
+	Serving      string    `json:"serving"`
+	HeadBlock    int64     `json:"headBlock"`
+	ChainBlock   int64     `json:"chainBlock"`
+	BlocksBehind int64     `json:"blocksBehind"`
+	Error        string    `json:"error,omitempty"`
+	CheckedAt    time.Time `json:"checkedAt"`
+	CheckID      string    `json:"checkId,omitempty"`
+}
+
+// SubgraphConfig is the body of AddSubgraph. CheckInterval is a duration
+// string like "30s".
+type SubgraphConfig struct {
+	Name              string   `json:"name"`
+	URL               string   `json:"url"`
+	Chain             string   `json:"chain"`
+	StartBlock        int64    `json:"startBlock,omitempty"`
+	MaxHistoryEntries int      `json:"maxHistoryEntries,omitempty"`
+	Priority          string   `json:"priority,omitempty"`
+	CheckInterval     string   `json:"checkInterval,omitempty"`
+	IPFSURL           string   `json:"ipfsUrl,omitempty"`
+	IndexNodeURL      string   `json:"indexNodeUrl,omitempty"`
+	Tenant            string   `json:"tenant,omitempty"`
+	Replicas          []string `json:"replicas,omitempty"`
+	CompareInterval   string   `json:"compareInterval,omitempty"`
+	ProgressBaseline  string   `json:"progressBaseline,omitempty"`
+	WarnBlocksBehind  int64    `json:"warnBlocksBehind,omitempty"`
+	CritBlocksBehind  int64    `json:"critBlocksBehind,omitempty"`
+	ErrorTolerance    int      `json:"errorTolerance,omitempty"`
+}
+
+type HistoryPoint struct {
+	Time            time.Time `json:"time"`
+	Samples         int       `json:"samples"`
+	Errors          int       `json:"errors"`
+	CurrentBlock    int64     `json:"currentBlock"`
+	BlocksBehind    float64   `json:"blocksBehind"`
+	MaxBlocksBehind int64     `json:"maxBlocksBehind"`
+	SyncSpeed       float64   `json:"syncSpeed"`
+	BlocksIndexed   int64     `json:"blocksIndexed"`
+}
+
+type History struct {
+	Subgraph string         `json:"subgraph"`
+	From     time.Time      `json:"from"`
+	To       time.Time      `json:"to"`
+	Step     string         `json:"step"`
+	Points   []HistoryPoint `json:"points"`
+}
+
+type Prediction struct {
+	Subgraph     string     `json:"subgraph"`
+	TargetBlock  int64      `json:"targetBlock"`
+	CurrentBlock int64      `json:"currentBlock"`
+	ChainBlock   int64      `json:"chainBlock"`
+	SyncSpeed    float64    `json:"syncSpeed"`
+	ChainSpeed   float64    `json:"chainSpeed"`
+	Reached      bool       `json:"reached"`
+	PredictedAt  *time.Time `json:"predictedAt,omitempty"`
+	ETASeconds   float64    `json:"etaSeconds"`
+	LimitedBy    string     `json:"limitedBy,omitempty"`
+}
+
+type ResyncEstimate struct {
+	Subgraph        string    `json:"subgraph"`
+	FromBlock       int64     `json:"fromBlock"`
+	ChainBlock      int64     `json:"chainBlock"`
+	Blocks          int64     `json:"blocks"`
+	SyncSpeed       float64   `json:"syncSpeed"`
+	ChainSpeed      float64   `json:"chainSpeed"`
+	Basis           string    `json:"basis"`
+	Samples         int       `json:"samples"`
+	WindowFrom      time.Time `json:"windowFrom"`
+	WindowTo        time.Time `json:"windowTo"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	Unknown         string    `json:"unknown,omitempty"`
+}
+
+type Silence struct {
+	Subgraph  string    `json:"subgraph"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const DefaultReassignInterval = time.Hour
+
+// ClusterConfig covers the graph-node cluster behind the index node URLs.
+// AdminURL is graph-node's admin JSON-RPC endpoint (port 8020); with
+// AutoReassign set, the first reassignment suggestion is executed through
+// it every ReassignInterval.
+type ClusterConfig struct {
+	AdminURL         string   `json:"adminUrl"`
+	AutoReassign     bool     `json:"autoReassign"`
+	ReassignInterval Duration `json:"reassignInterval"`
+}
+
+func (c *ClusterConfig) validate() error {
+	if !c.AutoReassign {
+		return nil
+	}
+	if c.AdminURL == "" {
+		return fmt.Errorf("cluster.adminUrl is required for autoReassign")
+	}
+	if c.ReassignInterval.Duration < time.Minute {
+		return fmt.Errorf("cluster.reassignInterval must be at least 1m")
+	}
+	return nil
+}
+
+// NodeLoad aggregates the deployments assigned to one index node. Lagging
+// counts the deployments that are WARN or CRIT for reasons other than the
+// chain provider, which moving them to another node could help.
+type NodeLoad struct {
+	Node            string `json:"node"`
+	Deployments     int    `json:"deployments"`
+	Lagging         int    `json:"lagging"`
+	BlocksBehind    int64  `json:"blocksBehind"`
+	MaxBlocksBehind int64  `json:"maxBlocksBehind"`
+	Overloaded      bool   `json:"overloaded"`
+}
+
+type Reassignment struct {
+	Subgraph     string `json:"subgraph"`
+	Deployment   string `json:"deployment"`
+	From         string `json:"from"`
+	To           string `json:"to"`
+	BlocksBehind int64  `json:"blocksBehind"`
+}
+
+type ClusterLoad struct {
+	Nodes       []NodeLoad     `json:"nodes"`
+	Suggestions []Reassignment `json:"suggestions"`
+}
+
+// clusterLoad groups the deployments by index node and suggests moving the
+// most lagging deployment of each overloaded node, one where at least two
+// and at least half of the deployments lag, to the node with the fewest
+// deployments among those without lagging ones.
+func clusterLoad(statuses []SubgraphStatus) ClusterLoad {
+	byDeployment := make(map[string]SubgraphStatus)
+	for _, s := range statuses {
+		if s.Node == "" || s.Deployment == "" {
+			continue
+		}
+		if prev, ok := byDeployment[s.Deployment]; !ok || s.BlocksBehind > prev.BlocksBehind {
+			byDeployment[s.Deployment] = s
+		}
+	}
+
+	nodes := make(map[string]*NodeLoad)
+	worst := make(map[string]SubgraphStatus)
+	for _, s := range byDeployment {
+		n := nodes[s.Node]
+		if n == nil {
+			n = &NodeLoad{Node: s.Node}
+			nodes[s.Node] = n
+		}
+		n.Deployments++
+		if (s.Status != StatusWarn && s.Status != StatusCrit) || s.LagCause == LagCauseProvider {
+			continue
+		}
+		n.Lagging++
+		n.BlocksBehind = addBlocks(n.BlocksBehind, s.BlocksBehind)
+		n.MaxBlocksBehind = max(n.MaxBlocksBehind, s.BlocksBehind)
+		if w, ok := worst[s.Node]; !ok || s.BlocksBehind > w.BlocksBehind || s.BlocksBehind == w.BlocksBehind && s.Name < w.Name {
+			worst[s.Node] = s
+		}
+	}
+
+	load := ClusterLoad{Nodes: []NodeLoad{}, Suggestions: []Reassignment{}}
+	for _, n := range nodes {
+		n.Overloaded = n.Lagging >= 2 && n.Lagging*2 >= n.Deployments
+		load.Nodes = append(load.Nodes, *n)
+	}
+	sort.Slice(load.Nodes, func(i, j int) bool { return load.Nodes[i].Node < load.Nodes[j].Node })
+
+	for _, n := range load.Nodes {
+		if !n.Overloaded {
+			continue
+		}
+		var target *NodeLoad
+		for _, name := range sortedNodeNames(nodes) {
+			if c := nodes[name]; c.Lagging == 0 && (target == nil || c.Deployments < target.Deployments) {
+				target = c
+			}
+		}
+		if target == nil {
+			break
+		}
+		s := worst[n.Node]
+		load.Suggestions = append(load.Suggestions, Reassignment{
+			Subgraph:     s.Name,
+			Deployment:   s.Deployment,
+			From:         n.Node,
+			To:           target.Node,
+			BlocksBehind: s.BlocksBehind,
+		})
+		// Spread further suggestions over the idle nodes.
+		target.Deployments++
+	}
+	return load
+}
+
+func sortedNodeNames(nodes map[string]*NodeLoad) []string {
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// reassignDeployment moves a deployment to another node with graph-node's
+// subgraph_reassign admin method.
+func reassignDeployment(adminURL string, r Reassignment) error {
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "subgraph_reassign",
+		"params":  map[string]string{"ipfs_hash": r.Deployment, "node_id": r.To},
+		"id":      1,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := post(adminURL, "application/json", reqBody, newCycleID())
+	if err != nil {
+		return fmt.Errorf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := readBody(resp)
+	if err != nil {
+		return fmt.Errorf("read response failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+	var result struct {
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("JSON error: %v", err)
+	}
+	if result.Error != nil {
+		return fmt.Errorf("RPC error: %s", result.Error.Message)
+	}
+	return nil
+}
+
+// runReassign executes the first reassignment suggestion every interval.
+// One move at a time gives the cluster a full interval to settle, and the
+// new assignment to show up in the index node status, before the next.
+func (m *Monitor) runReassign(cfg ClusterConfig) {
+	for {
+		time.Sleep(cfg.ReassignInterval.Duration)
+		load := clusterLoad(m.Statuses())
+		if len(load.Suggestions) == 0 {
+			continue
+		}
+		r := load.Suggestions[0]
+		log.Printf("Reassigning %s (%s, %d blocks behind) from overloaded node %s to %s",
+			r.Deployment, r.Subgraph, r.BlocksBehind, r.From, r.To)
+		if err := reassignDeployment(cfg.AdminURL, r); err != nil {
+			log.Printf("Reassigning %s failed: %v", r.Deployment, err)
+		}
+	}
+}
+
+func (m *Monitor) handleNodes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, clusterLoad(filterStatuses(m.Statuses(), viewTenant(r))))
+}
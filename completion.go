@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// listEntry is a monitored subgraph as printed by "list". Status is only
+// known when asking a running monitor.
+type listEntry struct {
+	Name     string `json:"name"`
+	Chain    string `json:"chain"`
+	Tenant   string `json:"tenant,omitempty"`
+	Priority string `json:"priority,omitempty"`
+	URL      string `json:"url"`
+	Status   Status `json:"status,omitempty"`
+}
+
+// subgraphArgCommands take a subgraph name as their first argument, which
+// the shell completions complete.
+var subgraphArgCommands = map[string]bool{
+	"reset-history": true,
+	"predict":       true,
+	"resync-cost":   true,
+	"debug":         true,
+	"wait":          true,
+}
+
+// runList implements "list": it prints the monitored subgraphs from the
+// config, or from a running monitor with -server, which includes subgraphs
+// added through the API.
+func runList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	kubeConfigMap := fs.String("k8s-configmap", "", "load config from a ConfigMap ([namespace/]name)")
+	kubeSecret := fs.String("k8s-secret", "", "load config from a Secret ([namespace/]name)")
+	kubeKey := fs.String("k8s-key", defaultKubeDataKey, "ConfigMap/Secret data key holding the config")
+	server := fs.String("server", "", "base URL of a running monitor's HTTP API to list instead of the config")
+	token := fs.String("token", os.Getenv("SUBGRAPH_MONITOR_TOKEN"), "bearer token for -server (default $SUBGRAPH_MONITOR_TOKEN)")
+	format := fs.String("format", FormatAuto, "output format: auto (table on a terminal, json otherwise), table, json, or names (one name per line)")
+	shard := fs.String("shard", "", "only list the subgraphs of shard <index>/<total>, e.g. 2/4")
+	fs.Parse(args)
+	out, err := outputFormat(*format, "table", "json", "names")
+	if err != nil {
+		return err
+	}
+
+	only, err := parseShard(*shard)
+	if err != nil {
+		return err
+	}
+	entries, err := listSubgraphs(*configPath, *kubeConfigMap, *kubeSecret, *kubeKey, *server, *token)
+	if err != nil {
+		return err
+	}
+	if only.Total > 0 {
+		owned := []listEntry{}
+		for _, e := range entries {
+			if only.owns(e.Name) {
+				owned = append(owned, e)
+			}
+		}
+		entries = owned
+	}
+
+	switch out {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	case "names":
+		for _, e := range entries {
+			fmt.Println(e.Name)
+		}
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tCHAIN\tTENANT\tPRIORITY\tSTATUS\tURL")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.Name, e.Chain, orDash(e.Tenant), orDash(e.Priority), orDash(string(e.Status)), e.URL)
+	}
+	return w.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// listSubgraphs returns the monitored subgraphs ordered by name.
+func listSubgraphs(configPath, configMap, secret, key, server, token string) ([]listEntry, error) {
+	entries := []listEntry{}
+	if server != "" {
+		statuses, err := fetchStatuses(server, token)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range statuses {
+			entries = append(entries, listEntry{Name: s.Name, Chain: s.Chain, Tenant: s.Tenant, URL: s.URL, Status: s.Status})
+		}
+	} else {
+		cfg, _, err := loadConfig(configPath, configMap, secret, key)
+		if err != nil {
+			return nil, err
+		}
+		for _, sg := range cfg.Subgraphs {
+			entries = append(entries, listEntry{Name: sg.Name, Chain: sg.Chain, Tenant: sg.Tenant, Priority: sg.Priority, URL: sg.URL})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, nil
+}
+
+func fetchStatuses(server, token string) ([]SubgraphStatus, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(server, "/")+"/api/v1/status", nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var statuses []SubgraphStatus
+	if err := json.NewDecoder(resp.Body).Decode(&statuses); err != nil {
+		return nil, fmt.Errorf("JSON error: %v", err)
+	}
+	return statuses, nil
+}
+
+// runCompletion implements "completion": it prints a completion script for
+// a shell. The scripts ask the binary for candidates with "__complete".
+func runCompletion(args []string) error {
+	fs := flag.NewFlagSet("completion", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s completion bash|zsh|fish\n", os.Args[0])
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	prog := filepath.Base(os.Args[0])
+	script, ok := completionScripts[fs.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unsupported shell %q, expected bash, zsh or fish", fs.Arg(0))
+	}
+	fn := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, prog)
+	fmt.Print(strings.NewReplacer("_PROG", "_"+fn, "PROG", prog).Replace(script))
+	return nil
+}
+
+// __complete refers to commands, so it is registered here rather than in
+// the map literal.
+func init() {
+	commands["__complete"] = runComplete
+}
+
+var completionScripts = map[string]string{
+	"bash": `# bash completion for PROG
+_PROG_complete() {
+	local IFS=$'\n'
+	COMPREPLY=($("${COMP_WORDS[0]}" __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null | while read -r c; do printf '%q\n' "$c"; done))
+}
+complete -o default -F _PROG_complete PROG
+`,
+	"zsh": `#compdef PROG
+_PROG() {
+	local -a candidates
+	candidates=("${(@f)$("${words[1]}" __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+	if (( ${#candidates[@]} )) && [[ -n "${candidates[1]}" ]]; then
+		compadd -a candidates
+	else
+		_files
+	fi
+}
+compdef _PROG PROG
+`,
+	"fish": `# fish completion for PROG
+function __PROG_complete
+	set -l words (commandline -opc)
+	PROG __complete $words[2..-1] (commandline -ct) 2>/dev/null
+end
+complete -c PROG -a '(__PROG_complete)'
+`,
+}
+
+// runComplete implements the hidden "__complete" command used by the
+// completion scripts. args are the words after the program name, the last
+// one being the word under the cursor; it prints the candidates for that
+// word, one per line.
+func runComplete(args []string) error {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	current := args[len(args)-1]
+	var candidates []string
+	switch {
+	case len(args) == 1:
+		for name := range commands {
+			if !strings.HasPrefix(name, "__") {
+				candidates = append(candidates, name)
+			}
+		}
+		sort.Strings(candidates)
+	case strings.HasPrefix(current, "-"):
+	case args[0] == "completion" && len(args) == 2:
+		candidates = []string{"bash", "fish", "zsh"}
+	case args[0] == "config" && len(args) == 2:
+		candidates = []string{"defaults", "docs", "validate"}
+	case args[0] == "config" && args[1] == "docs" && flagName(args[len(args)-2]) == "format":
+		candidates = []string{"auto", "json", "markdown", "table"}
+	case args[0] == "list" && flagName(args[len(args)-2]) == "format":
+		candidates = []string{"auto", "json", "names", "table"}
+	case (args[0] == "events" || args[0] == "audit" || args[0] == "report") && flagName(args[len(args)-2]) == "format":
+		candidates = []string{"auto", "json", "table"}
+	case subgraphArgCommands[args[0]] && positionals(args[1:len(args)-1]) == 0 && positionals(args[1:]) == 1:
+		flags := completionFlags(args[1 : len(args)-1])
+		entries, err := listSubgraphs(flags["config"], flags["k8s-configmap"], flags["k8s-secret"],
+			firstNonEmpty(flags["k8s-key"], defaultKubeDataKey), flags["server"], firstNonEmpty(flags["token"], os.Getenv("SUBGRAPH_MONITOR_TOKEN")))
+		if err != nil {
+			return nil
+		}
+		for _, e := range entries {
+			candidates = append(candidates, e.Name)
+		}
+	}
+	for _, c := range candidates {
+		if strings.HasPrefix(c, current) {
+			fmt.Println(c)
+		}
+	}
+	return nil
+}
+
+// flagName returns the name of a -flag or --flag word, or "".
+func flagName(word string) string {
+	if !strings.HasPrefix(word, "-") {
+		return ""
+	}
+	name, _, _ := strings.Cut(strings.TrimLeft(word, "-"), "=")
+	return name
+}
+
+// completionFlags collects the values of -flag value and -flag=value words.
+func completionFlags(words []string) map[string]string {
+	flags := make(map[string]string)
+	for i, w := range words {
+		name := flagName(w)
+		if name == "" {
+			continue
+		}
+		if _, value, ok := strings.Cut(w, "="); ok {
+			flags[name] = value
+		} else if i+1 < len(words) {
+			flags[name] = words[i+1]
+		}
+	}
+	return flags
+}
+
+// positionals counts the words that are neither flags nor flag values,
+// assuming every flag without "=" takes a value.
+func positionals(words []string) int {
+	n := 0
+	for i := 0; i < len(words); i++ {
+		switch {
+		case flagName(words[i]) == "":
+			n++
+		case !strings.Contains(words[i], "="):
+			i++
+		}
+	}
+	return n
+}
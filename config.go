@@ -0,0 +1,499 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"10m\": %v", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %v", s, err)
+	}
+	d.Duration = v
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+type Config struct {
+	CheckInterval Duration              `json:"checkInterval"`
+	HTTPTimeout   Duration              `json:"httpTimeout"`
+	HTTP          HTTPConfig            `json:"http"`
+	IPFSURL       string                `json:"ipfsUrl"`
+	Server        ServerConfig          `json:"server"`
+	Thresholds    Thresholds            `json:"thresholds"`
+	Tiers         map[string]TierConfig `json:"tiers"`
+	Storage       StorageConfig         `json:"storage"`
+	// Shard is the part of the fleet this instance checks, "2/4"; the -shard
+	// flag overrides it. Read at startup.
+	Shard        Shard                   `json:"shard"`
+	History      HistoryConfig           `json:"history"`
+	EventLog     EventLogConfig          `json:"eventLog"`
+	Audit        AuditConfig             `json:"audit"`
+	SlackBot     SlackBotConfig          `json:"slackBot"`
+	Health       HealthConfig            `json:"health"`
+	Chains       map[string]*ChainInfo   `json:"chains"`
+	Subgraphs    []*SubgraphInfo         `json:"subgraphs"`
+	Firehose     []*FirehoseInfo         `json:"firehose"`
+	Notifiers    []NotifierConfig        `json:"notifiers"`
+	Tenants      map[string]TenantConfig `json:"tenants"`
+	UpdateCheck  UpdateCheckConfig       `json:"updateCheck"`
+	SLO          SLOConfig               `json:"slo"`
+	Availability AvailabilityConfig      `json:"availability"`
+	Export       ExportConfig            `json:"export"`
+	Remediation  RemediationConfig       `json:"remediation"`
+	Cluster      ClusterConfig           `json:"cluster"`
+	ETA          ETAConfig               `json:"eta"`
+	IndexNode    IndexNodeConfig         `json:"indexNode"`
+	Certificates CertificatesConfig      `json:"certificates"`
+	Simulation   SimulationConfig        `json:"simulation"`
+	// ProgressBaseline is the default 0% block for progress: the subgraph's
+	// startBlock, the chain's genesis, or the first block the monitor saw.
+	ProgressBaseline string `json:"progressBaseline"`
+	// ResponseSchema is the default for how strictly _meta responses are
+	// read: strict, default or lenient.
+	ResponseSchema string `json:"responseSchema"`
+	// GraphQLRequest is the default for how queries are sent to subgraph
+	// endpoints: post, get, apq or apq-post.
+	GraphQLRequest string `json:"graphqlRequest"`
+	// Locale is the language and number and date format of the report
+	// command and Slack bot messages: en, es or zh.
+	Locale string `json:"locale"`
+	// Severity decides WARN and CRIT with predicates instead of the
+	// blocks-behind thresholds.
+	Severity *SeverityPolicy `json:"severity,omitempty"`
+	// source names where a reloaded config came from, for the audit log.
+	source string
+	// upstreams lists the chain and Firehose upstreams named in any
+	// subgraph's dependsOn, including other shards' subgraphs. Set by
+	// Shard.apply, so the upstream's owner reports it.
+	upstreams []string
+	// certReporters maps the hosts of subgraph and chain endpoints to the
+	// shard reporting their certificates.
+	certReporters map[string]int
+}
+
+func newConfig() *Config {
+	return &Config{
+		CheckInterval: Duration{CheckInterval},
+		HTTPTimeout:   Duration{HTTPTimeout},
+		HTTP:          defaultHTTPConfig(),
+		IPFSURL:       DefaultIPFSURL,
+		Thresholds: Thresholds{
+			WarnBlocksBehind: DefaultWarnBlocksBehind,
+			CritBlocksBehind: DefaultCritBlocksBehind,
+			ErrorTolerance:   DefaultErrorTolerance,
+		},
+		Storage:  StorageConfig{Type: StorageMemory},
+		History:  HistoryConfig{Retention: Duration{DefaultHistoryRetention}},
+		EventLog: EventLogConfig{Retention: Duration{DefaultEventLogRetention}},
+		Audit:    AuditConfig{Retention: Duration{DefaultAuditRetention}},
+		SlackBot: SlackBotConfig{AckDuration: Duration{DefaultSlackAckDuration}, APIURL: DefaultSlackAPIURL},
+		Health:   defaultHealthConfig(),
+		UpdateCheck: UpdateCheckConfig{
+			URL:      DefaultReleaseURL,
+			Interval: Duration{24 * time.Hour},
+		},
+		SLO: SLOConfig{Window: Duration{DefaultSLOWindow}},
+		Availability: AvailabilityConfig{
+			Window:    DefaultAvailabilityWindow,
+			WarnBelow: DefaultAvailabilityWarnBelow,
+			CritBelow: DefaultAvailabilityCritBelow,
+		},
+		Export:           ExportConfig{Parquet: ParquetExportConfig{Interval: Duration{DefaultParquetExportInterval}}},
+		ProgressBaseline: ProgressBaselineStartBlock,
+		ResponseSchema:   ResponseSchemaDefault,
+		GraphQLRequest:   GraphQLRequestPost,
+		Locale:           DefaultLocale,
+		Remediation: RemediationConfig{
+			Cooldown:   Duration{DefaultRemediationCooldown},
+			MaxPerHour: DefaultRemediationMaxPerHour,
+			Timeout:    Duration{DefaultRemediationTimeout},
+		},
+		Cluster:      ClusterConfig{ReassignInterval: Duration{DefaultReassignInterval}},
+		ETA:          ETAConfig{RangeBlocks: DefaultETARangeBlocks},
+		IndexNode:    IndexNodeConfig{MetaInterval: Duration{DefaultIndexNodeMetaInterval}},
+		Certificates: CertificatesConfig{WarnBefore: Duration{DefaultCertWarnBefore}},
+	}
+}
+
+func defaultConfig() *Config {
+	cfg := newConfig()
+	cfg.Chains = initializeChains()
+	cfg.Subgraphs = initializeSubgraphs()
+	cfg.applyDefaults()
+	return cfg
+}
+
+func loadConfigFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config failed: %v", err)
+	}
+	return parseConfig(data)
+}
+
+func parseConfig(data []byte) (*Config, error) {
+	data = stripJSONComments(data)
+	cfg := newConfig()
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse config failed: %v", err)
+	}
+	if err := checkConfigFields(data); err != nil {
+		return nil, err
+	}
+	cfg.applyDefaults()
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) applyDefaults() {
+	c.resolveTiers()
+	for _, chain := range c.Chains {
+		if chain != nil && chain.PushMaxAge.Duration == 0 {
+			chain.PushMaxAge.Duration = DefaultPushMaxAge
+		}
+		if chain != nil && chain.BlockTimeSampleInterval.Duration == 0 {
+			chain.BlockTimeSampleInterval.Duration = DefaultBlockTimeSampleInterval
+		}
+		if chain != nil && chain.HeadPolicy == "" {
+			chain.HeadPolicy = HeadPolicyLatest
+		}
+	}
+	for _, sg := range c.Subgraphs {
+		if sg != nil {
+			c.applySubgraphDefaults(sg)
+		}
+	}
+	for _, fh := range c.Firehose {
+		if fh == nil {
+			continue
+		}
+		if fh.WarnBlocksBehind == 0 {
+			fh.WarnBlocksBehind = c.Thresholds.WarnBlocksBehind
+		}
+		if fh.CritBlocksBehind == 0 {
+			fh.CritBlocksBehind = c.Thresholds.CritBlocksBehind
+		}
+	}
+}
+
+// applySubgraphDefaults resolves a subgraph's check interval and thresholds:
+// explicit subgraph settings win over its priority tier, which wins over the
+// global settings.
+func (c *Config) applySubgraphDefaults(sg *SubgraphInfo) {
+	if sg.MaxHistoryEntries <= 0 {
+		sg.MaxHistoryEntries = DefaultMaxHistoryEntries
+	}
+	if sg.IPFSURL == "" {
+		sg.IPFSURL = c.IPFSURL
+	}
+	if sg.ProgressBaseline == "" {
+		sg.ProgressBaseline = c.ProgressBaseline
+	}
+	if sg.ResponseSchema == "" {
+		sg.ResponseSchema = c.ResponseSchema
+	}
+	if sg.GraphQLRequest == "" {
+		sg.GraphQLRequest = c.GraphQLRequest
+	}
+	if sg.Severity == nil && c.Severity != nil {
+		severity := *c.Severity
+		sg.Severity = &severity
+	}
+	if sg.Availability == nil {
+		availability := c.Availability
+		sg.Availability = &availability
+	} else if sg.Availability.Window == 0 {
+		sg.Availability.Window = c.Availability.Window
+	}
+	if sg.SlowSyncFor.Duration <= 0 {
+		sg.SlowSyncFor.Duration = DefaultSlowSyncFor
+	}
+	tier, ok := c.Tiers[sg.Priority]
+	if !ok {
+		tier = TierConfig{CheckInterval: c.CheckInterval, Thresholds: c.Thresholds}
+	}
+	if sg.CheckInterval.Duration == 0 {
+		sg.CheckInterval = tier.CheckInterval
+	}
+	if sg.WarnBlocksBehind == 0 {
+		sg.WarnBlocksBehind = tier.WarnBlocksBehind
+	}
+	if sg.CritBlocksBehind == 0 {
+		sg.CritBlocksBehind = tier.CritBlocksBehind
+	}
+	if sg.ErrorTolerance == 0 {
+		sg.ErrorTolerance = tier.ErrorTolerance
+	}
+	if len(sg.Replicas) > 0 && sg.CompareInterval.Duration == 0 {
+		sg.CompareInterval.Duration = replicaCompareEvery * sg.CheckInterval.Duration
+	}
+}
+
+func (c *Config) validateSubgraph(sg *SubgraphInfo) error {
+	if sg.URL == "" {
+		return fmt.Errorf("subgraph %s: url is required", sg.Name)
+	}
+	if _, ok := c.Tiers[sg.Priority]; sg.Priority != "" && !ok {
+		return fmt.Errorf("subgraph %s: unknown priority %q", sg.Name, sg.Priority)
+	}
+	if sg.CheckInterval.Duration <= 0 {
+		return fmt.Errorf("subgraph %s: checkInterval must be positive", sg.Name)
+	}
+	if sg.ErrorTolerance < 0 {
+		return fmt.Errorf("subgraph %s: errorTolerance must not be negative", sg.Name)
+	}
+	if err := sg.Thresholds.validate(); err != nil {
+		return fmt.Errorf("subgraph %s: %v", sg.Name, err)
+	}
+	if sg.Remediation != nil {
+		if err := sg.Remediation.validate(); err != nil {
+			return fmt.Errorf("subgraph %s: remediation: %v", sg.Name, err)
+		}
+	}
+	if sg.MinSyncSpeed.Speed < 0 {
+		return fmt.Errorf("subgraph %s: minSyncSpeed must not be negative", sg.Name)
+	}
+	if err := validateDependsOn(c, sg); err != nil {
+		return fmt.Errorf("subgraph %s: %v", sg.Name, err)
+	}
+	if err := validateBlockRanges(sg.HeavyRanges); err != nil {
+		return fmt.Errorf("subgraph %s: heavyRanges: %v", sg.Name, err)
+	}
+	if !validProgressBaseline(sg.ProgressBaseline) {
+		return fmt.Errorf("subgraph %s: unknown progressBaseline %q", sg.Name, sg.ProgressBaseline)
+	}
+	if !validResponseSchema(sg.ResponseSchema) {
+		return fmt.Errorf("subgraph %s: unknown responseSchema %q", sg.Name, sg.ResponseSchema)
+	}
+	if !validGraphQLRequest(sg.GraphQLRequest) {
+		return fmt.Errorf("subgraph %s: unknown graphqlRequest %q", sg.Name, sg.GraphQLRequest)
+	}
+	if _, ok := c.Tenants[sg.Tenant]; sg.Tenant != "" && !ok {
+		return fmt.Errorf("subgraph %s: unknown tenant %q", sg.Name, sg.Tenant)
+	}
+	if err := sg.Availability.validate(); err != nil {
+		return fmt.Errorf("subgraph %s: availability: %v", sg.Name, err)
+	}
+	if sg.Severity != nil {
+		if err := sg.Severity.validate(); err != nil {
+			return fmt.Errorf("subgraph %s: severity.%v", sg.Name, err)
+		}
+	}
+	return validateReplicas(sg)
+}
+
+func (c *Config) validate() error {
+	if c.CheckInterval.Duration <= 0 {
+		return fmt.Errorf("checkInterval must be positive")
+	}
+	if c.HTTPTimeout.Duration <= 0 {
+		return fmt.Errorf("httpTimeout must be positive")
+	}
+	if c.Thresholds.ErrorTolerance < 1 {
+		return fmt.Errorf("thresholds.errorTolerance must be at least 1")
+	}
+	if err := c.Thresholds.validate(); err != nil {
+		return fmt.Errorf("thresholds: %v", err)
+	}
+	if !validProgressBaseline(c.ProgressBaseline) {
+		return fmt.Errorf("unknown progressBaseline %q", c.ProgressBaseline)
+	}
+	if !validResponseSchema(c.ResponseSchema) {
+		return fmt.Errorf("unknown responseSchema %q", c.ResponseSchema)
+	}
+	if !validGraphQLRequest(c.GraphQLRequest) {
+		return fmt.Errorf("unknown graphqlRequest %q", c.GraphQLRequest)
+	}
+	if !validLocale(c.Locale) {
+		return fmt.Errorf("unknown locale %q, expected one of %s", c.Locale, localeNames())
+	}
+	if c.Severity != nil {
+		if err := c.Severity.validate(); err != nil {
+			return fmt.Errorf("severity.%v", err)
+		}
+	}
+	if err := c.Storage.validate(); err != nil {
+		return err
+	}
+	if err := c.History.validate(); err != nil {
+		return err
+	}
+	if c.EventLog.Retention.Duration <= 0 {
+		return fmt.Errorf("eventLog.retention must be positive")
+	}
+	if c.Audit.Retention.Duration <= 0 {
+		return fmt.Errorf("audit.retention must be positive")
+	}
+	if err := c.validateTiers(); err != nil {
+		return err
+	}
+	if c.UpdateCheck.Enabled && c.UpdateCheck.Interval.Duration < time.Minute {
+		return fmt.Errorf("updateCheck.interval must be at least 1m")
+	}
+	if err := c.HTTP.validate(); err != nil {
+		return err
+	}
+	if err := c.Health.validate(); err != nil {
+		return err
+	}
+	if err := c.SlackBot.validate(); err != nil {
+		return err
+	}
+	if err := c.Server.validate(); err != nil {
+		return err
+	}
+	if err := c.Cluster.validate(); err != nil {
+		return err
+	}
+	if err := c.ETA.validate(); err != nil {
+		return err
+	}
+	if err := c.IndexNode.validate(); err != nil {
+		return err
+	}
+	if err := c.Certificates.validate(); err != nil {
+		return err
+	}
+	if err := c.Remediation.validate(); err != nil {
+		return err
+	}
+	if err := c.Availability.validate(); err != nil {
+		return fmt.Errorf("availability: %v", err)
+	}
+	if err := c.SLO.validate(); err != nil {
+		return err
+	}
+	if err := c.Export.Parquet.validate(c.History.Retention.Duration); err != nil {
+		return err
+	}
+	for key, chain := range c.Chains {
+		if chain == nil || chain.RpcURL == "" {
+			return fmt.Errorf("chain %s: rpcUrl is required", key)
+		}
+		if chain.Name == "" {
+			chain.Name = key
+		}
+		if chain.PushMaxAge.Duration < 0 {
+			return fmt.Errorf("chain %s: pushMaxAge must not be negative", key)
+		}
+		if chain.BlockTimeSampleInterval.Duration < 0 {
+			return fmt.Errorf("chain %s: blockTimeSampleInterval must not be negative", key)
+		}
+		if chain.HaltAfter.Duration < 0 {
+			return fmt.Errorf("chain %s: haltAfter must not be negative", key)
+		}
+		if !validHeadPolicy(chain.HeadPolicy) {
+			return fmt.Errorf("chain %s: unknown headPolicy %q, expected latest, safe or finalized", key, chain.HeadPolicy)
+		}
+	}
+	seen := make(map[string]bool)
+	for i, sg := range c.Subgraphs {
+		if sg == nil || sg.Name == "" {
+			return fmt.Errorf("subgraph #%d: name is required", i)
+		}
+		if err := c.validateSubgraph(sg); err != nil {
+			return err
+		}
+		if seen[sg.Name] {
+			return fmt.Errorf("subgraph %s: duplicate name", sg.Name)
+		}
+		seen[sg.Name] = true
+	}
+	seen = make(map[string]bool)
+	for i, fh := range c.Firehose {
+		if fh == nil || fh.Name == "" {
+			return fmt.Errorf("firehose #%d: name is required", i)
+		}
+		if fh.URL == "" {
+			return fmt.Errorf("firehose %s: url is required", fh.Name)
+		}
+		if _, ok := c.Chains[fh.Chain]; !ok {
+			return fmt.Errorf("firehose %s: unknown chain %q", fh.Name, fh.Chain)
+		}
+		if seen[fh.Name] {
+			return fmt.Errorf("firehose %s: duplicate name", fh.Name)
+		}
+		seen[fh.Name] = true
+	}
+	if err := validateNotifiers(c.Notifiers); err != nil {
+		return err
+	}
+	if err := c.Simulation.validate(c); err != nil {
+		return err
+	}
+	return c.validateTenants()
+}
+
+func validateNotifiers(notifiers []NotifierConfig) error {
+	seen := make(map[string]bool)
+	for i := range notifiers {
+		n := &notifiers[i]
+		if err := n.validate(); err != nil {
+			return fmt.Errorf("notifier #%d: %v", i, err)
+		}
+		if seen[n.Name] {
+			return fmt.Errorf("notifier %s: duplicate name", n.Name)
+		}
+		seen[n.Name] = true
+	}
+	return nil
+}
+
+// mergeChainState carries the head, halt and block time of each chain over
+// to the reloaded chain with the same name, so a reload neither repeats a
+// halt alert nor loses the recovery of a halted chain.
+func mergeChainState(old, next map[string]*ChainInfo) map[string]*ChainInfo {
+	for name, chain := range next {
+		prev, ok := old[name]
+		if !ok {
+			continue
+		}
+		chain.LatestBlock = prev.LatestBlock
+		chain.HeadSource = prev.HeadSource
+		chain.PushedBlock = prev.PushedBlock
+		chain.PushedAt = prev.PushedAt
+		chain.BlockTime = prev.BlockTime
+		chain.BlockTimeSampledAt = prev.BlockTimeSampledAt
+		chain.HeadTime = prev.HeadTime
+		chain.HaltBlock = prev.HaltBlock
+		chain.Halted = prev.Halted
+	}
+	return next
+}
+
+// mergeSubgraphHistory carries sync history over to reloaded subgraphs with
+// the same name and URL so speed and ETA survive a configuration reload.
+func mergeSubgraphHistory(old, next []*SubgraphInfo) []*SubgraphInfo {
+	byName := make(map[string]*SubgraphInfo, len(old))
+	for _, sg := range old {
+		byName[sg.Name] = sg
+	}
+	for _, sg := range next {
+		prev, ok := byName[sg.Name]
+		if !ok || prev.URL != sg.URL {
+			continue
+		}
+		sg.SyncState = prev.SyncState
+		if limit := time.Now().Add(sg.CheckInterval.Duration); sg.NextCheckAt.After(limit) {
+			sg.NextCheckAt = limit
+		}
+	}
+	return next
+}
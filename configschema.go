@@ -0,0 +1,795 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// runConfig implements "config": docs lists every config field with its
+// type, default and description, defaults prints a config with all defaults
+// filled in and validate checks a config without starting the monitor.
+func runConfig(args []string) error {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s config docs|defaults|validate [flags]\n", os.Args[0])
+	}
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "docs":
+		return runConfigDocs(args[1:])
+	case "defaults":
+		return runConfigDefaults(args[1:])
+	case "validate":
+		return runConfigValidate(args[1:])
+	}
+	usage()
+	os.Exit(2)
+	return nil
+}
+
+func runConfigDocs(args []string) error {
+	fs := flag.NewFlagSet("config docs", flag.ExitOnError)
+	format := fs.String("format", FormatAuto, "output format: auto (table on a terminal, json otherwise), table, markdown or json")
+	check := fs.Bool("check", false, "only check that every field has a description, failing otherwise")
+	fs.Parse(args)
+	if *check {
+		return checkConfigDocs()
+	}
+	out, err := outputFormat(*format, "table", "markdown", "json")
+	if err != nil {
+		return err
+	}
+
+	fields := configSchema()
+	switch out {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(fields)
+	case "markdown":
+		fmt.Println("| Field | Type | Default | Description |")
+		fmt.Println("|---|---|---|---|")
+		for _, f := range fields {
+			def := ""
+			if f.Default != "" {
+				def = "`" + f.Default + "`"
+			}
+			fmt.Printf("| `%s` | %s | %s | %s |\n", f.Path, f.Type, def, f.Doc)
+		}
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FIELD\tTYPE\tDEFAULT\tDESCRIPTION")
+	for _, f := range fields {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.Path, f.Type, orDash(f.Default), f.Doc)
+	}
+	return w.Flush()
+}
+
+// checkConfigDocs fails when a config field or section has no description
+// in configDocs, or a description names neither.
+func checkConfigDocs() error {
+	var problems []string
+	paths := make(map[string]bool)
+	for _, f := range configSchema() {
+		for path := f.Path; path != ""; path, _ = splitConfigPath(path) {
+			paths[path] = true
+		}
+	}
+	for path := range paths {
+		// List elements are described by their list.
+		if configDocs[path] == "" && !strings.HasSuffix(path, "[]") {
+			problems = append(problems, path+" has no description")
+		}
+	}
+	for path := range configDocs {
+		if !paths[path] {
+			problems = append(problems, path+" is described but is not a config field")
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("%d config docs problems:\n  %s", len(problems), strings.Join(problems, "\n  "))
+	}
+	fmt.Printf("config docs OK: %d fields and sections described\n", len(configDocs))
+	return nil
+}
+
+// runConfigDefaults prints the config the monitor runs with when a file
+// sets nothing, with one example chain and subgraph to show their defaults.
+// Each field is preceded by a // comment with its description, which config
+// files may keep.
+func runConfigDefaults(args []string) error {
+	fs := flag.NewFlagSet("config defaults", flag.ExitOnError)
+	comments := fs.Bool("comments", true, "describe each field in a // comment above it; false prints plain JSON")
+	fs.Parse(args)
+
+	cfg := newConfig()
+	cfg.Chains = map[string]*ChainInfo{"ethereum": {Name: "Ethereum", RpcURL: "https://eth.llamarpc.com"}}
+	cfg.Subgraphs = []*SubgraphInfo{{Name: "example", URL: "https://example.com/subgraphs/name/example", Chain: "ethereum"}}
+	cfg.applyDefaults()
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(cfg); err != nil {
+		return err
+	}
+	if !*comments {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	_, err := os.Stdout.Write(annotateConfig(buf.Bytes()))
+	return err
+}
+
+// annotateConfig adds a // comment with the description from configDocs
+// above each field of an indented config. Lines are matched to schema paths
+// by following the nesting, with the keys of map fields as <name>.
+func annotateConfig(data []byte) []byte {
+	maps := make(map[string]bool)
+	for _, f := range configSchema() {
+		if f.Type == "object" {
+			maps[f.Path] = true
+		}
+	}
+	type level struct {
+		path  string
+		array bool
+	}
+	var stack []level
+	var out bytes.Buffer
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		var top level
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+		switch {
+		case trimmed == "":
+		case strings.HasPrefix(trimmed, "}") || strings.HasPrefix(trimmed, "]"):
+			stack = stack[:len(stack)-1]
+		case len(stack) == 0:
+			// The config itself.
+			stack = append(stack, level{})
+		case top.array:
+			// A list element.
+			switch trimmed {
+			case "{":
+				stack = append(stack, level{path: top.path + "[]"})
+			case "[":
+				stack = append(stack, level{path: top.path + "[]", array: true})
+			}
+		default:
+			var key string
+			if err := json.NewDecoder(strings.NewReader(trimmed)).Decode(&key); err != nil {
+				break
+			}
+			path := joinConfigPath(top.path, key)
+			if maps[top.path] {
+				path = top.path + ".<name>"
+			}
+			if doc := configDocs[path]; doc != "" {
+				indent := line[:len(line)-len(strings.TrimLeft(line, " "))]
+				out.WriteString(indent + "// " + doc + "\n")
+			}
+			switch {
+			case strings.HasSuffix(trimmed, "{"):
+				stack = append(stack, level{path: path})
+			case strings.HasSuffix(trimmed, "["):
+				stack = append(stack, level{path: path, array: true})
+			}
+		}
+		out.WriteString(line)
+	}
+	return out.Bytes()
+}
+
+// stripJSONComments blanks out // and /* */ comments outside strings, so
+// configs annotated like "config defaults" prints them parse as JSON.
+// Comments become spaces, keeping the offsets in syntax errors right.
+func stripJSONComments(data []byte) []byte {
+	out := bytes.Clone(data)
+	inString, escaped := false, false
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		switch {
+		case inString:
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '/' && i+1 < len(out) && out[i+1] == '/':
+			for ; i < len(out) && out[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+		case c == '/' && i+1 < len(out) && out[i+1] == '*':
+			end := bytes.Index(out[i+2:], []byte("*/"))
+			if end < 0 {
+				return out
+			}
+			for j := i; j < i+2+end+2; j++ {
+				if out[j] != '\n' {
+					out[j] = ' '
+				}
+			}
+			i += 2 + end + 1
+		}
+	}
+	return out
+}
+
+func runConfigValidate(args []string) error {
+	fs := flag.NewFlagSet("config validate", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	kubeConfigMap := fs.String("k8s-configmap", "", "load config from a ConfigMap ([namespace/]name)")
+	kubeSecret := fs.String("k8s-secret", "", "load config from a Secret ([namespace/]name)")
+	kubeKey := fs.String("k8s-key", defaultKubeDataKey, "ConfigMap/Secret data key holding the config")
+	fs.Parse(args)
+	if *configPath == "" && *kubeConfigMap == "" && *kubeSecret == "" && fs.NArg() == 1 {
+		*configPath = fs.Arg(0)
+	}
+	if *configPath == "" && *kubeConfigMap == "" && *kubeSecret == "" {
+		return fmt.Errorf("no config given, use -config, -k8s-configmap or -k8s-secret")
+	}
+
+	cfg, _, err := loadConfig(*configPath, *kubeConfigMap, *kubeSecret, *kubeKey)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("config OK: %d chains, %d subgraphs, %d notifiers\n", len(cfg.Chains), len(cfg.Subgraphs), len(cfg.Notifiers))
+	return nil
+}
+
+// configField is one setting of the config file, derived from the Config
+// type so it cannot drift from what the monitor reads.
+type configField struct {
+	// Path is the dotted JSON path; "[]" stands for any list element and
+	// "<name>" for any map key, e.g. subgraphs[].warnBlocksBehind.
+	Path    string `json:"path"`
+	Type    string `json:"type"`
+	Default string `json:"default,omitempty"`
+	Doc     string `json:"doc,omitempty"`
+}
+
+var (
+	durationType = reflect.TypeOf(Duration{})
+	unmarshaler  = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// configSchema lists every config field with its type, its default (taken
+// from a config with one chain and one subgraph after applyDefaults) and
+// its documentation.
+func configSchema() []configField {
+	defaults := newConfig()
+	defaults.Chains = map[string]*ChainInfo{"<name>": {}}
+	defaults.Subgraphs = []*SubgraphInfo{{}}
+	defaults.applyDefaults()
+
+	var fields []configField
+	var walk func(t reflect.Type, v reflect.Value, path string)
+	walk = func(t reflect.Type, v reflect.Value, path string) {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+			if v.IsValid() {
+				if v.IsNil() {
+					v = reflect.Value{}
+				} else {
+					v = v.Elem()
+				}
+			}
+		}
+		if path != "" && (isConfigLeaf(t) || t.Kind() != reflect.Struct && t.Kind() != reflect.Map && t.Kind() != reflect.Slice) {
+			fields = append(fields, configField{Path: path, Type: configTypeName(t), Default: configDefault(v), Doc: configDocs[path]})
+			return
+		}
+		switch t.Kind() {
+		case reflect.Map:
+			fields = append(fields, configField{Path: path, Type: "object", Doc: configDocs[path]})
+			var elem reflect.Value
+			if v.IsValid() && v.Len() == 1 {
+				elem = v.MapIndex(v.MapKeys()[0])
+			}
+			walk(t.Elem(), elem, path+".<name>")
+		case reflect.Slice:
+			fields = append(fields, configField{Path: path, Type: "list", Doc: configDocs[path]})
+			var elem reflect.Value
+			if v.IsValid() && v.Len() == 1 {
+				elem = v.Index(0)
+			}
+			walk(t.Elem(), elem, path+"[]")
+		case reflect.Struct:
+			for i := 0; i < t.NumField(); i++ {
+				f := t.Field(i)
+				name, ok := configFieldName(f)
+				if !ok {
+					continue
+				}
+				var fv reflect.Value
+				if v.IsValid() {
+					fv = v.Field(i)
+				}
+				if f.Anonymous && name == "" {
+					walk(f.Type, fv, path)
+					continue
+				}
+				walk(f.Type, fv, joinConfigPath(path, name))
+			}
+		}
+	}
+	walk(reflect.TypeOf(defaults), reflect.ValueOf(defaults), "")
+	return fields
+}
+
+// configFieldName returns the JSON name of a struct field, "" for embedded
+// structs whose fields are promoted, and false for fields not in the file.
+func configFieldName(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" || !f.IsExported() && !f.Anonymous {
+		return "", false
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	if f.Anonymous && name == "" {
+		return "", true
+	}
+	if name == "" {
+		name = f.Name
+	}
+	return name, true
+}
+
+func joinConfigPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// isConfigLeaf reports whether a type is read as a single value, like the
+// durations and other types with their own JSON form.
+func isConfigLeaf(t reflect.Type) bool {
+	return t == durationType || reflect.PointerTo(t).Implements(unmarshaler)
+}
+
+func configTypeName(t reflect.Type) string {
+	switch {
+	case t == durationType:
+		return "duration"
+	case t == reflect.TypeOf(Shard{}):
+		return "string"
+	case t == reflect.TypeOf(SyncSpeedBaseline{}):
+		return "number or \"auto\""
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Uint, reflect.Uint64, reflect.Uint32:
+		return "integer"
+	case reflect.Float64, reflect.Float32:
+		return "number"
+	}
+	return t.Kind().String()
+}
+
+func configDefault(v reflect.Value) string {
+	if !v.IsValid() || v.IsZero() {
+		return ""
+	}
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// checkConfigFields returns an error naming the first field of a config
+// file the monitor does not know, with the closest known name, so a typo
+// does not silently leave a setting at its default.
+func checkConfigFields(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil
+	}
+	known := make(map[string][]string)
+	for _, f := range configSchema() {
+		for path := f.Path; path != ""; {
+			parent, name := splitConfigPath(path)
+			name = strings.TrimSuffix(name, "[]")
+			if !containsString(known[parent], name) {
+				known[parent] = append(known[parent], name)
+			}
+			path = parent
+		}
+	}
+	var unknown []string
+	var walk func(v interface{}, schemaPath, path string)
+	walk = func(v interface{}, schemaPath, path string) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			names, isObject := known[schemaPath]
+			if !isObject {
+				return
+			}
+			if len(names) == 1 && names[0] == "<name>" {
+				for k, child := range v {
+					walk(child, schemaPath+".<name>", path+"."+k)
+				}
+				return
+			}
+			for k, child := range v {
+				// encoding/json matches names case-insensitively, so
+				// only names matching none are typos.
+				name := closestConfigName(k, names)
+				if !strings.EqualFold(name, k) {
+					msg := joinConfigPath(path, k)
+					if name != "" {
+						msg += fmt.Sprintf(" (did you mean %s?)", name)
+					}
+					unknown = append(unknown, msg)
+					continue
+				}
+				walk(child, joinConfigPath(schemaPath, name), joinConfigPath(path, k))
+			}
+		case []interface{}:
+			for i, child := range v {
+				walk(child, schemaPath+"[]", fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	}
+	walk(raw, "", "")
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("unknown config field %s", strings.Join(unknown, ", "))
+}
+
+// splitConfigPath splits a schema path into its parent and last name;
+// list elements belong to the list's path plus "[]".
+func splitConfigPath(path string) (string, string) {
+	i := strings.LastIndex(path, ".")
+	if i < 0 {
+		return "", path
+	}
+	return path[:i], path[i+1:]
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// closestConfigName returns the known name matching name regardless of
+// case, or else the one it was probably meant to be, at most two edits
+// away.
+func closestConfigName(name string, known []string) string {
+	best, bestDist := "", 3
+	for _, k := range known {
+		if strings.EqualFold(k, name) {
+			return k
+		}
+		if d := editDistance(strings.ToLower(name), strings.ToLower(k)); d < bestDist {
+			best, bestDist = k, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// configDocs describes the config fields by schema path. Fields without an
+// entry are listed undocumented; see the README for the longer story.
+var configDocs = map[string]string{
+	"checkInterval":                               "how often subgraphs are checked",
+	"httpTimeout":                                 "timeout of each outbound HTTP request",
+	"http":                                        "outbound HTTP client settings shared by all requests",
+	"http.maxIdleConns":                           "idle connections kept open across all hosts",
+	"http.maxIdleConnsPerHost":                    "idle connections kept open per host",
+	"http.idleConnTimeout":                        "how long an idle connection is kept open",
+	"http.disableKeepAlives":                      "open a new connection for every request",
+	"http.disableHttp2":                           "only speak HTTP/1.1",
+	"http.disableCompression":                     "do not ask for gzip-compressed responses",
+	"http.maxResponseSize":                        "largest response body read, in bytes",
+	"http.dnsCacheTtl":                            "how long resolved addresses are cached; 0 resolves every connection",
+	"http.dnsServer":                              "DNS server (host:port) used instead of the system resolver",
+	"http.ipFamily":                               "ipv4, ipv6 or empty for both",
+	"http.hosts":                                  "per-host dnsServer and ipFamily overrides",
+	"http.hosts.<name>":                           "resolver settings of this host",
+	"http.hosts.<name>.dnsServer":                 "DNS server (host:port) for this host, overriding http.dnsServer",
+	"http.hosts.<name>.ipFamily":                  "ipv4 or ipv6 for this host, overriding http.ipFamily",
+	"http.userAgent":                              "User-Agent of outbound requests, subgraph-monitor/<version> by default",
+	"http.headers":                                "headers added to every outbound request that does not set them",
+	"http.headers.<name>":                         "value of the header",
+	"ipfsUrl":                                     "IPFS gateway used to read subgraph manifests",
+	"server":                                      "HTTP API, metrics and webhook receiver",
+	"server.listen":                               "address of the HTTP API and metrics, e.g. :8080",
+	"server.basePath":                             "path prefix of all API routes when served behind a proxy",
+	"server.trustedProxies":                       "proxy addresses whose X-Forwarded-For is trusted",
+	"server.trustedProxies[]":                     "proxy IP address or CIDR",
+	"server.cors":                                 "cross-origin access to the API from browsers",
+	"server.cors.allowedOrigins":                  "origins allowed to call the API from a browser",
+	"server.cors.allowedOrigins[]":                "origin, e.g. https://dashboard.example.com, or * for any",
+	"server.cors.allowCredentials":                "let browsers send credentials with cross-origin requests",
+	"server.auth":                                 "API credentials; without any, the API is open",
+	"server.auth.users":                           "basic auth users with their scopes and tenant",
+	"server.auth.users[].username":                "basic auth user name",
+	"server.auth.users[].password":                "basic auth password",
+	"server.auth.users[].scopes":                  "scopes granted to the user; read when empty",
+	"server.auth.users[].scopes[]":                "read, write or heads",
+	"server.auth.users[].tenant":                  "tenant the user is limited to",
+	"server.auth.tokens":                          "bearer tokens with their scopes and tenant",
+	"server.auth.tokens[].name":                   "name of the token in logs and the audit log",
+	"server.auth.tokens[].token":                  "bearer token value",
+	"server.auth.tokens[].scopes":                 "scopes granted to the token; read when empty",
+	"server.auth.tokens[].scopes[]":               "read, write or heads",
+	"server.auth.tokens[].tenant":                 "tenant the token is limited to",
+	"server.auth.tokensFile":                      "file of bearer tokens, reloaded when it changes",
+	"server.auth.oidc":                            "accept OIDC JWTs from this issuer",
+	"server.auth.oidc.issuer":                     "issuer (iss) JWTs must carry",
+	"server.auth.oidc.audience":                   "audience (aud) JWTs must carry",
+	"server.auth.oidc.jwksUrl":                    "JWKS endpoint the signing keys are read from",
+	"server.auth.oidc.scopes":                     "scopes granted to OIDC users",
+	"server.auth.oidc.scopes[]":                   "read, write or heads",
+	"server.auth.oidc.tenantClaim":                "JWT claim naming the user's tenant; tokens without it are rejected",
+	"server.auth.webhooks":                        "shared secrets for HMAC-signed webhook requests",
+	"server.auth.webhooks[].name":                 "name of the sender in logs and the audit log",
+	"server.auth.webhooks[].secret":               "HMAC key the sender signs requests with",
+	"server.auth.webhooks[].scopes":               "scopes granted to signed requests; read when empty",
+	"server.auth.webhooks[].scopes[]":             "read, write or heads",
+	"server.auth.webhooks[].tenant":               "tenant signed requests are limited to",
+	"server.accessLog":                            "API request logging",
+	"server.accessLog.enabled":                    "log one JSON line per API request",
+	"server.accessLog.path":                       "append the access log to this file instead of stderr",
+	"thresholds":                                  "default lag thresholds and error tolerance of subgraphs",
+	"thresholds.warnBlocksBehind":                 "blocks behind the chain head for WARN",
+	"thresholds.critBlocksBehind":                 "blocks behind the chain head for CRIT",
+	"thresholds.errorTolerance":                   "consecutive failed checks before a subgraph is ERROR",
+	"tiers":                                       "named checkInterval and thresholds that subgraphs select with priority",
+	"tiers.<name>":                                "settings of subgraphs with this priority",
+	"tiers.<name>.checkInterval":                  "check interval of the tier's subgraphs",
+	"tiers.<name>.warnBlocksBehind":               "blocks behind the chain head for WARN in this tier",
+	"tiers.<name>.critBlocksBehind":               "blocks behind the chain head for CRIT in this tier",
+	"tiers.<name>.errorTolerance":                 "consecutive failed checks before a subgraph of this tier is ERROR",
+	"storage":                                     "where monitor state is kept",
+	"storage.type":                                "state backend: memory",
+	"shard":                                       "only monitor the subgraphs of shard <index>/<total>, e.g. 2/4",
+	"history":                                     "sample history behind speeds, ETAs, SLOs and reports",
+	"history.retention":                           "how long speed and ETA samples are kept",
+	"history.path":                                "JSON lines file persisting samples across restarts",
+	"history.maxSamples":                          "cap on samples kept per subgraph",
+	"history.downsample":                          "coarser resolutions kept for samples older than retention",
+	"history.downsample[].step":                   "resolution samples are merged to",
+	"history.downsample[].retention":              "how long samples at this resolution are kept",
+	"eventLog":                                    "log of state transitions",
+	"eventLog.retention":                          "how long transitions are kept in the event log",
+	"eventLog.path":                               "JSON lines file persisting the event log",
+	"audit":                                       "log of changes made through the API",
+	"audit.retention":                             "how long audit entries are kept",
+	"audit.path":                                  "JSON lines file persisting the audit log",
+	"slackBot":                                    "interactive Slack bot",
+	"slackBot.appToken":                           "Slack app-level token (xapp-...) for Socket Mode",
+	"slackBot.botToken":                           "Slack bot token (xoxb-...) to post alerts",
+	"slackBot.channel":                            "channel alerts are posted to",
+	"slackBot.ackDuration":                        "how long acknowledging an alert silences the subgraph",
+	"slackBot.apiUrl":                             "Slack Web API base URL",
+	"slackBot.users":                              "Slack user IDs allowed to use the commands and buttons",
+	"slackBot.users[].id":                         "Slack user ID, e.g. U012AB3CD",
+	"slackBot.users[].tenant":                     "tenant the user is limited to",
+	"slackBot.channels":                           "Slack channel IDs in which everyone may use the commands and buttons",
+	"slackBot.channels[].id":                      "Slack channel ID, e.g. C012AB3CD",
+	"slackBot.channels[].tenant":                  "tenant the channel is limited to",
+	"health":                                      "health score settings",
+	"health.weights":                              "weight of each component of the health score",
+	"health.weights.lag":                          "weight of the lag behind the chain head",
+	"health.weights.trend":                        "weight of whether the lag is shrinking",
+	"health.weights.errorRate":                    "weight of the share of failed checks",
+	"health.weights.indexingErrors":               "weight of indexing errors",
+	"health.weights.latency":                      "weight of the query latency",
+	"health.maxLatency":                           "query latency scored as 0",
+	"chains":                                      "chains by key, referenced by subgraphs[].chain",
+	"chains.<name>":                               "a chain, keyed as referenced by subgraphs[].chain",
+	"chains.<name>.name":                          "display name",
+	"chains.<name>.rpcUrl":                        "JSON-RPC endpoint read for the chain head",
+	"chains.<name>.explorerUrl":                   "block explorer API used when the RPC fails",
+	"chains.<name>.explorerApiKey":                "API key of the block explorer",
+	"chains.<name>.pushMaxAge":                    "how long a pushed head is used before polling RPC again",
+	"chains.<name>.blockTimeSampleInterval":       "how often the average block time is measured",
+	"chains.<name>.haltAfter":                     "report the chain halted when its head block is this old",
+	"chains.<name>.headPolicy":                    "latest, safe or finalized head to measure lag against",
+	"subgraphs":                                   "subgraphs to monitor",
+	"subgraphs[].chain":                           "key of the subgraph's chain in chains",
+	"subgraphs[].name":                            "unique name used in alerts, the API and metrics",
+	"subgraphs[].url":                             "GraphQL query endpoint",
+	"subgraphs[].startBlock":                      "first indexed block, for progress",
+	"subgraphs[].maxHistoryEntries":               "checks sync speed and ETA are computed from",
+	"subgraphs[].priority":                        "tier the subgraph takes its interval and thresholds from",
+	"subgraphs[].checkInterval":                   "check interval of this subgraph",
+	"subgraphs[].ipfsUrl":                         "IPFS gateway for this subgraph's manifest",
+	"subgraphs[].indexNodeUrl":                    "graph-node index-node endpoint for indexing status",
+	"subgraphs[].tenant":                          "tenant owning the subgraph",
+	"subgraphs[].progressBaseline":                "block counted as 0% progress for this subgraph",
+	"subgraphs[].responseSchema":                  "how strictly this subgraph's _meta responses are read",
+	"subgraphs[].graphqlRequest":                  "how this subgraph's _meta query is sent",
+	"subgraphs[].replicas":                        "other endpoints serving the same subgraph",
+	"subgraphs[].replicas[]":                      "GraphQL query endpoint of a replica",
+	"subgraphs[].compareInterval":                 "how often replicas are compared",
+	"subgraphs[].remediation":                     "hook run when the subgraph stalls",
+	"subgraphs[].remediation.type":                "http, command or kubernetes",
+	"subgraphs[].remediation.url":                 "endpoint an http hook posts the stalled subgraph to",
+	"subgraphs[].remediation.method":              "HTTP method of an http hook, POST by default",
+	"subgraphs[].remediation.headers":             "headers of an http hook's request",
+	"subgraphs[].remediation.headers.<name>":      "value of the header",
+	"subgraphs[].remediation.command":             "program and arguments a command hook runs",
+	"subgraphs[].remediation.command[]":           "program or argument",
+	"subgraphs[].remediation.kind":                "deployment or statefulset restarted by a kubernetes hook",
+	"subgraphs[].remediation.target":              "[namespace/]name restarted by a kubernetes hook",
+	"subgraphs[].heavyRanges":                     "block ranges that index slower, for the ETA",
+	"subgraphs[].heavyRanges[].from":              "first block of the range",
+	"subgraphs[].heavyRanges[].to":                "last block of the range",
+	"subgraphs[].heavyRanges[].weight":            "how many times as long a block in the range takes to index",
+	"subgraphs[].minSyncSpeed":                    "slowest expected catch-up speed in blocks per minute, or auto",
+	"subgraphs[].slowSyncFor":                     "how long below minSyncSpeed before alerting",
+	"subgraphs[].dependsOn":                       "upstream subgraphs or chains whose alerts inhibit this one's",
+	"subgraphs[].dependsOn[]":                     "chain, node:<name> or firehose:<name>",
+	"subgraphs[].severity":                        "severity predicates replacing the thresholds",
+	"subgraphs[].severity.warn":                   "template predicate for WARN of this subgraph",
+	"subgraphs[].severity.crit":                   "template predicate for CRIT of this subgraph",
+	"subgraphs[].availability":                    "query availability thresholds of this subgraph",
+	"subgraphs[].availability.window":             "checks this subgraph's availability is computed over",
+	"subgraphs[].availability.warnBelow":          "availability ratio below which this subgraph is WARN",
+	"subgraphs[].availability.critBelow":          "availability ratio below which this subgraph is CRIT",
+	"subgraphs[].warnBlocksBehind":                "blocks behind the chain head for WARN of this subgraph",
+	"subgraphs[].critBlocksBehind":                "blocks behind the chain head for CRIT of this subgraph",
+	"subgraphs[].errorTolerance":                  "consecutive failed checks before this subgraph is ERROR",
+	"firehose":                                    "Firehose endpoints monitored like subgraphs",
+	"firehose[].name":                             "unique name used in alerts, the API and metrics",
+	"firehose[].url":                              "gRPC endpoint, host:port",
+	"firehose[].chain":                            "key of the endpoint's chain in chains",
+	"firehose[].headers":                          "gRPC metadata sent with every call, e.g. an API key",
+	"firehose[].headers.<name>":                   "value of the metadata entry",
+	"firehose[].warnBlocksBehind":                 "blocks behind the chain head for WARN of this endpoint",
+	"firehose[].critBlocksBehind":                 "blocks behind the chain head for CRIT of this endpoint",
+	"firehose[].errorTolerance":                   "consecutive failed checks before this endpoint is ERROR",
+	"notifiers":                                   "where transitions are sent",
+	"notifiers[].name":                            "name of the notifier in logs",
+	"notifiers[].type":                            "webhook, slack or siem",
+	"notifiers[].url":                             "endpoint transitions are posted to",
+	"notifiers[].headers":                         "headers of the notifier's requests",
+	"notifiers[].headers.<name>":                  "value of the header",
+	"notifiers[].secret":                          "key signing webhook bodies",
+	"notifiers[].format":                          "siem event format: json or cef",
+	"notifiers[].path":                            "siem file events are appended to instead of url",
+	"tenants":                                     "notifiers per tenant",
+	"tenants.<name>":                              "a tenant, keyed as referenced by subgraphs[].tenant",
+	"tenants.<name>.notifiers":                    "where the tenant's transitions are sent",
+	"tenants.<name>.notifiers[].name":             "name of the notifier in logs",
+	"tenants.<name>.notifiers[].type":             "webhook, slack or siem",
+	"tenants.<name>.notifiers[].url":              "endpoint transitions are posted to",
+	"tenants.<name>.notifiers[].headers":          "headers of the notifier's requests",
+	"tenants.<name>.notifiers[].headers.<name>":   "value of the header",
+	"tenants.<name>.notifiers[].secret":           "key signing webhook bodies",
+	"tenants.<name>.notifiers[].format":           "siem event format: json or cef",
+	"tenants.<name>.notifiers[].path":             "siem file events are appended to instead of url",
+	"updateCheck":                                 "checks for new releases",
+	"updateCheck.enabled":                         "check for new releases",
+	"updateCheck.url":                             "endpoint returning the latest release as {\"tag_name\": ...}",
+	"updateCheck.interval":                        "how often to check for new releases",
+	"slo":                                         "sync SLO and error budget of every subgraph",
+	"slo.target":                                  "share of time a subgraph should be in sync",
+	"slo.window":                                  "window the SLO is measured over",
+	"availability":                                "default query availability thresholds",
+	"availability.window":                         "checks the availability ratio is computed over",
+	"availability.warnBelow":                      "availability ratio below which it is WARN",
+	"availability.critBelow":                      "availability ratio below which it is CRIT",
+	"export":                                      "history exports",
+	"export.parquet":                              "periodic Parquet export of the history",
+	"export.parquet.path":                         "directory or s3:// URL Parquet files are written to",
+	"export.parquet.interval":                     "how often history is exported",
+	"export.parquet.s3":                           "S3 credentials when path is an s3:// URL",
+	"export.parquet.s3.region":                    "S3 region, $AWS_REGION by default",
+	"export.parquet.s3.endpoint":                  "S3-compatible endpoint instead of AWS",
+	"export.parquet.s3.accessKeyId":               "S3 access key, $AWS_ACCESS_KEY_ID by default",
+	"export.parquet.s3.secretAccessKey":           "S3 secret key, $AWS_SECRET_ACCESS_KEY by default",
+	"export.parquet.s3.sessionToken":              "S3 session token, $AWS_SESSION_TOKEN by default",
+	"remediation":                                 "automatic remediation of stalled subgraphs",
+	"remediation.stalledAfter":                    "how long without progress before remediating",
+	"remediation.cooldown":                        "minimum time between remediations of a subgraph",
+	"remediation.maxPerHour":                      "cap on hook calls per hour across subgraphs",
+	"remediation.timeout":                         "how long a hook may run",
+	"remediation.dryRun":                          "log remediations without running them",
+	"remediation.hook":                            "hook run for stalled subgraphs without their own",
+	"remediation.hook.type":                       "http, command or kubernetes",
+	"remediation.hook.url":                        "endpoint an http hook posts the stalled subgraph to",
+	"remediation.hook.method":                     "HTTP method of an http hook, POST by default",
+	"remediation.hook.headers":                    "headers of an http hook's request",
+	"remediation.hook.headers.<name>":             "value of the header",
+	"remediation.hook.command":                    "program and arguments a command hook runs",
+	"remediation.hook.command[]":                  "program or argument",
+	"remediation.hook.kind":                       "deployment or statefulset restarted by a kubernetes hook",
+	"remediation.hook.target":                     "[namespace/]name restarted by a kubernetes hook",
+	"cluster":                                     "graph-node cluster management",
+	"cluster.adminUrl":                            "graph-node admin JSON-RPC endpoint",
+	"cluster.autoReassign":                        "move subgraphs off failing index nodes",
+	"cluster.reassignInterval":                    "how often subgraphs on failing index nodes are reassigned",
+	"eta":                                         "ETA estimation",
+	"eta.learnRanges":                             "learn heavy ranges from the sample history",
+	"eta.rangeBlocks":                             "block range size used to learn heavy ranges",
+	"indexNode":                                   "index-node status queries",
+	"indexNode.batch":                             "read all indexing statuses with one index-node query",
+	"indexNode.metaInterval":                      "how often _meta is still queried when batching",
+	"certificates":                                "TLS certificate expiry warnings",
+	"certificates.warnBefore":                     "warn this long before a TLS certificate expires",
+	"simulation":                                  "fake chains and subgraphs for the simulate command",
+	"simulation.chains":                           "simulated chains by key in chains",
+	"simulation.chains.<name>":                    "a simulated chain",
+	"simulation.chains.<name>.blockTime":          "time between simulated blocks",
+	"simulation.chains.<name>.startBlock":         "head block when the simulation starts",
+	"simulation.chains.<name>.outages":            "periods the RPC endpoint fails",
+	"simulation.chains.<name>.outages[].after":    "start of the period from the start of the simulation",
+	"simulation.chains.<name>.outages[].for":      "length of the period",
+	"simulation.chains.<name>.outages[].every":    "repeat the period this often",
+	"simulation.chains.<name>.halts":              "periods no blocks are produced",
+	"simulation.chains.<name>.halts[].after":      "start of the period from the start of the simulation",
+	"simulation.chains.<name>.halts[].for":        "length of the period",
+	"simulation.chains.<name>.halts[].every":      "repeat the period this often",
+	"simulation.chains.<name>.reorgEvery":         "how often the head drops reorgDepth blocks",
+	"simulation.chains.<name>.reorgDepth":         "blocks dropped by each reorg",
+	"simulation.subgraphs":                        "simulated subgraphs by name",
+	"simulation.subgraphs.<name>":                 "a simulated subgraph",
+	"simulation.subgraphs.<name>.behind":          "blocks behind the head the subgraph starts",
+	"simulation.subgraphs.<name>.speed":           "blocks indexed per minute; 0 keeps pace with the chain",
+	"simulation.subgraphs.<name>.outages":         "periods the endpoint fails",
+	"simulation.subgraphs.<name>.outages[].after": "start of the period from the start of the simulation",
+	"simulation.subgraphs.<name>.outages[].for":   "length of the period",
+	"simulation.subgraphs.<name>.outages[].every": "repeat the period this often",
+	"simulation.subgraphs.<name>.stalls":          "periods the subgraph stops indexing",
+	"simulation.subgraphs.<name>.stalls[].after":  "start of the period from the start of the simulation",
+	"simulation.subgraphs.<name>.stalls[].for":    "length of the period",
+	"simulation.subgraphs.<name>.stalls[].every":  "repeat the period this often",
+	"progressBaseline":                            "block counted as 0% progress: startBlock, genesis or firstSeen",
+	"responseSchema":                              "how strictly _meta responses are read: default, strict or lenient",
+	"graphqlRequest":                              "how the _meta query is sent: post, get, apq or apq-post",
+	"locale":                                      "language of reports and Slack bot messages: en, es or zh",
+	"severity":                                    "default severity predicates replacing the block thresholds",
+	"severity.warn":                               "template predicate for WARN, replacing warnBlocksBehind",
+	"severity.crit":                               "template predicate for CRIT, replacing critBlocksBehind",
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// Config warnings are problems that do not stop the monitor but leave part
+// of the config without effect. They are shown after every cycle, exported
+// as metrics and served by /api/v1/warnings until the config is fixed.
+const (
+	// ConfigWarningUnusedChain is a chain no subgraph or Firehose endpoint
+	// uses, so it is never checked.
+	ConfigWarningUnusedChain = "unused_chain"
+	// ConfigWarningMissingChain is a subgraph on a chain that is not
+	// configured, so it is never checked.
+	ConfigWarningMissingChain = "missing_chain"
+)
+
+type ConfigWarning struct {
+	Kind     string `json:"kind"`
+	Chain    string `json:"chain"`
+	Subgraph string `json:"subgraph,omitempty"`
+	Tenant   string `json:"tenant,omitempty"`
+	Message  string `json:"message"`
+}
+
+// configWarnings checks the chains against the subgraphs and Firehose
+// endpoints. A shard leaves unused chains to the shards using them. Must be
+// called with mu held.
+func (m *Monitor) configWarnings() []ConfigWarning {
+	warnings := []ConfigWarning{}
+	used := make(map[string]bool)
+	for _, sg := range m.subgraphs {
+		used[sg.Chain] = true
+		if _, ok := m.chains[sg.Chain]; !ok {
+			warnings = append(warnings, ConfigWarning{
+				Kind:     ConfigWarningMissingChain,
+				Chain:    sg.Chain,
+				Subgraph: sg.Name,
+				Tenant:   sg.Tenant,
+				Message:  fmt.Sprintf("subgraph %s is on chain %q, which is not configured; it is not checked", sg.Name, sg.Chain),
+			})
+		}
+	}
+	for _, fh := range m.firehose {
+		used[fh.Chain] = true
+	}
+	if m.shard.Total <= 1 {
+		for name := range m.chains {
+			if !used[name] {
+				warnings = append(warnings, ConfigWarning{
+					Kind:    ConfigWarningUnusedChain,
+					Chain:   name,
+					Message: fmt.Sprintf("chain %s has no subgraphs or firehose endpoints; it is not checked", name),
+				})
+			}
+		}
+	}
+	sort.Slice(warnings, func(i, j int) bool {
+		a, b := warnings[i], warnings[j]
+		if a.Chain != b.Chain {
+			return a.Chain < b.Chain
+		}
+		return a.Subgraph < b.Subgraph
+	})
+	return warnings
+}
+
+// visibleWarnings filters warnings to a tenant's subgraphs, leaving out
+// unused chains, when view is set.
+func visibleWarnings(warnings []ConfigWarning, view string) []ConfigWarning {
+	visible := []ConfigWarning{}
+	for _, cw := range warnings {
+		if view == "" || cw.Subgraph != "" && cw.Tenant == view {
+			visible = append(visible, cw)
+		}
+	}
+	return visible
+}
+
+func (m *Monitor) handleWarnings(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, visibleWarnings(m.Snapshot().Warnings, viewTenant(r)))
+}
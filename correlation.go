@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// requestIDHeader carries the check ID on outbound requests so gateway and
+// graph-node logs can be matched with the monitor's own.
+const requestIDHeader = "X-Request-ID"
+
+func newCycleID() string {
+	var b [6]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// newCheckID derives the ID of the n-th check of a cycle, so every check ID
+// also identifies its cycle.
+func newCheckID(cycleID string, n int) string {
+	return fmt.Sprintf("%s-%d", cycleID, n)
+}
+
+func logCheck(sg *SubgraphInfo, format string, args ...interface{}) {
+	log.Printf("[%s] "+format, append([]interface{}{sg.CheckID}, args...)...)
+}
+
+func post(url, contentType string, body []byte, requestID string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if requestID != "" {
+		req.Header.Set(requestIDHeader, requestID)
+	}
+	return httpClient().Do(req)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	minDebugInterval = time.Second
+	maxDebugDuration = time.Hour
+)
+
+// runDebug implements "debug": a verbose check loop for a single subgraph
+// that logs every request and response with a timing breakdown. It runs
+// independently of any monitor and stops after -duration.
+func runDebug(args []string) error {
+	fs := flag.NewFlagSet("debug", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	kubeConfigMap := fs.String("k8s-configmap", "", "load config from a ConfigMap ([namespace/]name)")
+	kubeSecret := fs.String("k8s-secret", "", "load config from a Secret ([namespace/]name)")
+	kubeKey := fs.String("k8s-key", defaultKubeDataKey, "ConfigMap/Secret data key holding the config")
+	interval := fs.Duration("interval", 2*time.Second, "time between checks (at least 1s)")
+	duration := fs.Duration("duration", 5*time.Minute, "how long to run (at most 1h)")
+	bodyLimit := fs.Int("body-limit", 4096, "bytes of each response body to print")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s debug [flags] <subgraph>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *interval < minDebugInterval {
+		return fmt.Errorf("-interval must be at least %s", minDebugInterval)
+	}
+	if *duration <= 0 || *duration > maxDebugDuration {
+		return fmt.Errorf("-duration must be positive and at most %s", maxDebugDuration)
+	}
+
+	cfg, _, err := loadConfig(*configPath, *kubeConfigMap, *kubeSecret, *kubeKey)
+	if err != nil {
+		return err
+	}
+	applyHTTPConfig(cfg)
+	var sg *SubgraphInfo
+	for _, s := range cfg.Subgraphs {
+		if s.Name == fs.Arg(0) {
+			sg = s
+		}
+	}
+	if sg == nil {
+		return fmt.Errorf("no subgraph named %q", fs.Arg(0))
+	}
+	chain := cfg.Chains[sg.Chain]
+
+	cycleID := newCycleID()
+	fmt.Printf("Debugging %s every %s for %s (debug session %s)\n", sg.Name, *interval, *duration, cycleID)
+	deadline := time.Now().Add(*duration)
+	for n := 1; ; n++ {
+		checkID := newCheckID(cycleID, n)
+		fmt.Printf("\n=== Check %s at %s ===\n", checkID, time.Now().Format("15:04:05.000"))
+
+		var head int64
+		if chain != nil {
+			rpcBody, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "method": "eth_blockNumber", "params": []string{}, "id": 1})
+			if body, err := debugPost("chain "+sg.Chain, chain.RpcURL, rpcBody, checkID, *bodyLimit); err == nil {
+				var r struct {
+					Result string `json:"result"`
+				}
+				if json.Unmarshal(body, &r) == nil {
+					if head, err = parseHexQuantity("block number", r.Result); err != nil {
+						fmt.Printf("--> %v\n", err)
+					}
+				}
+			}
+		}
+
+		var block int64
+		if body, err := debugGraphQL(sg, checkID, *bodyLimit); err == nil {
+			meta, err := parseMetaResponse(body, sg.ResponseSchema)
+			if err != nil {
+				fmt.Printf("--> %v\n", err)
+			}
+			block = meta.Block
+		}
+		switch {
+		case block > 0 && head > 0:
+			fmt.Printf("--> block %d, chain head %d, %d blocks behind\n", block, head, head-block)
+		case block > 0:
+			fmt.Printf("--> block %d, chain head unknown\n", block)
+		default:
+			fmt.Println("--> no block in the subgraph response")
+		}
+
+		if time.Now().Add(*interval).After(deadline) {
+			fmt.Printf("\nDebug session %s finished after %d checks\n", cycleID, n)
+			return nil
+		}
+		time.Sleep(*interval)
+	}
+}
+
+// debugPost POSTs body to url with debugRequest.
+func debugPost(label, url string, body []byte, requestID string, bodyLimit int) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		fmt.Printf("[%s] invalid request: %v\n", label, err)
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(requestIDHeader, requestID)
+	return debugRequest(label, req, body, bodyLimit)
+}
+
+// debugGraphQL sends the _meta query the way the subgraph's graphqlRequest
+// asks with debugRequest, an APQ hash first and the query only if the
+// gateway does not know it.
+func debugGraphQL(sg *SubgraphInfo, requestID string, bodyLimit int) ([]byte, error) {
+	var q map[string]string
+	json.Unmarshal([]byte(query), &q)
+	for _, hashOnly := range []bool{true, false} {
+		if hashOnly && !persistedQueries(sg.GraphQLRequest) {
+			continue
+		}
+		req, err := newGraphQLRequest(sg.URL, q["query"], sg.GraphQLRequest, hashOnly, requestID)
+		if err != nil {
+			fmt.Printf("[subgraph] invalid request: %v\n", err)
+			return nil, err
+		}
+		var body []byte
+		if req.GetBody != nil {
+			r, _ := req.GetBody()
+			body, _ = io.ReadAll(r)
+		}
+		respBody, err := debugRequest("subgraph", req, body, bodyLimit)
+		if !hashOnly || err != nil || !persistedQueryNotFound(respBody) {
+			return respBody, err
+		}
+		fmt.Println("[subgraph] persisted query not found, sending the query")
+	}
+	return nil, nil
+}
+
+// debugRequest sends req, printing the request with its body, the response
+// and where the time went. It returns the response body.
+func debugRequest(label string, req *http.Request, body []byte, bodyLimit int) ([]byte, error) {
+	var t debugTimings
+	start := time.Now()
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), t.trace(start)))
+
+	fmt.Printf("[%s] > %s %s\n", label, req.Method, req.URL)
+	printHeaders("[%s] > ", label, req.Header)
+	if len(body) > 0 {
+		fmt.Printf("[%s] > %s\n", label, body)
+	}
+
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		fmt.Printf("[%s] ! %v after %s\n", label, err, time.Since(start).Round(time.Microsecond))
+		fmt.Printf("[%s]   %s\n", label, t)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := readBody(resp)
+	total := time.Since(start)
+
+	fmt.Printf("[%s] < %s %s\n", label, resp.Proto, resp.Status)
+	printHeaders("[%s] < ", label, resp.Header)
+	if err != nil {
+		fmt.Printf("[%s] ! read body: %v\n", label, err)
+		return nil, err
+	}
+	shown := respBody
+	if len(shown) > bodyLimit {
+		shown = shown[:bodyLimit]
+	}
+	fmt.Printf("[%s] < %s", label, shown)
+	if len(shown) < len(respBody) {
+		fmt.Printf("... (%d more bytes)", len(respBody)-len(shown))
+	}
+	fmt.Println()
+	t.total = total
+	fmt.Printf("[%s]   %s\n", label, t)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return respBody, nil
+}
+
+func printHeaders(format, label string, h http.Header) {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf(format+"%s: %s\n", label, name, strings.Join(h[name], ", "))
+	}
+}
+
+// debugTimings collects a request's phases from httptrace. DNS is only
+// reported when the standard resolver is used, not for http.hosts overrides
+// or http.dnsServer.
+type debugTimings struct {
+	dns, connect, tls, firstByte, total time.Duration
+	dnsStart, connectStart, tlsStart    time.Time
+	reused                              bool
+}
+
+func (t *debugTimings) trace(start time.Time) *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { t.dnsStart = time.Now() },
+		DNSDone:           func(httptrace.DNSDoneInfo) { t.dns = time.Since(t.dnsStart) },
+		ConnectStart:      func(string, string) { t.connectStart = time.Now() },
+		ConnectDone:       func(string, string, error) { t.connect = time.Since(t.connectStart) },
+		TLSHandshakeStart: func() { t.tlsStart = time.Now() },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { t.tls = time.Since(t.tlsStart) },
+		GotConn:           func(info httptrace.GotConnInfo) { t.reused = info.Reused },
+		GotFirstResponseByte: func() {
+			t.firstByte = time.Since(start)
+		},
+	}
+}
+
+func (t debugTimings) String() string {
+	conn := "new connection"
+	if t.reused {
+		conn = "reused connection"
+	}
+	r := func(d time.Duration) string { return d.Round(time.Microsecond).String() }
+	return fmt.Sprintf("timing: dns %s, connect %s, tls %s, first byte %s, total %s (%s)",
+		r(t.dns), r(t.connect), r(t.tls), r(t.firstByte), r(t.total), conn)
+}
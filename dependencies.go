@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TransitionUpstream marks transitions of an upstream named in a
+// subgraph's dependsOn going down (To ERROR or the Firehose endpoint's
+// status) or recovering. Endpoint names the upstream.
+const TransitionUpstream = "upstream"
+
+// upstreamNodeMinFailing is how many of a graph-node's subgraphs must fail,
+// besides at least half of them, for the node to count as down.
+const upstreamNodeMinFailing = 2
+
+type upstreamState struct {
+	status  Status
+	chain   string
+	trigger string
+}
+
+func validateDependsOn(c *Config, sg *SubgraphInfo) error {
+	for _, dep := range sg.DependsOn {
+		kind, name, _ := strings.Cut(dep, ":")
+		switch {
+		case dep == "chain":
+		case kind == "node" && name != "":
+		case kind == "firehose" && name != "":
+			if findFirehose(c.Firehose, name) == nil {
+				return fmt.Errorf("dependsOn: unknown firehose endpoint %q", name)
+			}
+		default:
+			return fmt.Errorf("dependsOn: %q must be \"chain\", \"node:<name>\" or \"firehose:<name>\"", dep)
+		}
+	}
+	return nil
+}
+
+func findFirehose(endpoints []*FirehoseInfo, name string) *FirehoseInfo {
+	for _, fh := range endpoints {
+		if fh.Name == name {
+			return fh
+		}
+	}
+	return nil
+}
+
+// upstreamName names a dependsOn entry of sg, resolving "chain" to its
+// chain.
+func upstreamName(sg *SubgraphInfo, dep string) string {
+	if dep == "chain" {
+		return "chain:" + sg.Chain
+	}
+	return dep
+}
+
+// upstreamStates evaluates every upstream named in a dependsOn list: a
+// chain is down while its head is stale because the RPC endpoint and its
+// fallbacks fail, a Firehose endpoint while it is ERROR or CRIT, and a
+// graph-node while most of the subgraphs depending on it fail their checks.
+// A sharded monitor also evaluates the chain and Firehose upstreams it owns
+// that only other shards' subgraphs depend on. Must be called with mu held.
+func (m *Monitor) upstreamStates() map[string]upstreamState {
+	states := make(map[string]upstreamState)
+	nodeTotal := make(map[string]int)
+	nodeFailing := make(map[string]int)
+	for _, sg := range m.subgraphs {
+		for _, dep := range sg.DependsOn {
+			up := upstreamName(sg, dep)
+			if kind, _, _ := strings.Cut(up, ":"); kind != "node" {
+				m.upstreamState(states, up)
+				continue
+			}
+			if sg.CheckedAt.IsZero() {
+				continue
+			}
+			nodeTotal[up]++
+			if sg.LastError != "" {
+				nodeFailing[up]++
+			}
+		}
+	}
+	for _, up := range m.cfg.upstreams {
+		if m.ownsUpstream(up) {
+			m.upstreamState(states, up)
+		}
+	}
+	for up, total := range nodeTotal {
+		failing := nodeFailing[up]
+		status := StatusOK
+		if failing >= upstreamNodeMinFailing && failing*2 >= total {
+			status = StatusError
+		}
+		states[up] = upstreamState{status: status, trigger: fmt.Sprintf("%d of %d dependent subgraphs failing", failing, total)}
+	}
+	return states
+}
+
+// upstreamState evaluates the chain or Firehose upstream up into states,
+// leaving it out until it has been checked.
+func (m *Monitor) upstreamState(states map[string]upstreamState, up string) {
+	kind, name, _ := strings.Cut(up, ":")
+	switch kind {
+	case "chain":
+		chain := m.chains[name]
+		if chain == nil || chain.LatestBlock == 0 {
+			return
+		}
+		if chain.HeadSource == HeadSourceStale {
+			states[up] = upstreamState{status: StatusError, chain: name, trigger: fmt.Sprintf("chain head stuck at %d, every head source failing", chain.LatestBlock)}
+		} else {
+			states[up] = upstreamState{status: StatusOK, chain: name, trigger: "chain head from " + chain.HeadSource}
+		}
+	case "firehose":
+		fh := findFirehose(m.firehose, name)
+		if fh == nil || fh.CheckedAt.IsZero() {
+			return
+		}
+		trigger := fmt.Sprintf("%d blocks behind", fh.BlocksBehind)
+		if fh.LastError != "" {
+			trigger = fh.LastError
+		}
+		status := fh.Status
+		if status != StatusError && status != StatusCrit {
+			status = StatusOK
+		}
+		states[up] = upstreamState{status: status, chain: fh.Chain, trigger: trigger}
+	}
+}
+
+// ownsUpstream reports whether this shard reports the upstream's
+// transitions. A graph-node is reported by each shard for its own
+// subgraphs, as the shards see different subgraphs of it.
+func (m *Monitor) ownsUpstream(up string) bool {
+	kind, name, _ := strings.Cut(up, ":")
+	switch kind {
+	case "chain":
+		return m.shard.ownsChain(name)
+	case "firehose":
+		return m.shard.owns(name)
+	}
+	return true
+}
+
+// checkUpstreams re-evaluates the upstreams and returns a transition for
+// each one whose status changed since the previous cycle. Upstreams first
+// seen up are not reported. Must be called with mu held.
+func (m *Monitor) checkUpstreams(cycleID string, now time.Time) []StateTransition {
+	states := m.upstreamStates()
+	names := make([]string, 0, len(states))
+	for up := range states {
+		names = append(names, up)
+	}
+	sort.Strings(names)
+
+	var transitions []StateTransition
+	seen := make(map[string]Status, len(states))
+	for _, up := range names {
+		s := states[up]
+		seen[up] = s.status
+		prev, ok := m.upstreams[up]
+		if !ok {
+			prev = StatusOK
+		}
+		if prev == s.status || !m.ownsUpstream(up) {
+			continue
+		}
+		transitions = append(transitions, StateTransition{
+			Kind:     TransitionUpstream,
+			Time:     now,
+			CycleID:  cycleID,
+			CheckID:  cycleID,
+			Chain:    s.chain,
+			Endpoint: up,
+			From:     prev,
+			To:       s.status,
+			Trigger:  s.trigger,
+			Context:  SubgraphStatus{Chain: s.chain, Status: s.status, CheckedAt: now},
+		})
+	}
+	m.upstreams = seen
+	return transitions
+}
+
+// downUpstream returns the first upstream of sg that is down, or "".
+func (m *Monitor) downUpstream(sg *SubgraphInfo) string {
+	for _, dep := range sg.DependsOn {
+		up := upstreamName(sg, dep)
+		if s, ok := m.upstreams[up]; ok && s != StatusOK {
+			return up
+		}
+	}
+	return ""
+}
+
+// inhibit marks the transitions of a subgraph's check as inhibited while
+// one of its upstreams is down, so the upstream pages once instead of every
+// subgraph behind it. The check after the upstream recovers inhibits the
+// subgraph's return to the status notified before the outage; a subgraph
+// in another status then gets a status transition from that one, as the
+// change was never notified. Must be called with mu held, after
+// checkUpstreams.
+func (m *Monitor) inhibit(sg *SubgraphInfo, before Status, transitions []StateTransition, cycleID string) []StateTransition {
+	if up := m.downUpstream(sg); up != "" {
+		if sg.InhibitedBy == "" {
+			sg.InhibitedFrom = before
+		}
+		sg.InhibitedBy = up
+		for i := range transitions {
+			transitions[i].Inhibited = up
+		}
+		return transitions
+	}
+	if sg.InhibitedBy == "" {
+		return transitions
+	}
+	up, notified := sg.InhibitedBy, sg.InhibitedFrom
+	sg.InhibitedBy, sg.InhibitedFrom = "", ""
+	logCheck(sg, "Subgraph %s: %s recovered, alerts no longer inhibited", sg.Name, up)
+	statusChanged := false
+	for i, t := range transitions {
+		if t.Kind == "" {
+			statusChanged = true
+			if t.To == notified {
+				transitions[i].Inhibited = up
+			}
+		} else if resolves(t) {
+			transitions[i].Inhibited = up
+		}
+	}
+	if !statusChanged && notified != StatusUnknown && sg.Status != notified && !m.isSilenced(sg.Name, sg.CheckedAt) {
+		transitions = append(transitions, StateTransition{
+			Time:     sg.CheckedAt,
+			CycleID:  cycleID,
+			CheckID:  sg.CheckID,
+			Subgraph: sg.Name,
+			Chain:    sg.Chain,
+			From:     notified,
+			To:       sg.Status,
+			Context:  newSubgraphStatus(sg),
+			Trigger:  fmt.Sprintf("%s, still %s after %s recovered", statusTrigger(sg), sg.Status, up),
+		})
+	}
+	return transitions
+}
+
+// resolves reports whether t ends an alert rather than raising one.
+func resolves(t StateTransition) bool {
+	switch t.Kind {
+	case TransitionBurnRate:
+		return t.Context.SLO == nil || t.Context.SLO.Alert == ""
+	case TransitionSlowSync:
+		return !t.Context.SlowSync
+	}
+	return t.To == StatusOK
+}
+
+func formatUpstream(prefix string, t StateTransition) string {
+	if t.To == StatusOK {
+		return fmt.Sprintf("%sUpstream %s recovered: %s (cycle %s)", prefix, t.Endpoint, t.Trigger, t.CycleID)
+	}
+	return fmt.Sprintf("%sUpstream %s is down (%s): %s; alerts of subgraphs depending on it are inhibited (cycle %s)",
+		prefix, t.Endpoint, t.To, t.Trigger, t.CycleID)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	IPFamilyAny = ""
+	IPFamilyV4  = "ipv4"
+	IPFamilyV6  = "ipv6"
+)
+
+// HostConfig overrides name resolution for a single host, e.g. internal
+// graph-nodes behind split-horizon DNS.
+type HostConfig struct {
+	DNSServer string `json:"dnsServer"`
+	IPFamily  string `json:"ipFamily"`
+}
+
+func validateIPFamily(family string) error {
+	switch family {
+	case IPFamilyAny, IPFamilyV4, IPFamilyV6:
+		return nil
+	}
+	return fmt.Errorf("must be %q or %q, got %q", IPFamilyV4, IPFamilyV6, family)
+}
+
+type resolvePolicy struct {
+	family   string
+	server   string
+	resolver *net.Resolver
+}
+
+func newResolvePolicy(family, server string, dialer *net.Dialer) resolvePolicy {
+	p := resolvePolicy{family: family, server: server, resolver: net.DefaultResolver}
+	if server != "" {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		p.server = server
+		p.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+	return p
+}
+
+func (p resolvePolicy) lookupNetwork() string {
+	switch p.family {
+	case IPFamilyV4:
+		return "ip4"
+	case IPFamilyV6:
+		return "ip6"
+	}
+	return "ip"
+}
+
+func (p resolvePolicy) dialNetwork(network string) string {
+	switch p.family {
+	case IPFamilyV4:
+		return strings.TrimRight(network, "46") + "4"
+	case IPFamilyV6:
+		return strings.TrimRight(network, "46") + "6"
+	}
+	return network
+}
+
+// hostDialer resolves host names itself so the resolver and IP family can
+// be chosen per host, optionally caching the results.
+type hostDialer struct {
+	dialer *net.Dialer
+	def    resolvePolicy
+	hosts  map[string]resolvePolicy
+	cache  *dnsCache
+}
+
+func newHostDialer(cfg HTTPConfig) *hostDialer {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	d := &hostDialer{
+		dialer: dialer,
+		def:    newResolvePolicy(cfg.IPFamily, cfg.DNSServer, dialer),
+		hosts:  make(map[string]resolvePolicy, len(cfg.Hosts)),
+	}
+	for host, hc := range cfg.Hosts {
+		family, server := hc.IPFamily, hc.DNSServer
+		if family == IPFamilyAny {
+			family = cfg.IPFamily
+		}
+		if server == "" {
+			server = cfg.DNSServer
+		}
+		d.hosts[strings.ToLower(host)] = newResolvePolicy(family, server, dialer)
+	}
+	if cfg.DNSCacheTTL.Duration > 0 {
+		d.cache = &dnsCache{ttl: cfg.DNSCacheTTL.Duration, entries: make(map[string]dnsEntry)}
+	}
+	return d
+}
+
+func (d *hostDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return d.dialer.DialContext(ctx, network, addr)
+	}
+	p, ok := d.hosts[strings.ToLower(host)]
+	if !ok {
+		p = d.def
+	}
+	network = p.dialNetwork(network)
+	if net.ParseIP(host) != nil {
+		return d.dialer.DialContext(ctx, network, addr)
+	}
+
+	addrs, err := d.lookup(ctx, p, host)
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error
+	for _, ip := range addrs {
+		conn, err := d.dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func (d *hostDialer) lookup(ctx context.Context, p resolvePolicy, host string) ([]string, error) {
+	key := p.family + "|" + p.server + "|" + host
+	if d.cache != nil {
+		if addrs, ok := d.cache.get(key); ok {
+			return addrs, nil
+		}
+	}
+	ips, err := p.resolver.LookupIP(ctx, p.lookupNetwork(), host)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, len(ips))
+	for i, ip := range ips {
+		addrs[i] = ip.String()
+	}
+	if d.cache != nil {
+		d.cache.put(key, addrs)
+	}
+	return addrs, nil
+}
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+type dnsCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]dnsEntry
+}
+
+func (c *dnsCache) get(key string) ([]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.addrs, true
+}
+
+func (c *dnsCache) put(key string, addrs []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = dnsEntry{addrs: addrs, expires: time.Now().Add(c.ttl)}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	DefaultETARangeBlocks = 100_000
+	etaRelearnInterval    = time.Hour
+	// etaMaxSampleGap skips pairs of samples with downtime in between.
+	etaMaxSampleGap = time.Hour
+)
+
+// ETAConfig enables learning block range weights from the sample history
+// for subgraphs without configured heavyRanges. History is split into
+// ranges of RangeBlocks blocks; a range indexed at least 25% slower or
+// faster than the subgraph's average gets a weight.
+type ETAConfig struct {
+	LearnRanges bool  `json:"learnRanges"`
+	RangeBlocks int64 `json:"rangeBlocks"`
+}
+
+func (c *ETAConfig) validate() error {
+	if c.RangeBlocks <= 0 {
+		return fmt.Errorf("eta.rangeBlocks must be positive")
+	}
+	return nil
+}
+
+// BlockRange is a range of blocks, From to To inclusive, that takes Weight
+// times as long to index as a typical block: 3 for a range of dense blocks,
+// 0.5 for a quiet one.
+type BlockRange struct {
+	From   int64   `json:"from"`
+	To     int64   `json:"to"`
+	Weight float64 `json:"weight"`
+}
+
+func validateBlockRanges(ranges []BlockRange) error {
+	sorted := append([]BlockRange(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].From < sorted[j].From })
+	for i, r := range sorted {
+		if r.From < 0 || r.To < r.From {
+			return fmt.Errorf("invalid range %d-%d", r.From, r.To)
+		}
+		if r.Weight <= 0 {
+			return fmt.Errorf("range %d-%d: weight must be positive", r.From, r.To)
+		}
+		if i > 0 && r.From <= sorted[i-1].To {
+			return fmt.Errorf("range %d-%d overlaps %d-%d", r.From, r.To, sorted[i-1].From, sorted[i-1].To)
+		}
+	}
+	return nil
+}
+
+// etaRanges returns the configured heavy ranges of a subgraph, or else the
+// ones learned from its history.
+func etaRanges(sg *SubgraphInfo) []BlockRange {
+	if len(sg.HeavyRanges) > 0 {
+		return sg.HeavyRanges
+	}
+	return sg.LearnedRanges
+}
+
+// blockCost returns how many typical blocks the blocks from up to to weigh.
+func blockCost(ranges []BlockRange, from, to int64) float64 {
+	cost := float64(to - from)
+	for _, r := range ranges {
+		if lo, hi := max(from, r.From), min(to, r.To+1); hi > lo {
+			cost += float64(hi-lo) * (r.Weight - 1)
+		}
+	}
+	return cost
+}
+
+// remainingRanges returns the ranges that overlap the blocks still to index.
+func remainingRanges(ranges []BlockRange, from, to int64) []BlockRange {
+	var out []BlockRange
+	for _, r := range ranges {
+		if r.To >= from && r.From < to {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// estimateTimeLeft weights the remaining blocks by their ranges. The speed
+// measured over the recently indexed blocks, from, is first converted to
+// typical blocks per minute, so a subgraph crawling through a heavy range
+// is not expected to crawl through the light ones after it. Without ranges
+// this is the plain blocks behind divided by the sync speed.
+func estimateTimeLeft(sg *SubgraphInfo, from int64, minutes float64) time.Duration {
+	ranges := etaRanges(sg)
+	indexed := blockCost(ranges, from, sg.CurrentBlock)
+	if indexed <= 0 {
+		return 0
+	}
+	remaining := blockCost(ranges, sg.CurrentBlock, sg.LastBlock)
+	return time.Duration(remaining / (indexed / minutes) * float64(time.Minute))
+}
+
+// learnBlockRanges derives range weights from pairs of consecutive samples
+// in which the subgraph indexed blocks while further behind than it got, so
+// the chain head did not limit its speed. A range needs three such pairs.
+func learnBlockRanges(samples []Sample, rangeBlocks int64) []BlockRange {
+	type bucket struct {
+		blocks  int64
+		minutes float64
+		pairs   int
+	}
+	buckets := make(map[int64]*bucket)
+	var blocks int64
+	var minutes float64
+	for i := 1; i < len(samples); i++ {
+		p, c := samples[i-1], samples[i]
+		gap := c.Time.Sub(p.Time)
+		indexed := c.CurrentBlock - p.CurrentBlock
+		if p.Failed || c.Failed || p.LagUnknown || c.LagUnknown || gap <= 0 || gap > etaMaxSampleGap || indexed <= 0 || p.BlocksBehind <= indexed {
+			continue
+		}
+		key := p.CurrentBlock / rangeBlocks
+		b := buckets[key]
+		if b == nil {
+			b = &bucket{}
+			buckets[key] = b
+		}
+		b.blocks += indexed
+		b.minutes += gap.Minutes()
+		b.pairs++
+		blocks += indexed
+		minutes += gap.Minutes()
+	}
+	if len(buckets) < 2 {
+		return nil
+	}
+
+	average := float64(blocks) / minutes
+	var ranges []BlockRange
+	for key, b := range buckets {
+		if b.pairs < 3 {
+			continue
+		}
+		weight := math.Round(average/(float64(b.blocks)/b.minutes)*100) / 100
+		if weight >= 1.25 || weight <= 0.8 {
+			ranges = append(ranges, BlockRange{From: key * rangeBlocks, To: (key+1)*rangeBlocks - 1, Weight: weight})
+		}
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].From < ranges[j].From })
+	return ranges
+}
+
+// learnETARanges refreshes the learned ranges of a checked subgraph once
+// per etaRelearnInterval. Must be called with mu held.
+func (m *Monitor) learnETARanges(sg *SubgraphInfo, now time.Time) {
+	if !m.cfg.ETA.LearnRanges || len(sg.HeavyRanges) > 0 || now.Sub(sg.RangesLearnedAt) < etaRelearnInterval {
+		return
+	}
+	sg.LearnedRanges = learnBlockRanges(m.store.LoadHistory(sg.Name, time.Time{}, now), m.cfg.ETA.RangeBlocks)
+	sg.RangesLearnedAt = now
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultEventLogRetention = 30 * 24 * time.Hour
+
+type EventLogConfig struct {
+	Retention Duration `json:"retention"`
+	// Path, when set, appends every transition to a JSON lines file that
+	// is never rewritten, so the log survives restarts and can be read by
+	// the events command. Read at startup.
+	Path string `json:"path,omitempty"`
+}
+
+// EventLog keeps every state transition, including silenced ones, for
+// retention. It is separate from the sample history: it records what
+// changed and why, not every check.
+type EventLog struct {
+	mu        sync.RWMutex
+	retention time.Duration
+	events    []StateTransition
+	file      *os.File
+	enc       *json.Encoder
+}
+
+// EventFilter selects transitions; empty fields match everything.
+type EventFilter struct {
+	Since    time.Time
+	Subgraph string
+	Chain    string
+	Kind     string
+	Tenant   string
+}
+
+func NewEventLog(retention time.Duration) *EventLog {
+	return &EventLog{retention: retention}
+}
+
+func (l *EventLog) Add(t StateTransition) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.events = append(l.events, t)
+	cutoff := t.Time.Add(-l.retention)
+	drop := sort.Search(len(l.events), func(i int) bool { return !l.events[i].Time.Before(cutoff) })
+	if drop > 0 {
+		l.events = append(l.events[:0:0], l.events[drop:]...)
+	}
+
+	if l.enc != nil {
+		if err := l.enc.Encode(t); err != nil {
+			log.Printf("Event log write to %s failed, persistence disabled: %v", l.file.Name(), err)
+			l.file.Close()
+			l.file, l.enc = nil, nil
+		}
+	}
+}
+
+// Open loads the transitions in path that are within retention and appends
+// every further transition to it.
+func (l *EventLog) Open(path string) error {
+	events, err := readEventLogFile(path, time.Now().Add(-l.retention))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(events, l.events...)
+	l.file, l.enc = f, json.NewEncoder(f)
+	return nil
+}
+
+// readEventLogFile returns the transitions in an event log file at or after
+// since, in file order, skipping unparseable lines.
+func readEventLogFile(path string, since time.Time) ([]StateTransition, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []StateTransition
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var t StateTransition
+		if json.Unmarshal(scanner.Bytes(), &t) != nil || t.Time.Before(since) {
+			continue
+		}
+		events = append(events, t)
+	}
+	return events, scanner.Err()
+}
+
+func (f EventFilter) match(t StateTransition) bool {
+	return !t.Time.Before(f.Since) &&
+		(f.Subgraph == "" || t.Subgraph == f.Subgraph) &&
+		(f.Chain == "" || t.Chain == f.Chain) &&
+		(f.Kind == "" || t.Kind == f.Kind || f.Kind == "status" && t.Kind == "") &&
+		tenantVisible(f.Tenant, t.Context.Tenant)
+}
+
+// Query returns a copy of the matching transitions, oldest first.
+func (l *EventLog) Query(f EventFilter) []StateTransition {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	out := []StateTransition{}
+	start := sort.Search(len(l.events), func(i int) bool { return !l.events[i].Time.Before(f.Since) })
+	for _, t := range l.events[start:] {
+		if f.match(t) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// parseSince reads a since parameter given as a duration ("24h", "7d"), an
+// RFC 3339 time or unix seconds.
+func parseSince(v string, now time.Time) (time.Time, error) {
+	if d, err := parseDays(v); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("must be positive")
+		}
+		return now.Add(-d), nil
+	}
+	return parseTimeParam(v)
+}
+
+func (m *Monitor) handleTransitions(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := EventFilter{
+		Since:    time.Now().Add(-24 * time.Hour),
+		Subgraph: q.Get("subgraph"),
+		Chain:    q.Get("chain"),
+		Kind:     q.Get("kind"),
+		Tenant:   viewTenant(r),
+	}
+	if v := q.Get("since"); v != "" {
+		since, err := parseSince(v, time.Now())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid since: "+err.Error())
+			return
+		}
+		f.Since = since
+	}
+	writeJSON(w, http.StatusOK, m.store.LoadIncidents(f))
+}
+
+// runEvents implements "events": it lists the transitions in the event log
+// file or, with -server, in a running monitor's log.
+func runEvents(args []string) error {
+	fs := flag.NewFlagSet("events", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file (for eventLog.path)")
+	logPath := fs.String("log", "", "event log file to read (default: eventLog.path from the config)")
+	server := fs.String("server", "", "base URL of a running monitor's HTTP API to query instead of a file")
+	token := fs.String("token", os.Getenv("SUBGRAPH_MONITOR_TOKEN"), "bearer token for -server (default $SUBGRAPH_MONITOR_TOKEN)")
+	since := fs.String("since", "24h", "how far back to list, e.g. 24h or 7d, or an RFC 3339 time")
+	subgraph := fs.String("subgraph", "", "only list transitions of this subgraph")
+	chain := fs.String("chain", "", "only list transitions on this chain")
+	kind := fs.String("kind", "", "only list this kind: status, burn_rate, chain_halt, cert_expiry, slow_sync, availability or upstream")
+	format := fs.String("format", FormatAuto, "output format: auto (table on a terminal, json otherwise), table, or json (one transition per line)")
+	asJSON := fs.Bool("json", false, "print the transitions as JSON lines, like -format json")
+	fs.Parse(args)
+	if *asJSON {
+		*format = "json"
+	}
+	out, err := outputFormat(*format, "table", "json")
+	if err != nil {
+		return err
+	}
+
+	from, err := parseSince(*since, time.Now())
+	if err != nil {
+		return fmt.Errorf("invalid -since %q", *since)
+	}
+	filter := EventFilter{Since: from, Subgraph: *subgraph, Chain: *chain, Kind: *kind}
+
+	var events []StateTransition
+	if *server != "" {
+		events, err = fetchTransitions(*server, *token, *since, filter)
+		if err != nil {
+			return err
+		}
+	} else {
+		path := *logPath
+		if path == "" && *configPath != "" {
+			cfg, err := loadConfigFile(*configPath)
+			if err != nil {
+				return err
+			}
+			path = cfg.EventLog.Path
+		}
+		if path == "" {
+			return fmt.Errorf("no event log: set eventLog.path in the config, pass -log or -server")
+		}
+		all, err := readEventLogFile(path, from)
+		if err != nil {
+			return fmt.Errorf("read event log failed: %v", err)
+		}
+		for _, t := range all {
+			if filter.match(t) {
+				events = append(events, t)
+			}
+		}
+	}
+
+	if out == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		for _, t := range events {
+			if err := enc.Encode(t); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(events) == 0 {
+		fmt.Printf("No transitions since %s\n", from.Format("2006-01-02 15:04"))
+		return nil
+	}
+	fmt.Printf("%-19s %-25s %-12s %-10s %-17s %s\n", "Time", "Subgraph", "Chain", "Kind", "Transition", "Trigger")
+	for _, t := range events {
+		kind := t.Kind
+		if kind == "" {
+			kind = "status"
+		}
+		name := t.Subgraph
+		if name == "" {
+			name = t.Endpoint
+		}
+		if name == "" {
+			name = "-"
+		}
+		transition := fmt.Sprintf("%s -> %s", t.From, t.To)
+		if t.Silenced {
+			transition += " (s)"
+		} else if t.Inhibited != "" {
+			transition += " (i)"
+		}
+		fmt.Printf("%-19s %-25s %-12s %-10s %-17s %s\n", t.Time.Local().Format("2006-01-02 15:04:05"), name, t.Chain, kind, transition, t.Trigger)
+	}
+	return nil
+}
+
+func fetchTransitions(server, token, since string, f EventFilter) ([]StateTransition, error) {
+	q := url.Values{"since": {since}}
+	for k, v := range map[string]string{"subgraph": f.Subgraph, "chain": f.Chain, "kind": f.Kind} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(server, "/")+"/api/v1/transitions?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var events []StateTransition
+	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+		return nil, fmt.Errorf("JSON error: %v", err)
+	}
+	return events, nil
+}
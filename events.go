@@ -0,0 +1,141 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const eventBufferSize = 64
+
+// StateTransition is a status change of a subgraph or, with Kind
+// TransitionBurnRate, an error budget burn alert firing or resolving
+// (Context.SLO.Alert empty), or with Kind TransitionChainHalt, a chain
+// halting or recovering (Subgraph empty), or with Kind TransitionCertExpiry,
+// an endpoint certificate expiring (Subgraph and Chain empty), or with Kind
+// TransitionSlowSync, a subgraph catching up slower than expected or
+// recovering (Context.SlowSync false), or with Kind TransitionAvailability,
+// a change of a subgraph endpoint's availability status.
+type StateTransition struct {
+	Kind     string         `json:"kind,omitempty"`
+	Time     time.Time      `json:"time"`
+	CycleID  string         `json:"cycleId"`
+	CheckID  string         `json:"checkId"`
+	Subgraph string         `json:"subgraph"`
+	Chain    string         `json:"chain"`
+	Endpoint string         `json:"endpoint,omitempty"`
+	From     Status         `json:"from"`
+	To       Status         `json:"to"`
+	Context  SubgraphStatus `json:"context"`
+	// Trigger names the value that caused the transition, e.g.
+	// "blocksBehind 1200 >= critBlocksBehind 1000".
+	Trigger  string `json:"trigger,omitempty"`
+	Silenced bool   `json:"silenced,omitempty"`
+	// Inhibited names the upstream whose outage the transition is part of;
+	// such transitions are logged but not notified.
+	Inhibited string `json:"inhibited,omitempty"`
+	Test      bool   `json:"test,omitempty"`
+}
+
+type StatusChange struct {
+	Subgraph string         `json:"subgraph"`
+	Silenced bool           `json:"silenced"`
+	Before   SubgraphStatus `json:"before"`
+	After    SubgraphStatus `json:"after"`
+}
+
+// CycleChanges lists the subgraphs whose status changed in the most recent
+// check cycle compared to the one before it.
+type CycleChanges struct {
+	CycleID         string         `json:"cycleId,omitempty"`
+	CycleAt         time.Time      `json:"cycleAt"`
+	PreviousCycleAt time.Time      `json:"previousCycleAt"`
+	Changes         []StatusChange `json:"changes"`
+}
+
+// EventHub fans transitions out to WebSocket clients, which may miss
+// events when they fall behind, and to alert queues, which never do.
+type EventHub struct {
+	mu     sync.Mutex
+	subs   map[chan StateTransition]struct{}
+	alerts []*alertQueue
+}
+
+func NewEventHub() *EventHub {
+	return &EventHub{subs: make(map[chan StateTransition]struct{})}
+}
+
+func (h *EventHub) Subscribe() (<-chan StateTransition, func()) {
+	ch := make(chan StateTransition, eventBufferSize)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subs, ch)
+		h.mu.Unlock()
+	}
+}
+
+// SubscribeAlerts returns a queue receiving every transition published from
+// now on, for notifiers that must not lose alerts. It is never closed.
+func (h *EventHub) SubscribeAlerts() *alertQueue {
+	q := newAlertQueue()
+	h.mu.Lock()
+	h.alerts = append(h.alerts, q)
+	h.mu.Unlock()
+	return q
+}
+
+// Publish never blocks the check loop: alert queues grow to hold the event,
+// while subscribers that fall behind by more than eventBufferSize events
+// miss the overflow.
+func (h *EventHub) Publish(event StateTransition) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, q := range h.alerts {
+		q.push(event)
+	}
+	for ch := range h.subs {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("Dropping %s event for slow subscriber", event.Subgraph)
+		}
+	}
+}
+
+// alertQueue hands transitions to one alert consumer in publish order. It
+// grows without bound while the consumer is slow rather than dropping any.
+type alertQueue struct {
+	mu      sync.Mutex
+	pending sync.Cond
+	events  []StateTransition
+}
+
+func newAlertQueue() *alertQueue {
+	q := &alertQueue{}
+	q.pending.L = &q.mu
+	return q
+}
+
+func (q *alertQueue) push(event StateTransition) {
+	q.mu.Lock()
+	q.events = append(q.events, event)
+	q.mu.Unlock()
+	q.pending.Signal()
+}
+
+// pop waits for the oldest queued transition and removes it.
+func (q *alertQueue) pop() StateTransition {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.events) == 0 {
+		q.pending.Wait()
+	}
+	event := q.events[0]
+	q.events[0] = StateTransition{}
+	q.events = q.events[1:]
+	return event
+}
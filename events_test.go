@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAlertQueueKeepsEveryEvent(t *testing.T) {
+	hub := NewEventHub()
+	alerts := hub.SubscribeAlerts()
+	// A WebSocket subscriber nobody reads from must not hold back alerts.
+	hub.Subscribe()
+
+	const n = 3 * eventBufferSize
+	for i := 0; i < n; i++ {
+		hub.Publish(StateTransition{Subgraph: fmt.Sprintf("sg-%d", i)})
+	}
+	for i := 0; i < n; i++ {
+		if got, want := alerts.pop().Subgraph, fmt.Sprintf("sg-%d", i); got != want {
+			t.Fatalf("event %d: got %s, want %s", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Head policies: which block of a chain lag is measured against.
+const (
+	HeadPolicyLatest    = "latest"
+	HeadPolicySafe      = "safe"
+	HeadPolicyFinalized = "finalized"
+)
+
+func validHeadPolicy(p string) bool {
+	return p == HeadPolicyLatest || p == HeadPolicySafe || p == HeadPolicyFinalized
+}
+
+// headLabel names the chain head of a head policy in the status table.
+func headLabel(policy string) string {
+	switch policy {
+	case HeadPolicySafe:
+		return "Safe Block"
+	case HeadPolicyFinalized:
+		return "Finalized Block"
+	}
+	return "Latest Block"
+}
+
+// Sources of a chain's latest block.
+const (
+	HeadSourceRPC      = "rpc"
+	HeadSourceExplorer = "explorer"
+	HeadSourcePush     = "push"
+	// HeadSourceStale means every source failed and the previous head is
+	// still in use.
+	HeadSourceStale = "stale"
+)
+
+// getLatestBlockFromExplorer reads the latest block from an Etherscan or
+// Blockscout compatible API (module=proxy&action=eth_blockNumber).
+// explorerURL may already carry parameters such as Etherscan v2's chainid.
+func getLatestBlockFromExplorer(explorerURL, apiKey, requestID string) (int64, error) {
+	u, err := url.Parse(explorerURL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid explorer URL: %v", err)
+	}
+	q := u.Query()
+	q.Set("module", "proxy")
+	q.Set("action", "eth_blockNumber")
+	if apiKey != "" {
+		q.Set("apikey", apiKey)
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	if requestID != "" {
+		req.Header.Set(requestIDHeader, requestID)
+	}
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := readBody(resp)
+	if err != nil {
+		return 0, fmt.Errorf("read response failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Result  string `json:"result"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return 0, fmt.Errorf("JSON error: %v", err)
+	}
+	// Etherscan reports errors as {"status":"0","message":"NOTOK","result":"..."}.
+	if !strings.HasPrefix(result.Result, "0x") {
+		return 0, fmt.Errorf("explorer error: %s %s", result.Message, result.Result)
+	}
+	return parseHexQuantity("block number", result.Result)
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const DefaultParquetExportInterval = time.Hour
+
+type ExportConfig struct {
+	Parquet ParquetExportConfig `json:"parquet"`
+}
+
+// ParquetExportConfig writes the check history as Parquet files partitioned
+// by date and chain. Path is a local directory or s3://bucket/prefix; an
+// empty path disables the export.
+type ParquetExportConfig struct {
+	Path     string   `json:"path"`
+	Interval Duration `json:"interval"`
+	S3       S3Config `json:"s3"`
+}
+
+// S3Config holds the S3 credentials for exports. Empty fields fall back to
+// the standard AWS_* environment variables. Endpoint selects an
+// S3-compatible service (MinIO, R2) using path-style URLs.
+type S3Config struct {
+	Region          string `json:"region,omitempty"`
+	Endpoint        string `json:"endpoint,omitempty"`
+	AccessKeyID     string `json:"accessKeyId,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty"`
+	SessionToken    string `json:"sessionToken,omitempty"`
+}
+
+func (c *ParquetExportConfig) validate(retention time.Duration) error {
+	if c.Path == "" {
+		return nil
+	}
+	if c.Interval.Duration < time.Minute {
+		return fmt.Errorf("export.parquet.interval must be at least 1m")
+	}
+	if c.Interval.Duration > retention {
+		return fmt.Errorf("export.parquet.interval must not exceed history.retention")
+	}
+	if bucket, _, ok := splitS3Path(c.Path); ok && bucket == "" {
+		return fmt.Errorf("export.parquet.path: missing bucket in %q", c.Path)
+	}
+	return nil
+}
+
+func splitS3Path(path string) (bucket, prefix string, ok bool) {
+	rest, ok := strings.CutPrefix(path, "s3://")
+	if !ok {
+		return "", "", false
+	}
+	bucket, prefix, _ = strings.Cut(rest, "/")
+	return bucket, strings.Trim(prefix, "/"), true
+}
+
+// runParquetExport exports the samples taken since the previous export
+// every interval. A failed export is retried with the next one, overwriting
+// any files it managed to write.
+//
+// Samples carry the time of their check but are stored when the cycle ends,
+// so a sample taken just before an export may only be stored after it. Each
+// export therefore re-reads the previous interval too and skips the samples
+// already exported.
+func (m *Monitor) runParquetExport(cfg ParquetExportConfig) {
+	from := time.Now()
+	exported := make(map[exportedSample]bool)
+	for {
+		time.Sleep(cfg.Interval.Duration)
+		to := time.Now()
+		var samples []Sample
+		for _, s := range m.store.RangeHistory(from.Add(-cfg.Interval.Duration), to) {
+			if !exported[exportedSample{s.Subgraph, s.Time.UnixNano()}] {
+				samples = append(samples, s)
+			}
+		}
+		n, err := exportParquet(cfg, samples, from)
+		if err != nil {
+			log.Printf("Parquet export to %s failed: %v", cfg.Path, err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("Exported %d samples to %d Parquet files in %s", len(samples), n, cfg.Path)
+		}
+		for _, s := range samples {
+			exported[exportedSample{s.Subgraph, s.Time.UnixNano()}] = true
+		}
+		for k := range exported {
+			if k.time < to.Add(-cfg.Interval.Duration).UnixNano() {
+				delete(exported, k)
+			}
+		}
+		from = to
+	}
+}
+
+type exportedSample struct {
+	subgraph string
+	time     int64
+}
+
+// exportParquet writes samples to one file per date and chain partition,
+// date=YYYY-MM-DD/chain=<chain>/samples-<from>.parquet, and returns the
+// number of files written.
+func exportParquet(cfg ParquetExportConfig, samples []Sample, from time.Time) (int, error) {
+	partitions := make(map[string][]Sample)
+	for _, s := range samples {
+		key := "date=" + s.Time.UTC().Format("2006-01-02") + "/chain=" + partitionValue(s.Chain)
+		partitions[key] = append(partitions[key], s)
+	}
+	keys := make([]string, 0, len(partitions))
+	for key := range partitions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	name := "samples-" + from.UTC().Format("20060102T150405Z") + ".parquet"
+	for _, key := range keys {
+		data := encodeParquet(partitions[key])
+		if err := writeExport(cfg, key+"/"+name, data); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
+
+// partitionValue keeps chain names usable as a single path segment.
+func partitionValue(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == '=' {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+func writeExport(cfg ParquetExportConfig, key string, data []byte) error {
+	if bucket, prefix, ok := splitS3Path(cfg.Path); ok {
+		if prefix != "" {
+			key = prefix + "/" + key
+		}
+		return s3Put(cfg.S3, bucket, key, data)
+	}
+	path := filepath.Join(cfg.Path, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// s3Put uploads data with a SigV4-signed PutObject request.
+func s3Put(cfg S3Config, bucket, key string, data []byte) error {
+	region := firstNonEmpty(cfg.Region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1")
+	accessKey := firstNonEmpty(cfg.AccessKeyID, os.Getenv("AWS_ACCESS_KEY_ID"))
+	secretKey := firstNonEmpty(cfg.SecretAccessKey, os.Getenv("AWS_SECRET_ACCESS_KEY"))
+	sessionToken := firstNonEmpty(cfg.SessionToken, os.Getenv("AWS_SESSION_TOKEN"))
+	if accessKey == "" || secretKey == "" {
+		return fmt.Errorf("no S3 credentials: set export.parquet.s3 or AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY")
+	}
+
+	var url, host, path string
+	if cfg.Endpoint != "" {
+		base := strings.TrimSuffix(cfg.Endpoint, "/")
+		path = s3Escape("/" + bucket + "/" + key)
+		url = base + path
+		host = strings.TrimPrefix(strings.TrimPrefix(base, "https://"), "http://")
+	} else {
+		host = bucket + ".s3." + region + ".amazonaws.com"
+		path = s3Escape("/" + key)
+		url = "https://" + host + path
+	}
+
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	payloadHash := sha256Hex(data)
+	req.Header.Set("Content-Type", "application/vnd.apache.parquet")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": host, "x-amz-content-sha256": payloadHash, "x-amz-date": amzDate}
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+		headers["x-amz-security-token"] = sessionToken
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{http.MethodPut, path, "", canonicalHeaders.String(), signedHeaders, payloadHash}, "\n")
+	scope := now.Format("20060102") + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+	signingKey := []byte("AWS4" + secretKey)
+	for _, part := range []string{now.Format("20060102"), region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, hex.EncodeToString(hmacSHA256(signingKey, stringToSign))))
+
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := readBody(resp)
+		return fmt.Errorf("PUT s3://%s/%s: HTTP %d: %s", bucket, key, resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// s3Escape percent-encodes a path the way SigV4 canonicalises S3 keys.
+func s3Escape(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// runExport implements "export": it writes the persisted history as Parquet
+// without checking anything, e.g. to backfill before the periodic export
+// was enabled.
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file (for history.path and export.parquet)")
+	historyPath := fs.String("history", "", "history file to read (default: history.path from the config)")
+	out := fs.String("out", "", "directory or s3://bucket/prefix to write to (default: export.parquet.path from the config)")
+	last := fs.String("last", "7d", "period to export, e.g. 24h or 7d")
+	fs.Parse(args)
+
+	period, err := parseDays(*last)
+	if err != nil || period <= 0 {
+		return fmt.Errorf("invalid -last %q", *last)
+	}
+	var cfg ParquetExportConfig
+	path := *historyPath
+	if *configPath != "" {
+		c, err := loadConfigFile(*configPath)
+		if err != nil {
+			return err
+		}
+		cfg = c.Export.Parquet
+		if path == "" {
+			path = c.History.Path
+		}
+	}
+	if *out != "" {
+		cfg.Path = *out
+	}
+	if path == "" {
+		return fmt.Errorf("no history file: set history.path in the config or pass -history")
+	}
+	if cfg.Path == "" {
+		return fmt.Errorf("no destination: set export.parquet.path in the config or pass -out")
+	}
+
+	from := time.Now().Add(-period)
+	samples, err := readHistoryFile(path, from)
+	if err != nil {
+		return fmt.Errorf("read history failed: %v", err)
+	}
+	n, err := exportParquet(cfg, samples, from)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Exported %d samples to %d Parquet files in %s\n", len(samples), n, cfg.Path)
+	return nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	grpcHealthCheckMethod = "/grpc.health.v1.Health/Check"
+	firehoseBlocksMethod  = "/sf.firehose.v2.Stream/Blocks"
+
+	grpcHealthServing = 1
+	grpcUnimplemented = "12"
+)
+
+type FirehoseInfo struct {
+	Name    string            `json:"name"`
+	URL     string            `json:"url"`
+	Chain   string            `json:"chain"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Thresholds
+	FirehoseState `json:"-"`
+
+	client *grpcClient
+	// dependencyOnly marks another shard's endpoint, checked here only for
+	// the dependsOn of this shard's subgraphs and not reported.
+	dependencyOnly bool
+}
+
+type FirehoseState struct {
+	Serving      string
+	HeadBlock    int64
+	ChainBlock   int64
+	BlocksBehind int64
+	Status       Status
+	LastError    string
+	CheckID      string
+	CheckedAt    time.Time
+	NextCheckAt  time.Time
+}
+
+type FirehoseStatus struct {
+	Name         string    `json:"name"`
+	Chain        string    `json:"chain"`
+	URL          string    `json:"url"`
+	Status       Status    `json:"status"`
+	Serving      string    `json:"serving"`
+	HeadBlock    int64     `json:"headBlock"`
+	ChainBlock   int64     `json:"chainBlock"`
+	BlocksBehind int64     `json:"blocksBehind"`
+	Error        string    `json:"error,omitempty"`
+	CheckedAt    time.Time `json:"checkedAt"`
+	CheckID      string    `json:"checkId,omitempty"`
+}
+
+func newFirehoseStatus(fh *FirehoseInfo) FirehoseStatus {
+	return FirehoseStatus{
+		Name:         fh.Name,
+		Chain:        fh.Chain,
+		URL:          fh.URL,
+		Status:       fh.Status,
+		Serving:      fh.Serving,
+		HeadBlock:    fh.HeadBlock,
+		ChainBlock:   fh.ChainBlock,
+		BlocksBehind: fh.BlocksBehind,
+		Error:        fh.LastError,
+		CheckedAt:    fh.CheckedAt,
+		CheckID:      fh.CheckID,
+	}
+}
+
+// tenantFirehose returns the Firehose endpoints each tenant's subgraphs
+// name in dependsOn. Must be called with mu held.
+func (m *Monitor) tenantFirehose() map[string]map[string]bool {
+	visible := make(map[string]map[string]bool)
+	for _, sg := range m.subgraphs {
+		if sg.Tenant == "" {
+			continue
+		}
+		for _, dep := range sg.DependsOn {
+			if name, ok := strings.CutPrefix(upstreamName(sg, dep), "firehose:"); ok {
+				if visible[sg.Tenant] == nil {
+					visible[sg.Tenant] = make(map[string]bool)
+				}
+				visible[sg.Tenant][name] = true
+			}
+		}
+	}
+	return visible
+}
+
+// visibleFirehose returns the Firehose statuses view may see: all of them
+// for admins, for a tenant those its subgraphs depend on.
+func (s *Snapshot) visibleFirehose(view string) []FirehoseStatus {
+	if view == "" {
+		return append([]FirehoseStatus(nil), s.Firehose...)
+	}
+	visible := []FirehoseStatus{}
+	for _, fh := range s.Firehose {
+		if s.TenantFirehose[view][fh.Name] {
+			visible = append(visible, fh)
+		}
+	}
+	return visible
+}
+
+func mergeFirehoseState(old, next []*FirehoseInfo) []*FirehoseInfo {
+	byName := make(map[string]*FirehoseInfo, len(old))
+	for _, fh := range old {
+		byName[fh.Name] = fh
+	}
+	for _, fh := range next {
+		if prev, ok := byName[fh.Name]; ok && prev.URL == fh.URL {
+			fh.FirehoseState = prev.FirehoseState
+		}
+	}
+	return next
+}
+
+func checkFirehoseEndpoints(endpoints []*FirehoseInfo, chains map[string]*ChainInfo, cfg *Config) {
+	if len(endpoints) == 0 {
+		return
+	}
+	if !statusJSON {
+		fmt.Printf("\n--- Firehose Status - %s ---\n", time.Now().Format("2006-01-02 15:04:05"))
+		fmt.Printf("%-25s %-12s %-6s %-12s %-12s %s\n", "Endpoint", "Chain", "Status", "Serving", "Head", "Behind")
+	}
+	for _, fh := range endpoints {
+		var latestBlock int64
+		if chain, ok := chains[fh.Chain]; ok {
+			latestBlock = chain.LatestBlock
+		}
+		checkFirehose(fh, latestBlock, cfg)
+		if statusJSON {
+			continue
+		}
+		fmt.Printf("%-25s %-12s %-6s %-12s %-12d %d\n", fh.Name, fh.Chain, fh.Status, fh.Serving, fh.HeadBlock, fh.BlocksBehind)
+	}
+}
+
+// checkFirehose asks the endpoint for its gRPC health and for the most
+// recent block on its stream, and compares that block with the chain head.
+func checkFirehose(fh *FirehoseInfo, latestBlock int64, cfg *Config) {
+	fh.CheckedAt = time.Now()
+	fh.ChainBlock = latestBlock
+	if fh.client == nil {
+		fh.client = newGRPCClient(fh.URL, fh.Headers, cfg.HTTPTimeout.Duration, cfg.HTTP)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HTTPTimeout.Duration)
+	defer cancel()
+
+	serving, err := firehoseHealth(ctx, fh.client)
+	if err != nil {
+		fh.fail(err)
+		return
+	}
+	fh.Serving = serving
+
+	head, err := firehoseHeadBlock(ctx, fh.client)
+	if err != nil {
+		fh.fail(err)
+		return
+	}
+	fh.LastError = ""
+	fh.HeadBlock = head
+	fh.BlocksBehind = 0
+	if latestBlock > 0 {
+		fh.BlocksBehind = latestBlock - head
+	}
+
+	switch {
+	case fh.Serving == "NOT_SERVING":
+		fh.Status = StatusCrit
+	case fh.CritBlocksBehind > 0 && fh.BlocksBehind >= fh.CritBlocksBehind:
+		fh.Status = StatusCrit
+	case fh.WarnBlocksBehind > 0 && fh.BlocksBehind >= fh.WarnBlocksBehind:
+		fh.Status = StatusWarn
+	default:
+		fh.Status = StatusOK
+	}
+}
+
+func (fh *FirehoseInfo) fail(err error) {
+	log.Printf("[%s] Firehose %s error: %v", fh.CheckID, fh.Name, err)
+	fh.LastError = err.Error()
+	fh.Status = StatusError
+}
+
+// firehoseHealth calls the standard gRPC health service. Endpoints that do
+// not implement it are reported as "UNKNOWN" rather than failing the check.
+func firehoseHealth(ctx context.Context, c *grpcClient) (string, error) {
+	resp, err := c.call(ctx, grpcHealthCheckMethod, nil)
+	if err != nil {
+		if isGRPCStatus(err, grpcUnimplemented) {
+			return "UNKNOWN", nil
+		}
+		return "", fmt.Errorf("health check: %v", err)
+	}
+	fields, err := protoFields(resp)
+	if err != nil {
+		return "", fmt.Errorf("health check: %v", err)
+	}
+	if f, ok := protoFind(fields, 1); ok && f.Varint == grpcHealthServing {
+		return "SERVING", nil
+	}
+	return "NOT_SERVING", nil
+}
+
+// firehoseHeadBlock opens a Blocks stream starting one block before the head
+// (start_block_num = -1) and reads the block number of the first response
+// from its metadata, falling back to the number field of Ethereum blocks for
+// servers that do not send metadata.
+func firehoseHeadBlock(ctx context.Context, c *grpcClient) (int64, error) {
+	var req []byte
+	req = protoAppendVarint(req, 1, ^uint64(0)) // int64 -1 in two's complement
+
+	resp, err := c.call(ctx, firehoseBlocksMethod, req)
+	if err != nil {
+		return 0, fmt.Errorf("blocks stream: %v", err)
+	}
+	fields, err := protoFields(resp)
+	if err != nil {
+		return 0, fmt.Errorf("blocks stream: %v", err)
+	}
+
+	if meta, ok := protoFind(fields, 12); ok {
+		if mf, err := protoFields(meta.Bytes); err == nil {
+			if num, ok := protoFind(mf, 1); ok && num.Varint > 0 {
+				return int64(num.Varint), nil
+			}
+		}
+	}
+	if anyBlock, ok := protoFind(fields, 1); ok {
+		if af, err := protoFields(anyBlock.Bytes); err == nil {
+			if value, ok := protoFind(af, 2); ok {
+				if bf, err := protoFields(value.Bytes); err == nil {
+					if num, ok := protoFind(bf, 3); ok && num.Varint > 0 {
+						return int64(num.Varint), nil
+					}
+				}
+			}
+		}
+	}
+	return 0, fmt.Errorf("blocks stream: response carries no block number")
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const DefaultIPFSURL = "https://ipfs.network.thegraph.com"
+
+type GraftInfo struct {
+	Base          string `json:"base"`
+	Block         int64  `json:"block"`
+	BaseAvailable bool   `json:"baseAvailable"`
+}
+
+// updateGraftInfo resolves the graft base of the subgraph's deployment from
+// its manifest whenever the deployment changes, and re-checks on every call
+// whether the base deployment is still served.
+func updateGraftInfo(sg *SubgraphInfo, deployment string) {
+	if deployment == "" {
+		return
+	}
+	if deployment != sg.GraftResolvedFor {
+		manifest, err := fetchManifest(sg.IPFSURL, deployment, sg.CheckID)
+		if err != nil {
+			logCheck(sg, "Manifest %s for %s: %v", deployment, sg.Name, err)
+			return
+		}
+		graft, err := parseGraft(manifest)
+		if err != nil {
+			logCheck(sg, "Manifest %s for %s: %v", deployment, sg.Name, err)
+			return
+		}
+		sg.Graft = graft
+		sg.GraftResolvedFor = deployment
+		if graft != nil {
+			logCheck(sg, "Subgraph %s is grafted on %s at block %d", sg.Name, graft.Base, graft.Block)
+		}
+	}
+
+	if sg.Graft != nil {
+		available := false
+		if baseURL := graftBaseURL(sg.URL, sg.Graft.Base); baseURL != "" {
+			_, err := fetchSubgraphMeta(baseURL, query, sg.CheckID, sg.ResponseSchema, sg.GraphQLRequest)
+			available = err == nil
+		}
+		if sg.Graft.BaseAvailable && !available {
+			logCheck(sg, "Graft base %s of %s is no longer available", sg.Graft.Base, sg.Name)
+		}
+		sg.Graft.BaseAvailable = available
+	}
+}
+
+func fetchManifest(ipfsURL, hash, requestID string) ([]byte, error) {
+	u := strings.TrimSuffix(ipfsURL, "/") + "/api/v0/cat?arg=" + url.QueryEscape(hash)
+	resp, err := post(u, "", nil, requestID)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := readBody(resp)
+	if err != nil {
+		return nil, fmt.Errorf("read response failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
+
+// parseGraft extracts the top-level graft section of a subgraph manifest:
+//
+//	graft:
+//	  base: Qm...
+//	  block: 1234
+//
+// It returns nil when the manifest has no graft section.
+func parseGraft(manifest []byte) (*GraftInfo, error) {
+	var graft *GraftInfo
+	scanner := bufio.NewScanner(bytes.NewReader(manifest))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		indented := line[0] == ' ' || line[0] == '\t'
+		if !indented {
+			if graft != nil {
+				break
+			}
+			if line == "graft:" {
+				graft = &GraftInfo{}
+			}
+			continue
+		}
+		if graft == nil {
+			continue
+		}
+
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		switch key {
+		case "base":
+			graft.Base = value
+		case "block":
+			block, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid graft block %q", value)
+			}
+			graft.Block = block
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if graft != nil && graft.Base == "" {
+		return nil, fmt.Errorf("graft section without base")
+	}
+	return graft, nil
+}
+
+// graftBaseURL derives the query URL of the base deployment from the
+// subgraph's own graph-node URL, e.g. .../subgraphs/name/foo/bar becomes
+// .../subgraphs/id/<base>.
+func graftBaseURL(subgraphURL, base string) string {
+	for _, marker := range []string{"/subgraphs/name/", "/subgraphs/id/"} {
+		if i := strings.Index(subgraphURL, marker); i >= 0 {
+			return subgraphURL[:i] + "/subgraphs/id/" + base
+		}
+	}
+	return ""
+}
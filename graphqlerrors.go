@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Kinds of GraphQL errors returned by graph-node in an HTTP 200 response.
+const (
+	GraphQLErrorDeploying      = "deploying"
+	GraphQLErrorStore          = "store"
+	GraphQLErrorIndexingFailed = "indexing_failed"
+	GraphQLErrorNotFound       = "not_found"
+	GraphQLErrorUnknown        = "unknown"
+)
+
+const (
+	// deployingRetryInterval caps the wait before re-checking a subgraph
+	// that is still being deployed.
+	deployingRetryInterval = time.Minute
+	storeErrorRetryDelay   = time.Second
+)
+
+var graphQLErrorPatterns = []struct {
+	kind     string
+	patterns []string
+}{
+	{GraphQLErrorDeploying, []string{"has not started syncing yet", "is still deploying", "not yet synced"}},
+	{GraphQLErrorIndexingFailed, []string{"indexing_error", "deterministic", "subgraph failed", "has failed"}},
+	{GraphQLErrorStore, []string{"store error", "database unavailable", "connection pool", "statement timeout"}},
+	{GraphQLErrorNotFound, []string{"not found", "does not exist"}},
+}
+
+type graphQLError struct {
+	Kind    string
+	Message string
+}
+
+func (e *graphQLError) Error() string {
+	return fmt.Sprintf("GraphQL error (%s): %s", e.Kind, e.Message)
+}
+
+func newGraphQLError(message string) *graphQLError {
+	lower := strings.ToLower(message)
+	for _, p := range graphQLErrorPatterns {
+		for _, pattern := range p.patterns {
+			if strings.Contains(lower, pattern) {
+				return &graphQLError{Kind: p.kind, Message: message}
+			}
+		}
+	}
+	return &graphQLError{Kind: GraphQLErrorUnknown, Message: message}
+}
+
+// graphQLErrorKind returns the kind of a GraphQL-level error, or "" for
+// transport and other errors.
+func graphQLErrorKind(err error) string {
+	var gqlErr *graphQLError
+	if errors.As(err, &gqlErr) {
+		return gqlErr.Kind
+	}
+	return ""
+}
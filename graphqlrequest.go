@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// How queries are sent to subgraph endpoints: as a POST body, in the query
+// string of a GET request, or as automatic persisted queries (APQ), which
+// send the query's SHA-256 hash and add the query itself only when the
+// gateway does not know the hash yet, over GET or POST.
+const (
+	GraphQLRequestPost    = "post"
+	GraphQLRequestGet     = "get"
+	GraphQLRequestAPQ     = "apq"
+	GraphQLRequestAPQPost = "apq-post"
+)
+
+func validGraphQLRequest(mode string) bool {
+	switch mode {
+	case GraphQLRequestPost, GraphQLRequestGet, GraphQLRequestAPQ, GraphQLRequestAPQPost:
+		return true
+	}
+	return false
+}
+
+func persistedQueries(mode string) bool {
+	return mode == GraphQLRequestAPQ || mode == GraphQLRequestAPQPost
+}
+
+// newGraphQLRequest builds the request sending query the way mode asks.
+// With hashOnly an APQ request leaves out the query.
+func newGraphQLRequest(endpoint, query, mode string, hashOnly bool, requestID string) (*http.Request, error) {
+	params := make(map[string]interface{})
+	if !hashOnly {
+		params["query"] = query
+	}
+	if persistedQueries(mode) {
+		sum := sha256.Sum256([]byte(query))
+		params["extensions"] = map[string]interface{}{
+			"persistedQuery": map[string]interface{}{"version": 1, "sha256Hash": hex.EncodeToString(sum[:])},
+		}
+	}
+
+	var req *http.Request
+	if mode == GraphQLRequestPost || mode == GraphQLRequestAPQPost {
+		body, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		if req, err = http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body)); err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		q := u.Query()
+		for k, v := range params {
+			s, ok := v.(string)
+			if !ok {
+				b, err := json.Marshal(v)
+				if err != nil {
+					return nil, err
+				}
+				s = string(b)
+			}
+			q.Set(k, s)
+		}
+		u.RawQuery = q.Encode()
+		if req, err = http.NewRequest(http.MethodGet, u.String(), nil); err != nil {
+			return nil, err
+		}
+	}
+	if requestID != "" {
+		req.Header.Set(requestIDHeader, requestID)
+	}
+	return req, nil
+}
+
+// sendGraphQL sends query to endpoint the way mode asks. An APQ request
+// that the gateway answers with PersistedQueryNotFound is sent again with
+// the query, which registers its hash.
+func sendGraphQL(endpoint, query, mode, requestID string) (*http.Response, error) {
+	apq := persistedQueries(mode)
+	req, err := newGraphQLRequest(endpoint, query, mode, apq, requestID)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient().Do(req)
+	if err != nil || !apq {
+		return resp, err
+	}
+	body, err := readBody(resp)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if !persistedQueryNotFound(body) {
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return resp, nil
+	}
+	if req, err = newGraphQLRequest(endpoint, query, mode, false, requestID); err != nil {
+		return nil, err
+	}
+	return httpClient().Do(req)
+}
+
+func persistedQueryNotFound(body []byte) bool {
+	var r struct {
+		Errors []struct {
+			Message    string `json:"message"`
+			Extensions struct {
+				Code string `json:"code"`
+			} `json:"extensions"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(body, &r) != nil {
+		return false
+	}
+	for _, e := range r.Errors {
+		if e.Message == "PersistedQueryNotFound" || e.Extensions.Code == "PERSISTED_QUERY_NOT_FOUND" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const grpcMaxMessageSize = 16 << 20
+
+// grpcClient speaks just enough of the gRPC wire protocol over net/http's
+// HTTP/2 support (TLS only) to call unary and server-streaming methods with
+// hand-encoded protobuf messages.
+type grpcClient struct {
+	baseURL string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newGRPCClient(target string, headers map[string]string, timeout time.Duration, httpCfg HTTPConfig) *grpcClient {
+	if !strings.Contains(target, "://") {
+		target = "https://" + target
+	}
+	return &grpcClient{
+		baseURL: strings.TrimSuffix(target, "/"),
+		headers: headers,
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: withHeaders(httpCfg, &http.Transport{
+				DialContext:       newHostDialer(httpCfg).DialContext,
+				ForceAttemptHTTP2: true,
+				TLSClientConfig:   &tls.Config{NextProtos: []string{"h2"}},
+			}),
+		},
+	}
+}
+
+type grpcStatusError struct {
+	Code    string
+	Message string
+}
+
+func (e *grpcStatusError) Error() string {
+	return fmt.Sprintf("gRPC status %s: %s", e.Code, e.Message)
+}
+
+func isGRPCStatus(err error, code string) bool {
+	var se *grpcStatusError
+	return errors.As(err, &se) && se.Code == code
+}
+
+// call sends msg to method and returns the first response message. For
+// server-streaming methods the stream is cancelled after that message.
+func (c *grpcClient) call(ctx context.Context, method string, msg []byte) ([]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	frame := make([]byte, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(msg)))
+	copy(frame[5:], msg)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+method, bytes.NewReader(frame))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if resp.ProtoMajor != 2 {
+		return nil, fmt.Errorf("endpoint did not negotiate HTTP/2")
+	}
+	// Trailers-only responses carry the error status in the headers.
+	if status := resp.Header.Get("Grpc-Status"); status != "" && status != "0" {
+		return nil, &grpcStatusError{Code: status, Message: resp.Header.Get("Grpc-Message")}
+	}
+
+	var prefix [5]byte
+	if _, err := io.ReadFull(resp.Body, prefix[:]); err != nil {
+		if err == io.EOF {
+			io.Copy(io.Discard, resp.Body)
+			if status := resp.Trailer.Get("Grpc-Status"); status != "" && status != "0" {
+				return nil, &grpcStatusError{Code: status, Message: resp.Trailer.Get("Grpc-Message")}
+			}
+			return nil, fmt.Errorf("empty gRPC response")
+		}
+		return nil, fmt.Errorf("read response failed: %v", err)
+	}
+	if prefix[0] != 0 {
+		return nil, fmt.Errorf("compressed gRPC responses are not supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > grpcMaxMessageSize {
+		return nil, fmt.Errorf("gRPC message too large: %d bytes", size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(resp.Body, payload); err != nil {
+		return nil, fmt.Errorf("read response failed: %v", err)
+	}
+	return payload, nil
+}
+
+// Minimal protobuf helpers.
+
+func protoAppendVarint(b []byte, field int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3)
+	return binary.AppendUvarint(b, v)
+}
+
+type protoField struct {
+	Num    int
+	Varint uint64
+	Bytes  []byte
+}
+
+func protoFields(b []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid protobuf key")
+		}
+		b = b[n:]
+		f := protoField{Num: int(key >> 3)}
+		switch key & 7 {
+		case 0:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return nil, fmt.Errorf("invalid protobuf varint")
+			}
+			f.Varint, b = v, b[n:]
+		case 1:
+			if len(b) < 8 {
+				return nil, fmt.Errorf("truncated protobuf fixed64")
+			}
+			f.Varint, b = binary.LittleEndian.Uint64(b), b[8:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return nil, fmt.Errorf("truncated protobuf bytes")
+			}
+			f.Bytes, b = b[n:n+int(l)], b[n+int(l):]
+		case 5:
+			if len(b) < 4 {
+				return nil, fmt.Errorf("truncated protobuf fixed32")
+			}
+			f.Varint, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		default:
+			return nil, fmt.Errorf("unsupported protobuf wire type %d", key&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func protoFind(fields []protoField, num int) (protoField, bool) {
+	for _, f := range fields {
+		if f.Num == num {
+			return f, true
+		}
+	}
+	return protoField{}, false
+}
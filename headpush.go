@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// DefaultPushMaxAge is how long a pushed chain head is trusted when the
+// chain does not set pushMaxAge.
+const DefaultPushMaxAge = time.Minute
+
+type pushedHead struct {
+	Block int64
+	At    time.Time
+}
+
+// PushHead records a chain head reported by an external feed. It only takes
+// headMu, so feeds are never blocked by a running check cycle; the head is
+// picked up by the next cycle instead of polling the chain's RPC endpoint.
+func (m *Monitor) PushHead(chain string, block int64, at time.Time) bool {
+	if !m.Snapshot().hasChain(chain) {
+		return false
+	}
+	m.headMu.Lock()
+	defer m.headMu.Unlock()
+	if prev, ok := m.heads[chain]; !ok || !at.Before(prev.At) {
+		m.heads[chain] = pushedHead{Block: block, At: at}
+	}
+	return true
+}
+
+// pushedHeadFresh reports whether the chain has a pushed head younger than
+// pushMaxAge.
+func (c *ChainInfo) pushedHeadFresh() bool {
+	return !c.PushedAt.IsZero() && time.Since(c.PushedAt) <= c.PushMaxAge.Duration
+}
+
+// applyPushedHeads copies pushed heads into the chains checked this cycle.
+// Must be called with mu held.
+func (m *Monitor) applyPushedHeads(chains map[string]*ChainInfo) {
+	m.headMu.Lock()
+	defer m.headMu.Unlock()
+	for name, chain := range chains {
+		if head, ok := m.heads[name]; ok {
+			chain.PushedBlock = head.Block
+			chain.PushedAt = head.At
+		}
+	}
+}
+
+// handlePushHead accepts {"block": N} from a block listener.
+func (m *Monitor) handlePushHead(w http.ResponseWriter, r *http.Request) {
+	chain := r.PathValue("chain")
+	var req struct {
+		Block int64 `json:"block"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if req.Block <= 0 {
+		writeError(w, http.StatusBadRequest, "block must be positive")
+		return
+	}
+	if !m.PushHead(chain, req.Block, time.Now()) {
+		writeError(w, http.StatusNotFound, "unknown chain")
+		return
+	}
+	m.audit(r, AuditHeadPush, chain, "", nil, req)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	healthWindow            = 20
+	DefaultHealthMaxLatency = 2 * time.Second
+)
+
+type HealthWeights struct {
+	Lag            float64 `json:"lag"`
+	Trend          float64 `json:"trend"`
+	ErrorRate      float64 `json:"errorRate"`
+	IndexingErrors float64 `json:"indexingErrors"`
+	Latency        float64 `json:"latency"`
+}
+
+type HealthConfig struct {
+	Weights    HealthWeights `json:"weights"`
+	MaxLatency Duration      `json:"maxLatency"`
+}
+
+// healthConfig is the active score configuration, replaced on config load
+// and reload while checks read it.
+var healthConfig atomic.Pointer[HealthConfig]
+
+func init() {
+	setHealthConfig(defaultHealthConfig())
+}
+
+func setHealthConfig(cfg HealthConfig) {
+	healthConfig.Store(&cfg)
+}
+
+func defaultHealthConfig() HealthConfig {
+	return HealthConfig{
+		Weights: HealthWeights{
+			Lag:            40,
+			Trend:          15,
+			ErrorRate:      20,
+			IndexingErrors: 15,
+			Latency:        10,
+		},
+		MaxLatency: Duration{DefaultHealthMaxLatency},
+	}
+}
+
+func (c *HealthConfig) validate() error {
+	w := c.Weights
+	if w.Lag < 0 || w.Trend < 0 || w.ErrorRate < 0 || w.IndexingErrors < 0 || w.Latency < 0 {
+		return fmt.Errorf("health.weights must not be negative")
+	}
+	if w.Lag+w.Trend+w.ErrorRate+w.IndexingErrors+w.Latency == 0 {
+		return fmt.Errorf("health.weights must not all be zero")
+	}
+	if c.MaxLatency.Duration <= 0 {
+		return fmt.Errorf("health.maxLatency must be positive")
+	}
+	return nil
+}
+
+func recordCheckResult(sg *SubgraphInfo, ok bool) {
+	sg.RecentChecks = append(sg.RecentChecks, ok)
+	if len(sg.RecentChecks) > healthWindow {
+		sg.RecentChecks = sg.RecentChecks[len(sg.RecentChecks)-healthWindow:]
+	}
+}
+
+// calculateHealthScore combines the individual signals, each scored from 0
+// (bad) to 1 (good), into a weighted 0-100 score.
+func calculateHealthScore(sg *SubgraphInfo, cfg HealthConfig) float64 {
+	crit := float64(sg.CritBlocksBehind)
+	if crit <= 0 {
+		crit = DefaultCritBlocksBehind
+	}
+	failed := sg.CurrentBlock == 0
+	// Without a chain head lag and its trend are unknown rather than bad, so
+	// they are left out of the score.
+	lagWeight, trendWeight := cfg.Weights.Lag, cfg.Weights.Trend
+	if !failed && !lagKnown(sg) {
+		lagWeight, trendWeight = 0, 0
+	}
+
+	lag := 0.0
+	if !failed {
+		lag = 1 - clamp01(float64(sg.BlocksBehind)/crit)
+	}
+
+	trend := 1.0
+	if n := len(sg.LastCheckedBlocks); n >= 2 && len(sg.LastCheckedHeads) == n {
+		minutes := sg.LastCheckedTimes[n-1].Sub(sg.LastCheckedTimes[0]).Minutes()
+		firstLag := sg.LastCheckedHeads[0] - sg.LastCheckedBlocks[0]
+		lastLag := sg.LastCheckedHeads[n-1] - sg.LastCheckedBlocks[n-1]
+		if minutes > 0 && lastLag > firstLag {
+			// Penalise by how much of the critical threshold the lag would
+			// grow within an hour at the current rate.
+			growthPerHour := float64(lastLag-firstLag) / minutes * 60
+			trend = 1 - clamp01(growthPerHour/crit)
+		}
+	}
+
+	errorRate := 1.0
+	if len(sg.RecentChecks) > 0 {
+		ok := 0
+		for _, c := range sg.RecentChecks {
+			if c {
+				ok++
+			}
+		}
+		errorRate = float64(ok) / float64(len(sg.RecentChecks))
+	}
+
+	indexing := 1.0
+	if sg.HasIndexingErrors {
+		indexing = 0
+	}
+
+	latency := 0.0
+	if !failed {
+		latency = 1 - clamp01(float64(sg.QueryLatency)/float64(cfg.MaxLatency.Duration))
+	}
+
+	w := cfg.Weights
+	total := lagWeight + trendWeight + w.ErrorRate + w.IndexingErrors + w.Latency
+	if total == 0 {
+		return 0
+	}
+	score := lagWeight*lag + trendWeight*trend + w.ErrorRate*errorRate + w.IndexingErrors*indexing + w.Latency*latency
+	return score / total * 100
+}
+
+func clamp01(v float64) float64 {
+	switch {
+	case v < 0:
+		return 0
+	case v > 1:
+		return 1
+	default:
+		return v
+	}
+}
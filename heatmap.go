@@ -0,0 +1,424 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// heatmapMinScale is the least lag an automatic scale draws darkest, so a
+// subgraph that never lags much is not painted dark by a few blocks.
+const heatmapMinScale = 100
+
+// lagHeatmap is a subgraph's average lag by day and hour of day.
+type lagHeatmap struct {
+	Subgraph string
+	Days     []time.Time
+	Cells    [][24]heatCell
+	ByHour   [24]heatCell
+	// Scale is the lag drawn darkest.
+	Scale float64
+}
+
+// heatCell accumulates the checks of one hour, lag over the successful ones.
+type heatCell struct {
+	lagSum float64
+	ok     int
+	errors int
+}
+
+func (c *heatCell) add(s Sample) {
+	checks, _, errors := sampleCounts(s)
+	c.errors += errors
+	if ok := checks - errors; ok > 0 {
+		c.lagSum += float64(s.BlocksBehind) * float64(ok)
+		c.ok += ok
+	}
+}
+
+// lag returns the average lag, false when the hour had no successful check.
+func (c heatCell) lag() (float64, bool) {
+	if c.ok == 0 {
+		return 0, false
+	}
+	return c.lagSum / float64(c.ok), true
+}
+
+func (c heatCell) describe(l *locale) string {
+	lag, ok := c.lag()
+	switch {
+	case !ok && c.errors == 0:
+		return l.T("no data")
+	case !ok:
+		return l.Sprintf("%s failed checks", l.Int(int64(c.errors)))
+	case c.errors > 0:
+		return l.Sprintf("%s blocks behind over %s checks, %s failed", l.Float(lag, 0), l.Int(int64(c.ok)), l.Int(int64(c.errors)))
+	}
+	return l.Sprintf("%s blocks behind over %s checks", l.Float(lag, 0), l.Int(int64(c.ok)))
+}
+
+// runHeatmap implements "heatmap": it draws each subgraph's lag by hour of
+// day over the persisted history, to show lag that recurs at the same time
+// every day.
+func runHeatmap(args []string) error {
+	fs := flag.NewFlagSet("heatmap", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file (for history.path)")
+	historyPath := fs.String("history", "", "history file to read (default: history.path from the config)")
+	last := fs.String("last", "14d", "period to draw, e.g. 7d or 30d")
+	subgraph := fs.String("subgraph", "", "only draw this subgraph")
+	format := fs.String("format", "html", "output format: html or png")
+	out := fs.String("out", "", "file to write (default heatmap.<format>)")
+	scale := fs.Float64("scale", 0, "lag in blocks drawn darkest, the same for every subgraph (default: each subgraph's largest hourly average, at least 100)")
+	utc := fs.Bool("utc", false, "use UTC hours instead of local time")
+	lang := fs.String("locale", "", "language and number format of the HTML heatmap: "+localeNames()+" (default: locale from the config, or en)")
+	fs.Parse(args)
+
+	period, err := parseDays(*last)
+	if err != nil || period <= 0 {
+		return fmt.Errorf("invalid -last %q", *last)
+	}
+	if *format != "html" && *format != "png" {
+		return fmt.Errorf("unknown -format %q, expected html or png", *format)
+	}
+	if *lang != "" && !validLocale(*lang) {
+		return fmt.Errorf("unknown -locale %q, expected one of %s", *lang, localeNames())
+	}
+	path := *historyPath
+	if *configPath != "" {
+		cfg, err := loadConfigFile(*configPath)
+		if err != nil {
+			return err
+		}
+		if path == "" {
+			path = cfg.History.Path
+		}
+		if *lang == "" {
+			*lang = cfg.Locale
+		}
+	}
+	if path == "" {
+		return fmt.Errorf("no history file: set history.path in the config or pass -history")
+	}
+	if *out == "" {
+		*out = "heatmap." + *format
+	}
+	loc := time.Local
+	if *utc {
+		loc = time.UTC
+	}
+
+	to := time.Now()
+	from := to.Add(-period)
+	samples, err := readHistoryFile(path, from)
+	if err != nil {
+		return fmt.Errorf("read history failed: %v", err)
+	}
+	if *subgraph != "" {
+		var only []Sample
+		for _, s := range samples {
+			if s.Subgraph == *subgraph {
+				only = append(only, s)
+			}
+		}
+		samples = only
+	}
+	maps := buildHeatmaps(samples, from, to, loc, *scale)
+	if len(maps) == 0 {
+		return fmt.Errorf("no samples in %s since %s", path, from.Format("2006-01-02 15:04"))
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if *format == "png" {
+		err = writeHeatmapPNG(f, maps, from, to, loc)
+	} else {
+		err = writeHeatmapHTML(f, maps, from, to, loc, *lang)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Wrote lag heatmap of %d subgraphs over %s to %s\n", len(maps), *last, *out)
+	return nil
+}
+
+// buildHeatmaps groups samples by subgraph, sorted by name, into the days
+// of [from, to] in loc. Downsampled samples coarser than an hour are left
+// out, as their hour is unknown.
+func buildHeatmaps(samples []Sample, from, to time.Time, loc *time.Location, scale float64) []*lagHeatmap {
+	first := startOfDay(from.In(loc))
+	var days []time.Time
+	for d := first; !d.After(to); d = d.AddDate(0, 0, 1) {
+		days = append(days, d)
+	}
+
+	byName := make(map[string]*lagHeatmap)
+	for _, s := range samples {
+		if s.Time.Before(from) || s.Time.After(to) || sampleResolution(s) > time.Hour {
+			continue
+		}
+		m, ok := byName[s.Subgraph]
+		if !ok {
+			m = &lagHeatmap{Subgraph: s.Subgraph, Days: days, Cells: make([][24]heatCell, len(days))}
+			byName[s.Subgraph] = m
+		}
+		t := s.Time.In(loc)
+		day := sort.Search(len(days), func(i int) bool { return days[i].After(t) }) - 1
+		if day < 0 {
+			continue
+		}
+		m.Cells[day][t.Hour()].add(s)
+		m.ByHour[t.Hour()].add(s)
+	}
+
+	maps := make([]*lagHeatmap, 0, len(byName))
+	for _, m := range byName {
+		m.Scale = scale
+		if scale <= 0 {
+			m.Scale = heatmapMinScale
+			for _, row := range m.Cells {
+				for _, c := range row {
+					if lag, ok := c.lag(); ok {
+						m.Scale = max(m.Scale, lag)
+					}
+				}
+			}
+		}
+		maps = append(maps, m)
+	}
+	sort.Slice(maps, func(i, j int) bool { return maps[i].Subgraph < maps[j].Subgraph })
+	return maps
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+var (
+	heatNoData = color.RGBA{230, 230, 230, 255}
+	heatFailed = color.RGBA{60, 60, 60, 255}
+	// heatStops runs from no lag to the heatmap's scale; lag is placed on it
+	// logarithmically so small lags stay visible next to a large one.
+	heatStops = []color.RGBA{{255, 255, 204, 255}, {254, 178, 76, 255}, {240, 59, 32, 255}, {128, 0, 38, 255}}
+)
+
+func (m *lagHeatmap) color(c heatCell) color.RGBA {
+	lag, ok := c.lag()
+	if !ok {
+		if c.errors > 0 {
+			return heatFailed
+		}
+		return heatNoData
+	}
+	t := 1.0
+	if m.Scale > 0 {
+		t = min(1, math.Log1p(lag)/math.Log1p(m.Scale))
+	}
+	pos := t * float64(len(heatStops)-1)
+	i := min(int(pos), len(heatStops)-2)
+	f := pos - float64(i)
+	a, b := heatStops[i], heatStops[i+1]
+	mix := func(x, y uint8) uint8 { return uint8(float64(x) + (float64(y)-float64(x))*f + 0.5) }
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 255}
+}
+
+type heatmapHTMLCell struct {
+	Style template.CSS
+	Title string
+}
+
+type heatmapHTMLRow struct {
+	Label string
+	Cells []heatmapHTMLCell
+}
+
+type heatmapHTMLMap struct {
+	Subgraph string
+	Scale    string
+	Rows     []heatmapHTMLRow
+	ByHour   heatmapHTMLRow
+}
+
+var heatmapTemplate = template.Must(template.New("heatmap").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th { font-weight: normal; font-size: 11px; color: #555; padding: 0 4px; }
+td { width: 22px; height: 16px; border: 1px solid #fff; }
+tr.avg td { border-top: 3px solid #fff; }
+</style>
+</head>
+<body>
+<h1>{{.Heading}}</h1>
+<p>{{.Intro}}</p>
+{{range .Maps}}<h2>{{.Subgraph}}</h2>
+<table>
+<tr><th></th>{{range $.Hours}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr><th>{{.Label}}</th>{{range .Cells}}<td style="{{.Style}}" title="{{.Title}}"></td>{{end}}</tr>
+{{end}}<tr class="avg"><th>{{.ByHour.Label}}</th>{{range .ByHour.Cells}}<td style="{{.Style}}" title="{{.Title}}"></td>{{end}}</tr>
+</table>
+<p>{{.Scale}}</p>
+{{end}}</body>
+</html>
+`))
+
+// writeHeatmapHTML writes the heatmaps as an HTML page with labels, numbers
+// and dates in the named locale.
+func writeHeatmapHTML(w io.Writer, maps []*lagHeatmap, from, to time.Time, loc *time.Location, lang string) error {
+	l := getLocale(lang)
+	if !validLocale(lang) {
+		lang = DefaultLocale
+	}
+	row := func(m *lagHeatmap, label string, when func(h int) string, cells [24]heatCell) heatmapHTMLRow {
+		r := heatmapHTMLRow{Label: label}
+		for h, c := range cells {
+			col := m.color(c)
+			r.Cells = append(r.Cells, heatmapHTMLCell{
+				Style: template.CSS(fmt.Sprintf("background: rgb(%d, %d, %d)", col.R, col.G, col.B)),
+				Title: when(h) + ": " + c.describe(l),
+			})
+		}
+		return r
+	}
+	everyDay := func(h int) string { return fmt.Sprintf("%s %02d:00", l.T("every day"), h) }
+	var views []heatmapHTMLMap
+	for _, m := range maps {
+		v := heatmapHTMLMap{
+			Subgraph: m.Subgraph,
+			Scale:    l.Sprintf("Scale: %s blocks behind.", l.Float(m.Scale, 0)),
+			ByHour:   row(m, l.T("average"), everyDay, m.ByHour),
+		}
+		for i, day := range m.Days {
+			at := func(h int) string {
+				return l.Date(time.Date(day.Year(), day.Month(), day.Day(), h, 0, 0, 0, day.Location()))
+			}
+			v.Rows = append(v.Rows, row(m, l.Day(day), at, m.Cells[i]))
+		}
+		views = append(views, v)
+	}
+	hours := make([]int, 24)
+	for h := range hours {
+		hours[h] = h
+	}
+	return heatmapTemplate.Execute(w, map[string]interface{}{
+		"Lang":    lang,
+		"Title":   l.T("Lag heatmap"),
+		"Heading": l.T("Lag by hour of day"),
+		"Intro":   l.Sprintf("%s to %s, hours in %s. Each cell is the average blocks behind over the hour's successful checks, darker for more lag (logarithmic up to the subgraph's scale); grey cells had no checks, black ones only failed checks.", l.Date(from.In(loc)), l.Date(to.In(loc)), to.In(loc).Format("MST")),
+		"Hours":   hours,
+		"Maps":    views,
+	})
+}
+
+const (
+	heatCellW   = 16
+	heatCellH   = 12
+	heatMargin  = 10
+	heatLabelW  = 8 * heatGlyphAdvance
+	heatLineH   = 5*heatFontScale + 6
+	heatSection = 20
+)
+
+// writeHeatmapPNG draws the heatmaps below each other, labelled with a
+// small built-in font.
+func writeHeatmapPNG(w io.Writer, maps []*lagHeatmap, from, to time.Time, loc *time.Location) error {
+	days := len(maps[0].Days)
+	blockH := 2*heatLineH + (days+1)*heatCellH + 4 + heatSection
+	width := 2*heatMargin + heatLabelW + 24*heatCellW
+	height := 2*heatMargin + 2*heatLineH + len(maps)*blockH
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	fillRect(img, img.Bounds(), color.RGBA{255, 255, 255, 255})
+	ink := color.RGBA{40, 40, 40, 255}
+
+	y := heatMargin
+	drawText(img, heatMargin, y, fmt.Sprintf("LAG BY HOUR %s - %s %s", from.In(loc).Format("2006-01-02"), to.In(loc).Format("2006-01-02"), to.In(loc).Format("MST")), ink)
+	y += heatLineH
+	drawText(img, heatMargin, y, "GREY: NO CHECKS, BLACK: ONLY FAILED CHECKS", ink)
+	y += heatLineH
+	left := heatMargin + heatLabelW
+	for _, m := range maps {
+		drawText(img, heatMargin, y, fmt.Sprintf("%s (SCALE %.0f)", m.Subgraph, m.Scale), ink)
+		y += heatLineH
+		for h := 0; h < 24; h += 3 {
+			drawText(img, left+h*heatCellW, y, fmt.Sprintf("%d", h), ink)
+		}
+		y += heatLineH
+		cell := func(row [24]heatCell) {
+			for h, c := range row {
+				fillRect(img, image.Rect(left+h*heatCellW, y, left+(h+1)*heatCellW-1, y+heatCellH-1), m.color(c))
+			}
+		}
+		for i, day := range m.Days {
+			drawText(img, heatMargin, y+1, day.Format("01-02"), ink)
+			cell(m.Cells[i])
+			y += heatCellH
+		}
+		y += 4
+		drawText(img, heatMargin, y+1, "AVG", ink)
+		cell(m.ByHour)
+		y += heatCellH + heatSection
+	}
+	return png.Encode(w, img)
+}
+
+func fillRect(img *image.RGBA, r image.Rectangle, c color.RGBA) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+}
+
+const (
+	heatFontScale    = 2
+	heatGlyphAdvance = 4 * heatFontScale
+)
+
+// heatGlyphs is a 3x5 pixel font, rows top to bottom. Lower case is drawn
+// as upper case and other characters as blanks.
+var heatGlyphs = map[rune]string{
+	'0': "### #.# #.# #.# ###", '1': ".#. ##. .#. .#. ###", '2': "### ..# ### #.. ###", '3': "### ..# ### ..# ###",
+	'4': "#.# #.# ### ..# ..#", '5': "### #.. ### ..# ###", '6': "### #.. ### #.# ###", '7': "### ..# ..# ..# ..#",
+	'8': "### #.# ### #.# ###", '9': "### #.# ### ..# ###",
+	'A': ".#. #.# ### #.# #.#", 'B': "##. #.# ##. #.# ##.", 'C': "### #.. #.. #.. ###", 'D': "##. #.# #.# #.# ##.",
+	'E': "### #.. ##. #.. ###", 'F': "### #.. ##. #.. #..", 'G': "### #.. #.# #.# ###", 'H': "#.# #.# ### #.# #.#",
+	'I': "### .#. .#. .#. ###", 'J': "..# ..# ..# #.# ###", 'K': "#.# #.# ##. #.# #.#", 'L': "#.. #.. #.. #.. ###",
+	'M': "#.# ### ### #.# #.#", 'N': "##. #.# #.# #.# #.#", 'O': "### #.# #.# #.# ###", 'P': "### #.# ### #.. #..",
+	'Q': "### #.# #.# ### ..#", 'R': "### #.# ##. #.# #.#", 'S': "### #.. ### ..# ###", 'T': "### .#. .#. .#. .#.",
+	'U': "#.# #.# #.# #.# ###", 'V': "#.# #.# #.# #.# .#.", 'W': "#.# #.# ### ### #.#", 'X': "#.# #.# .#. #.# #.#",
+	'Y': "#.# #.# .#. .#. .#.", 'Z': "### ..# .#. #.. ###",
+	'-': "... ... ### ... ...", ':': "... .#. ... .#. ...", '.': "... ... ... ... .#.", ',': "... ... ... .#. #..",
+	'/': "..# ..# .#. #.. #..", '_': "... ... ... ... ###", '(': ".#. #.. #.. #.. .#.", ')': ".#. ..# ..# ..# .#.",
+	'+': "... .#. ### .#. ...", '%': "#.# ..# .#. #.. #.#", '#': "#.# ### #.# ### #.#", '&': ".#. #.# .#. #.# .##",
+}
+
+func drawText(img *image.RGBA, x, y int, s string, c color.RGBA) {
+	for _, r := range strings.ToUpper(s) {
+		rows := strings.Fields(heatGlyphs[r])
+		for gy, row := range rows {
+			for gx, px := range row {
+				if px == '#' {
+					fillRect(img, image.Rect(x+gx*heatFontScale, y+gy*heatFontScale, x+(gx+1)*heatFontScale, y+(gy+1)*heatFontScale), c)
+				}
+			}
+		}
+		x += heatGlyphAdvance
+	}
+}
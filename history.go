@@ -0,0 +1,561 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultHistoryRetention = 7 * 24 * time.Hour
+	defaultHistoryPoints    = 300
+	// historyCompactInterval is how often samples past a retention are
+	// downsampled and the history file rewritten.
+	historyCompactInterval = time.Hour
+)
+
+type HistoryConfig struct {
+	Retention Duration `json:"retention"`
+	// Path, when set, persists samples as JSON lines so history survives
+	// restarts and can be read by the report command. Read at startup.
+	Path string `json:"path,omitempty"`
+	// MaxSamples, when set, caps the samples kept per subgraph in a ring
+	// buffer allocated up front, so memory stays fixed however long the
+	// retention. Read at startup.
+	MaxSamples int `json:"maxSamples,omitempty"`
+	// Downsample keeps samples older than Retention at coarser resolutions,
+	// finest first, each until its own retention. Read at startup.
+	Downsample []DownsampleTier `json:"downsample,omitempty"`
+}
+
+type DownsampleTier struct {
+	Step      Duration `json:"step"`
+	Retention Duration `json:"retention"`
+}
+
+func (c HistoryConfig) validate() error {
+	if c.Retention.Duration <= 0 {
+		return fmt.Errorf("history.retention must be positive")
+	}
+	if c.MaxSamples < 0 {
+		return fmt.Errorf("history.maxSamples must not be negative")
+	}
+	var step time.Duration
+	retention := c.Retention.Duration
+	for i, t := range c.Downsample {
+		if t.Step.Duration < time.Minute {
+			return fmt.Errorf("history.downsample[%d]: step must be at least 1m", i)
+		}
+		if step > 0 && t.Step.Duration%step != 0 {
+			return fmt.Errorf("history.downsample[%d]: step %s must be a multiple of the previous step %s", i, t.Step.Duration, step)
+		}
+		if t.Retention.Duration <= retention {
+			return fmt.Errorf("history.downsample[%d]: retention must exceed the previous retention %s", i, retention)
+		}
+		step, retention = t.Step.Duration, t.Retention.Duration
+	}
+	return nil
+}
+
+type Sample struct {
+	Time          time.Time `json:"time"`
+	Subgraph      string    `json:"subgraph"`
+	Chain         string    `json:"chain"`
+	Status        Status    `json:"status"`
+	ChainBlock    int64     `json:"chainBlock"`
+	CurrentBlock  int64     `json:"currentBlock"`
+	BlocksBehind  int64     `json:"blocksBehind"`
+	SyncSpeed     float64   `json:"syncSpeed"`
+	BlocksIndexed int64     `json:"blocksIndexed"`
+	Failed        bool      `json:"failed,omitempty"`
+	// LagUnknown marks checks without a fresh chain head, whose lag and
+	// speed are left at 0. Only their failures count.
+	LagUnknown bool `json:"lagUnknown,omitempty"`
+	// Set on samples downsampled from older ones: the bucket width, the
+	// checks merged into it, how many of them met the SLO and how many
+	// failed. Time is that of the last check; lag and speed are averaged
+	// over the successful checks.
+	Resolution      string `json:"resolution,omitempty"`
+	Checks          int    `json:"checks,omitempty"`
+	Good            int    `json:"good,omitempty"`
+	Errors          int    `json:"errors,omitempty"`
+	MaxBlocksBehind int64  `json:"maxBlocksBehind,omitempty"`
+}
+
+func newSample(sg *SubgraphInfo) Sample {
+	if !lagKnown(sg) {
+		return Sample{
+			Time:          sg.CheckedAt,
+			Subgraph:      sg.Name,
+			Chain:         sg.Chain,
+			Status:        sg.Status,
+			ChainBlock:    sg.LastBlock,
+			CurrentBlock:  sg.CurrentBlock,
+			BlocksIndexed: sg.BlocksIndexed,
+			Failed:        sg.LastError != "" || sg.CurrentBlock == 0,
+			LagUnknown:    true,
+		}
+	}
+	return Sample{
+		Time:          sg.CheckedAt,
+		Subgraph:      sg.Name,
+		Chain:         sg.Chain,
+		Status:        sg.Status,
+		ChainBlock:    sg.LastBlock,
+		CurrentBlock:  sg.CurrentBlock,
+		BlocksBehind:  sg.BlocksBehind,
+		SyncSpeed:     sg.SyncSpeed,
+		BlocksIndexed: sg.BlocksIndexed,
+		Failed:        sg.LastError != "" || sg.CurrentBlock == 0,
+	}
+}
+
+// sampleCounts returns the checks a sample stands for, how many of them
+// met the SLO and how many failed. A successful check of unknown lag
+// stands for none, as it can neither meet nor miss the SLO.
+func sampleCounts(s Sample) (checks, good, errors int) {
+	if s.Checks > 0 {
+		return s.Checks, s.Good, s.Errors
+	}
+	if s.LagUnknown && !s.Failed {
+		return 0, 0, 0
+	}
+	if sampleGood(s) {
+		good = 1
+	}
+	if s.Failed {
+		errors = 1
+	}
+	return 1, good, errors
+}
+
+// sampleMaxLag is the largest lag of the successful checks in s.
+func sampleMaxLag(s Sample) int64 {
+	return max(s.BlocksBehind, s.MaxBlocksBehind)
+}
+
+// sampleResolution is the bucket width of a downsampled sample, 0 for a
+// single check.
+func sampleResolution(s Sample) time.Duration {
+	d, _ := time.ParseDuration(s.Resolution)
+	return d
+}
+
+// HistoryStore keeps per-subgraph samples in memory, ordered by time and
+// pruned to the configured retention, optionally appending them to a file.
+// Samples past the retention are downsampled into the configured tiers by
+// Compact.
+type HistoryStore struct {
+	mu         sync.RWMutex
+	retention  time.Duration
+	maxSamples int
+	tiers      []DownsampleTier
+	samples    map[string]*sampleRing
+	path       string
+	file       *os.File
+	enc        *json.Encoder
+}
+
+func NewHistoryStore(cfg HistoryConfig) *HistoryStore {
+	return &HistoryStore{
+		retention:  cfg.Retention.Duration,
+		maxSamples: cfg.MaxSamples,
+		tiers:      cfg.Downsample,
+		samples:    make(map[string]*sampleRing),
+	}
+}
+
+// maxRetention is how long any sample is kept, raw or downsampled.
+func (h *HistoryStore) maxRetention() time.Duration {
+	if len(h.tiers) == 0 {
+		return h.retention
+	}
+	return h.tiers[len(h.tiers)-1].Retention.Duration
+}
+
+func (h *HistoryStore) Add(s Sample) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.push(s)
+	h.samples[s.Subgraph].dropBefore(s.Time.Add(-h.maxRetention()))
+
+	if h.enc != nil {
+		if err := h.enc.Encode(s); err != nil {
+			log.Printf("History write to %s failed, persistence disabled: %v", h.path, err)
+			h.closeFile()
+		}
+	}
+}
+
+// closeFile must be called with mu held.
+func (h *HistoryStore) closeFile() {
+	if h.file != nil {
+		h.file.Close()
+	}
+	h.path, h.file, h.enc = "", nil, nil
+}
+
+// push must be called with mu held.
+func (h *HistoryStore) push(s Sample) {
+	r := h.samples[s.Subgraph]
+	if r == nil {
+		r = &sampleRing{}
+		if h.maxSamples > 0 {
+			r.buf, r.fixed = make([]Sample, h.maxSamples), true
+		}
+		h.samples[s.Subgraph] = r
+	}
+	r.push(s)
+}
+
+// Persist loads the samples in path that are within retention, compacts
+// them, rewrites the file with what is kept and appends every further sample
+// to it.
+func (h *HistoryStore) Persist(path string) error {
+	samples, err := readHistoryFile(path, time.Now().Add(-h.maxRetention()))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, s := range samples {
+		h.push(s)
+	}
+	h.path = path
+	if err := h.compact(time.Now()); err != nil {
+		h.closeFile()
+		return err
+	}
+	return nil
+}
+
+// Compact downsamples the samples that have passed the raw or a tier's
+// retention, drops those past the last retention and rewrites the history
+// file with what is kept.
+func (h *HistoryStore) Compact(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.compact(now); err != nil {
+		log.Printf("History rewrite of %s failed, persistence disabled: %v", h.path, err)
+		h.closeFile()
+	}
+}
+
+// runHistoryCompaction downsamples history every historyCompactInterval.
+func (m *Monitor) runHistoryCompaction() {
+	for {
+		time.Sleep(historyCompactInterval)
+		m.store.CompactHistory(time.Now())
+	}
+}
+
+// compact must be called with mu held.
+func (h *HistoryStore) compact(now time.Time) error {
+	for name, r := range h.samples {
+		samples := make([]Sample, 0, r.n)
+		for i := 0; i < r.n; i++ {
+			samples = append(samples, *r.at(i))
+		}
+		samples = compactSamples(samples, now, h.retention, h.tiers)
+		next := &sampleRing{}
+		if h.maxSamples > 0 {
+			next.buf, next.fixed = make([]Sample, h.maxSamples), true
+			for _, s := range samples {
+				next.push(s)
+			}
+		} else {
+			next.buf, next.n = samples, len(samples)
+		}
+		h.samples[name] = next
+	}
+	if h.path == "" {
+		return nil
+	}
+
+	if h.file != nil {
+		h.file.Close()
+		h.file, h.enc = nil, nil
+	}
+	tmp := h.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	var samples []Sample
+	for _, r := range h.samples {
+		for i := 0; i < r.n; i++ {
+			samples = append(samples, *r.at(i))
+		}
+	}
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Time.Before(samples[j].Time) })
+	enc := json.NewEncoder(f)
+	for _, s := range samples {
+		if err := enc.Encode(s); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, h.path); err != nil {
+		return err
+	}
+	f, err = os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	h.file, h.enc = f, json.NewEncoder(f)
+	return nil
+}
+
+// compactSamples drops the samples of one subgraph, ordered by time, that
+// are past the last retention and merges those past the raw retention, or
+// the previous tier's, into each tier's step-wide buckets. Only whole
+// buckets are merged, so a bucket is never split across resolutions.
+func compactSamples(samples []Sample, now time.Time, retention time.Duration, tiers []DownsampleTier) []Sample {
+	last := retention
+	if len(tiers) > 0 {
+		last = tiers[len(tiers)-1].Retention.Duration
+	}
+	cutoff := now.Add(-last)
+	start := sort.Search(len(samples), func(i int) bool { return !samples[i].Time.Before(cutoff) })
+	samples = samples[start:]
+
+	for _, t := range tiers {
+		step := t.Step.Duration
+		boundary := now.Add(-retention).Truncate(step)
+		retention = t.Retention.Duration
+		end := sort.Search(len(samples), func(i int) bool { return !samples[i].Time.Before(boundary) })
+		var out, finer []Sample
+		for _, s := range samples[:end] {
+			if sampleResolution(s) >= step {
+				out = append(out, s)
+			} else {
+				finer = append(finer, s)
+			}
+		}
+		if len(finer) == 0 {
+			continue
+		}
+		out = append(out, mergeSamples(finer, step)...)
+		sort.SliceStable(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+		samples = append(out, samples[end:]...)
+	}
+	return samples
+}
+
+// mergeSamples merges samples ordered by time into one per step-wide
+// bucket. A bucket's status is the worst of its checks, its blocks those of
+// its last successful check.
+func mergeSamples(samples []Sample, step time.Duration) []Sample {
+	var out []Sample
+	var cur *Sample
+	var bucket time.Time
+	var lagSum, speedSum float64
+	flush := func() {
+		if cur == nil {
+			return
+		}
+		if ok := cur.Checks - cur.Errors; ok > 0 {
+			cur.BlocksBehind = int64(lagSum/float64(ok) + 0.5)
+			cur.SyncSpeed = speedSum / float64(ok)
+		}
+		cur.Failed = cur.Errors == cur.Checks
+		out = append(out, *cur)
+	}
+
+	for _, s := range samples {
+		checks, good, errors := sampleCounts(s)
+		if checks == 0 {
+			continue
+		}
+		if b := s.Time.Truncate(step); cur == nil || !b.Equal(bucket) {
+			flush()
+			cur = &Sample{Subgraph: s.Subgraph, Chain: s.Chain, Status: s.Status, Resolution: formatWindow(step)}
+			bucket, lagSum, speedSum = b, 0, 0
+		}
+		cur.Time = s.Time
+		cur.Checks += checks
+		cur.Good += good
+		cur.Errors += errors
+		cur.BlocksIndexed = addBlocks(cur.BlocksIndexed, s.BlocksIndexed)
+		status := s.Status
+		if s.Failed && s.Checks == 0 {
+			status = StatusError
+		}
+		if incidentSeverity[status] >= incidentSeverity[cur.Status] {
+			cur.Status = status
+		}
+		if ok := checks - errors; ok > 0 {
+			lagSum += float64(s.BlocksBehind) * float64(ok)
+			speedSum += s.SyncSpeed * float64(ok)
+			cur.ChainBlock = s.ChainBlock
+			cur.CurrentBlock = s.CurrentBlock
+			cur.MaxBlocksBehind = max(cur.MaxBlocksBehind, sampleMaxLag(s))
+		}
+	}
+	flush()
+	return out
+}
+
+// readHistoryFile returns the samples in a history file taken at or after
+// since, in file order. Unparseable lines, e.g. from a crash mid-write, are
+// skipped.
+func readHistoryFile(path string, since time.Time) ([]Sample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var samples []Sample
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var s Sample
+		if json.Unmarshal(scanner.Bytes(), &s) != nil || s.Time.Before(since) {
+			continue
+		}
+		samples = append(samples, s)
+	}
+	return samples, scanner.Err()
+}
+
+// Query returns a copy of the samples for subgraph within [from, to].
+func (h *HistoryStore) Query(subgraph string, from, to time.Time) []Sample {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	r := h.samples[subgraph]
+	if r == nil {
+		return nil
+	}
+	start := sort.Search(r.n, func(i int) bool { return !r.at(i).Time.Before(from) })
+	end := sort.Search(r.n, func(i int) bool { return r.at(i).Time.After(to) })
+	if start >= end {
+		return nil
+	}
+	out := make([]Sample, 0, end-start)
+	for i := start; i < end; i++ {
+		out = append(out, *r.at(i))
+	}
+	return out
+}
+
+// Range returns a copy of every subgraph's samples taken in [from, to),
+// ordered by time.
+func (h *HistoryStore) Range(from, to time.Time) []Sample {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var out []Sample
+	for _, r := range h.samples {
+		for i := 0; i < r.n; i++ {
+			if s := r.at(i); !s.Time.Before(from) && s.Time.Before(to) {
+				out = append(out, *s)
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	return out
+}
+
+// sampleRing holds the samples of one subgraph, oldest first. A fixed ring
+// overwrites its oldest sample when full; otherwise it grows.
+type sampleRing struct {
+	buf   []Sample
+	start int
+	n     int
+	fixed bool
+}
+
+func (r *sampleRing) at(i int) *Sample {
+	return &r.buf[(r.start+i)%len(r.buf)]
+}
+
+func (r *sampleRing) push(s Sample) {
+	if r.n == len(r.buf) {
+		if r.fixed {
+			*r.at(0) = s
+			r.start = (r.start + 1) % len(r.buf)
+			return
+		}
+		buf := make([]Sample, max(2*len(r.buf), 16))
+		for i := 0; i < r.n; i++ {
+			buf[i] = *r.at(i)
+		}
+		r.buf, r.start = buf, 0
+	}
+	*r.at(r.n) = s
+	r.n++
+}
+
+func (r *sampleRing) dropBefore(cutoff time.Time) {
+	for r.n > 0 && r.at(0).Time.Before(cutoff) {
+		*r.at(0) = Sample{}
+		r.start = (r.start + 1) % len(r.buf)
+		r.n--
+	}
+}
+
+type HistoryPoint struct {
+	Time            time.Time `json:"time"`
+	Samples         int       `json:"samples"`
+	Errors          int       `json:"errors"`
+	CurrentBlock    int64     `json:"currentBlock"`
+	BlocksBehind    float64   `json:"blocksBehind"`
+	MaxBlocksBehind int64     `json:"maxBlocksBehind"`
+	SyncSpeed       float64   `json:"syncSpeed"`
+	BlocksIndexed   int64     `json:"blocksIndexed"`
+}
+
+// downsample groups samples into step-wide buckets starting at from and
+// averages lag and speed per bucket, summing the blocks indexed in it.
+// Failed checks only count as errors.
+// Empty buckets are omitted.
+func downsample(samples []Sample, from time.Time, step time.Duration) []HistoryPoint {
+	points := []HistoryPoint{}
+	var cur *HistoryPoint
+	var ok int
+	flush := func() {
+		if cur == nil {
+			return
+		}
+		if ok > 0 {
+			cur.BlocksBehind /= float64(ok)
+			cur.SyncSpeed /= float64(ok)
+		}
+		points = append(points, *cur)
+	}
+
+	for _, s := range samples {
+		bucket := from.Add(s.Time.Sub(from) / step * step)
+		if cur == nil || !cur.Time.Equal(bucket) {
+			flush()
+			cur = &HistoryPoint{Time: bucket}
+			ok = 0
+		}
+		checks, _, errors := sampleCounts(s)
+		cur.Samples += checks
+		cur.Errors += errors
+		if checks == errors {
+			continue
+		}
+		ok += checks - errors
+		cur.CurrentBlock = s.CurrentBlock
+		cur.BlocksBehind += float64(s.BlocksBehind) * float64(checks-errors)
+		cur.SyncSpeed += s.SyncSpeed * float64(checks-errors)
+		cur.BlocksIndexed = addBlocks(cur.BlocksIndexed, s.BlocksIndexed)
+		cur.MaxBlocksBehind = max(cur.MaxBlocksBehind, sampleMaxLag(s))
+	}
+	flush()
+	return points
+}
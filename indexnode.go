@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	LagCauseProvider = "provider"
+	LagCauseIndexing = "indexing"
+)
+
+const indexingStatusQuery = `query($ids: [String!]!) {
+  indexingStatuses(subgraphs: $ids) {
+    subgraph
+    node
+    health
+    chains { network chainHeadBlock { number } latestBlock { number } }
+  }
+}`
+
+type indexingStatus struct {
+	Subgraph string `json:"subgraph"`
+	Node     string `json:"node"`
+	Health   string `json:"health"`
+	Chains   []struct {
+		Network        string      `json:"network"`
+		ChainHeadBlock *blockField `json:"chainHeadBlock"`
+		LatestBlock    *blockField `json:"latestBlock"`
+	} `json:"chains"`
+}
+
+// NetworkProgress is graph-node's view of one network indexed by a
+// deployment. Multi-network deployments report one entry per network.
+type NetworkProgress struct {
+	Network      string `json:"network"`
+	ChainHead    int64  `json:"chainHead"`
+	LatestBlock  int64  `json:"latestBlock"`
+	BlocksBehind int64  `json:"blocksBehind"`
+}
+
+// blockField accepts block numbers encoded either as JSON numbers or as
+// strings, since graph-node's index-node API returns BigInt as strings.
+type blockField struct {
+	Number int64
+}
+
+func (b *blockField) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Number json.RawMessage `json:"number"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	var s string
+	if json.Unmarshal(raw.Number, &s) == nil {
+		n, err := parseDecimalQuantity("block number", s)
+		b.Number = n
+		return err
+	}
+	if isIntegerLiteral(string(raw.Number)) {
+		n, err := parseDecimalQuantity("block number", string(raw.Number))
+		b.Number = n
+		return err
+	}
+	return json.Unmarshal(raw.Number, &b.Number)
+}
+
+func fetchIndexingStatus(indexNodeURL, deployment, requestID string) (*indexingStatus, error) {
+	statuses, err := fetchIndexingStatuses(indexNodeURL, []string{deployment}, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if len(statuses) == 0 {
+		return nil, fmt.Errorf("deployment %s not found on index node", deployment)
+	}
+	return &statuses[0], nil
+}
+
+func fetchIndexingStatuses(indexNodeURL string, deployments []string, requestID string) ([]indexingStatus, error) {
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"query":     indexingStatusQuery,
+		"variables": map[string]interface{}{"ids": deployments},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal query failed: %v", err)
+	}
+
+	resp, err := post(indexNodeURL, "application/json", reqBody, requestID)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := readBody(resp)
+	if err != nil {
+		return nil, fmt.Errorf("read response failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	var response struct {
+		Data struct {
+			IndexingStatuses []indexingStatus `json:"indexingStatuses"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("JSON error: %v", err)
+	}
+	if len(response.Errors) > 0 {
+		return nil, fmt.Errorf("GraphQL errors: %v", response.Errors[0].Message)
+	}
+	return response.Data.IndexingStatuses, nil
+}
+
+// updateNodeHead records graph-node's own view of the chain head for the
+// subgraph's deployment, so lag can be attributed to block ingestion
+// (provider) or to slow mappings (indexing). status is the deployment's
+// status from a batched query, or nil to query the index node.
+func updateNodeHead(sg *SubgraphInfo, latestBlock int64, status *indexingStatus) {
+	sg.NodeChainHead = 0
+	sg.Node = ""
+	sg.LagCause = ""
+	sg.Networks = nil
+	if sg.IndexNodeURL == "" || sg.Deployment == "" {
+		return
+	}
+	if status == nil {
+		var err error
+		status, err = fetchIndexingStatus(sg.IndexNodeURL, sg.Deployment, sg.CheckID)
+		if err != nil {
+			sg.NodeError = err.Error()
+			return
+		}
+	}
+	sg.NodeError = ""
+	sg.Node = status.Node
+	sg.Networks = networkProgress(status)
+	if len(status.Chains) == 0 || status.Chains[0].ChainHeadBlock == nil {
+		return
+	}
+	sg.NodeChainHead = status.Chains[0].ChainHeadBlock.Number
+	sg.LagCause = classifyLagCause(sg, latestBlock)
+}
+
+func networkProgress(status *indexingStatus) []NetworkProgress {
+	networks := make([]NetworkProgress, 0, len(status.Chains))
+	for _, c := range status.Chains {
+		p := NetworkProgress{Network: c.Network}
+		if c.ChainHeadBlock != nil {
+			p.ChainHead = c.ChainHeadBlock.Number
+		}
+		if c.LatestBlock != nil {
+			p.LatestBlock = c.LatestBlock.Number
+		}
+		if p.ChainHead > p.LatestBlock {
+			p.BlocksBehind = p.ChainHead - p.LatestBlock
+		}
+		networks = append(networks, p)
+	}
+	return networks
+}
+
+func classifyLagCause(sg *SubgraphInfo, latestBlock int64) string {
+	if sg.BlocksBehind < sg.WarnBlocksBehind || sg.NodeChainHead == 0 {
+		return ""
+	}
+	// Most of the lag comes from graph-node not having the blocks yet.
+	if nodeLag := latestBlock - sg.NodeChainHead; nodeLag*2 >= sg.BlocksBehind {
+		return LagCauseProvider
+	}
+	return LagCauseIndexing
+}
+
+// printNetworks lists the networks of a multi-network deployment below its
+// row in the status table.
+func printNetworks(sg *SubgraphInfo) {
+	if len(sg.Networks) < 2 {
+		return
+	}
+	for _, n := range sg.Networks {
+		fmt.Printf("  %-23s %-6s %-6s %-12d %-12d %-12d\n", "- "+n.Network, "", "", n.ChainHead, n.LatestBlock, n.BlocksBehind)
+	}
+}
+
+func formatNodeLag(sg *SubgraphInfo) string {
+	if sg.NodeChainHead == 0 || sg.LastBlock == 0 {
+		return "-"
+	}
+	return strconv.FormatInt(sg.LastBlock-sg.NodeChainHead, 10)
+}
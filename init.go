@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const discoverQuery = `{ indexingStatuses { subgraph chains { network earliestBlock { number } } } }`
+
+// starterConfig is the subset of Config written by "init"; everything else
+// keeps its defaults.
+type starterConfig struct {
+	CheckInterval Duration              `json:"checkInterval"`
+	HTTPTimeout   Duration              `json:"httpTimeout"`
+	Thresholds    Thresholds            `json:"thresholds"`
+	Chains        map[string]*ChainInfo `json:"chains"`
+	Subgraphs     []starterSubgraph     `json:"subgraphs"`
+}
+
+type starterSubgraph struct {
+	Name         string `json:"name"`
+	URL          string `json:"url"`
+	Chain        string `json:"chain"`
+	StartBlock   int64  `json:"startBlock"`
+	IndexNodeURL string `json:"indexNodeUrl,omitempty"`
+}
+
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+	eof bool
+}
+
+func (p *prompter) ask(question, def string) string {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	line, err := p.in.ReadString('\n')
+	if err != nil {
+		p.eof = true
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return def
+	}
+	return line
+}
+
+func (p *prompter) confirm(question string, def bool) bool {
+	d := "y/N"
+	if def {
+		d = "Y/n"
+	}
+	switch strings.ToLower(p.ask(question+" ("+d+")", "")) {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	}
+	return def
+}
+
+// runInit implements "init": it asks for chains and subgraphs and writes a
+// starter config file.
+func runInit(args []string) error {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	output := fs.String("o", "config.json", "config file to write")
+	force := fs.Bool("force", false, "overwrite an existing file")
+	fs.Parse(args)
+
+	if _, err := os.Stat(*output); err == nil && !*force {
+		return fmt.Errorf("%s already exists (use -force to overwrite)", *output)
+	}
+
+	p := &prompter{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+	cfg := starterConfig{
+		CheckInterval: Duration{CheckInterval},
+		HTTPTimeout:   Duration{HTTPTimeout},
+		Thresholds: Thresholds{
+			WarnBlocksBehind: DefaultWarnBlocksBehind,
+			CritBlocksBehind: DefaultCritBlocksBehind,
+			ErrorTolerance:   2,
+		},
+		Chains: make(map[string]*ChainInfo),
+	}
+
+	fmt.Fprintln(p.out, "Chains (leave the key empty to finish)")
+	for {
+		key := p.ask("Chain key (e.g. ethereum)", "")
+		if key == "" {
+			if len(cfg.Chains) > 0 {
+				break
+			}
+			if p.eof {
+				return fmt.Errorf("no chains entered")
+			}
+			fmt.Fprintln(p.out, "At least one chain is required.")
+			continue
+		}
+		name := p.ask("Display name", key)
+		rpcURL := p.ask("RPC URL", "")
+		if block, err := getLatestBlockFromChain(rpcURL, ""); err != nil {
+			fmt.Fprintf(p.out, "  warning: %v\n", err)
+		} else {
+			fmt.Fprintf(p.out, "  latest block %d\n", block)
+		}
+		cfg.Chains[key] = &ChainInfo{Name: name, RpcURL: rpcURL}
+	}
+
+	if p.confirm("Discover subgraphs from a graph-node index-node endpoint?", false) {
+		indexURL := p.ask("Index-node URL", "http://localhost:8030/graphql")
+		queryBase := p.ask("Query node base URL", defaultQueryBase(indexURL))
+		found, err := discoverSubgraphs(indexURL, queryBase)
+		if err != nil {
+			fmt.Fprintf(p.out, "  discovery failed: %v\n", err)
+		}
+		for _, sg := range found {
+			if _, ok := cfg.Chains[sg.Chain]; !ok {
+				fmt.Fprintf(p.out, "  skipping %s: chain %q is not configured\n", sg.Name, sg.Chain)
+				continue
+			}
+			if p.confirm(fmt.Sprintf("  add %s (%s)?", sg.Name, sg.Chain), true) {
+				cfg.Subgraphs = append(cfg.Subgraphs, starterSubgraph{
+					Name: sg.Name, URL: sg.URL, Chain: sg.Chain, StartBlock: sg.StartBlock, IndexNodeURL: indexURL,
+				})
+			}
+		}
+	}
+
+	fmt.Fprintln(p.out, "Subgraphs (leave the name empty to finish)")
+	for {
+		name := p.ask("Subgraph name", "")
+		if name == "" {
+			break
+		}
+		sg := starterSubgraph{Name: name}
+		sg.URL = p.ask("Query URL", "")
+		sg.Chain = p.ask("Chain key", firstChainKey(cfg.Chains))
+		if v := p.ask("Start block", "0"); v != "" {
+			start, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				fmt.Fprintf(p.out, "  invalid start block %q, using 0\n", v)
+			}
+			sg.StartBlock = start
+		}
+		cfg.Subgraphs = append(cfg.Subgraphs, sg)
+	}
+
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Validate the result the same way the monitor will load it.
+	if _, err := parseConfig(data); err != nil {
+		return fmt.Errorf("generated config is invalid: %v", err)
+	}
+	if err := os.WriteFile(*output, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(p.out, "Wrote %s with %d chains and %d subgraphs\n", *output, len(cfg.Chains), len(cfg.Subgraphs))
+	return nil
+}
+
+func firstChainKey(chains map[string]*ChainInfo) string {
+	first := ""
+	for key := range chains {
+		if first == "" || key < first {
+			first = key
+		}
+	}
+	return first
+}
+
+// defaultQueryBase guesses the query node of an index-node URL, which by
+// default listens on port 8000 instead of 8030.
+func defaultQueryBase(indexURL string) string {
+	u, err := url.Parse(indexURL)
+	if err != nil {
+		return ""
+	}
+	host := u.Hostname()
+	if u.Port() == "8030" {
+		host += ":8000"
+	} else if u.Port() != "" {
+		host += ":" + u.Port()
+	}
+	return u.Scheme + "://" + host
+}
+
+// discoverSubgraphs lists the deployments indexed by a graph-node. The
+// index-node API only knows deployment IDs, so subgraphs are named and
+// queried by ID.
+func discoverSubgraphs(indexURL, queryBase string) ([]*SubgraphInfo, error) {
+	body, err := json.Marshal(map[string]string{"query": discoverQuery})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := post(indexURL, "application/json", body, "")
+	if err != nil {
+		return nil, fmt.Errorf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := readBody(resp)
+	if err != nil {
+		return nil, fmt.Errorf("read response failed: %v", err)
+	}
+
+	var response struct {
+		Data struct {
+			IndexingStatuses []struct {
+				Subgraph string `json:"subgraph"`
+				Chains   []struct {
+					Network       string      `json:"network"`
+					EarliestBlock *blockField `json:"earliestBlock"`
+				} `json:"chains"`
+			} `json:"indexingStatuses"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("JSON error: %v", err)
+	}
+	if len(response.Errors) > 0 {
+		return nil, fmt.Errorf("GraphQL errors: %v", response.Errors[0].Message)
+	}
+
+	var found []*SubgraphInfo
+	for _, status := range response.Data.IndexingStatuses {
+		sg := &SubgraphInfo{
+			Name: status.Subgraph,
+			URL:  strings.TrimSuffix(queryBase, "/") + "/subgraphs/id/" + status.Subgraph,
+		}
+		if len(status.Chains) > 0 {
+			sg.Chain = status.Chains[0].Network
+			if b := status.Chains[0].EarliestBlock; b != nil {
+				sg.StartBlock = b.Number
+			}
+		}
+		found = append(found, sg)
+	}
+	return found, nil
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	serviceAccountDir  = "/var/run/secrets/kubernetes.io/serviceaccount"
+	defaultKubeDataKey = "config.json"
+	kubeRetryDelay     = 5 * time.Second
+)
+
+// kubeClient talks to the API server of the cluster the monitor runs in,
+// with its service account.
+type kubeClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+type kubeSource struct {
+	Resource  string // "configmaps" or "secrets"
+	Namespace string
+	Name      string
+	Key       string
+
+	*kubeClient
+}
+
+type kubeObject struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Data map[string]string `json:"data"`
+}
+
+type kubeWatchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+func newKubeClient() (*kubeClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running inside a Kubernetes cluster")
+	}
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("read CA failed: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("invalid cluster CA certificate")
+	}
+	return &kubeClient{
+		baseURL: "https://" + net.JoinHostPort(host, port),
+		client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+// kubeNamespace splits a "namespace/name" reference, defaulting to the
+// monitor's own namespace.
+func kubeNamespace(kind, ref string) (namespace, name string, err error) {
+	namespace, name, found := strings.Cut(ref, "/")
+	if !found {
+		name = namespace
+		ns, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+		if err != nil {
+			return "", "", fmt.Errorf("read namespace failed: %v", err)
+		}
+		namespace = strings.TrimSpace(string(ns))
+	}
+	if namespace == "" || name == "" {
+		return "", "", fmt.Errorf("invalid %s reference %q", kind, ref)
+	}
+	return namespace, name, nil
+}
+
+func newKubeSource(resource, ref, key string) (*kubeSource, error) {
+	client, err := newKubeClient()
+	if err != nil {
+		return nil, err
+	}
+	namespace, name, err := kubeNamespace(resource, ref)
+	if err != nil {
+		return nil, err
+	}
+	return &kubeSource{
+		Resource:   resource,
+		Namespace:  namespace,
+		Name:       name,
+		Key:        key,
+		kubeClient: client,
+	}, nil
+}
+
+func (k *kubeSource) String() string {
+	return fmt.Sprintf("%s %s/%s", strings.TrimSuffix(k.Resource, "s"), k.Namespace, k.Name)
+}
+
+func (k *kubeClient) get(path string, query url.Values) (*http.Response, error) {
+	return k.do(http.MethodGet, path, query, "", nil)
+}
+
+func (k *kubeClient) do(method, path string, query url.Values, contentType string, body []byte) (*http.Response, error) {
+	// The token is re-read on every request because projected service
+	// account tokens are rotated by the kubelet.
+	token, err := os.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil {
+		return nil, fmt.Errorf("read token failed: %v", err)
+	}
+	u := k.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+	return resp, nil
+}
+
+func (k *kubeSource) Load() (*Config, string, error) {
+	resp, err := k.get(fmt.Sprintf("/api/v1/namespaces/%s/%s/%s", k.Namespace, k.Resource, k.Name), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	var obj kubeObject
+	if err := json.NewDecoder(resp.Body).Decode(&obj); err != nil {
+		return nil, "", fmt.Errorf("JSON error: %v", err)
+	}
+	cfg, err := k.parse(&obj)
+	return cfg, obj.Metadata.ResourceVersion, err
+}
+
+func (k *kubeSource) parse(obj *kubeObject) (*Config, error) {
+	raw, ok := obj.Data[k.Key]
+	if !ok {
+		return nil, fmt.Errorf("%s has no key %q", k, k.Key)
+	}
+	data := []byte(raw)
+	if k.Resource == "secrets" {
+		decoded, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil {
+			return nil, fmt.Errorf("decode secret key %q failed: %v", k.Key, err)
+		}
+		data = decoded
+	}
+	cfg, err := parseConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	cfg.source = fmt.Sprintf("%s@%s", k, obj.Metadata.ResourceVersion)
+	return cfg, nil
+}
+
+// Watch streams changes to the object and sends every valid new config on
+// out. Invalid configs are logged and skipped so a bad edit never takes the
+// checker down. It never returns.
+func (k *kubeSource) Watch(resourceVersion string, out chan<- *Config) {
+	for {
+		rv, err := k.watchOnce(resourceVersion, out)
+		if err != nil {
+			log.Printf("Watch %s error: %v", k, err)
+			time.Sleep(kubeRetryDelay)
+		}
+		if rv == "" {
+			// Resource version expired or unknown: re-list to resync.
+			cfg, latest, err := k.Load()
+			if err != nil {
+				log.Printf("Reload %s error: %v", k, err)
+				time.Sleep(kubeRetryDelay)
+				continue
+			}
+			if latest != resourceVersion {
+				out <- cfg
+			}
+			rv = latest
+		}
+		resourceVersion = rv
+	}
+}
+
+func (k *kubeSource) watchOnce(resourceVersion string, out chan<- *Config) (string, error) {
+	query := url.Values{
+		"watch":           {"true"},
+		"fieldSelector":   {"metadata.name=" + k.Name},
+		"resourceVersion": {resourceVersion},
+	}
+	resp, err := k.get(fmt.Sprintf("/api/v1/namespaces/%s/%s", k.Namespace, k.Resource), query)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var event kubeWatchEvent
+		if err := dec.Decode(&event); err != nil {
+			if err == io.EOF {
+				return resourceVersion, nil
+			}
+			return resourceVersion, fmt.Errorf("decode event failed: %v", err)
+		}
+
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			var obj kubeObject
+			if err := json.Unmarshal(event.Object, &obj); err != nil {
+				return resourceVersion, fmt.Errorf("decode object failed: %v", err)
+			}
+			if obj.Metadata.ResourceVersion == resourceVersion {
+				continue
+			}
+			resourceVersion = obj.Metadata.ResourceVersion
+			cfg, err := k.parse(&obj)
+			if err != nil {
+				log.Printf("Ignoring invalid config from %s: %v", k, err)
+				continue
+			}
+			out <- cfg
+		case "DELETED":
+			log.Printf("%s was deleted, keeping current config", k)
+		case "ERROR":
+			return "", fmt.Errorf("watch error: %s", string(event.Object))
+		}
+	}
+}
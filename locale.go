@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultLocale = "en"
+
+// locale formats numbers and dates and translates the strings of reports
+// and chat messages. Messages are keyed by their English format string, so
+// a missing translation falls back to English.
+type locale struct {
+	thousands string
+	decimal   string
+	// day, date and dateTime are time layouts.
+	day      string
+	date     string
+	dateTime string
+	messages map[string]string
+}
+
+var locales = map[string]*locale{
+	"en": {thousands: ",", decimal: ".", day: "01-02", date: "2006-01-02 15:04", dateTime: "2006-01-02 15:04:05"},
+	"es": {thousands: ".", decimal: ",", day: "02/01", date: "02/01/2006 15:04", dateTime: "02/01/2006 15:04:05", messages: map[string]string{
+		"Lag heatmap":        "Mapa de calor del retraso",
+		"Lag by hour of day": "Retraso por hora del día",
+		"%s to %s, hours in %s. Each cell is the average blocks behind over the hour's successful checks, darker for more lag (logarithmic up to the subgraph's scale); grey cells had no checks, black ones only failed checks.": "%s a %s, horas en %s. Cada celda es el promedio de bloques de retraso de los chequeos correctos de la hora, más oscura cuanto mayor el retraso (logarítmica hasta la escala del subgrafo); las celdas grises no tuvieron chequeos y las negras solo chequeos fallidos.",
+		"average":                         "promedio",
+		"every day":                       "cada día",
+		"Scale: %s blocks behind.":        "Escala: %s bloques de retraso.",
+		"no data":                         "sin datos",
+		"%s failed checks":                "%s chequeos fallidos",
+		"%s blocks behind over %s checks": "%s bloques de retraso en %s chequeos",
+		"%s blocks behind over %s checks, %s failed": "%s bloques de retraso en %s chequeos, %s fallidos",
+		"Mon": "lun", "Tue": "mar", "Wed": "mié", "Thu": "jue", "Fri": "vie", "Sat": "sáb", "Sun": "dom",
+		"No samples in %s since %s":           "No hay muestras en %s desde %s",
+		"History report %s - %s (%s samples)": "Informe de historial %s - %s (%s muestras)",
+		"Subgraph":                            "Subgrafo",
+		"Checks":                              "Chequeos",
+		"Availability":                        "Disponib.",
+		"Avg Lag":                             "Retr. medio",
+		"Max Lag":                             "Retr. máx.",
+		"Incidents":                           "Incidentes",
+		"No incidents.":                       "Sin incidentes.",
+		"Start":                               "Inicio",
+		"End":                                 "Fin",
+		"Duration":                            "Duración",
+		"Worst":                               "Peor",
+		"ongoing":                             "en curso",
+		"Error: %s":                           "Error: %s",
+		"Block %s of %s, %s behind, %s%%":     "Bloque %s de %s, %s de retraso, %s%%",
+		"Speed %s blocks/min, ETA %s":         "Velocidad %s bloques/min, ETA %s",
+		"Checked %s":                          "Comprobado %s",
+		"Fleet: %s":                           "Flota: %s",
+		"no subgraphs checked yet":            "aún no se ha comprobado ningún subgrafo",
+		"; worst: %s (%s)":                    "; peor: %s (%s)",
+		"-%s blocks":                          "-%s bloques",
+		"\n...and %s more":                    "\n...y %s más",
+		"\n• *%s* (%s): %s, %s behind":        "\n• *%s* (%s): %s, %s de retraso",
+		"Unknown subgraph %q":                 "Subgrafo desconocido %q",
+		"You are not allowed to use this command.": "No tienes permiso para usar este comando.",
+		"Usage: %s check <subgraph>":               "Uso: %s check <subgrafo>",
+		"Re-checking *%s*...":                      "Volviendo a comprobar *%s*...",
+		"Usage:\n`%[1]s status` fleet summary\n`%[1]s status <subgraph>` one subgraph\n`%[1]s check <subgraph>` check it now": "Uso:\n`%[1]s status` resumen de la flota\n`%[1]s status <subgrafo>` un subgrafo\n`%[1]s check <subgrafo>` comprobarlo ahora",
+		"Acknowledge failed: %s": "No se pudo confirmar: %s",
+		"%s\n:white_check_mark: Acknowledged by <@%s>, silenced until %s": "%s\n:white_check_mark: Confirmado por <@%s>, silenciado hasta %s",
+		"Re-check of *%s* did not finish within %s":                       "La nueva comprobación de *%s* no terminó en %s",
+		"Acknowledge": "Confirmar",
+		"Re-check":    "Volver a comprobar",
+	}},
+	"zh": {thousands: ",", decimal: ".", day: "01-02", date: "2006-01-02 15:04", dateTime: "2006-01-02 15:04:05", messages: map[string]string{
+		"Lag heatmap":        "延迟热力图",
+		"Lag by hour of day": "按小时统计的延迟",
+		"%s to %s, hours in %s. Each cell is the average blocks behind over the hour's successful checks, darker for more lag (logarithmic up to the subgraph's scale); grey cells had no checks, black ones only failed checks.": "%s 至 %s，时区 %s。每格为该小时成功检查的平均落后区块数，延迟越大颜色越深（按对数映射到子图的刻度）；灰色表示没有检查，黑色表示只有失败的检查。",
+		"average":                         "平均",
+		"every day":                       "每天",
+		"Scale: %s blocks behind.":        "刻度：落后 %s 个区块。",
+		"no data":                         "无数据",
+		"%s failed checks":                "%s 次检查失败",
+		"%s blocks behind over %s checks": "%[2]s 次检查平均落后 %[1]s 个区块",
+		"%s blocks behind over %s checks, %s failed": "%[2]s 次检查平均落后 %[1]s 个区块，%[3]s 次失败",
+		"Mon": "周一", "Tue": "周二", "Wed": "周三", "Thu": "周四", "Fri": "周五", "Sat": "周六", "Sun": "周日",
+		"No samples in %s since %s":           "%s 中自 %s 以来没有样本",
+		"History report %s - %s (%s samples)": "历史报告 %s - %s（%s 个样本）",
+		"Subgraph":                            "子图",
+		"Checks":                              "检查次数",
+		"Availability":                        "可用性",
+		"Avg Lag":                             "平均延迟",
+		"Max Lag":                             "最大延迟",
+		"Incidents":                           "事件",
+		"No incidents.":                       "无事件。",
+		"Start":                               "开始",
+		"End":                                 "结束",
+		"Duration":                            "持续时间",
+		"Worst":                               "最差",
+		"ongoing":                             "进行中",
+		"Error: %s":                           "错误：%s",
+		"Block %s of %s, %s behind, %s%%":     "区块 %s / %s，落后 %s，%s%%",
+		"Speed %s blocks/min, ETA %s":         "速度 %s 区块/分钟，预计剩余 %s",
+		"Checked %s":                          "检查于 %s",
+		"Fleet: %s":                           "总览：%s",
+		"no subgraphs checked yet":            "尚未检查任何子图",
+		"; worst: %s (%s)":                    "；最差：%s（%s）",
+		"-%s blocks":                          "-%s 区块",
+		"\n...and %s more":                    "\n……另有 %s 个",
+		"\n• *%s* (%s): %s, %s behind":        "\n• *%s* (%s)：%s，落后 %s",
+		"Unknown subgraph %q":                 "未知子图 %q",
+		"You are not allowed to use this command.": "你无权使用此命令。",
+		"Usage: %s check <subgraph>":               "用法：%s check <子图>",
+		"Re-checking *%s*...":                      "正在重新检查 *%s*……",
+		"Usage:\n`%[1]s status` fleet summary\n`%[1]s status <subgraph>` one subgraph\n`%[1]s check <subgraph>` check it now": "用法：\n`%[1]s status` 总览\n`%[1]s status <子图>` 单个子图\n`%[1]s check <子图>` 立即检查",
+		"Acknowledge failed: %s": "确认失败：%s",
+		"%s\n:white_check_mark: Acknowledged by <@%s>, silenced until %s": "%s\n:white_check_mark: 已由 <@%s> 确认，静默至 %s",
+		"Re-check of *%s* did not finish within %s":                       "*%s* 的重新检查未在 %s 内完成",
+		"Acknowledge": "确认",
+		"Re-check":    "重新检查",
+	}},
+}
+
+// locale is the configured locale of the Slack bot's messages.
+func (m *Monitor) locale() *locale {
+	return getLocale(m.Snapshot().Config.Locale)
+}
+
+func validLocale(name string) bool {
+	return locales[name] != nil
+}
+
+func localeNames() string {
+	names := make([]string, 0, len(locales))
+	for name := range locales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// getLocale returns the named locale, or English.
+func getLocale(name string) *locale {
+	if l := locales[name]; l != nil {
+		return l
+	}
+	return locales[DefaultLocale]
+}
+
+func (l *locale) Sprintf(format string, args ...interface{}) string {
+	if msg, ok := l.messages[format]; ok {
+		format = msg
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+func (l *locale) T(s string) string {
+	if msg, ok := l.messages[s]; ok {
+		return msg
+	}
+	return s
+}
+
+// Int formats n with thousands separators.
+func (l *locale) Int(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+	var b strings.Builder
+	for i, c := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteString(l.thousands)
+		}
+		b.WriteRune(c)
+	}
+	return sign + b.String()
+}
+
+// Float formats f with prec decimals and thousands separators.
+func (l *locale) Float(f float64, prec int) string {
+	s := strconv.FormatFloat(f, 'f', prec, 64)
+	whole, frac, _ := strings.Cut(s, ".")
+	n, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return s
+	}
+	whole = l.Int(n)
+	if n == 0 && strings.HasPrefix(s, "-") {
+		whole = "-0"
+	}
+	if frac == "" {
+		return whole
+	}
+	return whole + l.decimal + frac
+}
+
+// Pad translates s and pads it to width terminal columns, counting East
+// Asian wide characters as two.
+func (l *locale) Pad(s string, width int) string {
+	s = l.T(s)
+	n := 0
+	for _, r := range s {
+		n++
+		if isWideRune(r) {
+			n++
+		}
+	}
+	if n >= width {
+		return s
+	}
+	return s + strings.Repeat(" ", width-n)
+}
+
+func isWideRune(r rune) bool {
+	return r >= 0x1100 && r <= 0x115F || r >= 0x2E80 && r <= 0xA4CF || r >= 0xAC00 && r <= 0xD7A3 ||
+		r >= 0xF900 && r <= 0xFAFF || r >= 0xFE30 && r <= 0xFE4F || r >= 0xFF00 && r <= 0xFF60 || r >= 0xFFE0 && r <= 0xFFE6
+}
+
+// Day formats t as its translated weekday and day of the year.
+func (l *locale) Day(t time.Time) string {
+	return l.T(t.Format("Mon")) + " " + t.Format(l.day)
+}
+
+func (l *locale) Date(t time.Time) string {
+	return t.Format(l.date)
+}
+
+func (l *locale) DateTime(t time.Time) string {
+	return t.Format(l.dateTime)
+}
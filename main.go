@@ -1,72 +1,261 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 )
 
+// Progress baselines: the block that counts as 0% progress.
+const (
+	ProgressBaselineStartBlock = "startBlock"
+	ProgressBaselineGenesis    = "genesis"
+	ProgressBaselineFirstSeen  = "firstSeen"
+)
+
 const (
 	DefaultMaxHistoryEntries = 6
 	CheckInterval            = 10 * time.Minute
 	HTTPTimeout              = 10 * time.Second
 )
 
-type GraphQLResponse struct {
-	Data struct {
-		Meta struct {
-			Block struct {
-				Number int64 `json:"number"`
-			} `json:"block"`
-		} `json:"_meta"`
-	} `json:"data"`
-	Errors []struct {
-		Message string `json:"message"`
-	} `json:"errors"`
+type SubgraphInfo struct {
+	Chain             string   `json:"chain"`
+	Name              string   `json:"name"`
+	URL               string   `json:"url"`
+	StartBlock        int64    `json:"startBlock"`
+	MaxHistoryEntries int      `json:"maxHistoryEntries"`
+	Priority          string   `json:"priority,omitempty"`
+	CheckInterval     Duration `json:"checkInterval"`
+	IPFSURL           string   `json:"ipfsUrl,omitempty"`
+	IndexNodeURL      string   `json:"indexNodeUrl,omitempty"`
+	Tenant            string   `json:"tenant,omitempty"`
+	ProgressBaseline  string   `json:"progressBaseline,omitempty"`
+	ResponseSchema    string   `json:"responseSchema,omitempty"`
+	GraphQLRequest    string   `json:"graphqlRequest,omitempty"`
+	// Replicas are further URLs serving the same subgraph. Checks query the
+	// fastest healthy one; all are compared every CompareInterval.
+	Replicas        []string `json:"replicas,omitempty"`
+	CompareInterval Duration `json:"compareInterval,omitempty"`
+	// Remediation overrides the remediation hook, e.g. for subgraphs on
+	// another indexing node; type "none" disables it.
+	Remediation *RemediationHook `json:"remediation,omitempty"`
+	// HeavyRanges weight the ETA for block ranges that index slower or
+	// faster than typical blocks.
+	HeavyRanges []BlockRange `json:"heavyRanges,omitempty"`
+	// MinSyncSpeed alerts when the subgraph catches up slower for
+	// SlowSyncFor (default 30m).
+	MinSyncSpeed SyncSpeedBaseline `json:"minSyncSpeed,omitempty"`
+	SlowSyncFor  Duration          `json:"slowSyncFor,omitempty"`
+	// DependsOn lists the upstreams the subgraph relies on: "chain" (its
+	// chain's RPC), "node:<name>" (a graph-node shared with other subgraphs)
+	// and "firehose:<name>". While one is down its alerts are inhibited.
+	DependsOn []string `json:"dependsOn,omitempty"`
+	// Severity overrides the global severity policy.
+	Severity *SeverityPolicy `json:"severity,omitempty"`
+	// Availability overrides the global availability thresholds.
+	Availability *AvailabilityConfig `json:"availability,omitempty"`
+	Thresholds
+	SyncState `json:"-"`
 }
 
-type SubgraphInfo struct {
-	Chain             string
-	Name              string
-	URL               string
-	StartBlock        int64
-	CurrentBlock      int64
-	LastBlock         int64
-	BlocksBehind      int64
-	SyncSpeed         float64
-	EstimatedTimeLeft time.Duration
-	LastCheckedBlocks []int64
-	LastCheckedTimes  []time.Time
-	MaxHistoryEntries int
+// SyncState is the runtime state of a subgraph, carried over on reloads.
+type SyncState struct {
+	CurrentBlock        int64
+	LastBlock           int64
+	BlocksBehind        int64
+	SyncSpeed           float64
+	ChainSpeed          float64
+	BlockTime           time.Duration
+	ChainHalted         bool
+	ChainHeadAge        time.Duration
+	BlocksIndexed       int64
+	BlocksIndexedIn     time.Duration
+	BlocksIndexedTotal  int64
+	EstimatedTimeLeft   time.Duration
+	LearnedRanges       []BlockRange
+	RangesLearnedAt     time.Time
+	LastCheckedBlocks   []int64
+	LastCheckedHeads    []int64
+	LastCheckedTimes    []time.Time
+	RecentChecks        []bool
+	AvailabilityChecks  []bool
+	AvailabilityStatus  Status
+	LastUnavailable     string
+	ConsecutiveFailures int
+	LastSuccessAt       time.Time
+	MetaCheckedAt       time.Time
+	FirstSeenBlock      int64
+	ProgressAt          time.Time
+	Remediated          *RemediationInfo
+	QueryLatency        time.Duration
+	ReplicaStates       []ReplicaState
+	ActiveURL           string
+	ComparedAt          time.Time
+	ReplicaDivergence   string
+	HasIndexingErrors   bool
+	Deployment          string
+	Graft               *GraftInfo
+	Reindex             *ReindexInfo
+	GraftResolvedFor    string
+	NodeChainHead       int64
+	Node                string
+	Networks            []NetworkProgress
+	ChainHeadSource     string
+	ChainHeadPolicy     string
+	NodeError           string
+	LagCause            string
+	HealthScore         float64
+	SLO                 *SLOStatus
+	ExpectedSyncSpeed   float64
+	BaselineStart       time.Time
+	SlowSince           time.Time
+	SlowSync            bool
+	InhibitedBy         string
+	InhibitedFrom       Status
+	Status              Status
+	LastError           string
+	CheckID             string
+	ErrorKind           string
+	CheckedAt           time.Time
+	NextCheckAt         time.Time
 }
 
 type ChainInfo struct {
-	Name        string
-	RpcURL      string
-	LatestBlock int64
+	Name   string `json:"name"`
+	RpcURL string `json:"rpcUrl"`
+	// ExplorerURL is an Etherscan/Blockscout compatible API used for the
+	// chain head when the RPC endpoint fails.
+	ExplorerURL    string `json:"explorerUrl,omitempty"`
+	ExplorerAPIKey string `json:"explorerApiKey,omitempty"`
+	// PushMaxAge is how long a head pushed to the heads endpoint replaces
+	// polling the RPC endpoint.
+	PushMaxAge Duration `json:"pushMaxAge,omitempty"`
+	// BlockTimeSampleInterval is how often the block time is measured from
+	// block timestamps, for the chain speed and the time-behind estimate.
+	BlockTimeSampleInterval Duration `json:"blockTimeSampleInterval,omitempty"`
+	// HaltAfter reports the chain as halted when its head block is older;
+	// zero disables the check.
+	HaltAfter Duration `json:"haltAfter,omitempty"`
+	// HeadPolicy is the block tag read as the chain head: latest (default),
+	// safe or finalized, for chains whose latest block is still reorged.
+	HeadPolicy         string        `json:"headPolicy,omitempty"`
+	LatestBlock        int64         `json:"-"`
+	HeadSource         string        `json:"-"`
+	PushedBlock        int64         `json:"-"`
+	PushedAt           time.Time     `json:"-"`
+	BlockTime          time.Duration `json:"-"`
+	BlockTimeSampledAt time.Time     `json:"-"`
+	// HeadTime is the timestamp of HaltBlock, the latest block, which
+	// halts are measured at whatever the head policy.
+	HeadTime  time.Time `json:"-"`
+	HaltBlock int64     `json:"-"`
+	Halted    bool      `json:"-"`
 }
 
-var (
-	query = `{"query":"{_meta{block{number}}}"}`
-	DefaultHTTPClient = &http.Client{Timeout: HTTPTimeout}
-)
+var query = `{"query":"{_meta{block{number} deployment hasIndexingErrors}}"}`
 
 func main() {
-	chains := initializeChains()
-	subgraphs := initializeSubgraphs()
+	if len(os.Args) > 1 {
+		if run, ok := commands[os.Args[1]]; ok {
+			if err := run(os.Args[2:]); err != nil {
+				log.Fatalf("%s: %v", os.Args[1], err)
+			}
+			return
+		}
+	}
 
-	checkSubgraphs(subgraphs, chains)
+	configPath := flag.String("config", "", "path to a JSON config file")
+	kubeConfigMap := flag.String("k8s-configmap", "", "load config from a ConfigMap ([namespace/]name) and watch it for changes")
+	kubeSecret := flag.String("k8s-secret", "", "load config from a Secret ([namespace/]name) and watch it for changes")
+	kubeKey := flag.String("k8s-key", defaultKubeDataKey, "ConfigMap/Secret data key holding the config")
+	listen := flag.String("listen", "", "address for the HTTP API (overrides server.listen)")
+	shard := flag.String("shard", "", "only check shard <index>/<total> of the subgraphs, e.g. 2/4 (overrides shard)")
+	format := flag.String("format", FormatAuto, "output format: auto (table on a terminal, json otherwise), table, or json (one line per check and cycle)")
+	flag.Parse()
+	out, err := outputFormat(*format, "table", "json")
+	if err != nil {
+		log.Fatalf("Config error: %v", err)
+	}
+	statusJSON = out == "json"
 
-	ticker := time.NewTicker(CheckInterval)
-	defer ticker.Stop()
+	cfg, reloads, err := loadConfig(*configPath, *kubeConfigMap, *kubeSecret, *kubeKey)
+	if err != nil {
+		log.Fatalf("Config error: %v", err)
+	}
 
-	for range ticker.C {
-		checkSubgraphs(subgraphs, chains)
+	if *listen != "" {
+		cfg.Server.Listen = *listen
 	}
+	if *shard != "" {
+		if cfg.Shard, err = parseShard(*shard); err != nil {
+			log.Fatalf("Config error: %v", err)
+		}
+	}
+
+	log.Printf("subgraph-monitor %s", versionString())
+	monitor, err := NewMonitor(cfg)
+	if err != nil {
+		log.Fatalf("Storage error: %v", err)
+	}
+	if cfg.UpdateCheck.Enabled {
+		go runUpdateChecks(cfg.UpdateCheck)
+	}
+	if cfg.Export.Parquet.Path != "" {
+		go monitor.runParquetExport(cfg.Export.Parquet)
+	}
+	if len(cfg.History.Downsample) > 0 {
+		go monitor.runHistoryCompaction()
+	}
+	if cfg.Cluster.AutoReassign {
+		go monitor.runReassign(cfg.Cluster)
+	}
+	if cfg.SlackBot.Enabled() {
+		monitor.startSlackBot(cfg.SlackBot)
+	}
+	if cfg.Server.Listen != "" {
+		go monitor.Serve(cfg.Server)
+	}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	monitor.Run(reloads, stop)
+}
+
+func loadConfig(path, configMap, secret, key string) (*Config, <-chan *Config, error) {
+	var source *kubeSource
+	var err error
+	switch {
+	case configMap != "" && secret != "":
+		return nil, nil, fmt.Errorf("-k8s-configmap and -k8s-secret are mutually exclusive")
+	case configMap != "":
+		source, err = newKubeSource("configmaps", configMap, key)
+	case secret != "":
+		source, err = newKubeSource("secrets", secret, key)
+	case path != "":
+		cfg, err := loadConfigFile(path)
+		return cfg, nil, err
+	default:
+		return defaultConfig(), nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cfg, resourceVersion, err := source.Load()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", source, err)
+	}
+	reloads := make(chan *Config)
+	go source.Watch(resourceVersion, reloads)
+	log.Printf("Watching %s for config changes", source)
+	return cfg, reloads, nil
 }
 
 func initializeChains() map[string]*ChainInfo {
@@ -90,29 +279,51 @@ func initializeSubgraphs() []*SubgraphInfo {
 	}
 }
 
-func checkSubgraphs(subgraphs []*SubgraphInfo, chains map[string]*ChainInfo) {
-	updateChainBlocks(chains)
+func checkSubgraphs(cycleID string, subgraphs []*SubgraphInfo, chains map[string]*ChainInfo, indexNode IndexNodeConfig) {
+	updateChainBlocks(cycleID, chains)
+	sampleBlockTimes(cycleID, chains)
+	checkChainHalts(cycleID, chains)
+	batched := batchIndexingStatuses(cycleID, subgraphs, indexNode)
 	subgraphsByChain := groupSubgraphsByChain(subgraphs)
 
 	for chainName, chainSubgraphs := range subgraphsByChain {
 		chainInfo, ok := chains[chainName]
 		if !ok {
-			log.Printf("No chain info for %s", chainName)
 			continue
 		}
-		processChainSubgraphs(chainInfo, chainSubgraphs)
+		processChainSubgraphs(chainInfo, chainSubgraphs, batched)
 	}
 }
 
-func updateChainBlocks(chains map[string]*ChainInfo) {
+func updateChainBlocks(cycleID string, chains map[string]*ChainInfo) {
 	for name, info := range chains {
-		block, err := getLatestBlockFromChain(name, info.RpcURL)
-		if err != nil {
-			log.Printf("Chain %s error: %v", name, err)
+		// Pushed heads are latest blocks, so they only replace a latest head.
+		if info.HeadPolicy == HeadPolicyLatest && info.pushedHeadFresh() {
+			info.LatestBlock = info.PushedBlock
+			info.HeadSource = HeadSourcePush
+			log.Printf("[%s] Chain %s latest block: %d (%s)", cycleID, name, info.LatestBlock, HeadSourcePush)
 			continue
 		}
+		block, err := getHeadBlockFromChain(info.RpcURL, info.HeadPolicy, cycleID)
+		source := HeadSourceRPC
+		if err != nil {
+			log.Printf("[%s] Chain %s error: %v", cycleID, name, err)
+			// The explorer only serves the latest block.
+			if info.ExplorerURL == "" || info.HeadPolicy != HeadPolicyLatest {
+				info.HeadSource = HeadSourceStale
+				continue
+			}
+			block, err = getLatestBlockFromExplorer(info.ExplorerURL, info.ExplorerAPIKey, cycleID)
+			if err != nil {
+				log.Printf("[%s] Chain %s explorer error: %v", cycleID, name, err)
+				info.HeadSource = HeadSourceStale
+				continue
+			}
+			source = HeadSourceExplorer
+		}
 		info.LatestBlock = block
-		log.Printf("Chain %s latest block: %d", name, block)
+		info.HeadSource = source
+		log.Printf("[%s] Chain %s %s block: %d (%s)", cycleID, name, info.HeadPolicy, block, source)
 	}
 }
 
@@ -124,57 +335,205 @@ func groupSubgraphsByChain(subgraphs []*SubgraphInfo) map[string][]*SubgraphInfo
 	return group
 }
 
-func processChainSubgraphs(chainInfo *ChainInfo, subgraphs []*SubgraphInfo) {
-	if chainInfo.LatestBlock == 0 {
-		log.Printf("Skipping %s subgraphs, latest block = 0", chainInfo.Name)
-		return
+// processChainSubgraphs checks the subgraphs of a chain, printing their
+// table unless the monitor prints JSON lines.
+func processChainSubgraphs(chainInfo *ChainInfo, subgraphs []*SubgraphInfo, batched map[*SubgraphInfo]*indexingStatus) {
+	table := !statusJSON
+	if table {
+		printHeader(chainInfo)
+		if chainInfo.LatestBlock == 0 {
+			fmt.Printf("  CHAIN HEAD UNKNOWN: subgraphs are checked, but their lag, sync speed, ETA and progress are unknown until the chain head is read\n")
+		}
+		if chainInfo.Halted {
+			fmt.Printf("  CHAIN HALTED: head block %d is %s old\n", chainInfo.HaltBlock, chainHeadAge(chainInfo).Round(time.Second))
+		}
 	}
 
-	printHeader(chainInfo)
-
+	statuses := make([]SubgraphStatus, 0, len(subgraphs))
 	for _, sg := range subgraphs {
-		processSubgraph(sg, chainInfo.LatestBlock)
-		printSubgraphStatus(sg)
+		sg.ChainHeadSource = chainInfo.HeadSource
+		sg.ChainHeadPolicy = chainInfo.HeadPolicy
+		sg.BlockTime = chainInfo.BlockTime
+		sg.ChainHalted = chainInfo.Halted
+		sg.ChainHeadAge = chainHeadAge(chainInfo)
+		processSubgraph(sg, chainInfo.LatestBlock, batched[sg])
+		sg.Status = classifySubgraph(sg)
+		sg.HealthScore = calculateHealthScore(sg, *healthConfig.Load())
+		if table {
+			printSubgraphStatus(sg)
+			printNetworks(sg)
+			printReindex(sg)
+			printReplicas(sg)
+			printRemediation(sg)
+			printAvailability(sg)
+		}
+		statuses = append(statuses, newSubgraphStatus(sg))
+	}
+	if table && len(subgraphs) > 1 {
+		printChainSummary(summarizeChains(statuses)[0])
 	}
 }
 
 func printHeader(chainInfo *ChainInfo) {
-	fmt.Printf("\n--- %s Subgraph Sync Status (Latest Block: %d) - %s ---\n",
-		chainInfo.Name, chainInfo.LatestBlock, time.Now().Format("2006-01-02 15:04:05"))
-	fmt.Printf("%-25s %-12s %-12s %-12s %-15s %-15s %s\n",
-		"Subgraph", "ChainBlock", "Subgraph", "Behind", "Sync Speed", "ETA", "Progress")
+	fmt.Printf("\n--- %s Subgraph Sync Status (%s: %s) - %s ---\n",
+		chainInfo.Name, headLabel(chainInfo.HeadPolicy), formatChainHead(chainInfo), time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Printf("%-25s %-6s %-6s %-12s %-12s %-12s %-9s %-15s %-15s %s\n",
+		"Subgraph", "Status", "Health", "ChainBlock", "Subgraph", "Behind", "Node Lag", "Sync Speed", "ETA", "Progress")
 }
 
-func processSubgraph(sg *SubgraphInfo, latestBlock int64) {
-	current, err := getCurrentBlock(sg.URL, query)
+// processSubgraph checks a subgraph with a _meta query, or from batched, its
+// status in a batched index node query, when that is not nil.
+func processSubgraph(sg *SubgraphInfo, latestBlock int64, batched *indexingStatus) {
+	sg.CheckedAt = time.Now()
+	prevActive := sg.ActiveURL
+	var meta subgraphMeta
+	var err error
+	if batched != nil {
+		meta = batchedMeta(sg, batched)
+		sg.ActiveURL = sg.IndexNodeURL
+	} else {
+		meta, err = fetchReplicatedMeta(sg)
+		if err == nil {
+			sg.MetaCheckedAt = sg.CheckedAt
+		}
+	}
+	recordCheckResult(sg, err == nil)
+	if batched == nil {
+		recordAvailability(sg, err)
+	}
 	if err != nil {
-		log.Printf("Error %s: %v", sg.Name, err)
-		sg.CurrentBlock = 0
-		sg.BlocksBehind = latestBlock - sg.StartBlock
-		sg.SyncSpeed = 0
-		sg.EstimatedTimeLeft = 0
+		// Keep the last successful block and lag, annotated as stale, so a
+		// transient failure does not make the table and metrics swing.
+		sg.LastError = err.Error()
+		sg.ErrorKind = graphQLErrorKind(err)
+		if isRateLimited(err) {
+			sg.ErrorKind = ErrorKindRateLimited
+		}
+		if isSchemaError(err) {
+			sg.ErrorKind = ErrorKindSchema
+		}
+		sg.QueryLatency = 0
+		if sg.ErrorKind == ErrorKindRateLimited {
+			// The endpoint's limit, not the subgraph's health: keep the last
+			// state and try again once the backoff has passed.
+			logCheck(sg, "Subgraph %s: %v", sg.Name, err)
+			return
+		}
+		if sg.ErrorKind == GraphQLErrorDeploying {
+			// Not a failure: check again soon instead of counting it.
+			if retry := sg.CheckedAt.Add(deployingRetryInterval); retry.Before(sg.NextCheckAt) {
+				sg.NextCheckAt = retry
+			}
+			logCheck(sg, "Subgraph %s is deploying: %v", sg.Name, err)
+			return
+		}
+		if sg.CurrentBlock == 0 {
+			// Never reached: the head is still known, and lag stays unknown.
+			sg.LastBlock = latestBlock
+		}
+		sg.ConsecutiveFailures++
+		logCheck(sg, "Error %s (%d/%d): %v", sg.Name, sg.ConsecutiveFailures, sg.ErrorTolerance, err)
 		return
 	}
 
-	updateSubgraphHistory(sg, current)
+	sg.ConsecutiveFailures = 0
+	sg.LastSuccessAt = sg.CheckedAt
+	sg.LastError = ""
+	sg.ErrorKind = ""
+	sg.QueryLatency = meta.Latency
+	sg.HasIndexingErrors = meta.HasIndexingErrors
+	if sg.Deployment != "" && meta.Deployment != "" && meta.Deployment != sg.Deployment {
+		logCheck(sg, "Subgraph %s redeployed (%s -> %s), resetting sync history", sg.Name, sg.Deployment, meta.Deployment)
+		resetSyncHistory(sg)
+		sg.Reindex = nil
+		sg.FirstSeenBlock = 0
+	} else if len(sg.Replicas) > 0 && prevActive != "" && sg.ActiveURL != prevActive {
+		// Replicas index at their own pace: a lower block from the new
+		// endpoint is no rewind, and speeds mixing both would be wrong.
+		logCheck(sg, "Subgraph %s switched from %s to %s, resetting sync history", sg.Name, prevActive, sg.ActiveURL)
+		resetSyncHistory(sg)
+	} else {
+		detectRewind(sg, meta.Block)
+	}
+	if sg.FirstSeenBlock == 0 {
+		sg.FirstSeenBlock = meta.Block
+	}
+	sg.Deployment = meta.Deployment
+	updateGraftInfo(sg, meta.Deployment)
+	if latestBlock == 0 {
+		// Without a chain head only the subgraph's block is known. Lag, and
+		// the history that speed and ETA are computed from, wait for the
+		// head.
+		sg.CurrentBlock = meta.Block
+		sg.BlocksBehind = 0
+		sg.EstimatedTimeLeft = 0
+		return
+	}
+	if sg.ChainHeadSource == HeadSourceStale {
+		// Measured against a stale head the subgraph would soon look in
+		// sync, so lag stays unknown until the head moves again.
+		sg.CurrentBlock = meta.Block
+		sg.LastBlock = latestBlock
+		return
+	}
+	trackProgress(sg, meta.Block, latestBlock)
+	updateSubgraphHistory(sg, meta.Block, latestBlock)
 	calculateSyncMetrics(sg, latestBlock)
+	updateReindexProgress(sg)
+	updateNodeHead(sg, latestBlock, batched)
 }
 
-func updateSubgraphHistory(sg *SubgraphInfo, currentBlock int64) {
+func updateSubgraphHistory(sg *SubgraphInfo, currentBlock, latestBlock int64) {
 	now := time.Now()
+	recordBlockDelta(sg, currentBlock, now)
 	sg.LastCheckedBlocks = append(sg.LastCheckedBlocks, currentBlock)
+	sg.LastCheckedHeads = append(sg.LastCheckedHeads, latestBlock)
 	sg.LastCheckedTimes = append(sg.LastCheckedTimes, now)
 
-	if len(sg.LastCheckedBlocks) > sg.MaxHistoryEntries {
+	for len(sg.LastCheckedBlocks) > sg.MaxHistoryEntries {
 		sg.LastCheckedBlocks = sg.LastCheckedBlocks[1:]
+		sg.LastCheckedHeads = sg.LastCheckedHeads[1:]
 		sg.LastCheckedTimes = sg.LastCheckedTimes[1:]
 	}
 }
 
+// recordBlockDelta records the blocks indexed since the previous successful
+// check and adds them to the subgraph's running total, which only grows so it
+// can be exported as a counter. The first check after a reset or redeploy has
+// no previous block and records no delta.
+func recordBlockDelta(sg *SubgraphInfo, currentBlock int64, now time.Time) {
+	sg.BlocksIndexed = 0
+	sg.BlocksIndexedIn = 0
+	n := len(sg.LastCheckedBlocks)
+	if n == 0 {
+		return
+	}
+	sg.BlocksIndexed = currentBlock - sg.LastCheckedBlocks[n-1]
+	sg.BlocksIndexedIn = now.Sub(sg.LastCheckedTimes[n-1])
+	if sg.BlocksIndexed > 0 {
+		sg.BlocksIndexedTotal = addBlocks(sg.BlocksIndexedTotal, sg.BlocksIndexed)
+	}
+}
+
+// resetSyncHistory drops the samples speed and ETA are derived from, so they
+// are recomputed from scratch after a redeploy instead of mixing deployments.
+func resetSyncHistory(sg *SubgraphInfo) {
+	sg.LastCheckedBlocks = nil
+	sg.LastCheckedHeads = nil
+	sg.LastCheckedTimes = nil
+	sg.SyncSpeed = 0
+	sg.ChainSpeed = 0
+	sg.EstimatedTimeLeft = 0
+}
+
 func calculateSyncMetrics(sg *SubgraphInfo, latestBlock int64) {
 	sg.CurrentBlock = sg.LastCheckedBlocks[len(sg.LastCheckedBlocks)-1]
 	sg.LastBlock = latestBlock
-	sg.BlocksBehind = latestBlock - sg.CurrentBlock
+	// A safe or finalized head trails blocks the subgraph may already have.
+	sg.BlocksBehind = max(0, latestBlock-sg.CurrentBlock)
+	if sg.BlockTime > 0 {
+		sg.ChainSpeed = float64(time.Minute) / float64(sg.BlockTime)
+	}
 
 	if len(sg.LastCheckedBlocks) >= 2 {
 		first := 0
@@ -185,104 +544,162 @@ func calculateSyncMetrics(sg *SubgraphInfo, latestBlock int64) {
 
 		if timeDiff > 0 {
 			sg.SyncSpeed = float64(blockDiff) / timeDiff
+			if sg.BlockTime == 0 {
+				sg.ChainSpeed = float64(sg.LastCheckedHeads[last]-sg.LastCheckedHeads[first]) / timeDiff
+			}
 			if sg.SyncSpeed > 0 {
-				etaMin := float64(sg.BlocksBehind) / sg.SyncSpeed
-				sg.EstimatedTimeLeft = time.Duration(etaMin * float64(time.Minute))
+				sg.EstimatedTimeLeft = estimateTimeLeft(sg, sg.LastCheckedBlocks[first], timeDiff)
 			}
 		}
 	}
 }
 
 func printSubgraphStatus(sg *SubgraphInfo) {
-	progressPct := calculateProgressPercentage(sg)
-	etaDisplay := formatETA(sg)
-
-	fmt.Printf("%-25s %-12d %-12s %-12d %-15.2f %-15s %.2f%%\n",
+	unknown := unknownSignals(sg)
+	fmt.Printf("%-25s %-6s %-6.0f %-12s %-12s %-12s %-9s %-15s %-15s %s\n",
 		sg.Name,
-		sg.LastBlock,
+		sg.Status,
+		sg.HealthScore,
+		knownOr(unknown, UnknownChainBlock, strconv.FormatInt(sg.LastBlock, 10)),
 		formatCurrentBlock(sg),
-		sg.BlocksBehind,
-		sg.SyncSpeed,
-		etaDisplay,
-		progressPct)
+		knownOr(unknown, UnknownBlocksBehind, strconv.FormatInt(sg.BlocksBehind, 10)),
+		formatNodeLag(sg),
+		knownOr(unknown, UnknownSyncSpeed, fmt.Sprintf("%.2f", sg.SyncSpeed)),
+		knownOr(unknown, UnknownETA, formatETA(sg)),
+		knownOr(unknown, UnknownProgress, fmt.Sprintf("%.2f%%", calculateProgressPercentage(sg))))
 }
 
 func calculateProgressPercentage(sg *SubgraphInfo) float64 {
-	if sg.CurrentBlock == 0 || sg.StartBlock == 0 || sg.LastBlock <= sg.StartBlock {
+	start, ok := progressStartBlock(sg)
+	if sg.CurrentBlock == 0 || !ok || sg.LastBlock <= start {
 		return 0.0
 	}
-	return float64(sg.CurrentBlock-sg.StartBlock) / float64(sg.LastBlock-sg.StartBlock) * 100
+	return float64(sg.CurrentBlock-start) / float64(sg.LastBlock-start) * 100
+}
+
+// progressStartBlock is the block progress is measured from, by the
+// subgraph's progress baseline. With the start block baseline it is the graft
+// block for grafted subgraphs, since everything before it was copied from the
+// base. It reports false when the block is not known.
+func progressStartBlock(sg *SubgraphInfo) (int64, bool) {
+	switch sg.ProgressBaseline {
+	case ProgressBaselineGenesis:
+		return 0, true
+	case ProgressBaselineFirstSeen:
+		return sg.FirstSeenBlock, sg.FirstSeenBlock > 0
+	}
+	if sg.Graft != nil && sg.Graft.Block > 0 {
+		return sg.Graft.Block, true
+	}
+	return sg.StartBlock, sg.StartBlock > 0
+}
+
+func validProgressBaseline(b string) bool {
+	switch b {
+	case "", ProgressBaselineStartBlock, ProgressBaselineGenesis, ProgressBaselineFirstSeen:
+		return true
+	}
+	return false
 }
 
 func formatETA(sg *SubgraphInfo) string {
-	if sg.CurrentBlock == 0 {
-		return "Error"
+	if sg.CurrentBlock == 0 || sg.LastBlock == 0 {
+		return "unknown"
 	}
 	if sg.EstimatedTimeLeft <= 0 {
 		if sg.BlocksBehind == 0 {
 			return "In sync"
 		}
-		return "Unknown"
+		return "unknown"
 	}
-	days := sg.EstimatedTimeLeft.Hours() / 24
+	return formatETADuration(sg.EstimatedTimeLeft)
+}
+
+func formatETADuration(d time.Duration) string {
+	days := d.Hours() / 24
 	switch {
 	case days >= 1:
 		return fmt.Sprintf("%.1fd", days)
-	case sg.EstimatedTimeLeft.Hours() >= 1:
-		return fmt.Sprintf("%.1fh", sg.EstimatedTimeLeft.Hours())
+	case d.Hours() >= 1:
+		return fmt.Sprintf("%.1fh", d.Hours())
 	default:
-		return fmt.Sprintf("%.0fm", sg.EstimatedTimeLeft.Minutes())
+		return fmt.Sprintf("%.0fm", d.Minutes())
 	}
 }
 
 func formatCurrentBlock(sg *SubgraphInfo) string {
 	if sg.CurrentBlock == 0 {
-		return "Error"
+		return "unknown"
+	}
+	if age := staleFor(sg); age > 0 {
+		return fmt.Sprintf("%d (stale %s)", sg.CurrentBlock, age.Round(time.Second))
 	}
 	return fmt.Sprintf("%d", sg.CurrentBlock)
 }
 
-func getCurrentBlock(url, queryStr string) (int64, error) {
+// staleFor returns how old the shown state of a subgraph is when its latest
+// checks failed, or 0 when the last check succeeded.
+func staleFor(sg *SubgraphInfo) time.Duration {
+	if sg.LastError == "" || sg.LastSuccessAt.IsZero() {
+		return 0
+	}
+	return sg.CheckedAt.Sub(sg.LastSuccessAt)
+}
+
+type subgraphMeta struct {
+	Block             int64
+	Deployment        string
+	HasIndexingErrors bool
+	Latency           time.Duration
+}
+
+// fetchSubgraphMetaRetrying retries a query once after a store error, which
+// usually means a busy or restarting database.
+func fetchSubgraphMetaRetrying(url, requestID, schema, mode string) (subgraphMeta, error) {
+	meta, err := fetchSubgraphMeta(url, query, requestID, schema, mode)
+	if graphQLErrorKind(err) == GraphQLErrorStore {
+		time.Sleep(storeErrorRetryDelay)
+		meta, err = fetchSubgraphMeta(url, query, requestID, schema, mode)
+	}
+	return meta, err
+}
+
+// fetchSubgraphMeta queries _meta, sent as the graphqlRequest mode asks,
+// reading the response according to the responseSchema mode schema.
+func fetchSubgraphMeta(url, queryStr, requestID, schema, mode string) (subgraphMeta, error) {
 	var queryObj map[string]string
 	if err := json.Unmarshal([]byte(queryStr), &queryObj); err != nil {
-		return 0, fmt.Errorf("invalid GraphQL query: %v", err)
+		return subgraphMeta{}, fmt.Errorf("invalid GraphQL query: %v", err)
 	}
 
-	reqBody, err := json.Marshal(queryObj)
-	if err != nil {
-		return 0, fmt.Errorf("marshal query failed: %v", err)
+	start := time.Now()
+	resp, err := sendGraphQL(url, queryObj["query"], mode, requestID)
+	if rl := rateLimitError(err); rl != nil {
+		return subgraphMeta{}, rl
 	}
-
-	resp, err := DefaultHTTPClient.Post(url, "application/json", bytes.NewBuffer(reqBody))
 	if err != nil {
-		return 0, fmt.Errorf("HTTP error: %v", err)
+		return subgraphMeta{}, &endpointError{Err: err}
 	}
 	defer resp.Body.Close()
 
+	body, err := readBody(resp)
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return 0, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+		return subgraphMeta{}, &endpointError{Status: resp.StatusCode, Body: string(body)}
 	}
-
-	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return 0, fmt.Errorf("read response failed: %v", err)
+		return subgraphMeta{}, fmt.Errorf("read response failed: %v", err)
 	}
+	latency := time.Since(start)
 
-	var response GraphQLResponse
-	if err := json.Unmarshal(body, &response); err != nil {
-		return 0, fmt.Errorf("JSON error: %v", err)
-	}
-	if len(response.Errors) > 0 {
-		return 0, fmt.Errorf("GraphQL errors: %v", response.Errors[0].Message)
-	}
-	if response.Data.Meta.Block.Number <= 0 {
-		return 0, fmt.Errorf("invalid block number: %d", response.Data.Meta.Block.Number)
+	meta, err := parseMetaResponse(body, schema)
+	if err != nil {
+		return subgraphMeta{}, err
 	}
-	return response.Data.Meta.Block.Number, nil
+	meta.Latency = latency
+	return meta, nil
 }
 
-func getLatestBlockFromChain(chainName, rpcURL string) (int64, error) {
+func getLatestBlockFromChain(rpcURL, requestID string) (int64, error) {
 	reqBody, err := json.Marshal(map[string]interface{}{
 		"jsonrpc": "2.0",
 		"method":  "eth_blockNumber",
@@ -293,7 +710,7 @@ func getLatestBlockFromChain(chainName, rpcURL string) (int64, error) {
 		return 0, err
 	}
 
-	resp, err := DefaultHTTPClient.Post(rpcURL, "application/json", bytes.NewBuffer(reqBody))
+	resp, err := post(rpcURL, "application/json", reqBody, requestID)
 	if err != nil {
 		return 0, err
 	}
@@ -305,17 +722,63 @@ func getLatestBlockFromChain(chainName, rpcURL string) (int64, error) {
 			Message string `json:"message"`
 		} `json:"error"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	body, err := readBody(resp)
+	if err != nil {
+		return 0, fmt.Errorf("read response failed: %v", err)
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
 		return 0, err
 	}
 	if result.Error.Message != "" {
 		return 0, fmt.Errorf("RPC error: %s", result.Error.Message)
 	}
 
-	var block int64
-	_, err = fmt.Sscanf(result.Result, "0x%x", &block)
+	return parseHexQuantity("block number", result.Result)
+}
+
+// getHeadBlockFromChain reads the chain head under policy: eth_blockNumber
+// for latest, the number of the block tagged safe or finalized otherwise.
+func getHeadBlockFromChain(rpcURL, policy, requestID string) (int64, error) {
+	if policy == HeadPolicyLatest {
+		return getLatestBlockFromChain(rpcURL, requestID)
+	}
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_getBlockByNumber",
+		"params":  []interface{}{policy, false},
+		"id":      1,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := post(rpcURL, "application/json", reqBody, requestID)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Result *struct {
+			Number string `json:"number"`
+		} `json:"result"`
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	body, err := readBody(resp)
 	if err != nil {
-		return 0, fmt.Errorf("parse block error: %v", err)
+		return 0, fmt.Errorf("read response failed: %v", err)
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return 0, err
+	}
+	if result.Error.Message != "" {
+		return 0, fmt.Errorf("RPC error: %s", result.Error.Message)
 	}
-	return block, nil
+	if result.Result == nil {
+		return 0, fmt.Errorf("no %s block", policy)
+	}
+
+	return parseHexQuantity("block number", result.Result.Number)
 }
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const metricsNamespace = "subgraph_monitor"
+
+// metricsWriter renders the Prometheus text exposition format without
+// pulling in the client library. Samples are grouped per metric family, as
+// the format requires, and written out by flush.
+type metricsWriter struct {
+	order    []string
+	families map[string]*metricFamily
+}
+
+type metricFamily struct {
+	help, kind string
+	lines      []string
+}
+
+func newMetricsWriter() *metricsWriter {
+	return &metricsWriter{families: make(map[string]*metricFamily)}
+}
+
+func (mw *metricsWriter) gauge(name, help string, value float64, labels ...string) {
+	mw.sample(name, "gauge", help, value, labels...)
+}
+
+func (mw *metricsWriter) sample(name, kind, help string, value float64, labels ...string) {
+	name, f := mw.family(name, kind, help)
+	f.lines = append(f.lines, fmt.Sprintf("%s%s %g", name, formatLabels(labels), value))
+}
+
+// histogram writes the cumulative buckets, sum and count of one series;
+// counts[i] holds the observations up to bounds[i].
+func (mw *metricsWriter) histogram(name, help string, bounds []float64, counts []uint64, sum float64, count uint64, labels ...string) {
+	name, f := mw.family(name, "histogram", help)
+	for i, le := range bounds {
+		f.lines = append(f.lines, fmt.Sprintf("%s_bucket%s %d", name, formatLabels(append(labels[:len(labels):len(labels)], "le", strconv.FormatFloat(le, 'g', -1, 64))), counts[i]))
+	}
+	f.lines = append(f.lines,
+		fmt.Sprintf("%s_bucket%s %d", name, formatLabels(append(labels[:len(labels):len(labels)], "le", "+Inf")), count),
+		fmt.Sprintf("%s_sum%s %g", name, formatLabels(labels), sum),
+		fmt.Sprintf("%s_count%s %d", name, formatLabels(labels), count))
+}
+
+func (mw *metricsWriter) family(name, kind, help string) (string, *metricFamily) {
+	name = metricsNamespace + "_" + name
+	f, ok := mw.families[name]
+	if !ok {
+		f = &metricFamily{help: help, kind: kind}
+		mw.families[name] = f
+		mw.order = append(mw.order, name)
+	}
+	return name, f
+}
+
+func (mw *metricsWriter) flush(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+	for _, name := range mw.order {
+		f := mw.families[name]
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, f.help, name, f.kind)
+		for _, line := range f.lines {
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Flush()
+}
+
+func formatLabels(kv []string) string {
+	if len(kv) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(kv); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=%q", kv[i], kv[i+1])
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func boolGauge(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+func (m *Monitor) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	statuses := filterStatuses(m.Statuses(), viewTenant(r))
+	snap := m.Snapshot()
+	chains, sources := snap.ChainHeads, snap.HeadSources
+
+	mw := newMetricsWriter()
+	mw.gauge("build_info", "Build information of the running monitor.", 1,
+		"version", version, "commit", commit, "build_date", buildDate, "goversion", runtime.Version())
+	if latest, available := updates.get(); latest != "" {
+		mw.gauge("update_available", "Whether a newer release than the running version is published.", boolGauge(available), "latest", latest)
+	}
+	warnings := visibleWarnings(snap.Warnings, viewTenant(r))
+	mw.gauge("config_warnings", "Config problems leaving part of the config without effect, listed by /api/v1/warnings.", float64(len(warnings)))
+	for _, cw := range warnings {
+		mw.gauge("config_warning", "One config problem: an unused_chain or a missing_chain of a subgraph.", 1, "kind", cw.Kind, "chain", cw.Chain, "subgraph", cw.Subgraph)
+	}
+
+	names := make([]string, 0, len(chains))
+	for name := range chains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		mw.gauge("chain_latest_block", "Latest block of the chain, from RPC, a pushed head or the explorer fallback.", float64(chains[name]), "chain", name)
+	}
+	for _, name := range names {
+		if bt := snap.BlockTimes[name]; bt > 0 {
+			mw.gauge("chain_block_time_seconds", "Average block time measured from block timestamps.", bt.Seconds(), "chain", name)
+		}
+	}
+	for _, name := range names {
+		if halted, ok := snap.Halted[name]; ok {
+			if ht := snap.HeadTimes[name]; !ht.IsZero() {
+				mw.gauge("chain_head_age_seconds", "Age of the chain's head block by its timestamp.", time.Since(ht).Seconds(), "chain", name)
+			}
+			mw.gauge("chain_halted", "Whether the chain's head block is older than haltAfter.", boolGauge(halted), "chain", name)
+		}
+	}
+	for _, name := range names {
+		for _, source := range []string{HeadSourceRPC, HeadSourceExplorer, HeadSourcePush, HeadSourceStale} {
+			mw.gauge("chain_head_source", "Source of the chain head (1 for the active source).",
+				boolGauge(sources[name] == source), "chain", name, "source", source)
+		}
+	}
+
+	for _, c := range summarizeChains(statuses) {
+		mw.gauge("chain_subgraphs", "Subgraphs on the chain by state.", float64(c.Healthy), "chain", c.Chain, "state", "healthy")
+		mw.gauge("chain_subgraphs", "Subgraphs on the chain by state.", float64(c.Behind), "chain", c.Chain, "state", "behind")
+		mw.gauge("chain_subgraphs", "Subgraphs on the chain by state.", float64(c.Failed), "chain", c.Chain, "state", "failed")
+		mw.gauge("chain_subgraphs", "Subgraphs on the chain by state.", float64(c.RateLimited), "chain", c.Chain, "state", "rate_limited")
+		mw.gauge("chain_max_blocks_behind", "Largest lag of the chain's subgraphs.", float64(c.MaxBlocksBehind), "chain", c.Chain)
+		mw.gauge("chain_median_sync_speed", "Median indexing speed of the chain's subgraphs in blocks per minute.", c.MedianSyncSpeed, "chain", c.Chain)
+	}
+
+	for _, s := range statuses {
+		labels := []string{"subgraph", s.Name, "chain", s.Chain}
+		// Unknown values are left out rather than exported as 0.
+		known := func(signal string) bool { return !slices.Contains(s.Unknown, signal) }
+		if known(UnknownCurrentBlock) {
+			mw.gauge("subgraph_current_block", "Latest block indexed by the subgraph.", float64(s.CurrentBlock), labels...)
+		}
+		if known(UnknownBlocksBehind) {
+			mw.gauge("subgraph_blocks_behind", "Blocks between the chain head and the subgraph.", float64(s.BlocksBehind), labels...)
+			if s.BlockTime > 0 {
+				mw.gauge("subgraph_time_behind_seconds", "Estimated time between the chain head and the subgraph's block.", s.TimeBehind, labels...)
+			}
+		}
+		if known(UnknownSyncSpeed) {
+			mw.gauge("subgraph_sync_speed", "Indexing speed in blocks per minute.", s.SyncSpeed, labels...)
+		}
+		mw.sample("subgraph_blocks_indexed_total", "counter", "Blocks indexed by the subgraph since the monitor started.", float64(s.BlocksIndexedTotal), labels...)
+		mw.gauge("subgraph_blocks_indexed_last_check", "Blocks indexed between the last two successful checks.", float64(s.BlocksIndexed), labels...)
+		if known(UnknownETA) {
+			mw.gauge("subgraph_eta_seconds", "Estimated seconds until the subgraph is in sync.", s.ETASeconds, labels...)
+		}
+		if known(UnknownProgress) {
+			mw.gauge("subgraph_progress_percent", "Indexing progress from the progress baseline block.", s.Progress, labels...)
+		}
+		mw.gauge("subgraph_health_score", "Composite 0-100 health score.", s.HealthScore, labels...)
+		mw.gauge("subgraph_indexing_errors", "Whether the subgraph reports indexing errors.", boolGauge(s.HasIndexingErrors), labels...)
+		mw.gauge("subgraph_query_latency_seconds", "Latency of the last status query.", s.QueryLatencyMs/1000, labels...)
+		mw.gauge("subgraph_stale_seconds", "Age of the shown state when the latest checks failed, 0 when fresh.", s.StaleSeconds, labels...)
+		if s.NodeChainHead > 0 {
+			mw.gauge("subgraph_node_chain_head", "Chain head block ingested by the subgraph's graph-node.", float64(s.NodeChainHead), labels...)
+		}
+		for _, n := range s.Networks {
+			netLabels := append(labels[:len(labels):len(labels)], "network", n.Network)
+			mw.gauge("subgraph_network_latest_block", "Latest block indexed per network, from graph-node's index-node API.", float64(n.LatestBlock), netLabels...)
+			mw.gauge("subgraph_network_blocks_behind", "Blocks between graph-node's chain head and the deployment, per network.", float64(n.BlocksBehind), netLabels...)
+		}
+		if s.Reindex != nil {
+			mw.gauge("subgraph_reindex_progress_percent", "Re-indexing progress toward the block reached before a rewind.", s.Reindex.Progress, labels...)
+		}
+		if s.SLO != nil {
+			mw.gauge("subgraph_error_budget_remaining", "Share of the SLO error budget left in the SLO window.", s.SLO.BudgetRemaining, labels...)
+			for _, w := range burnWindows {
+				for _, d := range []time.Duration{w.Long, w.Short} {
+					window := formatWindow(d)
+					mw.gauge("subgraph_error_budget_burn_rate", "Rate the error budget is consumed at over the window.",
+						s.SLO.BurnRates[window], append(labels[:len(labels):len(labels)], "window", window)...)
+				}
+				mw.gauge("subgraph_error_budget_alert", "Whether the burn rate alert is firing.",
+					boolGauge(s.SLO.Alert == w.Alert), append(labels[:len(labels):len(labels)], "alert", w.Alert)...)
+			}
+		}
+		for _, r := range s.Replicas {
+			replicaLabels := append(labels[:len(labels):len(labels)], "url", r.URL)
+			mw.gauge("subgraph_replica_up", "Whether the replica answered its last query.", boolGauge(r.Healthy), replicaLabels...)
+			mw.gauge("subgraph_replica_latency_seconds", "Moving average of the replica's query latency.", r.LatencyMs/1000, replicaLabels...)
+			mw.gauge("subgraph_replica_block", "Latest block served by the replica at its last query.", float64(r.Block), replicaLabels...)
+		}
+		if len(s.Replicas) > 0 {
+			mw.gauge("subgraph_replicas_diverged", "Whether the replicas serve different deployments or blocks too far apart.", boolGauge(s.ReplicaDivergence != ""), labels...)
+		}
+		if s.ExpectedSyncSpeed > 0 {
+			mw.gauge("subgraph_expected_sync_speed", "Slowest indexing speed in blocks per minute expected while catching up.", s.ExpectedSyncSpeed, labels...)
+			mw.gauge("subgraph_slow_sync", "Whether the subgraph has been catching up slower than expected for slowSyncFor.", boolGauge(s.SlowSync), labels...)
+		}
+		if s.Availability != nil {
+			mw.gauge("subgraph_availability", "Share of the recent checks the subgraph endpoint answered without a transport error or HTTP 5xx.", *s.Availability, labels...)
+		}
+		mw.gauge("subgraph_availability_alert", "Whether availability is below warnBelow (1) or critBelow (2).", availabilityLevel(s.AvailabilityStatus), labels...)
+		mw.gauge("subgraph_stalled_seconds", "Seconds the subgraph has been behind the chain head without indexing a block.", s.StalledSeconds, labels...)
+		if r := s.Remediation; r != nil {
+			mw.sample("subgraph_remediations_total", "counter", "Remediation hook calls for the subgraph since the monitor started.", float64(r.Count), labels...)
+			mw.gauge("subgraph_remediation_failed", "Whether the last remediation hook call failed.", boolGauge(r.Error != ""), labels...)
+		}
+		if s.Graft != nil {
+			mw.gauge("subgraph_graft_block", "Graft block of a grafted subgraph.", float64(s.Graft.Block), labels...)
+			mw.gauge("subgraph_graft_base_available", "Whether the graft base deployment is still served.", boolGauge(s.Graft.BaseAvailable), labels...)
+		}
+		for _, st := range []Status{StatusOK, StatusWarn, StatusCrit, StatusError, StatusFailed, StatusRateLimited} {
+			mw.gauge("subgraph_status", "Current status of the subgraph (1 for the active status).",
+				boolGauge(s.Status == st), append(labels, "status", string(st))...)
+		}
+	}
+
+	for _, fh := range m.Snapshot().visibleFirehose(viewTenant(r)) {
+		labels := []string{"endpoint", fh.Name, "chain", fh.Chain}
+		mw.gauge("firehose_up", "Whether the Firehose endpoint answered its last check.", boolGauge(fh.Status != StatusError && fh.Status != StatusUnknown), labels...)
+		mw.gauge("firehose_serving", "Whether the Firehose gRPC health service reports SERVING.", boolGauge(fh.Serving == "SERVING"), labels...)
+		mw.gauge("firehose_head_block", "Latest block streamed by the Firehose endpoint.", float64(fh.HeadBlock), labels...)
+		mw.gauge("firehose_blocks_behind", "Blocks between the chain head and the Firehose endpoint.", float64(fh.BlocksBehind), labels...)
+	}
+	for _, c := range certificateInfos(snap.Config.Certificates.WarnBefore.Duration, time.Now()) {
+		mw.gauge("certificate_expiry_seconds", "Seconds until the certificate of an HTTPS endpoint expires, negative once expired.", c.ExpiresIn, "host", c.Host)
+	}
+	m.httpStats.write(mw)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	mw.flush(w)
+}
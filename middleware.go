@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+type CORSConfig struct {
+	AllowedOrigins   []string `json:"allowedOrigins"`
+	AllowCredentials bool     `json:"allowCredentials"`
+}
+
+func (c CORSConfig) validate() error {
+	if c.AllowCredentials && slices.Contains(c.AllowedOrigins, "*") {
+		return fmt.Errorf("allowCredentials cannot be combined with the \"*\" origin, list the origins instead")
+	}
+	return nil
+}
+
+// allows reports whether origin may call the API, and whether it is listed
+// by name rather than only matched by "*".
+func (c CORSConfig) allows(origin string) (allowed, listed bool) {
+	for _, o := range c.AllowedOrigins {
+		if strings.EqualFold(o, origin) {
+			return true, true
+		}
+		if o == "*" {
+			allowed = true
+		}
+	}
+	return allowed, false
+}
+
+// corsMiddleware answers preflight requests itself so that browsers can
+// discover the allowed headers before sending credentials.
+func corsMiddleware(cfg CORSConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		allowed, listed := cfg.allows(origin)
+		if !allowed {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Only named origins get credentials; "*" must never let any site
+		// read the API with the user's credentials.
+		if listed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if cfg.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type trustedProxies []*net.IPNet
+
+func parseTrustedProxies(cidrs []string) (trustedProxies, error) {
+	var nets trustedProxies
+	for _, c := range cidrs {
+		if !strings.Contains(c, "/") {
+			if strings.Contains(c, ":") {
+				c += "/128"
+			} else {
+				c += "/32"
+			}
+		}
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %v", c, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func (t trustedProxies) contains(ip net.IP) bool {
+	for _, n := range t {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyMiddleware rewrites RemoteAddr and the URL scheme/host from
+// X-Forwarded-* headers, but only for requests arriving from a trusted
+// proxy. The client address is the right-most X-Forwarded-For entry that is
+// not itself a trusted proxy.
+func proxyMiddleware(trusted trustedProxies, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil || !trusted.contains(net.ParseIP(host)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			hops := strings.Split(xff, ",")
+			for i := len(hops) - 1; i >= 0; i-- {
+				ip := net.ParseIP(strings.TrimSpace(hops[i]))
+				if ip == nil {
+					break
+				}
+				r.RemoteAddr = net.JoinHostPort(ip.String(), "0")
+				if !trusted.contains(ip) {
+					break
+				}
+			}
+		}
+		if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+			r.URL.Scheme = proto
+		}
+		if fwdHost := r.Header.Get("X-Forwarded-Host"); fwdHost != "" {
+			r.Host = fwdHost
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func normalizeBasePath(p string) string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return ""
+	}
+	return "/" + p
+}
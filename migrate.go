@@ -0,0 +1,272 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const stateArchiveFormat = 1
+
+// Files in a state archive. History and events are the monitor's own JSON
+// lines files, so an imported archive is read like any other on startup.
+const (
+	stateManifestFile = "manifest.json"
+	stateConfigFile   = "config.json"
+	stateHistoryFile  = "history.jsonl"
+	stateEventsFile   = "events.jsonl"
+	stateAuditFile    = "audit.jsonl"
+)
+
+type stateManifest struct {
+	Format     int       `json:"format"`
+	Version    string    `json:"version"`
+	Host       string    `json:"host"`
+	ExportedAt time.Time `json:"exportedAt"`
+	Files      []string  `json:"files"`
+}
+
+// runExportState implements "export-state": it packs the config file, the
+// persisted history, the event log and the audit log into one archive for moving the
+// monitor to another host.
+func runExportState(args []string) error {
+	fs := flag.NewFlagSet("export-state", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to the JSON config file to export (required)")
+	out := fs.String("out", "subgraph-monitor-state.tar.gz", "archive to write")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s export-state [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *configPath == "" {
+		return fmt.Errorf("-config is required")
+	}
+
+	raw, err := os.ReadFile(*configPath)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfigFile(*configPath)
+	if err != nil {
+		return err
+	}
+
+	host, _ := os.Hostname()
+	manifest := stateManifest{
+		Format:     stateArchiveFormat,
+		Version:    version,
+		Host:       host,
+		ExportedAt: time.Now().UTC(),
+		Files:      []string{stateConfigFile},
+	}
+	files := map[string]string{
+		stateHistoryFile: cfg.History.Path,
+		stateEventsFile:  cfg.EventLog.Path,
+		stateAuditFile:   cfg.Audit.Path,
+	}
+	for _, name := range []string{stateHistoryFile, stateEventsFile, stateAuditFile} {
+		if files[name] == "" {
+			continue
+		}
+		if _, err := os.Stat(files[name]); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		manifest.Files = append(manifest.Files, name)
+	}
+
+	// The config may hold credentials, so the archive is only readable by
+	// its owner.
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	err = writeStateArchive(tw, manifest, raw, files)
+	if cerr := tw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := gz.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(*out)
+		return err
+	}
+	fmt.Printf("Exported %v to %s\n", manifest.Files, *out)
+	return nil
+}
+
+func writeStateArchive(tw *tar.Writer, manifest stateManifest, config []byte, files map[string]string) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, stateManifestFile, manifest.ExportedAt, data); err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, stateConfigFile, manifest.ExportedAt, config); err != nil {
+		return err
+	}
+	for _, name := range manifest.Files[1:] {
+		// Read whole so a file the running monitor appends to is archived
+		// at one consistent length.
+		data, err := os.ReadFile(files[name])
+		if err != nil {
+			return err
+		}
+		if err := writeTarFile(tw, name, manifest.ExportedAt, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, modTime time.Time, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(data)), ModTime: modTime}); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// runImportState implements "import-state": it restores an archive written
+// by export-state. The monitor must not be running while it does.
+func runImportState(args []string) error {
+	fs := flag.NewFlagSet("import-state", flag.ExitOnError)
+	configPath := fs.String("config", "", "config file to restore to; an existing one is kept and decides where history and events go (required)")
+	in := fs.String("in", "subgraph-monitor-state.tar.gz", "archive to read")
+	force := fs.Bool("force", false, "overwrite existing history, event log and audit log files")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s import-state [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *configPath == "" {
+		return fmt.Errorf("-config is required")
+	}
+
+	manifest, contents, err := readStateArchive(*in)
+	if err != nil {
+		return fmt.Errorf("read %s failed: %v", *in, err)
+	}
+	fmt.Printf("Archive from %s exported %s by version %s\n", manifest.Host, manifest.ExportedAt.Format(time.RFC3339), manifest.Version)
+
+	if _, err := os.Stat(*configPath); err == nil {
+		fmt.Printf("Keeping existing config %s\n", *configPath)
+	} else if os.IsNotExist(err) {
+		if err := writeStateFile(*configPath, contents[stateConfigFile], 0o600); err != nil {
+			return err
+		}
+		fmt.Printf("Restored config to %s\n", *configPath)
+	} else {
+		return err
+	}
+	cfg, err := loadConfigFile(*configPath)
+	if err != nil {
+		return err
+	}
+
+	targets := []struct {
+		name, path, setting string
+	}{
+		{stateHistoryFile, cfg.History.Path, "history.path"},
+		{stateEventsFile, cfg.EventLog.Path, "eventLog.path"},
+		{stateAuditFile, cfg.Audit.Path, "audit.path"},
+	}
+	for _, t := range targets {
+		if _, ok := contents[t.name]; !ok {
+			continue
+		}
+		if t.path == "" {
+			fmt.Printf("Skipping %s: %s is not set in %s\n", t.name, t.setting, *configPath)
+			continue
+		}
+		if st, err := os.Stat(t.path); err == nil && st.Size() > 0 && !*force {
+			return fmt.Errorf("%s already exists, pass -force to overwrite it", t.path)
+		}
+	}
+	for _, t := range targets {
+		data, ok := contents[t.name]
+		if !ok || t.path == "" {
+			continue
+		}
+		if err := writeStateFile(t.path, data, 0o644); err != nil {
+			return err
+		}
+		fmt.Printf("Restored %s to %s (%d bytes)\n", t.name, t.path, len(data))
+	}
+	return nil
+}
+
+func readStateArchive(path string) (stateManifest, map[string][]byte, error) {
+	var manifest stateManifest
+	f, err := os.Open(path)
+	if err != nil {
+		return manifest, nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return manifest, nil, err
+	}
+	contents := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, nil, err
+		}
+		switch hdr.Name {
+		case stateManifestFile, stateConfigFile, stateHistoryFile, stateEventsFile, stateAuditFile:
+		default:
+			continue
+		}
+		if contents[hdr.Name], err = io.ReadAll(tr); err != nil {
+			return manifest, nil, err
+		}
+	}
+
+	if err := json.Unmarshal(contents[stateManifestFile], &manifest); err != nil {
+		return manifest, nil, fmt.Errorf("invalid %s: %v", stateManifestFile, err)
+	}
+	if manifest.Format != stateArchiveFormat {
+		return manifest, nil, fmt.Errorf("unsupported archive format %d", manifest.Format)
+	}
+	for _, name := range manifest.Files {
+		if _, ok := contents[name]; !ok {
+			return manifest, nil, fmt.Errorf("%s listed in the manifest is missing", name)
+		}
+	}
+	if _, ok := contents[stateConfigFile]; !ok {
+		return manifest, nil, fmt.Errorf("%s is missing", stateConfigFile)
+	}
+	return manifest, contents, nil
+}
+
+// writeStateFile replaces path atomically, creating its directory.
+func writeStateFile(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
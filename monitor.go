@@ -0,0 +1,521 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Monitor owns the subgraph state. mu serialises the check loop and
+// configuration changes; readers use the published Snapshot instead.
+type Monitor struct {
+	mu        sync.Mutex
+	state     stateStore
+	chains    map[string]*ChainInfo
+	subgraphs []*SubgraphInfo
+	firehose  []*FirehoseInfo
+	cfg       *Config
+	silenceMu sync.Mutex
+	silences  map[string]Silence
+	headMu    sync.Mutex
+	heads     map[string]pushedHead
+	events    *EventHub
+	store     Store
+	httpStats *httpStats
+	changes   CycleChanges
+	// wake interrupts the wait for the next due check, e.g. after CheckNow.
+	wake chan struct{}
+	// remediations and certStatuses are guarded by mu.
+	remediations remediationState
+	certStatuses map[string]Status
+	// upstreams holds the status of each upstream named in a dependsOn
+	// list, guarded by mu.
+	upstreams map[string]Status
+	// simulated marks transitions as tests, set by the simulate command.
+	simulated bool
+	// shard is the startup config's, kept across reloads.
+	shard Shard
+}
+
+func NewMonitor(cfg *Config) (*Monitor, error) {
+	store, err := newStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	applyHTTPConfig(cfg)
+	setHealthConfig(cfg.Health)
+	cfg.Shard.apply(cfg)
+	m := &Monitor{
+		chains:    cfg.Chains,
+		subgraphs: cfg.Subgraphs,
+		firehose:  cfg.Firehose,
+		cfg:       cfg,
+		silences:  make(map[string]Silence),
+		heads:     make(map[string]pushedHead),
+		events:    NewEventHub(),
+		store:     store,
+		httpStats: newHTTPStats(),
+		changes:   CycleChanges{Changes: []StatusChange{}},
+		wake:      make(chan struct{}, 1),
+		shard:     cfg.Shard,
+	}
+	m.publishSnapshot()
+	return m, nil
+}
+
+// Run checks every subgraph whenever its own check interval has elapsed, so
+// subgraphs in higher priority tiers are checked more often. It returns
+// after printing a last fleet summary when stop receives a signal.
+func (m *Monitor) Run(reloads <-chan *Config, stop <-chan os.Signal) {
+	// Subscribe before the first cycle, so its transitions are notified.
+	go m.runNotifiers(m.events.SubscribeAlerts())
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			m.runCycle()
+		case sig := <-stop:
+			if statusJSON {
+				log.Printf("Stopping on %s. Fleet: %s", sig, summarizeFleet(m.Statuses()).Text)
+			} else {
+				fmt.Printf("\n=== Stopping on %s. Fleet: %s ===\n", sig, summarizeFleet(m.Statuses()).Text)
+			}
+			return
+		case cfg := <-reloads:
+			m.applyConfig(cfg)
+			stopTimer(timer)
+		case <-m.wake:
+			stopTimer(timer)
+		}
+		timer.Reset(m.untilNextCheck())
+	}
+}
+
+func stopTimer(timer *time.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+}
+
+func (m *Monitor) untilNextCheck() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.subgraphs) == 0 && len(m.firehose) == 0 {
+		return m.cfg.CheckInterval.Duration
+	}
+	next := time.Now().Add(m.cfg.CheckInterval.Duration)
+	for _, sg := range m.subgraphs {
+		if sg.NextCheckAt.Before(next) {
+			next = sg.NextCheckAt
+		}
+	}
+	for _, fh := range m.firehose {
+		if fh.NextCheckAt.Before(next) {
+			next = fh.NextCheckAt
+		}
+	}
+	if wait := time.Until(next); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// dueSubgraphs returns the subgraphs whose next check time has passed and
+// the chains they need, scheduling their following check.
+func (m *Monitor) dueSubgraphs(now time.Time) ([]*SubgraphInfo, map[string]*ChainInfo) {
+	var due []*SubgraphInfo
+	chains := make(map[string]*ChainInfo)
+	for _, sg := range m.subgraphs {
+		if sg.NextCheckAt.After(now) {
+			continue
+		}
+		sg.NextCheckAt = now.Add(sg.CheckInterval.Duration)
+		due = append(due, sg)
+		if chain, ok := m.chains[sg.Chain]; ok {
+			chains[sg.Chain] = chain
+		}
+	}
+	return due, chains
+}
+
+// dueFirehose returns the Firehose endpoints due for a check, adding their
+// chains to chains. Endpoints use the global check interval.
+func (m *Monitor) dueFirehose(now time.Time, chains map[string]*ChainInfo) []*FirehoseInfo {
+	var due []*FirehoseInfo
+	for _, fh := range m.firehose {
+		if fh.NextCheckAt.After(now) {
+			continue
+		}
+		fh.NextCheckAt = now.Add(m.cfg.CheckInterval.Duration)
+		due = append(due, fh)
+		if chain, ok := m.chains[fh.Chain]; ok {
+			chains[fh.Chain] = chain
+		}
+	}
+	return due
+}
+
+// addOwnedChains adds to chains the chains whose halts and upstream state
+// this shard reports for every shard, though none of its own checks may use
+// them. Only sharded monitors need it.
+func (m *Monitor) addOwnedChains(chains map[string]*ChainInfo) {
+	if m.shard.Total <= 1 {
+		return
+	}
+	owned := func(name string) {
+		if chain, ok := m.chains[name]; ok && m.shard.ownsChain(name) {
+			chains[name] = chain
+		}
+	}
+	for name, chain := range m.chains {
+		if chain.HaltAfter.Duration > 0 {
+			owned(name)
+		}
+	}
+	for _, up := range m.cfg.upstreams {
+		if name, ok := strings.CutPrefix(up, "chain:"); ok {
+			owned(name)
+		}
+	}
+}
+
+func (m *Monitor) applyConfig(cfg *Config) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if cfg.Shard.Total != 0 && cfg.Shard != m.shard {
+		log.Printf("Config reload changes shard from %q to %q, which needs a restart; keeping %q", m.shard, cfg.Shard, m.shard)
+	}
+	m.shard.apply(cfg)
+	m.store.SaveAudit(AuditEntry{
+		Time:   time.Now(),
+		Actor:  cfg.source,
+		Action: AuditConfigReload,
+		Diff:   diffJSON(m.cfg, cfg),
+	})
+	m.chains = mergeChainState(m.chains, cfg.Chains)
+	m.subgraphs = mergeSubgraphHistory(m.subgraphs, cfg.Subgraphs)
+	m.firehose = mergeFirehoseState(m.firehose, cfg.Firehose)
+	m.cfg = cfg
+	applyHTTPConfig(cfg)
+	setHealthConfig(cfg.Health)
+	m.publishSnapshot()
+	log.Printf("Config reloaded: %d chains, %d subgraphs, %d firehose endpoints", len(m.chains), len(m.subgraphs), len(m.firehose))
+}
+
+// printCycle prints the fleet summary, config warnings and expiring
+// certificates after a cycle, or with JSON output, a line per check and one
+// for the cycle.
+func (m *Monitor) printCycle(cycleID string, due []*SubgraphInfo, dueFirehose []*FirehoseInfo, start, now time.Time) {
+	snap := m.Snapshot()
+	fleet := summarizeFleet(m.Statuses())
+	certs := certificateInfos(snap.Config.Certificates.WarnBefore.Duration, now)
+	if !statusJSON {
+		fmt.Printf("\nFleet: %s\n", fleet.Text)
+		for _, w := range snap.Warnings {
+			fmt.Printf("Config warning: %s\n", w.Message)
+		}
+		if expiring := formatExpiringCertificates(certs); expiring != "" {
+			fmt.Printf("Certificates: %s\n", expiring)
+		}
+		return
+	}
+	checked := make(map[string]bool, len(due)+len(dueFirehose))
+	for _, sg := range due {
+		checked["subgraph:"+sg.Name] = !sg.CheckedAt.Before(start)
+	}
+	for _, fh := range dueFirehose {
+		checked["firehose:"+fh.Name] = true
+	}
+	for _, st := range snap.Subgraphs {
+		if checked["subgraph:"+st.Name] {
+			printStatusLine(StatusLine{Type: "subgraph", CycleID: cycleID, Subgraph: &st})
+		}
+	}
+	for _, fh := range snap.Firehose {
+		if checked["firehose:"+fh.Name] {
+			printStatusLine(StatusLine{Type: "firehose", CycleID: cycleID, Firehose: &fh})
+		}
+	}
+	expiring := []CertInfo{}
+	for _, c := range certs {
+		if c.Status != StatusOK {
+			expiring = append(expiring, c)
+		}
+	}
+	printStatusLine(StatusLine{Type: "cycle", CycleID: cycleID, Fleet: &fleet, Warnings: snap.Warnings, Certificates: expiring})
+}
+
+func (m *Monitor) runCycle() {
+	m.mu.Lock()
+	start := time.Now()
+	due, chains := m.dueSubgraphs(start)
+	dueFirehose := m.dueFirehose(start, chains)
+	// A shard with nothing of its own to check still checks the chains it
+	// owns, once per check interval.
+	idle := len(m.subgraphs) == 0 && len(m.firehose) == 0
+	if len(due) > 0 || len(dueFirehose) > 0 || idle {
+		m.addOwnedChains(chains)
+	}
+	if len(due) == 0 && len(dueFirehose) == 0 && len(chains) == 0 {
+		m.mu.Unlock()
+		return
+	}
+	cycleID := newCycleID()
+	previous := make(map[string]SubgraphStatus, len(due))
+	for i, sg := range due {
+		previous[sg.Name] = newSubgraphStatus(sg)
+		sg.CheckID = newCheckID(cycleID, i+1)
+	}
+	for i, fh := range dueFirehose {
+		fh.CheckID = newCheckID(cycleID, len(due)+i+1)
+	}
+	log.Printf("[%s] Checking %d subgraphs, %d firehose endpoints", cycleID, len(due), len(dueFirehose))
+	m.applyPushedHeads(chains)
+	wasHalted := make(map[string]bool, len(chains))
+	for name, chain := range chains {
+		wasHalted[name] = chain.Halted
+	}
+
+	checkSubgraphs(cycleID, due, chains, m.cfg.IndexNode)
+	checkFirehoseEndpoints(dueFirehose, chains, m.cfg)
+
+	var transitions []StateTransition
+	changes := []StatusChange{}
+	now := time.Now()
+	for name, chain := range chains {
+		// Every shard checks the halts of its chains, one reports them.
+		if chain.Halted != wasHalted[name] && m.shard.ownsChain(name) {
+			transitions = append(transitions, newChainHaltTransition(cycleID, chain, now))
+		}
+	}
+	transitions = append(transitions, m.checkCertificates(cycleID, now)...)
+	transitions = append(transitions, m.checkUpstreams(cycleID, now)...)
+	for _, sg := range due {
+		checked := !sg.CheckedAt.Before(start)
+		var sgTransitions []StateTransition
+		if checked {
+			m.store.SaveSample(newSample(sg))
+			if t, ok := m.updateSLO(sg, cycleID, now); ok {
+				sgTransitions = append(sgTransitions, t)
+			}
+		}
+		// Checks without a fresh chain head have no lag, so they are left
+		// out of ETA learning and slow sync rather than counted as in sync.
+		if checked && lagKnown(sg) {
+			m.learnETARanges(sg, now)
+			if t, ok := m.updateSlowSync(sg, cycleID, now); ok {
+				sgTransitions = append(sgTransitions, t)
+			}
+		}
+		if checked {
+			if t, ok := m.updateAvailability(sg, cycleID, now); ok {
+				sgTransitions = append(sgTransitions, t)
+			}
+		}
+		if before := previous[sg.Name]; before.Status != StatusUnknown && before.Status != sg.Status {
+			after := newSubgraphStatus(sg)
+			silenced := m.isSilenced(sg.Name, now)
+			changes = append(changes, StatusChange{Subgraph: sg.Name, Silenced: silenced, Before: before, After: after})
+			if silenced {
+				logCheck(sg, "Subgraph %s: %s -> %s (silenced)", sg.Name, before.Status, sg.Status)
+			}
+			sgTransitions = append(sgTransitions, StateTransition{
+				Time:     sg.CheckedAt,
+				CycleID:  cycleID,
+				CheckID:  sg.CheckID,
+				Subgraph: sg.Name,
+				Chain:    sg.Chain,
+				From:     before.Status,
+				To:       sg.Status,
+				Context:  after,
+				Trigger:  statusTrigger(sg),
+				Silenced: silenced,
+			})
+		}
+		if checked {
+			sgTransitions = m.inhibit(sg, previous[sg.Name].Status, sgTransitions, cycleID)
+		}
+		transitions = append(transitions, sgTransitions...)
+	}
+	jobs := m.planRemediations(due, chains, start)
+	remediation := m.cfg.Remediation
+	m.changes = CycleChanges{
+		CycleID:         cycleID,
+		CycleAt:         start,
+		PreviousCycleAt: m.changes.CycleAt,
+		Changes:         changes,
+	}
+	m.publishSnapshot()
+	m.mu.Unlock()
+	m.printCycle(cycleID, due, dueFirehose, start, now)
+
+	for _, t := range transitions {
+		t.Test = t.Test || m.simulated
+		m.store.SaveIncident(t)
+		if t.Silenced {
+			continue
+		}
+		if t.Inhibited != "" {
+			log.Printf("[%s] %s (inhibited by %s)", t.CheckID, formatTransition(t), t.Inhibited)
+			continue
+		}
+		log.Printf("[%s] %s", t.CheckID, formatTransition(t))
+		m.events.Publish(t)
+	}
+	for _, job := range jobs {
+		go m.remediate(job, remediation)
+	}
+}
+
+// updateSLO re-evaluates the subgraph's error budget and returns a
+// transition when its burn alert fired or resolved. Must be called with mu
+// held, after the check's sample was recorded.
+func (m *Monitor) updateSLO(sg *SubgraphInfo, cycleID string, now time.Time) (StateTransition, bool) {
+	if m.cfg.SLO.Target == 0 {
+		sg.SLO = nil
+		return StateTransition{}, false
+	}
+	prev := ""
+	if sg.SLO != nil {
+		prev = sg.SLO.Alert
+	}
+	samples := m.store.LoadHistory(sg.Name, sg.CheckedAt.Add(-m.cfg.SLO.Window.Duration), sg.CheckedAt)
+	sg.SLO = evaluateSLO(samples, sg.CheckedAt, m.cfg.SLO)
+	if sg.SLO.Alert == prev {
+		return StateTransition{}, false
+	}
+	if m.isSilenced(sg.Name, now) {
+		logCheck(sg, "Subgraph %s: error budget alert %q -> %q (silenced)", sg.Name, prev, sg.SLO.Alert)
+		return StateTransition{}, false
+	}
+	return StateTransition{
+		Kind:     TransitionBurnRate,
+		Time:     sg.CheckedAt,
+		CycleID:  cycleID,
+		CheckID:  sg.CheckID,
+		Subgraph: sg.Name,
+		Chain:    sg.Chain,
+		From:     sg.Status,
+		To:       sg.Status,
+		Context:  newSubgraphStatus(sg),
+		Trigger:  burnTrigger(sg.SLO, prev),
+	}, true
+}
+
+func (m *Monitor) Changes() CycleChanges {
+	return m.Snapshot().Changes
+}
+
+// Statuses returns a copy of the subgraph statuses that callers may modify.
+func (m *Monitor) Statuses() []SubgraphStatus {
+	return append([]SubgraphStatus(nil), m.Snapshot().Subgraphs...)
+}
+
+func (m *Monitor) findSubgraph(name string) *SubgraphInfo {
+	for _, sg := range m.subgraphs {
+		if sg.Name == name {
+			return sg
+		}
+	}
+	return nil
+}
+
+// errSubgraphExists is returned by AddSubgraph for a name already in use.
+var errSubgraphExists = errors.New("already exists")
+
+// AddSubgraph starts monitoring sg from the next cycle. Runtime changes are
+// not written back to the config and are lost on the next config reload.
+// Like all writes it waits for a running cycle to finish.
+func (m *Monitor) AddSubgraph(sg *SubgraphInfo) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if sg.Name == "" || sg.URL == "" {
+		return fmt.Errorf("name and url are required")
+	}
+	if _, ok := m.chains[sg.Chain]; !ok {
+		return fmt.Errorf("unknown chain %q", sg.Chain)
+	}
+	if m.findSubgraph(sg.Name) != nil {
+		return fmt.Errorf("subgraph %q %w", sg.Name, errSubgraphExists)
+	}
+	if !m.shard.owns(sg.Name) {
+		return fmt.Errorf("subgraph %q belongs to another shard than %s", sg.Name, m.shard)
+	}
+	m.cfg.applySubgraphDefaults(sg)
+	if err := m.cfg.validateSubgraph(sg); err != nil {
+		return err
+	}
+	m.subgraphs = append(m.subgraphs, sg)
+	m.publishSnapshot()
+	return nil
+}
+
+// RemoveSubgraph stops monitoring a subgraph and returns it, or nil if
+// there is none by that name.
+func (m *Monitor) RemoveSubgraph(name string) *SubgraphInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, sg := range m.subgraphs {
+		if sg.Name == name {
+			m.subgraphs = append(m.subgraphs[:i:i], m.subgraphs[i+1:]...)
+			m.silenceMu.Lock()
+			delete(m.silences, name)
+			m.silenceMu.Unlock()
+			m.publishSnapshot()
+			return sg
+		}
+	}
+	return nil
+}
+
+// ResetHistory discards the speed/ETA samples of a subgraph. The recorded
+// time series returned by the history endpoint is kept.
+func (m *Monitor) ResetHistory(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sg := m.findSubgraph(name)
+	if sg == nil {
+		return false
+	}
+	resetSyncHistory(sg)
+	m.publishSnapshot()
+	return true
+}
+
+// CheckNow makes a subgraph due so the check loop checks it right away, or
+// once the running cycle is done. It returns false for unknown subgraphs.
+func (m *Monitor) CheckNow(name string) bool {
+	m.mu.Lock()
+	sg := m.findSubgraph(name)
+	if sg != nil {
+		sg.NextCheckAt = time.Time{}
+	}
+	m.mu.Unlock()
+	if sg == nil {
+		return false
+	}
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (m *Monitor) ChainHeads() map[string]int64 {
+	return m.Snapshot().ChainHeads
+}
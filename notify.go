@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	NotifierWebhook = "webhook"
+	NotifierSlack   = "slack"
+	NotifierSIEM    = "siem"
+)
+
+// NotifierConfig configures a channel that state transitions are sent to.
+type NotifierConfig struct {
+	Name    string            `json:"name"`
+	Type    string            `json:"type"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Secret, when set, signs every payload so the receiver can check it
+	// came from this monitor (see signPayload).
+	Secret string `json:"secret,omitempty"`
+	// Format is how siem notifiers write events: json (default) or cef.
+	Format string `json:"format,omitempty"`
+	// Path makes a siem notifier append events to a file, one per line,
+	// for a log shipper to pick up, instead of posting them to URL.
+	Path string `json:"path,omitempty"`
+}
+
+func (c *NotifierConfig) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	switch c.Type {
+	case NotifierWebhook, NotifierSlack:
+	case NotifierSIEM:
+		if c.URL == "" && c.Path == "" {
+			return fmt.Errorf("notifier %s: url or path is required", c.Name)
+		}
+		if c.URL != "" && c.Path != "" {
+			return fmt.Errorf("notifier %s: set url or path, not both", c.Name)
+		}
+		if !validSIEMFormat(c.Format) {
+			return fmt.Errorf("notifier %s: unknown format %q, expected json or cef", c.Name, c.Format)
+		}
+		return nil
+	default:
+		return fmt.Errorf("notifier %s: unknown type %q", c.Name, c.Type)
+	}
+	if c.URL == "" {
+		return fmt.Errorf("notifier %s: url is required", c.Name)
+	}
+	return nil
+}
+
+// Notify delivers a transition to the channel: webhooks receive the event
+// as JSON, Slack incoming webhooks a formatted text message and SIEM
+// notifiers a flat JSON or CEF event.
+func (c *NotifierConfig) Notify(t StateTransition) error {
+	if c.Type == NotifierSIEM {
+		return c.notifySIEM(t)
+	}
+	var payload interface{} = t
+	if c.Type == NotifierSlack {
+		payload = map[string]string{"text": formatTransition(t)}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal payload failed: %v", err)
+	}
+	return c.post(body, "application/json", t.CheckID)
+}
+
+func (c *NotifierConfig) post(body []byte, contentType, checkID string) error {
+	req, err := http.NewRequest(http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if checkID != "" {
+		req.Header.Set(requestIDHeader, checkID)
+	}
+	for k, v := range c.Headers {
+		req.Header.Set(k, v)
+	}
+	if c.Secret != "" {
+		setSignature(req, c.Secret, body, time.Now())
+	}
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := readBody(resp)
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+func formatTransition(t StateTransition) string {
+	prefix := ""
+	if t.Test {
+		prefix = "[TEST] "
+	}
+	if t.Kind == TransitionChainHalt {
+		return formatChainHalt(prefix, t)
+	}
+	if t.Kind == TransitionCertExpiry {
+		return formatCertExpiry(prefix, t)
+	}
+	if t.Kind == TransitionSlowSync {
+		return formatSlowSync(prefix, t)
+	}
+	if t.Kind == TransitionAvailability {
+		return formatAvailability(prefix, t)
+	}
+	if t.Kind == TransitionUpstream {
+		return formatUpstream(prefix, t)
+	}
+	if t.Kind == TransitionBurnRate && t.Context.SLO != nil {
+		slo := t.Context.SLO
+		if slo.Alert == "" {
+			return fmt.Sprintf("%s%s (%s): error budget burn alert resolved, %.0f%% of budget left (check %s)",
+				prefix, t.Subgraph, t.Chain, slo.BudgetRemaining*100, t.CheckID)
+		}
+		budget := "budget exhausted"
+		if slo.BudgetRemaining > 0 {
+			budget = fmt.Sprintf("%.0f%% of budget left, exhausted in %s", slo.BudgetRemaining*100,
+				time.Duration(slo.ExhaustedInSeconds*float64(time.Second)).Round(time.Minute))
+		}
+		return fmt.Sprintf("%s%s (%s): error budget burning %s (%.1fx over 1h), %s (check %s)",
+			prefix, t.Subgraph, t.Chain, slo.Alert, slo.BurnRates["1h"], budget, t.CheckID)
+	}
+	return fmt.Sprintf("%s%s (%s): %s -> %s, %d blocks behind (check %s)",
+		prefix, t.Subgraph, t.Chain, t.From, t.To, t.Context.BlocksBehind, t.CheckID)
+}
+
+// runNotifiers forwards the transitions queued in alerts to the global
+// notifiers and those of the subgraph's tenant until the process exits.
+func (m *Monitor) runNotifiers(alerts *alertQueue) {
+	for {
+		t := alerts.pop()
+		notifiers := m.Snapshot().Config.notifiersFor(t.Context.Tenant)
+		for i := range notifiers {
+			if err := notifiers[i].Notify(t); err != nil {
+				log.Printf("[%s] Notifier %s failed: %v", t.CheckID, notifiers[i].Name, err)
+			}
+		}
+	}
+}
+
+func newTestTransition() StateTransition {
+	now := time.Now()
+	cycleID := newCycleID()
+	return StateTransition{
+		Time:     now,
+		CycleID:  cycleID,
+		CheckID:  newCheckID(cycleID, 1),
+		Subgraph: "notify-test",
+		Chain:    "test",
+		From:     StatusOK,
+		To:       StatusCrit,
+		Test:     true,
+		Context: SubgraphStatus{
+			Name:      "notify-test",
+			Chain:     "test",
+			Status:    StatusCrit,
+			CheckedAt: now,
+		},
+	}
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec documents the HTTP API. The client package mirrors it; keep
+// both in sync when routes or response types change.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+func (m *Monitor) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
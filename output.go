@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+)
+
+// FormatAuto picks the table for a terminal and JSON when stdout is piped
+// or redirected, so the same command works interactively and in scripts.
+const FormatAuto = "auto"
+
+// stdoutIsTerminal reports whether stdout is a terminal rather than a pipe
+// or file.
+func stdoutIsTerminal() bool {
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// outputFormat resolves a -format flag value against the formats a command
+// supports; auto becomes table or json.
+func outputFormat(format string, supported ...string) (string, error) {
+	if format == FormatAuto {
+		if stdoutIsTerminal() {
+			return "table", nil
+		}
+		return "json", nil
+	}
+	if !slices.Contains(supported, format) {
+		return "", fmt.Errorf("unknown -format %q, expected %s", format, joinOr(append([]string{FormatAuto}, supported...)))
+	}
+	return format, nil
+}
+
+// statusJSON makes the monitor print its check results as JSON lines
+// instead of tables. It is set by -format before the first cycle.
+var statusJSON bool
+
+// StatusLine is one line of the monitor's JSON output: a checked subgraph
+// or Firehose endpoint, or, once per cycle, the fleet summary with the
+// config warnings and expiring certificates.
+type StatusLine struct {
+	Type         string          `json:"type"`
+	CycleID      string          `json:"cycleId"`
+	Subgraph     *SubgraphStatus `json:"subgraph,omitempty"`
+	Firehose     *FirehoseStatus `json:"firehose,omitempty"`
+	Fleet        *FleetSummary   `json:"fleet,omitempty"`
+	Warnings     []ConfigWarning `json:"warnings,omitempty"`
+	Certificates []CertInfo      `json:"certificates,omitempty"`
+}
+
+func printStatusLine(line StatusLine) {
+	if err := json.NewEncoder(os.Stdout).Encode(line); err != nil {
+		log.Printf("Write status failed: %v", err)
+	}
+}
+
+func joinOr(words []string) string {
+	switch len(words) {
+	case 0:
+		return ""
+	case 1:
+		return words[0]
+	}
+	s := words[0]
+	for _, w := range words[1 : len(words)-1] {
+		s += ", " + w
+	}
+	return s + " or " + words[len(words)-1]
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// A minimal Parquet writer for history samples: one row group, one
+// uncompressed PLAIN-encoded data page per column, all columns required.
+// That is enough for DuckDB, Athena/Trino, Spark and pyarrow.
+
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetConvertedUTF8            = 0
+	parquetConvertedTimestampMillis = 9
+
+	parquetEncodingPlain = 0
+	parquetEncodingRLE   = 3
+)
+
+type parquetColumn struct {
+	name      string
+	typ       int32
+	converted int32 // -1 for none
+	values    func(samples []Sample) []byte
+}
+
+var sampleColumns = []parquetColumn{
+	{"time", parquetInt64, parquetConvertedTimestampMillis, plainInt64(func(s Sample) int64 { return s.Time.UnixMilli() })},
+	{"subgraph", parquetByteArray, parquetConvertedUTF8, plainString(func(s Sample) string { return s.Subgraph })},
+	{"chain", parquetByteArray, parquetConvertedUTF8, plainString(func(s Sample) string { return s.Chain })},
+	{"status", parquetByteArray, parquetConvertedUTF8, plainString(func(s Sample) string { return string(s.Status) })},
+	{"chain_block", parquetInt64, -1, plainInt64(func(s Sample) int64 { return s.ChainBlock })},
+	{"current_block", parquetInt64, -1, plainInt64(func(s Sample) int64 { return s.CurrentBlock })},
+	{"blocks_behind", parquetInt64, -1, plainInt64(func(s Sample) int64 { return s.BlocksBehind })},
+	{"sync_speed", parquetDouble, -1, plainDouble(func(s Sample) float64 { return s.SyncSpeed })},
+	{"blocks_indexed", parquetInt64, -1, plainInt64(func(s Sample) int64 { return s.BlocksIndexed })},
+	{"failed", parquetBoolean, -1, plainBool(func(s Sample) bool { return s.Failed })},
+	{"lag_unknown", parquetBoolean, -1, plainBool(func(s Sample) bool { return s.LagUnknown })},
+}
+
+func plainInt64(get func(Sample) int64) func([]Sample) []byte {
+	return func(samples []Sample) []byte {
+		out := make([]byte, 0, 8*len(samples))
+		for _, s := range samples {
+			out = binary.LittleEndian.AppendUint64(out, uint64(get(s)))
+		}
+		return out
+	}
+}
+
+func plainDouble(get func(Sample) float64) func([]Sample) []byte {
+	return func(samples []Sample) []byte {
+		out := make([]byte, 0, 8*len(samples))
+		for _, s := range samples {
+			out = binary.LittleEndian.AppendUint64(out, math.Float64bits(get(s)))
+		}
+		return out
+	}
+}
+
+func plainString(get func(Sample) string) func([]Sample) []byte {
+	return func(samples []Sample) []byte {
+		var out []byte
+		for _, s := range samples {
+			v := get(s)
+			out = binary.LittleEndian.AppendUint32(out, uint32(len(v)))
+			out = append(out, v...)
+		}
+		return out
+	}
+}
+
+func plainBool(get func(Sample) bool) func([]Sample) []byte {
+	return func(samples []Sample) []byte {
+		out := make([]byte, (len(samples)+7)/8)
+		for i, s := range samples {
+			if get(s) {
+				out[i/8] |= 1 << (i % 8)
+			}
+		}
+		return out
+	}
+}
+
+// encodeParquet returns samples as a Parquet file.
+func encodeParquet(samples []Sample) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("PAR1")
+
+	type chunk struct {
+		offset, size int64
+	}
+	chunks := make([]chunk, len(sampleColumns))
+	for i, col := range sampleColumns {
+		data := col.values(samples)
+		var header thriftWriter
+		header.i32(1, 0) // DATA_PAGE
+		header.i32(2, int32(len(data)))
+		header.i32(3, int32(len(data)))
+		header.beginStruct(5)
+		header.i32(1, int32(len(samples)))
+		header.i32(2, parquetEncodingPlain)
+		header.i32(3, parquetEncodingRLE)
+		header.i32(4, parquetEncodingRLE)
+		header.endStruct()
+		header.stop()
+
+		chunks[i].offset = int64(buf.Len())
+		buf.Write(header.buf)
+		buf.Write(data)
+		chunks[i].size = int64(buf.Len()) - chunks[i].offset
+	}
+
+	var total int64
+	for _, c := range chunks {
+		total += c.size
+	}
+
+	var meta thriftWriter
+	meta.i32(1, 1)
+	meta.listBegin(2, thriftStruct, len(sampleColumns)+1)
+	meta.structElem(func(w *thriftWriter) {
+		w.binary(4, "schema")
+		w.i32(5, int32(len(sampleColumns)))
+	})
+	for _, col := range sampleColumns {
+		meta.structElem(func(w *thriftWriter) {
+			w.i32(1, col.typ)
+			w.i32(3, 0) // REQUIRED
+			w.binary(4, col.name)
+			if col.converted >= 0 {
+				w.i32(6, col.converted)
+			}
+		})
+	}
+	meta.i64(3, int64(len(samples)))
+	meta.listBegin(4, thriftStruct, 1)
+	meta.structElem(func(w *thriftWriter) {
+		w.listBegin(1, thriftStruct, len(sampleColumns))
+		for i, col := range sampleColumns {
+			c := chunks[i]
+			w.structElem(func(w *thriftWriter) {
+				w.i64(2, c.offset)
+				w.beginStruct(3)
+				w.i32(1, col.typ)
+				w.listBegin(2, thriftI32, 2)
+				w.varint(parquetEncodingPlain)
+				w.varint(parquetEncodingRLE)
+				w.listBegin(3, thriftBinary, 1)
+				w.rawBinary(col.name)
+				w.i32(4, 0) // UNCOMPRESSED
+				w.i64(5, int64(len(samples)))
+				w.i64(6, c.size)
+				w.i64(7, c.size)
+				w.i64(9, c.offset)
+				w.endStruct()
+			})
+		}
+		w.i64(2, total)
+		w.i64(3, int64(len(samples)))
+	})
+	meta.binary(6, "subgraph-monitor "+version)
+	meta.stop()
+
+	buf.Write(meta.buf)
+	buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(meta.buf))))
+	buf.WriteString("PAR1")
+	return buf.Bytes()
+}
+
+// Thrift compact protocol, as used by Parquet metadata.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftStruct = 12
+)
+
+type thriftWriter struct {
+	buf    []byte
+	last   int16
+	nested []int16
+}
+
+func (w *thriftWriter) field(id int16, typ byte) {
+	if delta := id - w.last; delta > 0 && delta <= 15 {
+		w.buf = append(w.buf, byte(delta)<<4|typ)
+	} else {
+		w.buf = append(w.buf, typ)
+		w.varint(int64(id))
+	}
+	w.last = id
+}
+
+// varint writes a zigzag varint.
+func (w *thriftWriter) varint(v int64) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(v<<1^v>>63))
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.field(id, thriftI32)
+	w.varint(int64(v))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.field(id, thriftI64)
+	w.varint(v)
+}
+
+func (w *thriftWriter) binary(id int16, s string) {
+	w.field(id, thriftBinary)
+	w.rawBinary(s)
+}
+
+func (w *thriftWriter) rawBinary(s string) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+func (w *thriftWriter) listBegin(id int16, elem byte, n int) {
+	w.field(id, 9)
+	if n < 15 {
+		w.buf = append(w.buf, byte(n)<<4|elem)
+	} else {
+		w.buf = append(w.buf, 0xf0|elem)
+		w.buf = binary.AppendUvarint(w.buf, uint64(n))
+	}
+}
+
+func (w *thriftWriter) beginStruct(id int16) {
+	w.field(id, thriftStruct)
+	w.nested = append(w.nested, w.last)
+	w.last = 0
+}
+
+func (w *thriftWriter) endStruct() {
+	w.stop()
+	w.last = w.nested[len(w.nested)-1]
+	w.nested = w.nested[:len(w.nested)-1]
+}
+
+// structElem writes a struct list element.
+func (w *thriftWriter) structElem(fields func(*thriftWriter)) {
+	w.nested = append(w.nested, w.last)
+	w.last = 0
+	fields(w)
+	w.endStruct()
+}
+
+func (w *thriftWriter) stop() {
+	w.buf = append(w.buf, 0)
+}
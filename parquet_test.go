@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// thriftReader decodes the Thrift compact protocol into generic values:
+// structs as map[int16]interface{}, lists as []interface{}, integers as
+// int64 and binaries as []byte.
+type thriftReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *thriftReader) byte() byte {
+	if r.pos >= len(r.buf) {
+		panic("thrift: unexpected end of data")
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		panic("thrift: invalid varint")
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) readStruct() map[int16]interface{} {
+	fields := make(map[int16]interface{})
+	var last int16
+	for {
+		b := r.byte()
+		if b == 0 {
+			return fields
+		}
+		id := last + int16(b>>4)
+		if b>>4 == 0 {
+			id = int16(r.zigzag())
+		}
+		last = id
+		fields[id] = r.value(b & 0x0f)
+	}
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case 1, 2:
+		return typ == 1
+	case thriftI32, thriftI64:
+		return r.zigzag()
+	case thriftBinary:
+		n := int(r.uvarint())
+		b := r.buf[r.pos : r.pos+n]
+		r.pos += n
+		return b
+	case 9:
+		h := r.byte()
+		n := int(h >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			items[i] = r.value(h & 0x0f)
+		}
+		return items
+	case thriftStruct:
+		return r.readStruct()
+	}
+	panic(fmt.Sprintf("thrift: unsupported type %d", typ))
+}
+
+func TestThriftWriterRoundTrip(t *testing.T) {
+	var w thriftWriter
+	w.i32(1, -7)
+	// A delta above 15 needs the long field header.
+	w.i64(20, math.MaxInt64)
+	w.binary(21, "name")
+	// Lists of 15 or more items need the long list header.
+	w.listBegin(22, thriftI32, 20)
+	for i := 0; i < 20; i++ {
+		w.varint(int64(i * 1000))
+	}
+	w.beginStruct(2)
+	w.i32(3, 42)
+	w.endStruct()
+	w.i32(30, 1)
+	w.stop()
+
+	r := &thriftReader{buf: w.buf}
+	got := r.readStruct()
+	if r.pos != len(w.buf) {
+		t.Fatalf("read %d of %d bytes", r.pos, len(w.buf))
+	}
+	if got[1] != int64(-7) || got[20] != int64(math.MaxInt64) || string(got[21].([]byte)) != "name" || got[30] != int64(1) {
+		t.Errorf("fields = %v", got)
+	}
+	list := got[22].([]interface{})
+	if len(list) != 20 || list[19] != int64(19000) {
+		t.Errorf("list = %v", list)
+	}
+	if nested := got[2].(map[int16]interface{}); nested[3] != int64(42) {
+		t.Errorf("nested struct = %v", nested)
+	}
+}
+
+func TestEncodeParquetFooter(t *testing.T) {
+	start := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	var samples []Sample
+	for i := 0; i < 20; i++ {
+		samples = append(samples, Sample{
+			Time:         start.Add(time.Duration(i) * time.Minute),
+			Subgraph:     fmt.Sprintf("sg-%d", i%3),
+			Chain:        "eth",
+			Status:       StatusOK,
+			ChainBlock:   21_000_000 + int64(i),
+			CurrentBlock: 20_999_990 + int64(i),
+			BlocksBehind: 10,
+			SyncSpeed:    1.5,
+			Failed:       i%7 == 0,
+		})
+	}
+	file := encodeParquet(samples)
+
+	if !bytes.HasPrefix(file, []byte("PAR1")) || !bytes.HasSuffix(file, []byte("PAR1")) {
+		t.Fatal("missing PAR1 magic")
+	}
+	footerLen := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	footerStart := len(file) - 8 - footerLen
+	r := &thriftReader{buf: file[footerStart : len(file)-8]}
+	meta := r.readStruct()
+	if r.pos != footerLen {
+		t.Fatalf("footer is %d bytes, decoded %d", footerLen, r.pos)
+	}
+
+	if meta[1] != int64(1) {
+		t.Errorf("version = %v", meta[1])
+	}
+	if meta[3] != int64(len(samples)) {
+		t.Errorf("num_rows = %v", meta[3])
+	}
+	schema := meta[2].([]interface{})
+	if len(schema) != len(sampleColumns)+1 {
+		t.Fatalf("schema has %d elements, want %d", len(schema), len(sampleColumns)+1)
+	}
+	if root := schema[0].(map[int16]interface{}); root[5] != int64(len(sampleColumns)) {
+		t.Errorf("root num_children = %v", root[5])
+	}
+	for i, col := range sampleColumns {
+		el := schema[i+1].(map[int16]interface{})
+		if string(el[4].([]byte)) != col.name || el[1] != int64(col.typ) {
+			t.Errorf("schema element %d = %v, want %s", i+1, el, col.name)
+		}
+	}
+
+	rowGroup := meta[4].([]interface{})[0].(map[int16]interface{})
+	columns := rowGroup[1].([]interface{})
+	if len(columns) != len(sampleColumns) {
+		t.Fatalf("row group has %d columns, want %d", len(columns), len(sampleColumns))
+	}
+	next := int64(4)
+	var total int64
+	for i, col := range sampleColumns {
+		chunk := columns[i].(map[int16]interface{})
+		cm := chunk[3].(map[int16]interface{})
+		offset := cm[9].(int64)
+		size := cm[6].(int64)
+		if chunk[2] != offset || offset != next {
+			t.Errorf("%s: file offset %v, page offset %d, want %d", col.name, chunk[2], offset, next)
+		}
+		if cm[5] != int64(len(samples)) || cm[7] != size {
+			t.Errorf("%s: column metadata %v", col.name, cm)
+		}
+		page := &thriftReader{buf: file[offset : offset+size]}
+		header := page.readStruct()
+		data := file[offset+int64(page.pos) : offset+size]
+		if header[2] != int64(len(data)) || header[3] != int64(len(data)) {
+			t.Errorf("%s: page sizes %v, %v, data is %d bytes", col.name, header[2], header[3], len(data))
+		}
+		if !bytes.Equal(data, col.values(samples)) {
+			t.Errorf("%s: page data differs from the column values", col.name)
+		}
+		next += size
+		total += size
+	}
+	if next != int64(footerStart) {
+		t.Errorf("column chunks end at %d, footer starts at %d", next, footerStart)
+	}
+	if rowGroup[2] != total || rowGroup[3] != int64(len(samples)) {
+		t.Errorf("row group total %v rows %v, want %d and %d", rowGroup[2], rowGroup[3], total, len(samples))
+	}
+
+	// Spot-check decoded values against the samples.
+	times := columns[0].(map[int16]interface{})[3].(map[int16]interface{})
+	off := times[9].(int64)
+	page := &thriftReader{buf: file[off:]}
+	page.readStruct()
+	values := file[off+int64(page.pos):]
+	for i, s := range samples {
+		if got := int64(binary.LittleEndian.Uint64(values[8*i:])); got != s.Time.UnixMilli() {
+			t.Fatalf("time %d = %d, want %d", i, got, s.Time.UnixMilli())
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Values of a subgraph status that can be unknown. Lag needs both a fresh
+// chain head and the subgraph's block; when only one side answers, what it
+// gives is still reported and the values that need the other side are
+// listed in the status's unknown field instead of being reported as 0. A
+// stale head is shown as the chain block but not measured against.
+const (
+	UnknownChainBlock   = "chainBlock"
+	UnknownCurrentBlock = "currentBlock"
+	UnknownBlocksBehind = "blocksBehind"
+	UnknownSyncSpeed    = "syncSpeed"
+	UnknownETA          = "eta"
+	UnknownProgress     = "progress"
+)
+
+// unknownSignals lists the values of a checked subgraph's status that are
+// unknown, nil when all are known.
+func unknownSignals(sg *SubgraphInfo) []string {
+	if sg.CheckedAt.IsZero() {
+		return nil
+	}
+	var unknown []string
+	headKnown, blockKnown := lagKnown(sg), sg.CurrentBlock > 0
+	if sg.LastBlock == 0 {
+		unknown = append(unknown, UnknownChainBlock)
+	}
+	if !blockKnown {
+		unknown = append(unknown, UnknownCurrentBlock)
+	}
+	if !headKnown || !blockKnown {
+		unknown = append(unknown, UnknownBlocksBehind)
+	}
+	if !headKnown || !blockKnown || len(sg.LastCheckedBlocks) < 2 {
+		unknown = append(unknown, UnknownSyncSpeed)
+	}
+	if !headKnown || !blockKnown || sg.BlocksBehind > 0 && sg.EstimatedTimeLeft <= 0 {
+		unknown = append(unknown, UnknownETA)
+	}
+	if _, ok := progressStartBlock(sg); !headKnown || !blockKnown || !ok {
+		unknown = append(unknown, UnknownProgress)
+	}
+	return unknown
+}
+
+// lagKnown reports whether the subgraph's last check had a fresh chain head
+// to measure lag against.
+func lagKnown(sg *SubgraphInfo) bool {
+	return sg.LastBlock > 0 && sg.ChainHeadSource != HeadSourceStale
+}
+
+// knownOr returns value, or "unknown" when signal is in unknown.
+func knownOr(unknown []string, signal, value string) string {
+	if slices.Contains(unknown, signal) {
+		return "unknown"
+	}
+	return value
+}
+
+// formatChainHead is the chain head shown above a chain's table.
+func formatChainHead(chainInfo *ChainInfo) string {
+	if chainInfo.LatestBlock == 0 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%d via %s", chainInfo.LatestBlock, chainInfo.HeadSource)
+}
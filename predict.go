@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Prediction answers "when will the subgraph reach block X?".
+type Prediction struct {
+	Subgraph     string     `json:"subgraph"`
+	TargetBlock  int64      `json:"targetBlock"`
+	CurrentBlock int64      `json:"currentBlock"`
+	ChainBlock   int64      `json:"chainBlock"`
+	SyncSpeed    float64    `json:"syncSpeed"`
+	ChainSpeed   float64    `json:"chainSpeed"`
+	Reached      bool       `json:"reached"`
+	PredictedAt  *time.Time `json:"predictedAt,omitempty"`
+	ETASeconds   float64    `json:"etaSeconds"`
+	// LimitedBy is "indexing" when the subgraph's speed decides the ETA, or
+	// "chain" when the target block has not been produced in time.
+	LimitedBy string `json:"limitedBy,omitempty"`
+}
+
+// predictBlock extrapolates the subgraph's indexing speed, and for blocks
+// beyond the chain head the chain's growth, from the last check of s.
+func predictBlock(s SubgraphStatus, target int64, now time.Time) (Prediction, error) {
+	p := Prediction{
+		Subgraph:     s.Name,
+		TargetBlock:  target,
+		CurrentBlock: s.CurrentBlock,
+		ChainBlock:   s.ChainBlock,
+		SyncSpeed:    s.SyncSpeed,
+		ChainSpeed:   s.ChainSpeed,
+	}
+	if s.CurrentBlock == 0 {
+		return p, fmt.Errorf("subgraph %s has not been checked successfully yet", s.Name)
+	}
+	if target <= s.CurrentBlock {
+		p.Reached = true
+		return p, nil
+	}
+	if s.SyncSpeed <= 0 {
+		return p, fmt.Errorf("indexing speed of %s is unknown or not positive", s.Name)
+	}
+
+	eta := float64(target-s.CurrentBlock) / s.SyncSpeed
+	p.LimitedBy = "indexing"
+	if target > s.ChainBlock {
+		if s.ChainSpeed <= 0 {
+			return p, fmt.Errorf("block %d is beyond the chain head and chain growth is unknown", target)
+		}
+		if chainETA := float64(target-s.ChainBlock) / s.ChainSpeed; chainETA > eta {
+			eta = chainETA
+			p.LimitedBy = "chain"
+		}
+	}
+
+	at := s.CheckedAt.Add(time.Duration(eta * float64(time.Minute)))
+	p.PredictedAt = &at
+	if wait := at.Sub(now); wait > 0 {
+		p.ETASeconds = wait.Seconds()
+	}
+	return p, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// ErrorKindRateLimited marks checks skipped or rejected because the
+	// endpoint rate limits the monitor.
+	ErrorKindRateLimited = "rate_limited"
+
+	defaultRateLimitBackoff = time.Minute
+	maxRateLimitBackoff     = time.Hour
+)
+
+// RateLimitError is returned for requests to an endpoint that answered 429
+// (or 503 with Retry-After) until the time it asked the monitor to wait.
+type RateLimitError struct {
+	Endpoint string
+	Until    time.Time
+	Wait     time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limited by %s, retrying in %s", e.Endpoint, e.Wait.Round(time.Second))
+}
+
+// rateLimitError returns the RateLimitError wrapped in err, if any.
+func rateLimitError(err error) *RateLimitError {
+	var rl *RateLimitError
+	if errors.As(err, &rl) {
+		return rl
+	}
+	return nil
+}
+
+func isRateLimited(err error) bool {
+	return rateLimitError(err) != nil
+}
+
+// rateLimits holds the backoff per endpoint (URL without query). It
+// outlives transport replacements on config reloads.
+var rateLimits = struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}{until: make(map[string]time.Time)}
+
+func rateLimitEndpoint(req *http.Request) string {
+	return req.URL.Scheme + "://" + req.URL.Host + req.URL.Path
+}
+
+// rateLimitTransport fails requests to endpoints that are backing off
+// without sending them, and starts a backoff when a response asks for one.
+type rateLimitTransport struct {
+	base http.RoundTripper
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := rateLimitEndpoint(req)
+	now := time.Now()
+	rateLimits.mu.Lock()
+	until := rateLimits.until[endpoint]
+	rateLimits.mu.Unlock()
+	if now.Before(until) {
+		return nil, &RateLimitError{Endpoint: endpoint, Until: until, Wait: until.Sub(now)}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	retryAfter := resp.Header.Get("Retry-After")
+	if resp.StatusCode != http.StatusTooManyRequests && (resp.StatusCode != http.StatusServiceUnavailable || retryAfter == "") {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	wait := parseRetryAfter(retryAfter, now)
+	until = now.Add(wait)
+	rateLimits.mu.Lock()
+	rateLimits.until[endpoint] = until
+	rateLimits.mu.Unlock()
+	log.Printf("Endpoint %s answered HTTP %d, backing off for %s", endpoint, resp.StatusCode, wait.Round(time.Second))
+	return nil, &RateLimitError{Endpoint: endpoint, Until: until, Wait: wait}
+}
+
+func (t *rateLimitTransport) CloseIdleConnections() {
+	if c, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP
+// date, falling back to defaultRateLimitBackoff and capping the wait at
+// maxRateLimitBackoff.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	wait := defaultRateLimitBackoff
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		wait = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(v); err == nil {
+		wait = t.Sub(now)
+	}
+	if wait <= 0 {
+		wait = time.Second
+	}
+	return min(wait, maxRateLimitBackoff)
+}
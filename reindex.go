@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// rewindTolerance is how far a subgraph's block may go back between checks
+// before it counts as a rewind rather than a chain reorg.
+const rewindTolerance = 100
+
+// ReindexInfo tracks a subgraph re-indexing after a rewind (e.g. graphman
+// rewind) until it is back at the block it had reached before.
+type ReindexInfo struct {
+	FromBlock      int64     `json:"fromBlock"`
+	HighWaterBlock int64     `json:"highWaterBlock"`
+	DetectedAt     time.Time `json:"detectedAt"`
+	Progress       float64   `json:"progress"`
+	ETASeconds     float64   `json:"etaSeconds"`
+}
+
+// detectRewind compares a successful check's block with the previous one of
+// the same deployment. A rewind starts (or extends) re-indexing and resets
+// the speed history, which would otherwise turn negative.
+func detectRewind(sg *SubgraphInfo, block int64) {
+	prev := sg.CurrentBlock
+	if sg.Reindex != nil && block >= sg.Reindex.HighWaterBlock {
+		logCheck(sg, "Subgraph %s reached its previous high-water block %d, re-indexing done", sg.Name, sg.Reindex.HighWaterBlock)
+		sg.Reindex = nil
+	}
+	if prev == 0 || prev-block <= rewindTolerance {
+		return
+	}
+	highWater := prev
+	if sg.Reindex != nil && sg.Reindex.HighWaterBlock > highWater {
+		highWater = sg.Reindex.HighWaterBlock
+	}
+	sg.Reindex = &ReindexInfo{FromBlock: block, HighWaterBlock: highWater, DetectedAt: sg.CheckedAt}
+	logCheck(sg, "Subgraph %s rewound from block %d, re-indexing from block %d", sg.Name, prev, block)
+	resetSyncHistory(sg)
+}
+
+// updateReindexProgress refreshes progress and ETA toward the high-water
+// block after the sync metrics were computed.
+func updateReindexProgress(sg *SubgraphInfo) {
+	r := sg.Reindex
+	if r == nil {
+		return
+	}
+	if span := r.HighWaterBlock - r.FromBlock; span > 0 {
+		r.Progress = float64(sg.CurrentBlock-r.FromBlock) / float64(span) * 100
+	}
+	r.ETASeconds = 0
+	if sg.SyncSpeed > 0 {
+		r.ETASeconds = float64(r.HighWaterBlock-sg.CurrentBlock) / sg.SyncSpeed * 60
+	}
+}
+
+func copyReindexInfo(r *ReindexInfo) *ReindexInfo {
+	if r == nil {
+		return nil
+	}
+	c := *r
+	return &c
+}
+
+func printReindex(sg *SubgraphInfo) {
+	if sg.Reindex == nil {
+		return
+	}
+	fmt.Printf("  re-indexing from block %d: %.2f%% to previous high-water block %d\n",
+		sg.Reindex.FromBlock, sg.Reindex.Progress, sg.Reindex.HighWaterBlock)
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	RemediationHTTP       = "http"
+	RemediationCommand    = "command"
+	RemediationKubernetes = "kubernetes"
+	// RemediationNone disables remediation for a subgraph.
+	RemediationNone = "none"
+
+	DefaultRemediationCooldown   = time.Hour
+	DefaultRemediationMaxPerHour = 2
+	DefaultRemediationTimeout    = time.Minute
+)
+
+// RemediationConfig restarts the indexing node of subgraphs that stopped
+// making progress for StalledAfter by calling Hook. Cooldown is the minimum
+// time between two calls for the same hook target and MaxPerHour caps the
+// calls across all subgraphs. A zero StalledAfter disables remediation.
+type RemediationConfig struct {
+	StalledAfter Duration        `json:"stalledAfter"`
+	Cooldown     Duration        `json:"cooldown"`
+	MaxPerHour   int             `json:"maxPerHour"`
+	Timeout      Duration        `json:"timeout"`
+	DryRun       bool            `json:"dryRun,omitempty"`
+	Hook         RemediationHook `json:"hook"`
+}
+
+// RemediationHook is what a remediation calls: an HTTP endpoint receiving
+// the RemediationRequest as JSON, a command receiving it on stdin (and as
+// SUBGRAPH_* environment variables), or a rollout restart of a Kubernetes
+// Deployment or StatefulSet given as [namespace/]name.
+type RemediationHook struct {
+	Type    string            `json:"type"`
+	URL     string            `json:"url,omitempty"`
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Command []string          `json:"command,omitempty"`
+	Kind    string            `json:"kind,omitempty"`
+	Target  string            `json:"target,omitempty"`
+}
+
+type RemediationRequest struct {
+	Subgraph     string    `json:"subgraph"`
+	Chain        string    `json:"chain"`
+	URL          string    `json:"url"`
+	Deployment   string    `json:"deployment,omitempty"`
+	IndexNodeURL string    `json:"indexNodeUrl,omitempty"`
+	CurrentBlock int64     `json:"currentBlock"`
+	ChainBlock   int64     `json:"chainBlock"`
+	StalledFor   float64   `json:"stalledForSeconds"`
+	CheckID      string    `json:"checkId"`
+	Time         time.Time `json:"time"`
+}
+
+type RemediationInfo struct {
+	Count  int       `json:"count"`
+	LastAt time.Time `json:"lastAt"`
+	DryRun bool      `json:"dryRun,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// remediationState holds the safety limits' bookkeeping, guarded by
+// Monitor.mu.
+type remediationState struct {
+	fired   []time.Time
+	targets map[string]time.Time
+	// limited holds the subgraphs already logged as held back by maxPerHour.
+	limited map[string]bool
+}
+
+type remediationJob struct {
+	hook RemediationHook
+	req  RemediationRequest
+}
+
+func (c *RemediationConfig) validate() error {
+	if c.StalledAfter.Duration < 0 {
+		return fmt.Errorf("remediation.stalledAfter must not be negative")
+	}
+	if c.StalledAfter.Duration == 0 {
+		return nil
+	}
+	if c.MaxPerHour < 1 {
+		return fmt.Errorf("remediation.maxPerHour must be at least 1")
+	}
+	if c.Timeout.Duration <= 0 {
+		return fmt.Errorf("remediation.timeout must be positive")
+	}
+	if c.Cooldown.Duration < c.Timeout.Duration {
+		return fmt.Errorf("remediation.cooldown must be at least remediation.timeout")
+	}
+	if err := c.Hook.validate(); err != nil {
+		return fmt.Errorf("remediation.hook: %v", err)
+	}
+	return nil
+}
+
+func (h *RemediationHook) validate() error {
+	switch h.Type {
+	case RemediationNone:
+	case RemediationHTTP:
+		if h.URL == "" {
+			return fmt.Errorf("url is required")
+		}
+	case RemediationCommand:
+		if len(h.Command) == 0 {
+			return fmt.Errorf("command is required")
+		}
+	case RemediationKubernetes:
+		if h.Target == "" {
+			return fmt.Errorf("target is required")
+		}
+		if _, err := kubeWorkload(h.Kind); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown type %q", h.Type)
+	}
+	return nil
+}
+
+// target identifies what the hook restarts, so subgraphs sharing an
+// indexing node trigger one restart per cooldown.
+func (h *RemediationHook) target() string {
+	switch h.Type {
+	case RemediationHTTP:
+		return h.Type + ":" + h.URL
+	case RemediationCommand:
+		return h.Type + ":" + strings.Join(h.Command, " ")
+	}
+	return h.Type + ":" + h.Kind + "/" + h.Target
+}
+
+func kubeWorkload(kind string) (string, error) {
+	switch strings.ToLower(kind) {
+	case "", "deployment":
+		return "deployments", nil
+	case "statefulset":
+		return "statefulsets", nil
+	}
+	return "", fmt.Errorf("unknown kind %q, want deployment or statefulset", kind)
+}
+
+// trackProgress records the check time when the subgraph advanced or is at
+// the chain head.
+func trackProgress(sg *SubgraphInfo, block, latestBlock int64) {
+	n := len(sg.LastCheckedBlocks)
+	if n == 0 || block > sg.LastCheckedBlocks[n-1] || block >= latestBlock {
+		sg.ProgressAt = sg.CheckedAt
+	}
+}
+
+// stalledFor is how long a subgraph that still answers has been behind the
+// chain head without indexing a block.
+func stalledFor(sg *SubgraphInfo) time.Duration {
+	if sg.ProgressAt.IsZero() || sg.LastError != "" {
+		return 0
+	}
+	return sg.CheckedAt.Sub(sg.ProgressAt)
+}
+
+// planRemediations picks the subgraphs checked this cycle that stalled for
+// longer than stalledAfter and whose hook may fire under the safety limits.
+// Stalls that a restart cannot fix are left alone: deterministic failures,
+// halted chains and chains whose head is unknown. Must be called with mu held.
+func (m *Monitor) planRemediations(due []*SubgraphInfo, chains map[string]*ChainInfo, start time.Time) []remediationJob {
+	cfg := m.cfg.Remediation
+	if cfg.StalledAfter.Duration <= 0 {
+		return nil
+	}
+	if m.remediations.targets == nil {
+		m.remediations.targets = make(map[string]time.Time)
+		m.remediations.limited = make(map[string]bool)
+	}
+	now := time.Now()
+	var jobs []remediationJob
+	for _, sg := range due {
+		stalled := stalledFor(sg)
+		if sg.CheckedAt.Before(start) || stalled < cfg.StalledAfter.Duration || sg.Status == StatusFailed {
+			continue
+		}
+		if chain := chains[sg.Chain]; chain == nil || chain.Halted || chain.HeadSource == HeadSourceStale {
+			continue
+		}
+		hook := cfg.Hook
+		if sg.Remediation != nil {
+			hook = *sg.Remediation
+		}
+		if hook.Type == RemediationNone {
+			continue
+		}
+		key := hook.target()
+		if now.Sub(m.remediations.targets[key]) < cfg.Cooldown.Duration {
+			continue
+		}
+		fired := m.remediations.fired[:0]
+		for _, t := range m.remediations.fired {
+			if now.Sub(t) < time.Hour {
+				fired = append(fired, t)
+			}
+		}
+		m.remediations.fired = fired
+		if len(fired) >= cfg.MaxPerHour {
+			if !m.remediations.limited[sg.Name] {
+				logCheck(sg, "Subgraph %s stalled for %s, not remediating: limit of %d per hour reached", sg.Name, stalled.Round(time.Second), cfg.MaxPerHour)
+				m.remediations.limited[sg.Name] = true
+			}
+			continue
+		}
+		delete(m.remediations.limited, sg.Name)
+		m.remediations.fired = append(m.remediations.fired, now)
+		m.remediations.targets[key] = now
+
+		if sg.Remediated == nil {
+			sg.Remediated = &RemediationInfo{}
+		}
+		r := sg.Remediated
+		r.Count++
+		r.LastAt = now
+		r.DryRun = cfg.DryRun
+		r.Error = ""
+		jobs = append(jobs, remediationJob{hook: hook, req: RemediationRequest{
+			Subgraph:     sg.Name,
+			Chain:        sg.Chain,
+			URL:          sg.URL,
+			Deployment:   sg.Deployment,
+			IndexNodeURL: sg.IndexNodeURL,
+			CurrentBlock: sg.CurrentBlock,
+			ChainBlock:   sg.LastBlock,
+			StalledFor:   stalled.Seconds(),
+			CheckID:      sg.CheckID,
+			Time:         now,
+		}})
+	}
+	return jobs
+}
+
+// remediate calls the hook and records the outcome on the subgraph.
+func (m *Monitor) remediate(job remediationJob, cfg RemediationConfig) {
+	req := job.req
+	if cfg.DryRun {
+		log.Printf("[%s] Subgraph %s stalled for %s, would call %s remediation %s (dry run)",
+			req.CheckID, req.Subgraph, time.Duration(req.StalledFor*float64(time.Second)).Round(time.Second), job.hook.Type, job.hook.target())
+		return
+	}
+	log.Printf("[%s] Subgraph %s stalled for %s at block %d, calling %s remediation %s",
+		req.CheckID, req.Subgraph, time.Duration(req.StalledFor*float64(time.Second)).Round(time.Second), req.CurrentBlock, job.hook.Type, job.hook.target())
+	err := runRemediationHook(job.hook, req, cfg.Timeout.Duration)
+	if err != nil {
+		log.Printf("[%s] Remediation of %s failed: %v", req.CheckID, req.Subgraph, err)
+	} else {
+		log.Printf("[%s] Remediation of %s done", req.CheckID, req.Subgraph)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, sg := range m.subgraphs {
+		if sg.Name == req.Subgraph && sg.Remediated != nil && sg.Remediated.LastAt.Equal(req.Time) {
+			if err != nil {
+				sg.Remediated.Error = err.Error()
+			}
+		}
+	}
+}
+
+func runRemediationHook(hook RemediationHook, req RemediationRequest, timeout time.Duration) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	switch hook.Type {
+	case RemediationHTTP:
+		method := hook.Method
+		if method == "" {
+			method = http.MethodPost
+		}
+		httpReq, err := http.NewRequestWithContext(ctx, method, hook.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+		for k, v := range hook.Headers {
+			httpReq.Header.Set(k, v)
+		}
+		resp, err := httpClient().Do(httpReq)
+		if err != nil {
+			return fmt.Errorf("HTTP error: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			data, _ := readBody(resp)
+			return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+		}
+		return nil
+
+	case RemediationCommand:
+		cmd := exec.CommandContext(ctx, hook.Command[0], hook.Command[1:]...)
+		cmd.Stdin = bytes.NewReader(body)
+		cmd.Env = append(os.Environ(),
+			"SUBGRAPH_NAME="+req.Subgraph,
+			"SUBGRAPH_CHAIN="+req.Chain,
+			"SUBGRAPH_URL="+req.URL,
+			"SUBGRAPH_DEPLOYMENT="+req.Deployment,
+			"SUBGRAPH_INDEX_NODE_URL="+req.IndexNodeURL,
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+
+	case RemediationKubernetes:
+		return kubeRolloutRestart(hook, timeout)
+	}
+	return fmt.Errorf("unknown type %q", hook.Type)
+}
+
+// kubeRolloutRestart does what kubectl rollout restart does: it bumps an
+// annotation on the pod template, which replaces the pods.
+func kubeRolloutRestart(hook RemediationHook, timeout time.Duration) error {
+	resource, err := kubeWorkload(hook.Kind)
+	if err != nil {
+		return err
+	}
+	client, err := newKubeClient()
+	if err != nil {
+		return err
+	}
+	client.client.Timeout = timeout
+	namespace, name, err := kubeNamespace(strings.TrimSuffix(resource, "s"), hook.Target)
+	if err != nil {
+		return err
+	}
+	patch := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{"kubectl.kubernetes.io/restartedAt":%q}}}}}`,
+		time.Now().UTC().Format(time.RFC3339))
+	resp, err := client.do(http.MethodPatch, fmt.Sprintf("/apis/apps/v1/namespaces/%s/%s/%s", namespace, resource, name),
+		nil, "application/strategic-merge-patch+json", []byte(patch))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func copyRemediationInfo(r *RemediationInfo) *RemediationInfo {
+	if r == nil {
+		return nil
+	}
+	c := *r
+	return &c
+}
+
+func printRemediation(sg *SubgraphInfo) {
+	if stalled := stalledFor(sg); stalled >= time.Minute {
+		fmt.Printf("  stalled for %s at block %d\n", stalled.Round(time.Second), sg.CurrentBlock)
+	}
+	if r := sg.Remediated; r != nil {
+		fmt.Printf("  remediated %d times, last %s ago", r.Count, time.Since(r.LastAt).Round(time.Second))
+		if r.Error != "" {
+			fmt.Printf(" (failed: %s)", r.Error)
+		}
+		fmt.Println()
+	}
+}
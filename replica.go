@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// replicaCompareEvery is the default compareInterval, in check intervals.
+	replicaCompareEvery = 5
+	// replicaLatencyWeight is the weight of the newest latency in a
+	// replica's moving average.
+	replicaLatencyWeight = 0.3
+)
+
+// ReplicaState is the last known state of one endpoint of a replicated
+// subgraph: its url or one of its replicas.
+type ReplicaState struct {
+	URL        string
+	Healthy    bool
+	Latency    time.Duration
+	Block      int64
+	Deployment string
+	Error      string
+	CheckedAt  time.Time
+}
+
+type ReplicaStatus struct {
+	URL        string    `json:"url"`
+	Active     bool      `json:"active"`
+	Healthy    bool      `json:"healthy"`
+	LatencyMs  float64   `json:"latencyMs"`
+	Block      int64     `json:"block,omitempty"`
+	Deployment string    `json:"deployment,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	CheckedAt  time.Time `json:"checkedAt"`
+}
+
+func (sg *SubgraphInfo) endpoints() []string {
+	return append([]string{sg.URL}, sg.Replicas...)
+}
+
+// endpointURLs returns every URL the subgraph's checks connect to: its
+// endpoints, IPFS and the index node.
+func (sg *SubgraphInfo) endpointURLs() []string {
+	return append(sg.endpoints(), sg.IPFSURL, sg.IndexNodeURL)
+}
+
+// syncReplicaStates aligns the replica states with the configured endpoints,
+// keeping the state of endpoints that are still configured.
+func syncReplicaStates(sg *SubgraphInfo) {
+	byURL := make(map[string]ReplicaState, len(sg.ReplicaStates))
+	for _, r := range sg.ReplicaStates {
+		byURL[r.URL] = r
+	}
+	states := make([]ReplicaState, 0, len(sg.Replicas)+1)
+	for _, url := range sg.endpoints() {
+		r, ok := byURL[url]
+		if !ok {
+			r = ReplicaState{URL: url, Healthy: true}
+		}
+		states = append(states, r)
+	}
+	sg.ReplicaStates = states
+}
+
+// fetchReplicatedMeta queries a subgraph's status. With replicas configured,
+// routine checks query the fastest healthy endpoint, falling back to the
+// others in order of latency if it fails, and every compareInterval all
+// endpoints are queried at once to detect replicas that diverge.
+func fetchReplicatedMeta(sg *SubgraphInfo) (subgraphMeta, error) {
+	if len(sg.Replicas) == 0 {
+		sg.ReplicaStates = nil
+		sg.ActiveURL = sg.URL
+		return fetchSubgraphMetaRetrying(sg.URL, sg.CheckID, sg.ResponseSchema, sg.GraphQLRequest)
+	}
+	syncReplicaStates(sg)
+	if sg.CheckedAt.Sub(sg.ComparedAt) >= sg.CompareInterval.Duration {
+		return compareReplicas(sg)
+	}
+
+	var lastErr error
+	for _, i := range replicaOrder(sg.ReplicaStates) {
+		r := &sg.ReplicaStates[i]
+		meta, err := fetchSubgraphMetaRetrying(r.URL, sg.CheckID, sg.ResponseSchema, sg.GraphQLRequest)
+		recordReplica(r, meta, err, sg.CheckedAt)
+		if err == nil {
+			sg.ActiveURL = r.URL
+			return meta, nil
+		}
+		logCheck(sg, "Subgraph %s replica %s failed: %v", sg.Name, r.URL, err)
+		lastErr = err
+	}
+	return subgraphMeta{}, lastErr
+}
+
+// compareReplicas queries every endpoint concurrently, records which ones
+// diverge and returns the result of the fastest healthy endpoint.
+func compareReplicas(sg *SubgraphInfo) (subgraphMeta, error) {
+	metas := make([]subgraphMeta, len(sg.ReplicaStates))
+	errs := make([]error, len(sg.ReplicaStates))
+	var wg sync.WaitGroup
+	for i, r := range sg.ReplicaStates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			metas[i], errs[i] = fetchSubgraphMetaRetrying(r.URL, sg.CheckID, sg.ResponseSchema, sg.GraphQLRequest)
+		}()
+	}
+	wg.Wait()
+	for i := range sg.ReplicaStates {
+		recordReplica(&sg.ReplicaStates[i], metas[i], errs[i], sg.CheckedAt)
+	}
+	sg.ComparedAt = sg.CheckedAt
+
+	divergence := replicaDivergence(sg.ReplicaStates, sg.WarnBlocksBehind)
+	switch {
+	case divergence != "" && divergence != sg.ReplicaDivergence:
+		logCheck(sg, "Subgraph %s replicas diverge: %s", sg.Name, divergence)
+	case divergence == "" && sg.ReplicaDivergence != "":
+		logCheck(sg, "Subgraph %s replicas agree again", sg.Name)
+	}
+	sg.ReplicaDivergence = divergence
+
+	order := replicaOrder(sg.ReplicaStates)
+	best := order[0]
+	if errs[best] == nil {
+		sg.ActiveURL = sg.ReplicaStates[best].URL
+	}
+	return metas[best], errs[best]
+}
+
+// replicaOrder returns the indexes of the healthy endpoints by latency,
+// followed by the unhealthy ones in configuration order.
+func replicaOrder(states []ReplicaState) []int {
+	order := make([]int, len(states))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		ra, rb := states[order[a]], states[order[b]]
+		if ra.Healthy != rb.Healthy {
+			return ra.Healthy
+		}
+		return ra.Healthy && ra.Latency < rb.Latency
+	})
+	return order
+}
+
+func recordReplica(r *ReplicaState, meta subgraphMeta, err error, now time.Time) {
+	r.CheckedAt = now
+	if err != nil {
+		r.Healthy = false
+		r.Error = err.Error()
+		return
+	}
+	r.Healthy = true
+	r.Error = ""
+	r.Block = meta.Block
+	r.Deployment = meta.Deployment
+	if r.Latency == 0 {
+		r.Latency = meta.Latency
+	} else {
+		r.Latency = time.Duration((1-replicaLatencyWeight)*float64(r.Latency) + replicaLatencyWeight*float64(meta.Latency))
+	}
+}
+
+// replicaDivergence describes how the healthy endpoints disagree: serving
+// different deployments, or blocks more than maxSpread apart. It returns ""
+// when they agree.
+func replicaDivergence(states []ReplicaState, maxSpread int64) string {
+	var healthy []ReplicaState
+	for _, r := range states {
+		if r.Healthy {
+			healthy = append(healthy, r)
+		}
+	}
+	if len(healthy) < 2 {
+		return ""
+	}
+	lo, hi := healthy[0], healthy[0]
+	for _, r := range healthy[1:] {
+		if r.Deployment != healthy[0].Deployment {
+			return fmt.Sprintf("%s serves %s, %s serves %s", healthy[0].URL, healthy[0].Deployment, r.URL, r.Deployment)
+		}
+		if r.Block < lo.Block {
+			lo = r
+		}
+		if r.Block > hi.Block {
+			hi = r
+		}
+	}
+	if maxSpread > 0 && hi.Block-lo.Block > maxSpread {
+		return fmt.Sprintf("%s is %d blocks behind %s", lo.URL, hi.Block-lo.Block, hi.URL)
+	}
+	return ""
+}
+
+func replicaStatuses(sg *SubgraphInfo) []ReplicaStatus {
+	if len(sg.ReplicaStates) == 0 {
+		return nil
+	}
+	out := make([]ReplicaStatus, len(sg.ReplicaStates))
+	for i, r := range sg.ReplicaStates {
+		out[i] = ReplicaStatus{
+			URL:        r.URL,
+			Active:     r.URL == sg.ActiveURL,
+			Healthy:    r.Healthy,
+			LatencyMs:  float64(r.Latency) / float64(time.Millisecond),
+			Block:      r.Block,
+			Deployment: r.Deployment,
+			Error:      r.Error,
+			CheckedAt:  r.CheckedAt,
+		}
+	}
+	return out
+}
+
+func validateReplicas(sg *SubgraphInfo) error {
+	seen := map[string]bool{sg.URL: true}
+	for _, url := range sg.Replicas {
+		if strings.TrimSpace(url) == "" {
+			return fmt.Errorf("subgraph %s: empty replica url", sg.Name)
+		}
+		if seen[url] {
+			return fmt.Errorf("subgraph %s: duplicate replica %s", sg.Name, url)
+		}
+		seen[url] = true
+	}
+	if sg.CompareInterval.Duration < 0 {
+		return fmt.Errorf("subgraph %s: compareInterval must not be negative", sg.Name)
+	}
+	return nil
+}
+
+func printReplicas(sg *SubgraphInfo) {
+	if len(sg.ReplicaStates) == 0 {
+		return
+	}
+	if sg.ActiveURL != "" && sg.ActiveURL != sg.URL {
+		fmt.Printf("  queried replica %s\n", sg.ActiveURL)
+	}
+	if sg.ReplicaDivergence != "" {
+		fmt.Printf("  replicas diverge: %s\n", sg.ReplicaDivergence)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// subgraphReport summarises a subgraph's samples over the report period.
+type subgraphReport struct {
+	Name      string
+	Checks    int
+	Good      int
+	lagSum    float64
+	lagCount  int
+	MaxLag    int64
+	Incidents []incident
+}
+
+// incident is a run of consecutive checks that failed the SLO (CRIT, ERROR,
+// FAILED or a failed query).
+type incident struct {
+	Subgraph string
+	Start    time.Time
+	End      time.Time
+	Worst    Status
+	Checks   int
+	Ongoing  bool
+}
+
+// historyReport is the report's JSON output.
+type historyReport struct {
+	From      time.Time            `json:"from"`
+	To        time.Time            `json:"to"`
+	Samples   int                  `json:"samples"`
+	Subgraphs []subgraphReportJSON `json:"subgraphs"`
+	Incidents []incidentJSON       `json:"incidents"`
+}
+
+type subgraphReportJSON struct {
+	Name         string   `json:"name"`
+	Checks       int      `json:"checks"`
+	Availability float64  `json:"availability"`
+	AvgLag       *float64 `json:"avgLag"`
+	MaxLag       int64    `json:"maxLag"`
+	Incidents    int      `json:"incidents"`
+}
+
+type incidentJSON struct {
+	Subgraph        string    `json:"subgraph"`
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	Worst           Status    `json:"worst"`
+	Checks          int       `json:"checks"`
+	Ongoing         bool      `json:"ongoing"`
+}
+
+var incidentSeverity = map[Status]int{StatusCrit: 1, StatusError: 2, StatusFailed: 3}
+
+// runReport implements "report": it summarises the persisted history
+// without checking anything.
+func runReport(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file (for history.path)")
+	historyPath := fs.String("history", "", "history file to read (default: history.path from the config)")
+	last := fs.String("last", "7d", "period to report on, e.g. 24h or 7d")
+	lang := fs.String("locale", "", "language and number format: "+localeNames()+" (default: locale from the config, or en)")
+	format := fs.String("format", FormatAuto, "output format: auto (table on a terminal, json otherwise), table, or json")
+	fs.Parse(args)
+	out, err := outputFormat(*format, "table", "json")
+	if err != nil {
+		return err
+	}
+
+	period, err := parseDays(*last)
+	if err != nil || period <= 0 {
+		return fmt.Errorf("invalid -last %q", *last)
+	}
+	if *lang != "" && !validLocale(*lang) {
+		return fmt.Errorf("unknown -locale %q, expected one of %s", *lang, localeNames())
+	}
+	path := *historyPath
+	if *configPath != "" {
+		cfg, err := loadConfigFile(*configPath)
+		if err != nil {
+			return err
+		}
+		if path == "" {
+			path = cfg.History.Path
+		}
+		if *lang == "" {
+			*lang = cfg.Locale
+		}
+	}
+	l := getLocale(*lang)
+	if path == "" {
+		return fmt.Errorf("no history file: set history.path in the config or pass -history")
+	}
+
+	to := time.Now()
+	from := to.Add(-period)
+	samples, err := readHistoryFile(path, from)
+	if err != nil {
+		return fmt.Errorf("read history failed: %v", err)
+	}
+	if out == "json" {
+		return printReportJSON(buildReports(samples), len(samples), from, to)
+	}
+	if len(samples) == 0 {
+		fmt.Println(l.Sprintf("No samples in %s since %s", path, l.Date(from)))
+		return nil
+	}
+
+	reports := buildReports(samples)
+	fmt.Println(l.Sprintf("History report %s - %s (%s samples)", l.Date(from), l.Date(to), l.Int(int64(len(samples)))) + "\n")
+	fmt.Printf("%s %s %s %s %s %s\n", l.Pad("Subgraph", 25), l.Pad("Checks", 8), l.Pad("Availability", 13), l.Pad("Avg Lag", 12), l.Pad("Max Lag", 12), l.T("Incidents"))
+	var incidents []incident
+	for _, r := range reports {
+		avgLag := "-"
+		if r.lagCount > 0 {
+			avgLag = l.Int(int64(r.lagSum / float64(r.lagCount)))
+		}
+		fmt.Printf("%-25s %-8s %-13s %-12s %-12s %d\n", r.Name, l.Int(int64(r.Checks)),
+			l.Float(float64(r.Good)/float64(r.Checks)*100, 3)+"%", avgLag, l.Int(r.MaxLag), len(r.Incidents))
+		incidents = append(incidents, r.Incidents...)
+	}
+
+	if len(incidents) == 0 {
+		fmt.Println("\n" + l.T("No incidents."))
+		return nil
+	}
+	sort.SliceStable(incidents, func(i, j int) bool { return incidents[i].Start.Before(incidents[j].Start) })
+	fmt.Printf("\n%s\n%s %s %s %s %s %s\n", l.T("Incidents"), l.Pad("Subgraph", 25), l.Pad("Start", 19), l.Pad("End", 19), l.Pad("Duration", 12), l.Pad("Worst", 7), l.T("Checks"))
+	for _, in := range incidents {
+		end := l.DateTime(in.End)
+		if in.Ongoing {
+			end = "ongoing"
+		}
+		fmt.Printf("%-25s %-19s %s %-12s %-7s %s\n", in.Subgraph, l.DateTime(in.Start), l.Pad(end, 19),
+			in.End.Sub(in.Start).Round(time.Second).String(), in.Worst, l.Int(int64(in.Checks)))
+	}
+	return nil
+}
+
+func printReportJSON(reports []*subgraphReport, samples int, from, to time.Time) error {
+	out := historyReport{From: from, To: to, Samples: samples, Subgraphs: []subgraphReportJSON{}, Incidents: []incidentJSON{}}
+	for _, r := range reports {
+		sr := subgraphReportJSON{Name: r.Name, Checks: r.Checks, MaxLag: r.MaxLag, Incidents: len(r.Incidents)}
+		if r.Checks > 0 {
+			sr.Availability = float64(r.Good) / float64(r.Checks)
+		}
+		if r.lagCount > 0 {
+			avg := r.lagSum / float64(r.lagCount)
+			sr.AvgLag = &avg
+		}
+		out.Subgraphs = append(out.Subgraphs, sr)
+		for _, in := range r.Incidents {
+			out.Incidents = append(out.Incidents, incidentJSON{
+				Subgraph:        in.Subgraph,
+				Start:           in.Start,
+				End:             in.End,
+				DurationSeconds: in.End.Sub(in.Start).Seconds(),
+				Worst:           in.Worst,
+				Checks:          in.Checks,
+				Ongoing:         in.Ongoing,
+			})
+		}
+	}
+	sort.SliceStable(out.Incidents, func(i, j int) bool { return out.Incidents[i].Start.Before(out.Incidents[j].Start) })
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// buildReports groups samples by subgraph, sorted by name. An incident
+// ends at the first good check after it, or at its last check if the
+// period ends first.
+func buildReports(samples []Sample) []*subgraphReport {
+	byName := make(map[string]*subgraphReport)
+	open := make(map[string]*incident)
+	for _, s := range samples {
+		r, ok := byName[s.Subgraph]
+		if !ok {
+			r = &subgraphReport{Name: s.Subgraph}
+			byName[s.Subgraph] = r
+		}
+		checks, good, errors := sampleCounts(s)
+		if checks == 0 {
+			continue
+		}
+		r.Checks += checks
+		r.Good += good
+		if ok := checks - errors; ok > 0 {
+			r.lagSum += float64(s.BlocksBehind) * float64(ok)
+			r.lagCount += ok
+			r.MaxLag = max(r.MaxLag, sampleMaxLag(s))
+		}
+
+		in := open[s.Subgraph]
+		if good == checks {
+			if in != nil {
+				in.End = s.Time
+				r.Incidents = append(r.Incidents, *in)
+				delete(open, s.Subgraph)
+			}
+			continue
+		}
+		status := s.Status
+		if s.Failed {
+			status = StatusError
+		}
+		if in == nil {
+			in = &incident{Subgraph: s.Subgraph, Start: s.Time, Worst: status}
+			open[s.Subgraph] = in
+		}
+		in.End = s.Time
+		in.Checks += checks - good
+		if incidentSeverity[status] > incidentSeverity[in.Worst] {
+			in.Worst = status
+		}
+	}
+	for name, in := range open {
+		in.Ongoing = true
+		byName[name].Incidents = append(byName[name].Incidents, *in)
+	}
+
+	reports := make([]*subgraphReport, 0, len(byName))
+	for _, r := range byName {
+		reports = append(reports, r)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Name < reports[j].Name })
+	return reports
+}
+
+// parseDays parses a duration that may also be given in whole days ("7d").
+func parseDays(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// minResyncGain is the smallest lead of indexing over chain speed, as a
+// share of the chain speed, that a re-sync duration is projected from.
+// Below it the two speeds are within measurement noise of each other, as
+// for a subgraph that only ever followed the head.
+const minResyncGain = 0.05
+
+// ResyncEstimate is the projected duration of indexing a subgraph again
+// from FromBlock up to the (growing) chain head.
+type ResyncEstimate struct {
+	Subgraph   string  `json:"subgraph"`
+	FromBlock  int64   `json:"fromBlock"`
+	ChainBlock int64   `json:"chainBlock"`
+	Blocks     int64   `json:"blocks"`
+	SyncSpeed  float64 `json:"syncSpeed"`
+	ChainSpeed float64 `json:"chainSpeed"`
+	// Basis is "catch-up" when the speed was measured while the subgraph
+	// was behind, or "in-sync" when it only ever followed the chain head,
+	// in which case the speed is a lower bound and the duration an upper one.
+	Basis           string    `json:"basis"`
+	Samples         int       `json:"samples"`
+	WindowFrom      time.Time `json:"windowFrom"`
+	WindowTo        time.Time `json:"windowTo"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	// Unknown says why no duration could be projected; DurationSeconds is
+	// then 0.
+	Unknown string `json:"unknown,omitempty"`
+}
+
+// estimateResync projects a re-sync from the average speeds in samples.
+// Speeds are averaged over pairs of consecutive successful checks; pairs
+// where the subgraph was behind (WARN or CRIT) are preferred, since while
+// in sync a subgraph indexes no faster than the chain grows.
+func estimateResync(s SubgraphStatus, samples []Sample, from int64) (ResyncEstimate, error) {
+	e := ResyncEstimate{Subgraph: s.Name, FromBlock: from, ChainBlock: s.ChainBlock}
+	if s.ChainBlock == 0 {
+		return e, fmt.Errorf("chain head of %s is unknown", s.Name)
+	}
+	if from >= s.ChainBlock {
+		return e, fmt.Errorf("from block %d is not below the chain head %d", from, s.ChainBlock)
+	}
+	e.Blocks = s.ChainBlock - from
+
+	// Block sums are float64, as many large deltas may overflow int64.
+	var catchUpBlocks, allBlocks, chainBlocks float64
+	var catchUpMin, allMin float64
+	var prev *Sample
+	for i := range samples {
+		cur := &samples[i]
+		if cur.Failed || cur.LagUnknown {
+			continue
+		}
+		if prev != nil {
+			blocks := cur.CurrentBlock - prev.CurrentBlock
+			minutes := cur.Time.Sub(prev.Time).Minutes()
+			// A drop in blocks means a redeploy started from scratch.
+			if blocks >= 0 && minutes > 0 {
+				allBlocks += float64(blocks)
+				allMin += minutes
+				chainBlocks += float64(cur.ChainBlock) - float64(prev.ChainBlock)
+				if prev.Status == StatusWarn || prev.Status == StatusCrit {
+					catchUpBlocks += float64(blocks)
+					catchUpMin += minutes
+				}
+				e.Samples++
+				if e.WindowFrom.IsZero() {
+					e.WindowFrom = prev.Time
+				}
+				e.WindowTo = cur.Time
+			}
+		}
+		prev = cur
+	}
+	if allMin == 0 {
+		return e, fmt.Errorf("not enough history for %s to measure its indexing speed", s.Name)
+	}
+	e.ChainSpeed = chainBlocks / allMin
+	e.Basis = "in-sync"
+	e.SyncSpeed = allBlocks / allMin
+	if catchUpMin > 0 {
+		e.Basis = "catch-up"
+		e.SyncSpeed = catchUpBlocks / catchUpMin
+	}
+
+	// The head keeps moving while re-syncing, so only the difference
+	// between indexing and chain speed closes the gap.
+	gain := e.SyncSpeed - e.ChainSpeed
+	switch {
+	case gain <= 0:
+		e.Unknown = fmt.Sprintf("average indexing speed (%.2f blocks/min) does not outpace the chain (%.2f blocks/min)", e.SyncSpeed, e.ChainSpeed)
+	case gain < e.ChainSpeed*minResyncGain:
+		e.Unknown = fmt.Sprintf("average indexing speed (%.2f blocks/min) is too close to the chain's (%.2f blocks/min) to project from", e.SyncSpeed, e.ChainSpeed)
+	default:
+		e.DurationSeconds = float64(e.Blocks) / gain * 60
+	}
+	return e, nil
+}
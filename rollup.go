@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ChainSummary rolls up the subgraphs of one chain, to show the blast radius
+// of a chain-level problem at a glance. Healthy counts OK subgraphs, Behind
+// WARN and CRIT ones, and Failed ERROR and FAILED ones; subgraphs not
+// checked yet are only included in Subgraphs.
+type ChainSummary struct {
+	Chain           string  `json:"chain"`
+	Subgraphs       int     `json:"subgraphs"`
+	Healthy         int     `json:"healthy"`
+	Behind          int     `json:"behind"`
+	Failed          int     `json:"failed"`
+	RateLimited     int     `json:"rateLimited"`
+	MaxBlocksBehind int64   `json:"maxBlocksBehind"`
+	MedianSyncSpeed float64 `json:"medianSyncSpeed"`
+	// LagUnknown counts the subgraphs whose lag is unknown, which the max
+	// lag and median speed leave out.
+	LagUnknown int `json:"lagUnknown,omitempty"`
+}
+
+// summarizeChains returns one summary per chain, ordered by chain name.
+// The max lag and median speed are over the subgraphs whose lag and speed
+// are known.
+func summarizeChains(statuses []SubgraphStatus) []ChainSummary {
+	byChain := make(map[string]*ChainSummary)
+	speeds := make(map[string][]float64)
+	for _, s := range statuses {
+		c := byChain[s.Chain]
+		if c == nil {
+			c = &ChainSummary{Chain: s.Chain}
+			byChain[s.Chain] = c
+		}
+		c.Subgraphs++
+		switch s.Status {
+		case StatusOK:
+			c.Healthy++
+		case StatusWarn, StatusCrit:
+			c.Behind++
+		case StatusError, StatusFailed:
+			c.Failed++
+		case StatusRateLimited:
+			c.RateLimited++
+		}
+		if slices.Contains(s.Unknown, UnknownBlocksBehind) {
+			c.LagUnknown++
+		} else {
+			c.MaxBlocksBehind = max(c.MaxBlocksBehind, s.BlocksBehind)
+		}
+		if !slices.Contains(s.Unknown, UnknownSyncSpeed) {
+			speeds[s.Chain] = append(speeds[s.Chain], s.SyncSpeed)
+		}
+	}
+
+	out := make([]ChainSummary, 0, len(byChain))
+	for chain, c := range byChain {
+		c.MedianSyncSpeed = median(speeds[chain])
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Chain < out[j].Chain })
+	return out
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+func printChainSummary(c ChainSummary) {
+	fmt.Printf("%-25s %d subgraphs: %d healthy, %d behind, %d failed", "Summary", c.Subgraphs, c.Healthy, c.Behind, c.Failed)
+	if c.RateLimited > 0 {
+		fmt.Printf(", %d rate limited", c.RateLimited)
+	}
+	if c.LagUnknown == c.Subgraphs {
+		fmt.Println("; lag unknown")
+		return
+	}
+	fmt.Printf("; max lag %d, median speed %.2f blocks/min", c.MaxBlocksBehind, c.MedianSyncSpeed)
+	if c.LagUnknown > 0 {
+		fmt.Printf(" (lag unknown for %d)", c.LagUnknown)
+	}
+	fmt.Println()
+}
+
+func (m *Monitor) handleChains(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, summarizeChains(filterStatuses(m.Statuses(), viewTenant(r))))
+}
+
+// FleetSummary is the one-line triage view of every subgraph, e.g.
+// "42 OK, 3 WARN, 1 CRIT, 2 ERROR; worst: pDEX (-120k blocks, ETA 6.2h)".
+type FleetSummary struct {
+	Subgraphs int            `json:"subgraphs"`
+	Counts    map[Status]int `json:"counts"`
+	Worst     *FleetWorst    `json:"worst,omitempty"`
+	Text      string         `json:"text"`
+}
+
+type FleetWorst struct {
+	Name         string  `json:"name"`
+	Chain        string  `json:"chain"`
+	Status       Status  `json:"status"`
+	BlocksBehind int64   `json:"blocksBehind"`
+	ETASeconds   float64 `json:"etaSeconds,omitempty"`
+}
+
+var (
+	fleetStatusOrder = []Status{StatusOK, StatusWarn, StatusCrit, StatusError, StatusFailed, StatusRateLimited}
+	fleetSeverity    = map[Status]int{StatusWarn: 1, StatusCrit: 2, StatusError: 3, StatusFailed: 4}
+)
+
+// summarizeFleet counts the subgraphs by status and picks the worst one:
+// the most severe status, then the largest lag.
+func summarizeFleet(statuses []SubgraphStatus) FleetSummary {
+	f := FleetSummary{Subgraphs: len(statuses), Counts: make(map[Status]int)}
+	for _, s := range statuses {
+		if s.Status == StatusUnknown {
+			continue
+		}
+		f.Counts[s.Status]++
+		rank := fleetSeverity[s.Status]
+		if rank == 0 {
+			continue
+		}
+		if w := f.Worst; w == nil || rank > fleetSeverity[w.Status] || rank == fleetSeverity[w.Status] && s.BlocksBehind > w.BlocksBehind {
+			f.Worst = &FleetWorst{Name: s.Name, Chain: s.Chain, Status: s.Status, BlocksBehind: s.BlocksBehind, ETASeconds: s.ETASeconds}
+		}
+	}
+
+	var parts []string
+	for _, status := range fleetStatusOrder {
+		if n := f.Counts[status]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, status))
+		}
+	}
+	if len(parts) == 0 {
+		f.Text = "no subgraphs checked yet"
+		return f
+	}
+	f.Text = strings.Join(parts, ", ")
+	if w := f.Worst; w != nil {
+		f.Text += "; worst: " + w.Name + " (" + formatWorst(w) + ")"
+	}
+	return f
+}
+
+func formatWorst(w *FleetWorst) string {
+	if w.Status == StatusError || w.Status == StatusFailed {
+		return string(w.Status)
+	}
+	s := "-" + formatBlockCount(w.BlocksBehind) + " blocks"
+	if w.ETASeconds > 0 {
+		s += ", ETA " + formatETADuration(time.Duration(w.ETASeconds*float64(time.Second)))
+	}
+	return s
+}
+
+// formatBlockCount abbreviates large block counts: 950, 120k, 1.2M.
+func formatBlockCount(n int64) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1e6)
+	case n >= 10_000:
+		return fmt.Sprintf("%dk", n/1000)
+	case n >= 1000:
+		return fmt.Sprintf("%.1fk", float64(n)/1e3)
+	}
+	return fmt.Sprintf("%d", n)
+}
+
+func (m *Monitor) handleSummary(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, summarizeFleet(filterStatuses(m.Statuses(), viewTenant(r))))
+}
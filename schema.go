@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Response schema modes: how closely a _meta response must match what
+// graph-node returns.
+const (
+	// ResponseSchemaStrict rejects missing and unknown fields, so a proxy
+	// or indexer changing the response is noticed.
+	ResponseSchemaStrict = "strict"
+	// ResponseSchemaDefault ignores unknown fields but needs the block
+	// number as a JSON number.
+	ResponseSchemaDefault = "default"
+	// ResponseSchemaLenient also reads numbers and booleans sent as
+	// strings, including hex block numbers, for non-standard indexers.
+	ResponseSchemaLenient = "lenient"
+)
+
+// ErrorKindSchema marks checks whose response did not have the shape the
+// subgraph's responseSchema expects.
+const ErrorKindSchema = "schema"
+
+func validResponseSchema(mode string) bool {
+	switch mode {
+	case ResponseSchemaStrict, ResponseSchemaDefault, ResponseSchemaLenient:
+		return true
+	}
+	return false
+}
+
+// SchemaError names the field of a _meta response that could not be read.
+type SchemaError struct {
+	Field   string
+	Problem string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("unexpected _meta response: %s: %s", e.Field, e.Problem)
+}
+
+func isSchemaError(err error) bool {
+	var se *SchemaError
+	return errors.As(err, &se)
+}
+
+type metaParser struct {
+	mode string
+}
+
+// parseMetaResponse reads the block, deployment and indexing error flag of
+// a _meta query response. GraphQL errors in the response are returned as a
+// graphQLError; anything else unreadable as a SchemaError.
+func parseMetaResponse(body []byte, mode string) (subgraphMeta, error) {
+	p := metaParser{mode: mode}
+	top, err := p.object(body, "response", "data", "errors")
+	if err != nil {
+		return subgraphMeta{}, err
+	}
+	if raw, ok := top["errors"]; ok && !isNull(raw) {
+		message, err := p.firstErrorMessage(raw)
+		if err != nil {
+			return subgraphMeta{}, err
+		}
+		if message != "" {
+			return subgraphMeta{}, newGraphQLError(message)
+		}
+	}
+
+	data, err := p.object(top["data"], "data", "_meta")
+	if err != nil {
+		return subgraphMeta{}, err
+	}
+	meta, err := p.object(data["_meta"], "data._meta", "block", "deployment", "hasIndexingErrors")
+	if err != nil {
+		return subgraphMeta{}, err
+	}
+	block, err := p.object(meta["block"], "data._meta.block", "number")
+	if err != nil {
+		return subgraphMeta{}, err
+	}
+
+	var out subgraphMeta
+	if out.Block, err = p.integer(block["number"], "data._meta.block.number"); err != nil {
+		return subgraphMeta{}, err
+	}
+	if out.Block <= 0 {
+		return subgraphMeta{}, &SchemaError{Field: "data._meta.block.number", Problem: fmt.Sprintf("invalid block number %d", out.Block)}
+	}
+	if out.Deployment, err = p.str(meta["deployment"], "data._meta.deployment"); err != nil {
+		return subgraphMeta{}, err
+	}
+	if out.HasIndexingErrors, err = p.boolean(meta["hasIndexingErrors"], "data._meta.hasIndexingErrors"); err != nil {
+		return subgraphMeta{}, err
+	}
+	return out, nil
+}
+
+// object decodes a JSON object. In strict mode, keys other than allowed
+// are an error.
+func (p metaParser) object(raw json.RawMessage, field string, allowed ...string) (map[string]json.RawMessage, error) {
+	if isNull(raw) {
+		return nil, &SchemaError{Field: field, Problem: "missing"}
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, &SchemaError{Field: field, Problem: "expected an object, got " + describeJSON(raw)}
+	}
+	if p.mode == ResponseSchemaStrict {
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if !slices.Contains(allowed, k) {
+				return nil, &SchemaError{Field: field + "." + k, Problem: "unexpected field"}
+			}
+		}
+	}
+	return obj, nil
+}
+
+func (p metaParser) integer(raw json.RawMessage, field string) (int64, error) {
+	if isNull(raw) {
+		return 0, &SchemaError{Field: field, Problem: "missing"}
+	}
+	if s := strings.TrimSpace(string(raw)); isIntegerLiteral(s) {
+		n, err := parseDecimalQuantity("block number", s)
+		if err != nil {
+			return 0, &SchemaError{Field: field, Problem: err.Error()}
+		}
+		return n, nil
+	}
+	if p.mode == ResponseSchemaLenient {
+		var f float64
+		if json.Unmarshal(raw, &f) == nil && f == math.Trunc(f) {
+			// float64(maxQuantity) rounds up to 2^63, itself out of range.
+			if f < 0 || f >= float64(maxQuantity) {
+				return 0, &SchemaError{Field: field, Problem: fmt.Sprintf("block number %g is out of range, the maximum is %d", f, maxQuantity)}
+			}
+			return int64(f), nil
+		}
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			n, err := parseQuantity("block number", s)
+			if err != nil {
+				return 0, &SchemaError{Field: field, Problem: err.Error()}
+			}
+			return n, nil
+		}
+	}
+	return 0, &SchemaError{Field: field, Problem: "expected an integer, got " + describeJSON(raw)}
+}
+
+// str reads an optional string; strict mode requires it.
+func (p metaParser) str(raw json.RawMessage, field string) (string, error) {
+	if isNull(raw) {
+		if p.mode == ResponseSchemaStrict {
+			return "", &SchemaError{Field: field, Problem: "missing"}
+		}
+		return "", nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", &SchemaError{Field: field, Problem: "expected a string, got " + describeJSON(raw)}
+	}
+	return s, nil
+}
+
+// boolean reads an optional boolean; strict mode requires it.
+func (p metaParser) boolean(raw json.RawMessage, field string) (bool, error) {
+	if isNull(raw) {
+		if p.mode == ResponseSchemaStrict {
+			return false, &SchemaError{Field: field, Problem: "missing"}
+		}
+		return false, nil
+	}
+	var b bool
+	if json.Unmarshal(raw, &b) == nil {
+		return b, nil
+	}
+	if p.mode == ResponseSchemaLenient {
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			if b, err := strconv.ParseBool(s); err == nil {
+				return b, nil
+			}
+		}
+	}
+	return false, &SchemaError{Field: field, Problem: "expected a boolean, got " + describeJSON(raw)}
+}
+
+// firstErrorMessage returns the message of the first GraphQL error, or ""
+// for an empty list. Lenient mode also takes errors given as plain strings.
+func (p metaParser) firstErrorMessage(raw json.RawMessage) (string, error) {
+	var errs []json.RawMessage
+	if err := json.Unmarshal(raw, &errs); err != nil {
+		return "", &SchemaError{Field: "errors", Problem: "expected an array, got " + describeJSON(raw)}
+	}
+	if len(errs) == 0 {
+		return "", nil
+	}
+	if p.mode == ResponseSchemaLenient {
+		var s string
+		if json.Unmarshal(errs[0], &s) == nil {
+			return s, nil
+		}
+	}
+	e, err := p.object(errs[0], "errors[0]", "message", "locations", "path", "extensions")
+	if err != nil {
+		return "", err
+	}
+	message, err := p.str(e["message"], "errors[0].message")
+	if err != nil {
+		return "", err
+	}
+	if message == "" {
+		return "", &SchemaError{Field: "errors[0].message", Problem: "missing"}
+	}
+	return message, nil
+}
+
+func isNull(raw json.RawMessage) bool {
+	s := strings.TrimSpace(string(raw))
+	return s == "" || s == "null"
+}
+
+// describeJSON names the type of a JSON value and shows its start.
+func describeJSON(raw json.RawMessage) string {
+	s := strings.TrimSpace(string(raw))
+	if s == "" {
+		return "nothing"
+	}
+	kind := "invalid JSON"
+	switch {
+	case !json.Valid(raw):
+	case s[0] == '"':
+		kind = "a string"
+	case s[0] == '{':
+		kind = "an object"
+	case s[0] == '[':
+		kind = "an array"
+	case s == "true" || s == "false":
+		kind = "a boolean"
+	case s == "null":
+		return "null"
+	default:
+		kind = "a number"
+	}
+	if len(s) > 40 {
+		s = s[:40] + "..."
+	}
+	return kind + " " + s
+}
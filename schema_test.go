@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseMetaResponse(t *testing.T) {
+	const full = `{"data":{"_meta":{"block":{"number":100},"deployment":"QmDeployment","hasIndexingErrors":false}}}`
+	// want is the block number per mode, or the field of the expected
+	// SchemaError.
+	type want struct {
+		block int64
+		field string
+	}
+	ok := want{block: 100}
+	for _, tc := range []struct {
+		name                 string
+		body                 string
+		strict, def, lenient want
+	}{
+		{"standard", full, ok, ok, ok},
+		{"unknown top-level field",
+			`{"data":{"_meta":{"block":{"number":100},"deployment":"Qm","hasIndexingErrors":false}},"extensions":{}}`,
+			want{field: "response.extensions"}, ok, ok},
+		{"unknown _meta field",
+			`{"data":{"_meta":{"block":{"number":100,"hash":"0xab"},"deployment":"Qm","hasIndexingErrors":false}}}`,
+			want{field: "data._meta.block.hash"}, ok, ok},
+		{"number as string",
+			`{"data":{"_meta":{"block":{"number":"100"},"deployment":"Qm","hasIndexingErrors":false}}}`,
+			want{field: "data._meta.block.number"}, want{field: "data._meta.block.number"}, ok},
+		{"number as hex string",
+			`{"data":{"_meta":{"block":{"number":"0x64"},"deployment":"Qm","hasIndexingErrors":false}}}`,
+			want{field: "data._meta.block.number"}, want{field: "data._meta.block.number"}, ok},
+		{"whole float",
+			`{"data":{"_meta":{"block":{"number":100.0},"deployment":"Qm","hasIndexingErrors":false}}}`,
+			want{field: "data._meta.block.number"}, want{field: "data._meta.block.number"}, ok},
+		{"fractional float",
+			`{"data":{"_meta":{"block":{"number":100.5},"deployment":"Qm","hasIndexingErrors":false}}}`,
+			want{field: "data._meta.block.number"}, want{field: "data._meta.block.number"}, want{field: "data._meta.block.number"}},
+		{"number above int64",
+			`{"data":{"_meta":{"block":{"number":9223372036854775808},"deployment":"Qm","hasIndexingErrors":false}}}`,
+			want{field: "data._meta.block.number"}, want{field: "data._meta.block.number"}, want{field: "data._meta.block.number"}},
+		{"zero block",
+			`{"data":{"_meta":{"block":{"number":0},"deployment":"Qm","hasIndexingErrors":false}}}`,
+			want{field: "data._meta.block.number"}, want{field: "data._meta.block.number"}, want{field: "data._meta.block.number"}},
+		{"boolean as string",
+			`{"data":{"_meta":{"block":{"number":100},"deployment":"Qm","hasIndexingErrors":"false"}}}`,
+			want{field: "data._meta.hasIndexingErrors"}, want{field: "data._meta.hasIndexingErrors"}, ok},
+		{"missing optional fields",
+			`{"data":{"_meta":{"block":{"number":100}}}}`,
+			want{field: "data._meta.deployment"}, ok, ok},
+		{"missing _meta", `{"data":{}}`,
+			want{field: "data._meta"}, want{field: "data._meta"}, want{field: "data._meta"}},
+		{"null _meta", `{"data":{"_meta":null}}`,
+			want{field: "data._meta"}, want{field: "data._meta"}, want{field: "data._meta"}},
+		{"missing block", `{"data":{"_meta":{"deployment":"Qm","hasIndexingErrors":false}}}`,
+			want{field: "data._meta.block"}, want{field: "data._meta.block"}, want{field: "data._meta.block"}},
+		{"missing number", `{"data":{"_meta":{"block":{},"deployment":"Qm","hasIndexingErrors":false}}}`,
+			want{field: "data._meta.block.number"}, want{field: "data._meta.block.number"}, want{field: "data._meta.block.number"}},
+		{"missing data", `{}`,
+			want{field: "data"}, want{field: "data"}, want{field: "data"}},
+		{"not an object", `[]`,
+			want{field: "response"}, want{field: "response"}, want{field: "response"}},
+	} {
+		for _, m := range []struct {
+			mode string
+			want want
+		}{
+			{ResponseSchemaStrict, tc.strict},
+			{ResponseSchemaDefault, tc.def},
+			{ResponseSchemaLenient, tc.lenient},
+		} {
+			meta, err := parseMetaResponse([]byte(tc.body), m.mode)
+			if m.want.field != "" {
+				var se *SchemaError
+				if !errors.As(err, &se) || se.Field != m.want.field {
+					t.Errorf("%s (%s): error = %v, want a schema error for %s", tc.name, m.mode, err, m.want.field)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s (%s): %v", tc.name, m.mode, err)
+			} else if meta.Block != m.want.block {
+				t.Errorf("%s (%s): block %d, want %d", tc.name, m.mode, meta.Block, m.want.block)
+			}
+		}
+	}
+}
+
+func TestParseMetaResponseGraphQLError(t *testing.T) {
+	body := `{"data":null,"errors":[{"message":"Subgraph failed with deterministic error"}]}`
+	for _, mode := range []string{ResponseSchemaStrict, ResponseSchemaDefault, ResponseSchemaLenient} {
+		_, err := parseMetaResponse([]byte(body), mode)
+		if err == nil || isSchemaError(err) {
+			t.Errorf("%s: error = %v, want a GraphQL error", mode, err)
+		}
+	}
+	if _, err := parseMetaResponse([]byte(`{"errors":["boom"]}`), ResponseSchemaLenient); err == nil || isSchemaError(err) {
+		t.Errorf("lenient string error = %v, want a GraphQL error", err)
+	}
+	if _, err := parseMetaResponse([]byte(`{"errors":["boom"]}`), ResponseSchemaDefault); !isSchemaError(err) {
+		t.Errorf("default string error = %v, want a schema error", err)
+	}
+}
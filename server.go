@@ -0,0 +1,480 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type ServerConfig struct {
+	Listen         string     `json:"listen"`
+	BasePath       string     `json:"basePath"`
+	TrustedProxies []string   `json:"trustedProxies"`
+	CORS           CORSConfig `json:"cors"`
+	Auth           AuthConfig `json:"auth"`
+	// AccessLog writes one JSON line per API request. Read at startup.
+	AccessLog AccessLogConfig `json:"accessLog"`
+}
+
+func (c *ServerConfig) validate() error {
+	if _, err := parseTrustedProxies(c.TrustedProxies); err != nil {
+		return fmt.Errorf("server.trustedProxies: %v", err)
+	}
+	if err := c.CORS.validate(); err != nil {
+		return fmt.Errorf("server.cors: %v", err)
+	}
+	return c.Auth.validate()
+}
+
+func (m *Monitor) Serve(cfg ServerConfig) {
+	handler, err := m.handler(cfg)
+	if err != nil {
+		log.Fatalf("HTTP server error: %v", err)
+	}
+
+	srv := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("HTTP server listening on %s", cfg.Listen)
+	if err := srv.ListenAndServe(); err != nil {
+		log.Fatalf("HTTP server error: %v", err)
+	}
+}
+
+// handler wraps the API routes in, from the outside in: proxy header
+// handling, access logging and request metrics, base path stripping, CORS
+// and authentication.
+func (m *Monitor) handler(cfg ServerConfig) (http.Handler, error) {
+	handler := m.routes()
+	if cfg.Auth.Enabled() {
+		m.mu.Lock()
+		tenants := m.cfg.Tenants
+		m.mu.Unlock()
+		auth, err := newAuthenticator(cfg.Auth, tenants)
+		if err != nil {
+			return nil, err
+		}
+		handler = auth.middleware(handler)
+	} else if !isLoopbackListen(cfg.Listen) {
+		log.Printf("WARNING: HTTP server on %s has no authentication configured (server.auth)", cfg.Listen)
+	}
+
+	if len(cfg.CORS.AllowedOrigins) > 0 {
+		handler = corsMiddleware(cfg.CORS, handler)
+	}
+
+	if base := normalizeBasePath(cfg.BasePath); base != "" {
+		mux := http.NewServeMux()
+		mux.Handle(base+"/", http.StripPrefix(base, handler))
+		mux.Handle(base, http.RedirectHandler(base+"/", http.StatusMovedPermanently))
+		handler = mux
+	}
+
+	var accessLog *accessLogger
+	if cfg.AccessLog.Enabled {
+		var err error
+		if accessLog, err = newAccessLogger(cfg.AccessLog); err != nil {
+			return nil, fmt.Errorf("access log: %v", err)
+		}
+	}
+	handler = accessMiddleware(m.httpStats, accessLog, handler)
+
+	if len(cfg.TrustedProxies) > 0 {
+		trusted, err := parseTrustedProxies(cfg.TrustedProxies)
+		if err != nil {
+			return nil, err
+		}
+		handler = proxyMiddleware(trusted, handler)
+	}
+	return handler, nil
+}
+
+func (m *Monitor) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", requireScope(ScopeRead, m.handleMetrics))
+	mux.HandleFunc("GET /api/v1/openapi.json", requireScope(ScopeRead, m.handleOpenAPI))
+	mux.HandleFunc("GET /api/v1/status", requireScope(ScopeRead, m.handleStatus))
+	mux.HandleFunc("GET /api/v1/events", requireScope(ScopeRead, m.handleEvents))
+	mux.HandleFunc("GET /api/v1/changes", requireScope(ScopeRead, m.handleChanges))
+	mux.HandleFunc("GET /api/v1/transitions", requireScope(ScopeRead, m.handleTransitions))
+	mux.HandleFunc("GET /api/v1/audit", requireScope(ScopeRead, m.handleAudit))
+	mux.HandleFunc("GET /api/v1/firehose", requireScope(ScopeRead, m.handleFirehose))
+	mux.HandleFunc("GET /api/v1/nodes", requireScope(ScopeRead, m.handleNodes))
+	mux.HandleFunc("GET /api/v1/certificates", requireScope(ScopeRead, m.handleCertificates))
+	mux.HandleFunc("GET /api/v1/chains", requireScope(ScopeRead, m.handleChains))
+	mux.HandleFunc("GET /api/v1/summary", requireScope(ScopeRead, m.handleSummary))
+	mux.HandleFunc("GET /api/v1/warnings", requireScope(ScopeRead, m.handleWarnings))
+	mux.HandleFunc("POST /api/v1/chains/{chain}/head", requireScope(ScopeHeads, m.handlePushHead))
+	mux.HandleFunc("POST /api/v1/subgraphs", requireScope(ScopeWrite, m.handleAddSubgraph))
+	mux.HandleFunc("DELETE /api/v1/subgraphs/{name}", requireScope(ScopeWrite, m.handleRemoveSubgraph))
+	mux.HandleFunc("GET /api/v1/subgraphs/{name}/history", requireScope(ScopeRead, m.handleHistory))
+	mux.HandleFunc("GET /api/v1/subgraphs/{name}/predict", requireScope(ScopeRead, m.handlePredict))
+	mux.HandleFunc("GET /api/v1/subgraphs/{name}/resync-estimate", requireScope(ScopeRead, m.handleResyncEstimate))
+	mux.HandleFunc("POST /api/v1/subgraphs/{name}/history/reset", requireScope(ScopeWrite, m.handleResetHistory))
+	mux.HandleFunc("GET /api/v1/silences", requireScope(ScopeRead, m.handleListSilences))
+	mux.HandleFunc("POST /api/v1/silences", requireScope(ScopeWrite, m.handleCreateSilence))
+	mux.HandleFunc("DELETE /api/v1/silences/{subgraph}", requireScope(ScopeWrite, m.handleDeleteSilence))
+	return routeRecorder(mux)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Write response error: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// handleStatus returns all visible subgraphs in config order, or with
+// ?sort=health ordered from least to most healthy.
+func (m *Monitor) handleStatus(w http.ResponseWriter, r *http.Request) {
+	statuses := filterStatuses(m.Statuses(), viewTenant(r))
+	switch r.URL.Query().Get("sort") {
+	case "":
+	case "health":
+		sort.SliceStable(statuses, func(i, j int) bool {
+			return statuses[i].HealthScore < statuses[j].HealthScore
+		})
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported sort")
+		return
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (m *Monitor) handleChanges(w http.ResponseWriter, r *http.Request) {
+	changes := m.Changes()
+	if view := viewTenant(r); view != "" {
+		all := changes.Changes
+		changes.Changes = []StatusChange{}
+		for _, c := range all {
+			if c.After.Tenant == view {
+				changes.Changes = append(changes.Changes, c)
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, changes)
+}
+
+func (m *Monitor) handleFirehose(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, m.Snapshot().visibleFirehose(viewTenant(r)))
+}
+
+func (m *Monitor) handleAddSubgraph(w http.ResponseWriter, r *http.Request) {
+	var sg SubgraphInfo
+	if err := json.NewDecoder(r.Body).Decode(&sg); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	// A remediation hook runs commands or restarts workloads, so only the
+	// config file may set one.
+	if sg.Remediation != nil {
+		writeError(w, http.StatusBadRequest, "remediation can only be set in the config file")
+		return
+	}
+	// Severity predicates are evaluated on every cycle, so only the config
+	// file may set them too.
+	if sg.Severity != nil {
+		writeError(w, http.StatusBadRequest, "severity can only be set in the config file")
+		return
+	}
+	if t := principalTenant(r); t != "" {
+		sg.Tenant = t
+	}
+	if err := m.AddSubgraph(&sg); err != nil {
+		// Names are shared by all tenants; a tenant must not learn that
+		// another one has a subgraph by that name.
+		if errors.Is(err, errSubgraphExists) && !m.Snapshot().subgraphVisible(sg.Name, principalTenant(r)) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("subgraph name %q is not available", sg.Name))
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Printf("Subgraph %s added by %s", sg.Name, principalName(r))
+	m.audit(r, AuditSubgraphAdd, sg.Name, sg.Tenant, nil, &sg)
+	writeJSON(w, http.StatusCreated, &sg)
+}
+
+func (m *Monitor) handleRemoveSubgraph(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !m.Snapshot().subgraphVisible(name, viewTenant(r)) {
+		writeError(w, http.StatusNotFound, "unknown subgraph")
+		return
+	}
+	sg := m.RemoveSubgraph(name)
+	if sg == nil {
+		writeError(w, http.StatusNotFound, "unknown subgraph")
+		return
+	}
+	log.Printf("Subgraph %s removed by %s", name, principalName(r))
+	m.audit(r, AuditSubgraphRemove, name, sg.Tenant, sg, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *Monitor) handleResetHistory(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !m.Snapshot().subgraphVisible(name, viewTenant(r)) || !m.ResetHistory(name) {
+		writeError(w, http.StatusNotFound, "unknown subgraph")
+		return
+	}
+	log.Printf("Sync history of %s reset by %s", name, principalName(r))
+	m.audit(r, AuditHistoryReset, name, m.Snapshot().subgraphTenant(name), nil, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleHistory returns the lag/speed time series of a subgraph between
+// from and to (RFC 3339 or unix seconds, default: last 24h), averaged into
+// step-wide buckets (default: enough to yield ~300 points).
+func (m *Monitor) handleHistory(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	q := r.URL.Query()
+
+	to := time.Now()
+	from := to.Add(-24 * time.Hour)
+	var err error
+	if v := q.Get("to"); v != "" {
+		if to, err = parseTimeParam(v); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid to: "+err.Error())
+			return
+		}
+		from = to.Add(-24 * time.Hour)
+	}
+	if v := q.Get("from"); v != "" {
+		if from, err = parseTimeParam(v); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid from: "+err.Error())
+			return
+		}
+	}
+	if !from.Before(to) {
+		writeError(w, http.StatusBadRequest, "from must be before to")
+		return
+	}
+
+	step := to.Sub(from) / defaultHistoryPoints
+	if v := q.Get("step"); v != "" {
+		if step, err = time.ParseDuration(v); err != nil || step <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid step")
+			return
+		}
+	}
+	if step < time.Second {
+		step = time.Second
+	}
+
+	if !m.Snapshot().subgraphVisible(name, viewTenant(r)) {
+		writeError(w, http.StatusNotFound, "unknown subgraph")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"subgraph": name,
+		"from":     from,
+		"to":       to,
+		"step":     step.String(),
+		"points":   downsample(m.store.LoadHistory(name, from, to), from, step),
+	})
+}
+
+// handlePredict returns when the subgraph is expected to index ?block=N.
+func (m *Monitor) handlePredict(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	target, err := strconv.ParseInt(r.URL.Query().Get("block"), 10, 64)
+	if err != nil || target <= 0 {
+		writeError(w, http.StatusBadRequest, "block must be a positive block number")
+		return
+	}
+	for _, s := range filterStatuses(m.Snapshot().Subgraphs, viewTenant(r)) {
+		if s.Name != name {
+			continue
+		}
+		p, err := predictBlock(s, target, time.Now())
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+		return
+	}
+	writeError(w, http.StatusNotFound, "unknown subgraph")
+}
+
+// handleResyncEstimate estimates a full re-sync from the subgraph's start
+// block, or from ?from=N (e.g. a candidate graft block), using the speeds
+// recorded in its retained history.
+func (m *Monitor) handleResyncEstimate(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	for _, s := range filterStatuses(m.Snapshot().Subgraphs, viewTenant(r)) {
+		if s.Name != name {
+			continue
+		}
+		from := s.StartBlock
+		if v := r.URL.Query().Get("from"); v != "" {
+			var err error
+			if from, err = strconv.ParseInt(v, 10, 64); err != nil || from < 0 {
+				writeError(w, http.StatusBadRequest, "invalid from")
+				return
+			}
+		}
+		samples := m.store.LoadHistory(name, time.Time{}, time.Now())
+		e, err := estimateResync(s, samples, from)
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, e)
+		return
+	}
+	writeError(w, http.StatusNotFound, "unknown subgraph")
+}
+
+func parseTimeParam(v string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+func (m *Monitor) handleListSilences(w http.ResponseWriter, r *http.Request) {
+	silences := m.Silences()
+	if view := viewTenant(r); view != "" {
+		snap := m.Snapshot()
+		all := silences
+		silences = []Silence{}
+		for _, s := range all {
+			if snap.subgraphVisible(s.Subgraph, view) {
+				silences = append(silences, s)
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, silences)
+}
+
+func (m *Monitor) handleCreateSilence(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Subgraph string   `json:"subgraph"`
+		Duration Duration `json:"duration"`
+		Reason   string   `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if req.Duration.Duration <= 0 {
+		writeError(w, http.StatusBadRequest, "duration must be positive")
+		return
+	}
+	if view := viewTenant(r); view != "" && !m.Snapshot().subgraphVisible(req.Subgraph, view) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown subgraph %q", req.Subgraph))
+		return
+	}
+	now := time.Now()
+	silence := Silence{
+		Subgraph:  req.Subgraph,
+		Reason:    req.Reason,
+		CreatedBy: principalName(r),
+		CreatedAt: now,
+		ExpiresAt: now.Add(req.Duration.Duration),
+	}
+	if err := m.Silence(silence); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Printf("Subgraph %s silenced until %s by %s", silence.Subgraph, silence.ExpiresAt.Format(time.RFC3339), silence.CreatedBy)
+	m.audit(r, AuditSilenceCreate, silence.Subgraph, m.Snapshot().subgraphTenant(silence.Subgraph), nil, silence)
+	writeJSON(w, http.StatusCreated, silence)
+}
+
+func (m *Monitor) handleDeleteSilence(w http.ResponseWriter, r *http.Request) {
+	subgraph := r.PathValue("subgraph")
+	if view := viewTenant(r); view != "" && !m.Snapshot().subgraphVisible(subgraph, view) {
+		writeError(w, http.StatusNotFound, "no silence for subgraph")
+		return
+	}
+	var before *Silence
+	for _, s := range m.Silences() {
+		if s.Subgraph == subgraph {
+			before = &s
+		}
+	}
+	if !m.Unsilence(subgraph) {
+		writeError(w, http.StatusNotFound, "no silence for subgraph")
+		return
+	}
+	log.Printf("Silence for %s removed by %s", subgraph, principalName(r))
+	m.audit(r, AuditSilenceDelete, subgraph, m.Snapshot().subgraphTenant(subgraph), before, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func principalName(r *http.Request) string {
+	if p, ok := principalFromContext(r.Context()); ok {
+		return p.Name
+	}
+	return "anonymous"
+}
+
+// handleEvents pushes state transitions (e.g. OK -> WARN, ERROR -> OK) to a
+// WebSocket client as JSON text messages, one per transition.
+func (m *Monitor) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if !isWebSocketUpgrade(r) {
+		writeError(w, http.StatusUpgradeRequired, "websocket upgrade required")
+		return
+	}
+	ws, err := upgradeWebSocket(w, r, m.Snapshot().Config.Server.CORS)
+	if errors.Is(err, errWebSocketOrigin) {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer ws.Close()
+
+	events, cancel := m.events.Subscribe()
+	defer cancel()
+	view := viewTenant(r)
+
+	done := make(chan struct{})
+	go func() {
+		ws.readLoop()
+		close(done)
+	}()
+
+	ping := time.NewTicker(websocketPingPeriod)
+	defer ping.Stop()
+
+	for {
+		select {
+		case event := <-events:
+			if !tenantVisible(view, event.Context.Tenant) {
+				continue
+			}
+			payload, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("Marshal event error: %v", err)
+				continue
+			}
+			if err := ws.WriteText(payload); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := ws.writeFrame(wsOpPing, nil); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
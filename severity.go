@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// SeverityPolicy replaces the warn and crit thresholds of a subgraph with
+// predicates over its state, written as Go template expressions such as
+// `and (ge .BlocksBehind .CritBlocksBehind) (lt .SyncSpeed .ChainSpeed)`.
+// An empty predicate never matches. FAILED, RATE_LIMITED and ERROR are not
+// affected.
+type SeverityPolicy struct {
+	Warn string `json:"warn,omitempty"`
+	Crit string `json:"crit,omitempty"`
+
+	warn, crit *template.Template
+}
+
+// severityInput is what severity predicates see. Block counts are integers
+// and rates floats; compare a float field with a float literal (5.0) or
+// convert with float.
+type severityInput struct {
+	Name              string
+	Chain             string
+	Tenant            string
+	Priority          string
+	CurrentBlock      int64
+	ChainBlock        int64
+	BlocksBehind      int64
+	WarnBlocksBehind  int64
+	CritBlocksBehind  int64
+	SyncSpeed         float64
+	ChainSpeed        float64
+	ExpectedSyncSpeed float64
+	SlowSync          bool
+	// LagTrend is how many blocks per hour the lag grew over the recent
+	// checks; negative while catching up.
+	LagTrend            float64
+	TimeBehindSeconds   float64
+	StalledSeconds      float64
+	ChainHalted         bool
+	ConsecutiveFailures int
+	ErrorRate           float64
+	HasIndexingErrors   bool
+	QueryLatencyMs      float64
+}
+
+var severityFuncs = template.FuncMap{
+	"float": severityFloat,
+	"add":   func(a, b interface{}) float64 { return severityFloat(a) + severityFloat(b) },
+	"sub":   func(a, b interface{}) float64 { return severityFloat(a) - severityFloat(b) },
+	"mul":   func(a, b interface{}) float64 { return severityFloat(a) * severityFloat(b) },
+	"div":   func(a, b interface{}) float64 { return severityFloat(a) / severityFloat(b) },
+}
+
+func severityFloat(v interface{}) float64 {
+	rv := reflect.ValueOf(v)
+	switch {
+	case rv.CanInt():
+		return float64(rv.Int())
+	case rv.CanUint():
+		return float64(rv.Uint())
+	case rv.CanFloat():
+		return rv.Float()
+	}
+	return 0
+}
+
+func (p *SeverityPolicy) validate() error {
+	var err error
+	if p.warn, err = compileSeverity("warn", p.Warn); err != nil {
+		return err
+	}
+	p.crit, err = compileSeverity("crit", p.Crit)
+	return err
+}
+
+// compileSeverity parses a predicate and tries it on a zero input, so
+// unknown fields and non-boolean results are config errors. The predicate
+// must be a single expression: delimiters, which could close the action and
+// add loops or text around it, are rejected.
+func compileSeverity(name, expr string) (*template.Template, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	if strings.Contains(expr, "{{") || strings.Contains(expr, "}}") {
+		return nil, fmt.Errorf("%s: predicate must be an expression without {{ or }}", name)
+	}
+	t, err := template.New(name).Funcs(severityFuncs).Option("missingkey=error").Parse("{{" + expr + "}}")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if !singleExpression(t) {
+		return nil, fmt.Errorf("%s: predicate must be a single expression", name)
+	}
+	if _, err := evalSeverity(t, severityInput{}); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return t, nil
+}
+
+// singleExpression reports whether t is exactly one action evaluating a
+// pipeline, without variable declarations or further templates.
+func singleExpression(t *template.Template) bool {
+	if t.Tree == nil || len(t.Templates()) != 1 || len(t.Tree.Root.Nodes) != 1 {
+		return false
+	}
+	action, ok := t.Tree.Root.Nodes[0].(*parse.ActionNode)
+	return ok && action.Pipe != nil && len(action.Pipe.Decl) == 0 && !action.Pipe.IsAssign
+}
+
+func evalSeverity(t *template.Template, in severityInput) (bool, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, in); err != nil {
+		return false, err
+	}
+	switch buf.String() {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("predicate gave %q, expected true or false", buf.String())
+}
+
+// classify returns CRIT or WARN when the respective predicate holds, OK
+// otherwise. A predicate failing at runtime is logged and treated as not
+// matching.
+func (p *SeverityPolicy) classify(sg *SubgraphInfo) Status {
+	in := newSeverityInput(sg)
+	for _, c := range []struct {
+		t      *template.Template
+		status Status
+	}{{p.crit, StatusCrit}, {p.warn, StatusWarn}} {
+		if c.t == nil {
+			continue
+		}
+		ok, err := evalSeverity(c.t, in)
+		if err != nil {
+			log.Printf("Severity %s predicate for %s failed: %v", c.t.Name(), sg.Name, err)
+			continue
+		}
+		if ok {
+			return c.status
+		}
+	}
+	return StatusOK
+}
+
+func newSeverityInput(sg *SubgraphInfo) severityInput {
+	in := severityInput{
+		Name:                sg.Name,
+		Chain:               sg.Chain,
+		Tenant:              sg.Tenant,
+		Priority:            sg.Priority,
+		CurrentBlock:        sg.CurrentBlock,
+		ChainBlock:          sg.LastBlock,
+		BlocksBehind:        sg.BlocksBehind,
+		WarnBlocksBehind:    sg.WarnBlocksBehind,
+		CritBlocksBehind:    sg.CritBlocksBehind,
+		SyncSpeed:           sg.SyncSpeed,
+		ChainSpeed:          sg.ChainSpeed,
+		ExpectedSyncSpeed:   sg.ExpectedSyncSpeed,
+		SlowSync:            sg.SlowSync,
+		TimeBehindSeconds:   float64(sg.BlocksBehind) * sg.BlockTime.Seconds(),
+		StalledSeconds:      stalledFor(sg).Seconds(),
+		ChainHalted:         sg.ChainHalted,
+		ConsecutiveFailures: sg.ConsecutiveFailures,
+		HasIndexingErrors:   sg.HasIndexingErrors,
+		QueryLatencyMs:      sg.QueryLatency.Seconds() * 1000,
+	}
+	if n := len(sg.LastCheckedBlocks); n >= 2 && len(sg.LastCheckedHeads) == n && len(sg.LastCheckedTimes) == n {
+		if hours := sg.LastCheckedTimes[n-1].Sub(sg.LastCheckedTimes[0]).Hours(); hours > 0 {
+			firstLag := sg.LastCheckedHeads[0] - sg.LastCheckedBlocks[0]
+			lastLag := sg.LastCheckedHeads[n-1] - sg.LastCheckedBlocks[n-1]
+			in.LagTrend = float64(lastLag-firstLag) / hours
+		}
+	}
+	if len(sg.RecentChecks) > 0 {
+		failed := 0
+		for _, ok := range sg.RecentChecks {
+			if !ok {
+				failed++
+			}
+		}
+		in.ErrorRate = float64(failed) / float64(len(sg.RecentChecks))
+	}
+	return in
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Shard selects the part of the fleet one of several instances checks:
+// shard Index of Total, 1-based. Subgraphs and Firehose endpoints are
+// assigned by a hash of their name modulo Total, so every one is checked by
+// exactly one shard and adding or removing others does not move it.
+// Changing Total moves most of them to another shard. The zero Shard checks
+// everything.
+type Shard struct {
+	Index int
+	Total int
+}
+
+func parseShard(s string) (Shard, error) {
+	if s == "" {
+		return Shard{}, nil
+	}
+	index, total, ok := strings.Cut(s, "/")
+	i, err1 := strconv.Atoi(index)
+	n, err2 := strconv.Atoi(total)
+	if !ok || err1 != nil || err2 != nil || n < 1 || i < 1 || i > n {
+		return Shard{}, fmt.Errorf("shard must be <index>/<total> with 1 <= index <= total, got %q", s)
+	}
+	return Shard{Index: i, Total: n}, nil
+}
+
+func (s Shard) String() string {
+	if s.Total == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", s.Index, s.Total)
+}
+
+func (s *Shard) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return fmt.Errorf("shard must be a string like \"2/4\": %v", err)
+	}
+	shard, err := parseShard(str)
+	if err != nil {
+		return err
+	}
+	*s = shard
+	return nil
+}
+
+func (s Shard) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// owns reports whether the subgraph or Firehose endpoint name belongs to
+// this shard. Chain-level checks are owned as "chain:<name>", so one shard
+// reports each.
+func (s Shard) owns(name string) bool {
+	return s.Total <= 1 || s.owner(name) == s.Index
+}
+
+// owner returns the index of the shard name belongs to.
+func (s Shard) owner(name string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return int(h.Sum32()%uint32(s.Total)) + 1
+}
+
+// ownsChain reports whether this shard reports the chain's halts and its
+// state as an upstream.
+func (s Shard) ownsChain(name string) bool {
+	return s.owns("chain:" + name)
+}
+
+// apply drops the subgraphs and Firehose endpoints of other shards from cfg.
+// Other shards' Firehose endpoints that this shard's subgraphs depend on are
+// kept, marked dependencyOnly, so their dependsOn still inhibits alerts.
+func (s Shard) apply(cfg *Config) {
+	cfg.Shard = s
+	if s.Total <= 1 {
+		return
+	}
+	subgraphs, firehose := cfg.Subgraphs, cfg.Firehose
+	seen := make(map[string]bool)
+	needed := make(map[string]bool)
+	cfg.upstreams = nil
+	var owned []*SubgraphInfo
+	for _, sg := range subgraphs {
+		for _, dep := range sg.DependsOn {
+			up := upstreamName(sg, dep)
+			if kind, _, _ := strings.Cut(up, ":"); kind != "node" && !seen[up] {
+				seen[up] = true
+				cfg.upstreams = append(cfg.upstreams, up)
+			}
+			if name, ok := strings.CutPrefix(up, "firehose:"); ok && s.owns(sg.Name) {
+				needed[name] = true
+			}
+		}
+		if s.owns(sg.Name) {
+			owned = append(owned, sg)
+		}
+	}
+	cfg.Subgraphs = owned
+	var ownedFirehose []*FirehoseInfo
+	dependencies := 0
+	for _, fh := range firehose {
+		switch {
+		case s.owns(fh.Name):
+			ownedFirehose = append(ownedFirehose, fh)
+		case needed[fh.Name]:
+			fh.dependencyOnly = true
+			ownedFirehose = append(ownedFirehose, fh)
+			dependencies++
+		}
+	}
+	cfg.Firehose = ownedFirehose
+	cfg.certReporters = s.certReporters(cfg, subgraphs, firehose)
+	log.Printf("Shard %s: checking %d of %d subgraphs, %d of %d firehose endpoints (%d for dependsOn only)", s, len(cfg.Subgraphs), len(subgraphs), len(cfg.Firehose), len(firehose), dependencies)
+}
+
+// certReporters picks, for each host of a subgraph's endpoints or its
+// chain's, the lowest shard connecting to it, which reports its certificate.
+// Chains owned for halts and dependsOn count as connected by their owner.
+func (s Shard) certReporters(cfg *Config, subgraphs []*SubgraphInfo, firehose []*FirehoseInfo) map[string]int {
+	reporters := make(map[string]int)
+	add := func(index int, urls ...string) {
+		for _, raw := range urls {
+			u, err := url.Parse(raw)
+			if err != nil || u.Host == "" {
+				continue
+			}
+			if r, ok := reporters[u.Host]; !ok || index < r {
+				reporters[u.Host] = index
+			}
+		}
+	}
+	chain := func(index int, name string) {
+		if c, ok := cfg.Chains[name]; ok {
+			add(index, c.RpcURL, c.ExplorerURL)
+		}
+	}
+	for _, sg := range subgraphs {
+		index := s.owner(sg.Name)
+		add(index, sg.endpointURLs()...)
+		chain(index, sg.Chain)
+	}
+	for _, fh := range firehose {
+		chain(s.owner(fh.Name), fh.Chain)
+	}
+	for name, c := range cfg.Chains {
+		if c.HaltAfter.Duration > 0 {
+			chain(s.owner("chain:"+name), name)
+		}
+	}
+	for _, up := range cfg.upstreams {
+		if name, ok := strings.CutPrefix(up, "chain:"); ok {
+			chain(s.owner(up), name)
+		}
+	}
+	return reporters
+}
+
+// reportsCertificate reports whether this shard reports the certificate of
+// host. Other hosts, like notifiers and the OIDC issuer, are connected to by
+// whichever shards need them, so every shard that saw one reports it.
+func (s Shard) reportsCertificate(cfg *Config, host string) bool {
+	if s.Total <= 1 {
+		return true
+	}
+	if index, ok := cfg.certReporters[host]; ok {
+		return index == s.Index
+	}
+	return true
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	SIEMFormatJSON = "json"
+	SIEMFormatCEF  = "cef"
+
+	siemVendor  = "subgraph-monitor"
+	siemProduct = "subgraph-monitor"
+)
+
+func validSIEMFormat(f string) bool {
+	return f == "" || f == SIEMFormatJSON || f == SIEMFormatCEF
+}
+
+// siemEvent is the flat form of a transition sent to SIEM notifiers. Its
+// field names are kept stable for parsers and dashboards; new fields may be
+// added but existing ones are not renamed.
+type siemEvent struct {
+	Timestamp     string `json:"timestamp"`
+	TimestampMs   int64  `json:"timestamp_ms"`
+	Vendor        string `json:"vendor"`
+	Product       string `json:"product"`
+	Version       string `json:"version"`
+	EventID       string `json:"event_id"`
+	Kind          string `json:"kind"`
+	Outcome       string `json:"outcome"`
+	Severity      int    `json:"severity"`
+	SeverityLabel string `json:"severity_label"`
+	Subgraph      string `json:"subgraph,omitempty"`
+	Chain         string `json:"chain,omitempty"`
+	Tenant        string `json:"tenant,omitempty"`
+	Endpoint      string `json:"endpoint,omitempty"`
+	FromStatus    string `json:"from_status"`
+	ToStatus      string `json:"to_status"`
+	Trigger       string `json:"trigger,omitempty"`
+	BlocksBehind  int64  `json:"blocks_behind"`
+	CurrentBlock  int64  `json:"current_block"`
+	ChainBlock    int64  `json:"chain_block"`
+	Deployment    string `json:"deployment,omitempty"`
+	CheckID       string `json:"check_id,omitempty"`
+	CycleID       string `json:"cycle_id,omitempty"`
+	Silenced      bool   `json:"silenced"`
+	Inhibited     string `json:"inhibited,omitempty"`
+	Test          bool   `json:"test"`
+	Message       string `json:"message"`
+}
+
+func newSIEMEvent(t StateTransition) siemEvent {
+	kind := t.Kind
+	if kind == "" {
+		kind = "status"
+	}
+	outcome := "firing"
+	if resolves(t) {
+		outcome = "resolved"
+	}
+	severity, label := siemSeverity(t)
+	return siemEvent{
+		Timestamp:     t.Time.UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+		TimestampMs:   t.Time.UnixMilli(),
+		Vendor:        siemVendor,
+		Product:       siemProduct,
+		Version:       version,
+		EventID:       kind + "." + strings.ToLower(string(t.To)),
+		Kind:          kind,
+		Outcome:       outcome,
+		Severity:      severity,
+		SeverityLabel: label,
+		Subgraph:      t.Subgraph,
+		Chain:         t.Chain,
+		Tenant:        t.Context.Tenant,
+		Endpoint:      t.Endpoint,
+		FromStatus:    string(t.From),
+		ToStatus:      string(t.To),
+		Trigger:       t.Trigger,
+		BlocksBehind:  t.Context.BlocksBehind,
+		CurrentBlock:  t.Context.CurrentBlock,
+		ChainBlock:    t.Context.ChainBlock,
+		Deployment:    t.Context.Deployment,
+		CheckID:       t.CheckID,
+		CycleID:       t.CycleID,
+		Silenced:      t.Silenced,
+		Inhibited:     t.Inhibited,
+		Test:          t.Test,
+		Message:       formatTransition(t),
+	}
+}
+
+// siemSeverity maps a transition to the CEF severity scale, 0 to 10, and
+// its label: resolved alerts are Low, WARN Medium, ERROR and CRIT High and
+// FAILED Very-High.
+func siemSeverity(t StateTransition) (int, string) {
+	if resolves(t) {
+		return 1, "Low"
+	}
+	switch t.To {
+	case StatusFailed:
+		return 9, "Very-High"
+	case StatusCrit:
+		return 8, "High"
+	case StatusError:
+		return 7, "High"
+	case StatusWarn:
+		return 5, "Medium"
+	}
+	return 3, "Low"
+}
+
+// formatCEF renders an event as an ArcSight Common Event Format line.
+func formatCEF(e siemEvent) string {
+	parts := []string{
+		"rt=" + strconv.FormatInt(e.TimestampMs, 10),
+		"cat=" + cefExtensionEscape(e.Kind),
+		"outcome=" + e.Outcome,
+		"msg=" + cefExtensionEscape(e.Message),
+	}
+	// Custom fields are sent with their label, and left out when empty.
+	for _, f := range []struct{ key, label, value string }{
+		{"cs1", "subgraph", e.Subgraph},
+		{"cs2", "chain", e.Chain},
+		{"cs3", "tenant", e.Tenant},
+		{"cs4", "trigger", e.Trigger},
+		{"cs5", "checkId", e.CheckID},
+		{"cs6", "endpoint", e.Endpoint},
+		{"cn1", "blocksBehind", strconv.FormatInt(e.BlocksBehind, 10)},
+		{"cn2", "currentBlock", strconv.FormatInt(e.CurrentBlock, 10)},
+		{"cn3", "chainBlock", strconv.FormatInt(e.ChainBlock, 10)},
+		{"flexString1", "fromStatus", e.FromStatus},
+		{"flexString2", "toStatus", e.ToStatus},
+	} {
+		if f.value != "" {
+			parts = append(parts, f.key+"Label="+f.label, f.key+"="+cefExtensionEscape(f.value))
+		}
+	}
+	name := fmt.Sprintf("%s %s -> %s", e.Kind, e.FromStatus, e.ToStatus)
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|%s",
+		cefHeaderEscape(e.Vendor), cefHeaderEscape(e.Product), cefHeaderEscape(e.Version),
+		cefHeaderEscape(e.EventID), cefHeaderEscape(name), e.Severity, strings.Join(parts, " "))
+}
+
+var (
+	cefHeaderReplacer    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefExtensionReplacer = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+func cefHeaderEscape(s string) string {
+	return cefHeaderReplacer.Replace(s)
+}
+
+func cefExtensionEscape(s string) string {
+	return cefExtensionReplacer.Replace(s)
+}
+
+// notifySIEM writes the transition as one JSON or CEF line, to Path or as
+// the body of a POST to URL.
+func (c *NotifierConfig) notifySIEM(t StateTransition) error {
+	e := newSIEMEvent(t)
+	var line []byte
+	contentType := "application/json"
+	if c.Format == SIEMFormatCEF {
+		line = []byte(formatCEF(e))
+		contentType = "text/plain"
+	} else {
+		var err error
+		if line, err = json.Marshal(e); err != nil {
+			return fmt.Errorf("marshal event failed: %v", err)
+		}
+	}
+	if c.Path == "" {
+		return c.post(line, contentType, t.CheckID)
+	}
+	f, err := os.OpenFile(c.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testWebhookSecrets = []WebhookSecret{
+	{Name: "other", Secret: "other-secret"},
+	{Name: "ci", Secret: "shared-secret", Scopes: []string{ScopeWrite}},
+}
+
+func signedRequest(method, target, body string, signedAt time.Time) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	setSignature(r, "shared-secret", []byte(body), signedAt)
+	return r
+}
+
+func TestVerifySignature(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	body := `{"name":"dex","url":"https://example.com/subgraphs/name/dex","chain":"eth"}`
+	for _, tc := range []struct {
+		name    string
+		request func() *http.Request
+		err     string
+	}{
+		{"valid", func() *http.Request {
+			return signedRequest("POST", "/api/v1/subgraphs", body, now)
+		}, ""},
+		{"valid within skew", func() *http.Request {
+			return signedRequest("POST", "/api/v1/subgraphs", body, now.Add(signatureMaxAge-time.Second))
+		}, ""},
+		{"tampered body", func() *http.Request {
+			r := signedRequest("POST", "/api/v1/subgraphs", body, now)
+			r.Body = io.NopCloser(strings.NewReader(strings.Replace(body, "dex", "evil", 1)))
+			return r
+		}, "invalid signature"},
+		{"other path", func() *http.Request {
+			r := signedRequest("POST", "/api/v1/subgraphs", body, now)
+			signed := httptest.NewRequest("POST", "/api/v1/silences", strings.NewReader(body))
+			signed.Header = r.Header
+			return signed
+		}, "invalid signature"},
+		{"other method", func() *http.Request {
+			r := signedRequest("POST", "/api/v1/subgraphs/dex", "", now)
+			signed := httptest.NewRequest("DELETE", "/api/v1/subgraphs/dex", nil)
+			signed.Header = r.Header
+			return signed
+		}, "invalid signature"},
+		{"other query", func() *http.Request {
+			r := signedRequest("GET", "/api/v1/status?tenant=a", "", now)
+			signed := httptest.NewRequest("GET", "/api/v1/status?tenant=b", nil)
+			signed.Header = r.Header
+			return signed
+		}, "invalid signature"},
+		{"stale timestamp", func() *http.Request {
+			return signedRequest("POST", "/api/v1/subgraphs", body, now.Add(-signatureMaxAge-time.Second))
+		}, "outside the allowed"},
+		{"future timestamp", func() *http.Request {
+			return signedRequest("POST", "/api/v1/subgraphs", body, now.Add(signatureMaxAge+time.Second))
+		}, "outside the allowed"},
+		{"missing timestamp", func() *http.Request {
+			r := signedRequest("POST", "/api/v1/subgraphs", body, now)
+			r.Header.Del(signatureTimestampHeader)
+			return r
+		}, "missing or invalid"},
+		{"missing signature", func() *http.Request {
+			r := signedRequest("POST", "/api/v1/subgraphs", body, now)
+			r.Header.Del(signatureHeader)
+			return r
+		}, "must start with"},
+		{"unknown secret", func() *http.Request {
+			r := httptest.NewRequest("POST", "/api/v1/subgraphs", strings.NewReader(body))
+			setSignature(r, "wrong-secret", []byte(body), now)
+			return r
+		}, "invalid signature"},
+	} {
+		secret, err := verifySignature(tc.request(), testWebhookSecrets, &signatureCache{}, now)
+		switch {
+		case tc.err == "" && err != nil:
+			t.Errorf("%s: rejected: %v", tc.name, err)
+		case tc.err == "" && secret.Name != "ci":
+			t.Errorf("%s: verified as %q, want ci", tc.name, secret.Name)
+		case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+			t.Errorf("%s: error = %v, want one containing %q", tc.name, err, tc.err)
+		}
+	}
+}
+
+func TestVerifySignatureRejectsReplay(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	seen := &signatureCache{}
+	body := `{"block":21000000}`
+	first := signedRequest("POST", "/api/v1/chains/eth/head", body, now)
+	replay := httptest.NewRequest("POST", "/api/v1/chains/eth/head", strings.NewReader(body))
+	replay.Header = first.Header.Clone()
+
+	if _, err := verifySignature(first, testWebhookSecrets, seen, now); err != nil {
+		t.Fatalf("first request rejected: %v", err)
+	}
+	got, err := io.ReadAll(first.Body)
+	if err != nil || string(got) != body {
+		t.Errorf("body not restored for the handler: %q, %v", got, err)
+	}
+	if _, err := verifySignature(replay, testWebhookSecrets, seen, now.Add(time.Minute)); err == nil || !strings.Contains(err.Error(), "already used") {
+		t.Errorf("replay error = %v, want signature already used", err)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+type Silence struct {
+	Subgraph  string    `json:"subgraph"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func (s Silence) Active(now time.Time) bool {
+	return now.Before(s.ExpiresAt)
+}
+
+func (m *Monitor) Silence(s Silence) error {
+	if !m.Snapshot().hasSubgraph(s.Subgraph) {
+		return fmt.Errorf("unknown subgraph %q", s.Subgraph)
+	}
+	m.silenceMu.Lock()
+	defer m.silenceMu.Unlock()
+	m.silences[s.Subgraph] = s
+	return nil
+}
+
+func (m *Monitor) Unsilence(subgraph string) bool {
+	m.silenceMu.Lock()
+	defer m.silenceMu.Unlock()
+
+	_, ok := m.silences[subgraph]
+	delete(m.silences, subgraph)
+	return ok
+}
+
+func (m *Monitor) Silences() []Silence {
+	m.silenceMu.Lock()
+	defer m.silenceMu.Unlock()
+
+	now := time.Now()
+	silences := make([]Silence, 0, len(m.silences))
+	for name, s := range m.silences {
+		if !s.Active(now) {
+			delete(m.silences, name)
+			continue
+		}
+		silences = append(silences, s)
+	}
+	return silences
+}
+
+func (m *Monitor) isSilenced(subgraph string, now time.Time) bool {
+	m.silenceMu.Lock()
+	defer m.silenceMu.Unlock()
+	s, ok := m.silences[subgraph]
+	return ok && s.Active(now)
+}
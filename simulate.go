@@ -0,0 +1,384 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultSimBlockTime  = 2 * time.Second
+	DefaultSimStartBlock = 1000000
+)
+
+// SimulationConfig drives the "simulate" command, which replaces every chain
+// and subgraph endpoint with a synthetic one. Chains and subgraphs left out
+// produce a block every DefaultSimBlockTime and stay in sync.
+type SimulationConfig struct {
+	Chains    map[string]SimChain    `json:"chains,omitempty"`
+	Subgraphs map[string]SimSubgraph `json:"subgraphs,omitempty"`
+}
+
+type SimChain struct {
+	BlockTime  Duration `json:"blockTime,omitempty"`
+	StartBlock int64    `json:"startBlock,omitempty"`
+	// Outages make the RPC endpoint fail; Halts stop block production.
+	Outages []SimWindow `json:"outages,omitempty"`
+	Halts   []SimWindow `json:"halts,omitempty"`
+	// Every ReorgEvery the head drops ReorgDepth blocks, which the chain
+	// then rebuilds at twice its block rate.
+	ReorgEvery Duration `json:"reorgEvery,omitempty"`
+	ReorgDepth int64    `json:"reorgDepth,omitempty"`
+}
+
+type SimSubgraph struct {
+	// Behind is how many blocks behind the head the subgraph starts.
+	Behind int64 `json:"behind,omitempty"`
+	// Speed is how many blocks per minute it indexes; zero keeps pace with
+	// the chain, staying Behind blocks behind.
+	Speed float64 `json:"speed,omitempty"`
+	// Outages make the endpoint fail; Stalls stop indexing.
+	Outages []SimWindow `json:"outages,omitempty"`
+	Stalls  []SimWindow `json:"stalls,omitempty"`
+}
+
+// SimWindow is a period, measured from the start of the simulation, that
+// lasts For from After and repeats Every if set.
+type SimWindow struct {
+	After Duration `json:"after"`
+	For   Duration `json:"for"`
+	Every Duration `json:"every,omitempty"`
+}
+
+func (c SimulationConfig) validate(cfg *Config) error {
+	for name, chain := range c.Chains {
+		if _, ok := cfg.Chains[name]; !ok {
+			return fmt.Errorf("simulation.chains: unknown chain %q", name)
+		}
+		if chain.BlockTime.Duration < 0 || chain.StartBlock < 0 || chain.ReorgDepth < 0 || chain.ReorgEvery.Duration < 0 {
+			return fmt.Errorf("simulation.chains.%s: blockTime, startBlock, reorgEvery and reorgDepth must not be negative", name)
+		}
+		if err := validateSimWindows(chain.Outages); err != nil {
+			return fmt.Errorf("simulation.chains.%s.outages: %v", name, err)
+		}
+		if err := validateSimWindows(chain.Halts); err != nil {
+			return fmt.Errorf("simulation.chains.%s.halts: %v", name, err)
+		}
+	}
+	for name, sg := range c.Subgraphs {
+		if cfg.findSubgraph(name) == nil {
+			return fmt.Errorf("simulation.subgraphs: unknown subgraph %q", name)
+		}
+		if sg.Behind < 0 || sg.Speed < 0 {
+			return fmt.Errorf("simulation.subgraphs.%s: behind and speed must not be negative", name)
+		}
+		if err := validateSimWindows(sg.Outages); err != nil {
+			return fmt.Errorf("simulation.subgraphs.%s.outages: %v", name, err)
+		}
+		if err := validateSimWindows(sg.Stalls); err != nil {
+			return fmt.Errorf("simulation.subgraphs.%s.stalls: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func validateSimWindows(windows []SimWindow) error {
+	for i, w := range windows {
+		if w.After.Duration < 0 || w.For.Duration <= 0 {
+			return fmt.Errorf("#%d: after must not be negative and for must be positive", i)
+		}
+		if w.Every.Duration != 0 && w.Every.Duration < w.For.Duration {
+			return fmt.Errorf("#%d: every must be at least for", i)
+		}
+	}
+	return nil
+}
+
+func (c *Config) findSubgraph(name string) *SubgraphInfo {
+	for _, sg := range c.Subgraphs {
+		if sg.Name == name {
+			return sg
+		}
+	}
+	return nil
+}
+
+// overlap returns how much of the first elapsed of the simulation falls
+// within the windows.
+func overlap(windows []SimWindow, elapsed time.Duration) time.Duration {
+	var total time.Duration
+	for _, w := range windows {
+		since := elapsed - w.After.Duration
+		if since <= 0 {
+			continue
+		}
+		if w.Every.Duration == 0 {
+			total += min(since, w.For.Duration)
+			continue
+		}
+		n := since / w.Every.Duration
+		total += time.Duration(n)*w.For.Duration + min(since-n*w.Every.Duration, w.For.Duration)
+	}
+	return total
+}
+
+func inWindow(windows []SimWindow, elapsed time.Duration) bool {
+	for _, w := range windows {
+		since := elapsed - w.After.Duration
+		if since < 0 {
+			continue
+		}
+		if w.Every.Duration > 0 {
+			since %= w.Every.Duration
+		}
+		if since < w.For.Duration {
+			return true
+		}
+	}
+	return false
+}
+
+type simulation struct {
+	start     time.Time
+	chains    map[string]SimChain
+	subgraphs map[string]SimSubgraph
+	// subgraphChain maps each subgraph to its chain.
+	subgraphChain map[string]string
+}
+
+func newSimulation(cfg *Config, start time.Time) *simulation {
+	s := &simulation{
+		start:         start,
+		chains:        make(map[string]SimChain),
+		subgraphs:     make(map[string]SimSubgraph),
+		subgraphChain: make(map[string]string),
+	}
+	for name := range cfg.Chains {
+		c := cfg.Simulation.Chains[name]
+		if c.BlockTime.Duration == 0 {
+			c.BlockTime.Duration = DefaultSimBlockTime
+		}
+		if c.StartBlock == 0 {
+			c.StartBlock = DefaultSimStartBlock
+		}
+		s.chains[name] = c
+	}
+	for _, sg := range cfg.Subgraphs {
+		s.subgraphs[sg.Name] = cfg.Simulation.Subgraphs[sg.Name]
+		s.subgraphChain[sg.Name] = sg.Chain
+	}
+	return s
+}
+
+// produced returns the chain's block count without reorgs elapsed into the
+// simulation.
+func (c SimChain) produced(elapsed time.Duration) int64 {
+	return c.StartBlock + int64((elapsed-overlap(c.Halts, elapsed))/c.BlockTime.Duration)
+}
+
+func (c SimChain) head(elapsed time.Duration) int64 {
+	head := c.produced(elapsed)
+	if c.ReorgEvery.Duration > 0 && c.ReorgDepth > 0 && elapsed >= c.ReorgEvery.Duration {
+		rebuilt := int64((elapsed % c.ReorgEvery.Duration) / c.BlockTime.Duration)
+		head -= max(0, c.ReorgDepth-rebuilt)
+	}
+	return head
+}
+
+// producedAt returns when the chain produced block n, searching for the
+// first moment produced reached it.
+func (c SimChain) producedAt(start time.Time, n int64) time.Time {
+	if n <= c.StartBlock {
+		return start.Add(-time.Duration(c.StartBlock-n) * c.BlockTime.Duration)
+	}
+	lo, hi := time.Duration(0), time.Since(start)
+	for hi-lo > time.Millisecond {
+		mid := lo + (hi-lo)/2
+		if c.produced(mid) >= n {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return start.Add(hi)
+}
+
+func (s *simulation) subgraphBlock(name string, elapsed time.Duration) int64 {
+	sg := s.subgraphs[name]
+	chain := s.chains[s.subgraphChain[name]]
+	head := chain.head(elapsed)
+	active := elapsed - overlap(sg.Stalls, elapsed)
+	indexed := chain.StartBlock - sg.Behind + int64(active.Minutes()*sg.Speed)
+	if sg.Speed == 0 {
+		indexed = chain.produced(active) - sg.Behind
+	}
+	return max(0, min(indexed, head))
+}
+
+func (s *simulation) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	elapsed := time.Since(s.start)
+	kind, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch kind {
+	case "chain":
+		chain, ok := s.chains[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if inWindow(chain.Outages, elapsed) {
+			http.Error(w, "simulated RPC outage", http.StatusServiceUnavailable)
+			return
+		}
+		s.serveRPC(w, r, chain, elapsed)
+	case "subgraph":
+		sg, ok := s.subgraphs[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if inWindow(sg.Outages, elapsed) {
+			http.Error(w, "simulated subgraph outage", http.StatusBadGateway)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"_meta": map[string]interface{}{
+			"block":             map[string]interface{}{"number": s.subgraphBlock(name, elapsed)},
+			"deployment":        "QmSimulated" + strings.ReplaceAll(name, "-", ""),
+			"hasIndexingErrors": false,
+		}}})
+	case "ipfs":
+		// A manifest without a graft for every deployment.
+		w.Write([]byte("specVersion: 0.0.4\ndataSources: []\n"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *simulation) serveRPC(w http.ResponseWriter, r *http.Request, chain SimChain, elapsed time.Duration) {
+	var req struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params []interface{}   `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON-RPC request", http.StatusBadRequest)
+		return
+	}
+	resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+	head := chain.head(elapsed)
+	switch req.Method {
+	case "eth_blockNumber":
+		resp["result"] = fmt.Sprintf("0x%x", head)
+	case "eth_getBlockByNumber":
+		n := head
+		if len(req.Params) > 0 {
+			if p, ok := req.Params[0].(string); ok && p != "latest" {
+				if v, err := parseHexQuantity("block number", p); err == nil {
+					n = v
+				}
+			}
+		}
+		if n > head {
+			resp["result"] = nil
+			break
+		}
+		resp["result"] = map[string]interface{}{
+			"number":    fmt.Sprintf("0x%x", n),
+			"timestamp": fmt.Sprintf("0x%x", chain.producedAt(s.start, n).Unix()),
+		}
+	default:
+		resp["error"] = map[string]interface{}{"code": -32601, "message": "method not supported by the simulation"}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// simulate points every chain and subgraph at the simulation served from
+// base and turns off what would reach real infrastructure or files.
+func simulate(cfg *Config, base string) {
+	for name, chain := range cfg.Chains {
+		chain.RpcURL = base + "/chain/" + url.PathEscape(name)
+		chain.ExplorerURL = ""
+	}
+	cfg.IPFSURL = base + "/ipfs"
+	for _, sg := range cfg.Subgraphs {
+		sg.URL = base + "/subgraph/" + url.PathEscape(sg.Name)
+		sg.Replicas = nil
+		sg.IndexNodeURL = ""
+		sg.IPFSURL = cfg.IPFSURL
+	}
+	cfg.Firehose = nil
+	cfg.Remediation.DryRun = true
+	cfg.Cluster.AutoReassign = false
+	cfg.UpdateCheck.Enabled = false
+	cfg.History.Path = ""
+	cfg.EventLog.Path = ""
+	cfg.Audit.Path = ""
+	cfg.Export.Parquet.Path = ""
+}
+
+// runSimulate implements "simulate": it runs the monitor against synthetic
+// chains and subgraphs following the config's simulation section, so that
+// thresholds, ETAs and alert routing can be tried out. Notifications are
+// sent as tests.
+func runSimulate(args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	listen := fs.String("listen", "", "address for the HTTP API (overrides server.listen)")
+	duration := fs.Duration("duration", 0, "stop after this long (default: until interrupted)")
+	fs.Parse(args)
+
+	cfg := defaultConfig()
+	if *configPath != "" {
+		var err error
+		if cfg, err = loadConfigFile(*configPath); err != nil {
+			return err
+		}
+	}
+	if *listen != "" {
+		cfg.Server.Listen = *listen
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	sim := newSimulation(cfg, time.Now())
+	go http.Serve(ln, sim)
+	simulate(cfg, "http://"+ln.Addr().String())
+
+	names := make([]string, 0, len(sim.chains))
+	for name, c := range sim.chains {
+		names = append(names, fmt.Sprintf("%s (block %d every %s)", name, c.StartBlock, c.BlockTime.Duration))
+	}
+	sort.Strings(names)
+	log.Printf("Simulating %d subgraphs on %s; remediation is a dry run, nothing is persisted and notifications are marked as tests",
+		len(cfg.Subgraphs), strings.Join(names, ", "))
+
+	monitor, err := NewMonitor(cfg)
+	if err != nil {
+		return err
+	}
+	monitor.simulated = true
+	if cfg.SlackBot.Enabled() {
+		monitor.startSlackBot(cfg.SlackBot)
+	}
+	if cfg.Server.Listen != "" {
+		go monitor.Serve(cfg.Server)
+	}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	if *duration > 0 {
+		time.AfterFunc(*duration, func() { stop <- os.Interrupt })
+	}
+	monitor.Run(nil, stop)
+	return nil
+}
@@ -0,0 +1,518 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultSlackAPIURL      = "https://slack.com/api"
+	DefaultSlackAckDuration = 4 * time.Hour
+	slackReconnectDelay     = 10 * time.Second
+	slackMaxMessage         = 1 << 20
+	// slackRecheckTimeout bounds how long a re-check requested from Slack
+	// is waited for before its result is reported.
+	slackRecheckTimeout = 2 * time.Minute
+	slackStatusLimit    = 20
+
+	slackActionAck     = "ack"
+	slackActionRecheck = "recheck"
+)
+
+// SlackBotConfig runs a Slack app in socket mode, so no public endpoint is
+// needed. It answers the /subgraph slash command and, with Channel set,
+// posts alerts there with buttons to acknowledge them or re-check the
+// subgraph. Read at startup.
+type SlackBotConfig struct {
+	// AppToken is the app-level token (xapp-...) with connections:write.
+	AppToken string `json:"appToken"`
+	// BotToken is the bot token (xoxb-...) with chat:write, needed to post
+	// alerts to Channel.
+	BotToken string `json:"botToken"`
+	Channel  string `json:"channel,omitempty"`
+	// AckDuration is how long acknowledging an alert silences the subgraph.
+	AckDuration Duration `json:"ackDuration"`
+	APIURL      string   `json:"apiUrl"`
+	// Users and Channels allow Slack user IDs, and everyone in a channel,
+	// to use the commands and buttons; everyone else is denied. A user's
+	// entry takes precedence over the channel's.
+	Users    []SlackAccess `json:"users"`
+	Channels []SlackAccess `json:"channels"`
+}
+
+// SlackAccess allows a Slack user or channel ID, limited to Tenant's
+// subgraphs when set.
+type SlackAccess struct {
+	ID     string `json:"id"`
+	Tenant string `json:"tenant,omitempty"`
+}
+
+func (c *SlackBotConfig) Enabled() bool {
+	return c.AppToken != ""
+}
+
+func (c *SlackBotConfig) validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if c.Channel != "" && c.BotToken == "" {
+		return fmt.Errorf("slackBot.botToken is required to post to slackBot.channel")
+	}
+	if c.AckDuration.Duration <= 0 {
+		return fmt.Errorf("slackBot.ackDuration must be positive")
+	}
+	for i, u := range c.Users {
+		if u.ID == "" {
+			return fmt.Errorf("slackBot.users[%d]: id is required", i)
+		}
+	}
+	for i, ch := range c.Channels {
+		if ch.ID == "" {
+			return fmt.Errorf("slackBot.channels[%d]: id is required", i)
+		}
+	}
+	return nil
+}
+
+type slackEnvelope struct {
+	EnvelopeID string          `json:"envelope_id"`
+	Type       string          `json:"type"`
+	Reason     string          `json:"reason"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+type slackCommand struct {
+	Command     string `json:"command"`
+	Text        string `json:"text"`
+	UserID      string `json:"user_id"`
+	UserName    string `json:"user_name"`
+	ChannelID   string `json:"channel_id"`
+	ResponseURL string `json:"response_url"`
+}
+
+type slackInteraction struct {
+	Type string `json:"type"`
+	User struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	} `json:"user"`
+	Channel struct {
+		ID string `json:"id"`
+	} `json:"channel"`
+	ResponseURL string `json:"response_url"`
+	Actions     []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+	Message struct {
+		Text string `json:"text"`
+	} `json:"message"`
+}
+
+type slackMessage struct {
+	Channel         string        `json:"channel,omitempty"`
+	ResponseType    string        `json:"response_type,omitempty"`
+	ReplaceOriginal bool          `json:"replace_original,omitempty"`
+	Text            string        `json:"text"`
+	Blocks          []interface{} `json:"blocks,omitempty"`
+}
+
+// startSlackBot starts the bot in the background. Its alerts are subscribed
+// to before it returns, so they include the first cycle's transitions.
+func (m *Monitor) startSlackBot(cfg SlackBotConfig) {
+	if len(cfg.Users) == 0 && len(cfg.Channels) == 0 {
+		log.Printf("Slack bot: no slackBot.users or slackBot.channels allowed, commands and buttons are denied")
+	}
+	if cfg.Channel != "" {
+		go m.runSlackAlerts(cfg, m.events.SubscribeAlerts())
+	}
+	go m.runSlackBot(cfg)
+}
+
+// runSlackBot keeps a socket mode connection open until the process exits,
+// reconnecting whenever Slack drops it.
+func (m *Monitor) runSlackBot(cfg SlackBotConfig) {
+	for {
+		err := m.slackSession(cfg)
+		log.Printf("Slack bot disconnected, reconnecting in %s: %v", slackReconnectDelay, err)
+		time.Sleep(slackReconnectDelay)
+	}
+}
+
+func (m *Monitor) slackSession(cfg SlackBotConfig) error {
+	var open struct {
+		URL string `json:"url"`
+	}
+	if err := slackAPI(cfg, cfg.AppToken, "apps.connections.open", nil, &open); err != nil {
+		return err
+	}
+	ws, err := dialWebSocket(open.URL, slackMaxMessage)
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+	ws.readTimeout = 3 * websocketPingPeriod
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ping := time.NewTicker(websocketPingPeriod)
+		defer ping.Stop()
+		for {
+			select {
+			case <-ping.C:
+				if ws.writeFrame(wsOpPing, nil) != nil {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		data, err := ws.ReadMessage()
+		if err != nil {
+			return err
+		}
+		var env slackEnvelope
+		if err := json.Unmarshal(data, &env); err != nil {
+			log.Printf("Slack bot: invalid message: %v", err)
+			continue
+		}
+
+		var response interface{}
+		switch env.Type {
+		case "hello":
+			log.Printf("Slack bot connected")
+			continue
+		case "disconnect":
+			return fmt.Errorf("disconnect requested (%s)", env.Reason)
+		case "slash_commands":
+			var cmd slackCommand
+			if err := json.Unmarshal(env.Payload, &cmd); err != nil {
+				log.Printf("Slack bot: invalid slash command: %v", err)
+				break
+			}
+			response = m.slackCommand(cfg, cmd)
+		case "interactive":
+			var in slackInteraction
+			if err := json.Unmarshal(env.Payload, &in); err != nil {
+				log.Printf("Slack bot: invalid interaction: %v", err)
+				break
+			}
+			go m.slackInteraction(cfg, in)
+		}
+		if env.EnvelopeID == "" {
+			continue
+		}
+		ack, _ := json.Marshal(map[string]interface{}{"envelope_id": env.EnvelopeID, "payload": response})
+		if err := ws.WriteText(ack); err != nil {
+			return err
+		}
+	}
+}
+
+// access returns the tenant a Slack user acting in a channel is limited
+// to, "" for all subgraphs, and false when neither is allowed.
+func (c *SlackBotConfig) access(userID, channelID string) (string, bool) {
+	for _, u := range c.Users {
+		if u.ID == userID {
+			return u.Tenant, true
+		}
+	}
+	for _, ch := range c.Channels {
+		if ch.ID == channelID {
+			return ch.Tenant, true
+		}
+	}
+	return "", false
+}
+
+// slackCommand answers "/subgraph status [name]", "/subgraph check <name>"
+// and "/subgraph help" with a message only the caller sees.
+func (m *Monitor) slackCommand(cfg SlackBotConfig, cmd slackCommand) slackMessage {
+	sub, name, _ := strings.Cut(strings.TrimSpace(cmd.Text), " ")
+	name = strings.TrimSpace(name)
+	reply := slackMessage{ResponseType: "ephemeral"}
+	l := m.locale()
+	tenant, ok := cfg.access(cmd.UserID, cmd.ChannelID)
+	if !ok {
+		log.Printf("Slack bot: denied %s %s to %s (%s) in %s", cmd.Command, cmd.Text, cmd.UserName, cmd.UserID, cmd.ChannelID)
+		reply.Text = l.T("You are not allowed to use this command.")
+		return reply
+	}
+	statuses := filterStatuses(m.Statuses(), tenant)
+	switch strings.ToLower(sub) {
+	case "", "status":
+		if name == "" {
+			reply.Text = formatSlackFleet(l, statuses)
+			break
+		}
+		st, ok := findStatus(statuses, name)
+		if !ok {
+			reply.Text = l.Sprintf("Unknown subgraph %q", name)
+			break
+		}
+		reply.Text = formatSlackStatus(l, st)
+	case "check":
+		if name == "" {
+			reply.Text = l.Sprintf("Usage: %s check <subgraph>", cmd.Command)
+			break
+		}
+		st, ok := findStatus(statuses, name)
+		if !ok || !m.CheckNow(st.Name) {
+			reply.Text = l.Sprintf("Unknown subgraph %q", name)
+			break
+		}
+		name = st.Name
+		log.Printf("Re-check of %s requested by slack:%s", name, cmd.UserName)
+		m.auditSlack("slack:"+cmd.UserName, AuditSubgraphCheck, name, nil, nil)
+		go m.slackRecheckResult(cmd.ResponseURL, name, time.Now())
+		reply.Text = l.Sprintf("Re-checking *%s*...", name)
+	default:
+		reply.Text = l.Sprintf("Usage:\n`%[1]s status` fleet summary\n`%[1]s status <subgraph>` one subgraph\n`%[1]s check <subgraph>` check it now", cmd.Command)
+	}
+	return reply
+}
+
+func (m *Monitor) slackInteraction(cfg SlackBotConfig, in slackInteraction) {
+	if in.Type != "block_actions" || len(in.Actions) == 0 {
+		return
+	}
+	action, subgraph := in.Actions[0].ActionID, in.Actions[0].Value
+	actor := "slack:" + in.User.Username
+	l := m.locale()
+	tenant, ok := cfg.access(in.User.ID, in.Channel.ID)
+	if !ok || !tenantVisible(tenant, m.Snapshot().subgraphTenant(subgraph)) {
+		log.Printf("Slack bot: denied %s of %s to %s (%s) in %s", action, subgraph, actor, in.User.ID, in.Channel.ID)
+		postSlackResponse(in.ResponseURL, slackMessage{ResponseType: "ephemeral", Text: l.T("You are not allowed to use this command.")})
+		return
+	}
+	switch action {
+	case slackActionAck:
+		now := time.Now()
+		silence := Silence{
+			Subgraph:  subgraph,
+			Reason:    "acknowledged in Slack",
+			CreatedBy: actor,
+			CreatedAt: now,
+			ExpiresAt: now.Add(cfg.AckDuration.Duration),
+		}
+		reply := slackMessage{ReplaceOriginal: true}
+		if err := m.Silence(silence); err != nil {
+			reply = slackMessage{ResponseType: "ephemeral", Text: l.Sprintf("Acknowledge failed: %s", err)}
+		} else {
+			log.Printf("Subgraph %s acknowledged until %s by %s", subgraph, silence.ExpiresAt.Format(time.RFC3339), actor)
+			m.auditSlack(actor, AuditSilenceCreate, subgraph, nil, silence)
+			reply.Text = l.Sprintf("%s\n:white_check_mark: Acknowledged by <@%s>, silenced until %s", in.Message.Text, in.User.ID, l.Date(silence.ExpiresAt.UTC())+" UTC")
+		}
+		if err := postSlackResponse(in.ResponseURL, reply); err != nil {
+			log.Printf("Slack bot: respond failed: %v", err)
+		}
+	case slackActionRecheck:
+		if !m.CheckNow(subgraph) {
+			postSlackResponse(in.ResponseURL, slackMessage{ResponseType: "ephemeral", Text: l.Sprintf("Unknown subgraph %q", subgraph)})
+			return
+		}
+		log.Printf("Re-check of %s requested by %s", subgraph, actor)
+		m.auditSlack(actor, AuditSubgraphCheck, subgraph, nil, nil)
+		m.slackRecheckResult(in.ResponseURL, subgraph, time.Now())
+	}
+}
+
+// slackRecheckResult waits for the subgraph's first check after requested
+// and reports its status to the user who asked.
+func (m *Monitor) slackRecheckResult(responseURL, name string, requested time.Time) {
+	deadline := requested.Add(slackRecheckTimeout)
+	l := m.locale()
+	for time.Now().Before(deadline) {
+		st, ok := findStatus(m.Statuses(), name)
+		if !ok {
+			return
+		}
+		if !st.CheckedAt.Before(requested) {
+			msg := slackMessage{ResponseType: "ephemeral", Text: formatSlackStatus(l, st)}
+			if err := postSlackResponse(responseURL, msg); err != nil {
+				log.Printf("Slack bot: respond failed: %v", err)
+			}
+			return
+		}
+		time.Sleep(time.Second)
+	}
+	postSlackResponse(responseURL, slackMessage{ResponseType: "ephemeral", Text: l.Sprintf("Re-check of *%s* did not finish within %s", name, slackRecheckTimeout)})
+}
+
+// runSlackAlerts posts the transitions queued in alerts to the bot's
+// channel. Problems with a subgraph get Acknowledge and Re-check buttons.
+func (m *Monitor) runSlackAlerts(cfg SlackBotConfig, alerts *alertQueue) {
+	for {
+		t := alerts.pop()
+		text := formatTransition(t)
+		l := m.locale()
+		msg := slackMessage{Channel: cfg.Channel, Text: text}
+		if t.Subgraph != "" && t.To != StatusOK {
+			msg.Blocks = []interface{}{
+				map[string]interface{}{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": text}},
+				map[string]interface{}{"type": "actions", "elements": []interface{}{
+					slackButton(l.T("Acknowledge"), slackActionAck, t.Subgraph, "primary"),
+					slackButton(l.T("Re-check"), slackActionRecheck, t.Subgraph, ""),
+				}},
+			}
+		}
+		if err := slackAPI(cfg, cfg.BotToken, "chat.postMessage", msg, nil); err != nil {
+			log.Printf("[%s] Slack bot post to %s failed: %v", t.CheckID, cfg.Channel, err)
+		}
+	}
+}
+
+func slackButton(text, actionID, value, style string) map[string]interface{} {
+	b := map[string]interface{}{
+		"type":      "button",
+		"text":      map[string]string{"type": "plain_text", "text": text},
+		"action_id": actionID,
+		"value":     value,
+	}
+	if style != "" {
+		b["style"] = style
+	}
+	return b
+}
+
+// slackAPI calls a Slack Web API method and decodes its result into out.
+func slackAPI(cfg SlackBotConfig, token, method string, in, out interface{}) error {
+	body := []byte("{}")
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(cfg.APIURL, "/")+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := readBody(resp)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: HTTP %d: %s", method, resp.StatusCode, string(data))
+	}
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("%s: JSON error: %v", method, err)
+	}
+	if !result.OK {
+		return fmt.Errorf("%s: %s", method, result.Error)
+	}
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+func postSlackResponse(responseURL string, msg slackMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient().Post(responseURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := readBody(resp)
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(data))
+	}
+	return nil
+}
+
+func findStatus(statuses []SubgraphStatus, name string) (SubgraphStatus, bool) {
+	for _, st := range statuses {
+		if strings.EqualFold(st.Name, name) {
+			return st, true
+		}
+	}
+	return SubgraphStatus{}, false
+}
+
+func formatSlackStatus(l *locale, st SubgraphStatus) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%s* (%s): *%s*\n", st.Name, st.Chain, st.Status)
+	if st.Error != "" {
+		b.WriteString(l.Sprintf("Error: %s", st.Error) + "\n")
+	}
+	b.WriteString(l.Sprintf("Block %s of %s, %s behind, %s%%", l.Int(st.CurrentBlock), l.Int(st.ChainBlock), l.Int(st.BlocksBehind), l.Float(st.Progress, 2)) + "\n")
+	eta := "-"
+	if st.ETASeconds > 0 {
+		eta = formatETADuration(time.Duration(st.ETASeconds * float64(time.Second)))
+	}
+	b.WriteString(l.Sprintf("Speed %s blocks/min, ETA %s", l.Float(st.SyncSpeed, 2), eta) + "\n")
+	b.WriteString(l.Sprintf("Checked %s", l.DateTime(st.CheckedAt.UTC())+" UTC"))
+	return b.String()
+}
+
+// formatSlackFleet summarises the fleet and lists the least healthy
+// subgraphs that are not OK.
+func formatSlackFleet(l *locale, statuses []SubgraphStatus) string {
+	var b strings.Builder
+	b.WriteString(l.Sprintf("Fleet: %s", formatFleetSummary(l, summarizeFleet(statuses))))
+	var problems []SubgraphStatus
+	for _, st := range statuses {
+		if st.Status != StatusOK && st.Status != StatusUnknown {
+			problems = append(problems, st)
+		}
+	}
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].HealthScore < problems[j].HealthScore })
+	for i, st := range problems {
+		if i == slackStatusLimit {
+			b.WriteString(l.Sprintf("\n...and %s more", l.Int(int64(len(problems)-i))))
+			break
+		}
+		b.WriteString(l.Sprintf("\n• *%s* (%s): %s, %s behind", st.Name, st.Chain, st.Status, l.Int(st.BlocksBehind)))
+	}
+	return b.String()
+}
+
+// formatFleetSummary is FleetSummary.Text in l.
+func formatFleetSummary(l *locale, f FleetSummary) string {
+	var parts []string
+	for _, status := range fleetStatusOrder {
+		if n := f.Counts[status]; n > 0 {
+			parts = append(parts, l.Int(int64(n))+" "+string(status))
+		}
+	}
+	if len(parts) == 0 {
+		return l.T("no subgraphs checked yet")
+	}
+	text := strings.Join(parts, ", ")
+	if w := f.Worst; w != nil {
+		worst := string(w.Status)
+		if w.Status != StatusError && w.Status != StatusFailed {
+			worst = l.Sprintf("-%s blocks", formatBlockCount(w.BlocksBehind))
+			if w.ETASeconds > 0 {
+				worst += ", ETA " + formatETADuration(time.Duration(w.ETASeconds*float64(time.Second)))
+			}
+		}
+		text += l.Sprintf("; worst: %s (%s)", w.Name, worst)
+	}
+	return text
+}
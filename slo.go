@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	DefaultSLOWindow = 30 * 24 * time.Hour
+
+	BurnAlertFast = "fast"
+	BurnAlertSlow = "slow"
+
+	// TransitionBurnRate marks transitions that report an error budget burn
+	// alert firing or resolving instead of a status change.
+	TransitionBurnRate = "burn_rate"
+)
+
+// SLOConfig sets the share of checks a subgraph should pass. A check fails
+// the SLO when the subgraph is CRIT, ERROR or FAILED. A zero target
+// disables budget tracking.
+type SLOConfig struct {
+	Target float64  `json:"target"`
+	Window Duration `json:"window"`
+}
+
+func (c *SLOConfig) validate() error {
+	if c.Target < 0 || c.Target >= 1 {
+		return fmt.Errorf("slo.target must be in [0, 1)")
+	}
+	if c.Target > 0 && c.Window.Duration <= 0 {
+		return fmt.Errorf("slo.window must be positive")
+	}
+	return nil
+}
+
+// burnWindow is a multiwindow burn rate alert from the Google SRE workbook:
+// it fires when both the long and the short window burn faster than Rate.
+type burnWindow struct {
+	Alert       string
+	Long, Short time.Duration
+	Rate        float64
+}
+
+var burnWindows = []burnWindow{
+	{Alert: BurnAlertFast, Long: time.Hour, Short: 5 * time.Minute, Rate: 14.4},
+	{Alert: BurnAlertSlow, Long: 6 * time.Hour, Short: 30 * time.Minute, Rate: 6},
+}
+
+// SLOStatus is a subgraph's error budget as of its last check.
+// BudgetRemaining turns negative once the budget is overspent.
+type SLOStatus struct {
+	Target float64 `json:"target"`
+	// BurnRates maps alert windows ("1h", "5m", "6h", "30m") to the rate the
+	// budget is consumed at: 1 exhausts it exactly at the end of the window.
+	BurnRates       map[string]float64 `json:"burnRates"`
+	BudgetRemaining float64            `json:"budgetRemaining"`
+	// ExhaustedInSeconds projects the remaining budget at the 1h burn rate.
+	ExhaustedInSeconds float64 `json:"exhaustedInSeconds,omitempty"`
+	Alert              string  `json:"alert,omitempty"`
+}
+
+// evaluateSLO computes burn rates and the remaining budget from samples,
+// which must cover the SLO window (or as much of it as history retains).
+func evaluateSLO(samples []Sample, now time.Time, cfg SLOConfig) *SLOStatus {
+	budget := 1 - cfg.Target
+	s := &SLOStatus{Target: cfg.Target, BurnRates: make(map[string]float64), BudgetRemaining: 1}
+	rate := func(d time.Duration) float64 {
+		return badRatio(samples, now.Add(-d)) / budget
+	}
+	for _, w := range burnWindows {
+		long, short := rate(w.Long), rate(w.Short)
+		s.BurnRates[formatWindow(w.Long)] = long
+		s.BurnRates[formatWindow(w.Short)] = short
+		if s.Alert == "" && long >= w.Rate && short >= w.Rate {
+			s.Alert = w.Alert
+		}
+	}
+	s.BudgetRemaining = 1 - rate(cfg.Window.Duration)
+	if r := s.BurnRates[formatWindow(time.Hour)]; r > 0 && s.BudgetRemaining > 0 {
+		s.ExhaustedInSeconds = (s.BudgetRemaining * cfg.Window.Duration.Seconds()) / r
+	}
+	return s
+}
+
+func badRatio(samples []Sample, from time.Time) float64 {
+	var total, bad int
+	for _, s := range samples {
+		if s.Time.Before(from) {
+			continue
+		}
+		checks, good, _ := sampleCounts(s)
+		total += checks
+		bad += checks - good
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(bad) / float64(total)
+}
+
+// sampleGood reports whether a check met the SLO: it succeeded and the
+// subgraph was OK or WARN.
+func sampleGood(s Sample) bool {
+	if s.Status == StatusRateLimited {
+		return true
+	}
+	return !s.Failed && s.Status != StatusCrit && s.Status != StatusError && s.Status != StatusFailed
+}
+
+func formatWindow(d time.Duration) string {
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	return fmt.Sprintf("%dm", d/time.Minute)
+}
+
+// burnTrigger describes the burn rates behind an alert firing, or which
+// alert resolved.
+func burnTrigger(slo *SLOStatus, prev string) string {
+	for _, w := range burnWindows {
+		if w.Alert == slo.Alert {
+			return fmt.Sprintf("burn rate %.1f over %s and %.1f over %s > %g",
+				slo.BurnRates[formatWindow(w.Long)], formatWindow(w.Long), slo.BurnRates[formatWindow(w.Short)], formatWindow(w.Short), w.Rate)
+		}
+	}
+	return prev + " burn alert resolved"
+}
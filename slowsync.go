@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// TransitionSlowSync marks transitions that report a subgraph catching
+	// up slower than its expected speed (To WARN or CRIT, its status) or
+	// speeding up again (Context.SlowSync false).
+	TransitionSlowSync = "slow_sync"
+
+	DefaultSlowSyncFor = 30 * time.Minute
+	// speedBaselinePeriod is how long an automatic baseline watches a
+	// subgraph catch up before it is set.
+	speedBaselinePeriod = 24 * time.Hour
+	// speedBaselineMinSamples is how many catch-up checks the period needs;
+	// with fewer the baseline starts over with the next period.
+	speedBaselineMinSamples = 10
+	// speedBaselineRatio is the share of the median catch-up speed an
+	// automatic baseline expects.
+	speedBaselineRatio = 0.5
+)
+
+// SyncSpeedBaseline is the slowest indexing speed, in blocks per minute,
+// expected from a subgraph while it catches up: a number, or "auto" to learn
+// it from the first day of catching up.
+type SyncSpeedBaseline struct {
+	Speed float64
+	Auto  bool
+}
+
+func (b *SyncSpeedBaseline) UnmarshalJSON(data []byte) error {
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		if s != "auto" {
+			return fmt.Errorf("minSyncSpeed must be a number of blocks per minute or \"auto\", got %q", s)
+		}
+		*b = SyncSpeedBaseline{Auto: true}
+		return nil
+	}
+	var speed float64
+	if err := json.Unmarshal(data, &speed); err != nil {
+		return fmt.Errorf("minSyncSpeed must be a number of blocks per minute or \"auto\": %v", err)
+	}
+	*b = SyncSpeedBaseline{Speed: speed}
+	return nil
+}
+
+func (b SyncSpeedBaseline) MarshalJSON() ([]byte, error) {
+	if b.Auto {
+		return json.Marshal("auto")
+	}
+	return json.Marshal(b.Speed)
+}
+
+func (b SyncSpeedBaseline) enabled() bool {
+	return b.Auto || b.Speed > 0
+}
+
+// catchingUp reports whether the subgraph is far enough behind for its
+// indexing speed to matter.
+func catchingUp(sg *SubgraphInfo) bool {
+	return sg.LastError == "" && (sg.Status == StatusWarn || sg.Status == StatusCrit)
+}
+
+// updateSyncSpeedBaseline learns an automatic baseline from the history of
+// the first speedBaselinePeriod. Must be called with mu held.
+func (m *Monitor) updateSyncSpeedBaseline(sg *SubgraphInfo) {
+	if !sg.MinSyncSpeed.Auto {
+		sg.ExpectedSyncSpeed = sg.MinSyncSpeed.Speed
+		return
+	}
+	if sg.ExpectedSyncSpeed > 0 || sg.LastError != "" {
+		return
+	}
+	if sg.BaselineStart.IsZero() {
+		sg.BaselineStart = sg.CheckedAt
+		return
+	}
+	if sg.CheckedAt.Sub(sg.BaselineStart) < speedBaselinePeriod {
+		return
+	}
+	var speeds []float64
+	for _, s := range m.store.LoadHistory(sg.Name, sg.BaselineStart, sg.CheckedAt) {
+		if !s.Failed && !s.LagUnknown && s.Resolution == "" && (s.Status == StatusWarn || s.Status == StatusCrit) && s.SyncSpeed > 0 {
+			speeds = append(speeds, s.SyncSpeed)
+		}
+	}
+	if len(speeds) < speedBaselineMinSamples {
+		logCheck(sg, "Subgraph %s: %d catch-up checks since %s are too few for a speed baseline, starting over",
+			sg.Name, len(speeds), sg.BaselineStart.Format(time.RFC3339))
+		sg.BaselineStart = sg.CheckedAt
+		return
+	}
+	sort.Float64s(speeds)
+	sg.ExpectedSyncSpeed = speeds[len(speeds)/2] * speedBaselineRatio
+	logCheck(sg, "Subgraph %s: learned expected sync speed %.2f blocks/min from %d catch-up checks", sg.Name, sg.ExpectedSyncSpeed, len(speeds))
+}
+
+// updateSlowSync tracks how long the subgraph has been catching up slower
+// than expected and returns a transition when the alert fires or resolves.
+// Must be called with mu held, after the check's sample was recorded.
+func (m *Monitor) updateSlowSync(sg *SubgraphInfo, cycleID string, now time.Time) (StateTransition, bool) {
+	if !sg.MinSyncSpeed.enabled() {
+		sg.ExpectedSyncSpeed, sg.SlowSince, sg.SlowSync = 0, time.Time{}, false
+		return StateTransition{}, false
+	}
+	m.updateSyncSpeedBaseline(sg)
+	if sg.LastError != "" {
+		return StateTransition{}, false
+	}
+
+	slow := sg.ExpectedSyncSpeed > 0 && catchingUp(sg) && sg.SyncSpeed < sg.ExpectedSyncSpeed
+	if !slow {
+		sg.SlowSince = time.Time{}
+	} else if sg.SlowSince.IsZero() {
+		sg.SlowSince = sg.CheckedAt
+	}
+	firing := slow && sg.CheckedAt.Sub(sg.SlowSince) >= sg.SlowSyncFor.Duration
+	if firing == sg.SlowSync {
+		return StateTransition{}, false
+	}
+	sg.SlowSync = firing
+	trigger := fmt.Sprintf("syncSpeed %.2f < expected %.2f blocks/min for %s", sg.SyncSpeed, sg.ExpectedSyncSpeed,
+		sg.CheckedAt.Sub(sg.SlowSince).Round(time.Second))
+	if !firing {
+		trigger = fmt.Sprintf("syncSpeed %.2f, expected %.2f blocks/min", sg.SyncSpeed, sg.ExpectedSyncSpeed)
+	}
+	if m.isSilenced(sg.Name, now) {
+		logCheck(sg, "Subgraph %s: slow sync alert %t (silenced): %s", sg.Name, firing, trigger)
+		return StateTransition{}, false
+	}
+	return StateTransition{
+		Kind:     TransitionSlowSync,
+		Time:     sg.CheckedAt,
+		CycleID:  cycleID,
+		CheckID:  sg.CheckID,
+		Subgraph: sg.Name,
+		Chain:    sg.Chain,
+		From:     sg.Status,
+		To:       sg.Status,
+		Context:  newSubgraphStatus(sg),
+		Trigger:  trigger,
+	}, true
+}
+
+func formatSlowSync(prefix string, t StateTransition) string {
+	if !t.Context.SlowSync && t.To != StatusWarn && t.To != StatusCrit {
+		return fmt.Sprintf("%s%s (%s): slow catch-up resolved, now %s (check %s)", prefix, t.Subgraph, t.Chain, t.To, t.CheckID)
+	}
+	if !t.Context.SlowSync {
+		return fmt.Sprintf("%s%s (%s): catching up at the expected speed again, %s, %d blocks behind (check %s)",
+			prefix, t.Subgraph, t.Chain, t.Trigger, t.Context.BlocksBehind, t.CheckID)
+	}
+	return fmt.Sprintf("%s%s (%s): %s and crawling, %s, %d blocks behind (check %s)",
+		prefix, t.Subgraph, t.Chain, t.To, t.Trigger, t.Context.BlocksBehind, t.CheckID)
+}
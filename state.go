@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Snapshot is an immutable view of the monitor state. The check loop
+// publishes a new one whenever the state changes, so API and metrics
+// readers never wait for a running cycle or see a half-updated subgraph.
+type Snapshot struct {
+	Subgraphs  []SubgraphStatus
+	Firehose   []FirehoseStatus
+	ChainHeads map[string]int64
+	// HeadSources records where each chain head came from (HeadSource*).
+	HeadSources map[string]string
+	BlockTimes  map[string]time.Duration
+	HeadTimes   map[string]time.Time
+	Halted      map[string]bool
+	Changes     CycleChanges
+	Config      *Config
+	Warnings    []ConfigWarning
+	// TenantHosts holds the hosts of each tenant's endpoints, whose
+	// certificates the tenant may see.
+	TenantHosts map[string]map[string]bool
+	// TenantFirehose holds the Firehose endpoints each tenant's subgraphs
+	// depend on, the ones the tenant may see.
+	TenantFirehose map[string]map[string]bool
+}
+
+type stateStore struct {
+	current atomic.Pointer[Snapshot]
+}
+
+func (s *stateStore) Load() *Snapshot {
+	return s.current.Load()
+}
+
+func (s *stateStore) Store(snap *Snapshot) {
+	s.current.Store(snap)
+}
+
+// publishSnapshot must be called with m.mu held.
+func (m *Monitor) publishSnapshot() {
+	snap := &Snapshot{
+		Subgraphs:      make([]SubgraphStatus, 0, len(m.subgraphs)),
+		Firehose:       make([]FirehoseStatus, 0, len(m.firehose)),
+		ChainHeads:     make(map[string]int64, len(m.chains)),
+		HeadSources:    make(map[string]string, len(m.chains)),
+		BlockTimes:     make(map[string]time.Duration, len(m.chains)),
+		HeadTimes:      make(map[string]time.Time, len(m.chains)),
+		Halted:         make(map[string]bool, len(m.chains)),
+		Changes:        m.changes,
+		Config:         m.cfg,
+		Warnings:       m.configWarnings(),
+		TenantHosts:    m.tenantHosts(),
+		TenantFirehose: m.tenantFirehose(),
+	}
+	for _, sg := range m.subgraphs {
+		snap.Subgraphs = append(snap.Subgraphs, newSubgraphStatus(sg))
+	}
+	for _, fh := range m.firehose {
+		if fh.dependencyOnly {
+			continue
+		}
+		snap.Firehose = append(snap.Firehose, newFirehoseStatus(fh))
+	}
+	for name, chain := range m.chains {
+		snap.ChainHeads[name] = chain.LatestBlock
+		snap.HeadSources[name] = chain.HeadSource
+		snap.BlockTimes[name] = chain.BlockTime
+		if chain.HaltAfter.Duration > 0 {
+			snap.HeadTimes[name] = chain.HeadTime
+			snap.Halted[name] = chain.Halted
+		}
+	}
+	m.state.Store(snap)
+}
+
+func (m *Monitor) Snapshot() *Snapshot {
+	return m.state.Load()
+}
+
+func (s *Snapshot) hasSubgraph(name string) bool {
+	for _, st := range s.Subgraphs {
+		if st.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Snapshot) hasChain(name string) bool {
+	_, ok := s.ChainHeads[name]
+	return ok
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	DefaultWarnBlocksBehind = 100
+	DefaultCritBlocksBehind = 1000
+	DefaultErrorTolerance   = 1
+)
+
+type Status string
+
+const (
+	StatusUnknown Status = ""
+	StatusOK      Status = "OK"
+	StatusWarn    Status = "WARN"
+	StatusCrit    Status = "CRIT"
+	StatusError   Status = "ERROR"
+	// StatusFailed marks a deterministic indexing failure, which does not
+	// recover without a fix and redeploy.
+	StatusFailed Status = "FAILED"
+	// StatusRateLimited means the subgraph's endpoint rate limits the
+	// monitor; the shown state is from the last check that got through.
+	StatusRateLimited Status = "RATE_LIMITED"
+)
+
+type Thresholds struct {
+	WarnBlocksBehind int64 `json:"warnBlocksBehind"`
+	CritBlocksBehind int64 `json:"critBlocksBehind"`
+	// ErrorTolerance is the number of consecutive failed checks before a
+	// subgraph is reported as ERROR.
+	ErrorTolerance int `json:"errorTolerance"`
+}
+
+// validate checks the block thresholds; zero disables one, so crit only
+// has to be at least warn when both are set.
+func (t Thresholds) validate() error {
+	if t.WarnBlocksBehind < 0 || t.CritBlocksBehind < 0 {
+		return fmt.Errorf("warnBlocksBehind and critBlocksBehind must not be negative")
+	}
+	if t.WarnBlocksBehind > 0 && t.CritBlocksBehind > 0 && t.CritBlocksBehind < t.WarnBlocksBehind {
+		return fmt.Errorf("critBlocksBehind %d is below warnBlocksBehind %d", t.CritBlocksBehind, t.WarnBlocksBehind)
+	}
+	return nil
+}
+
+func classifySubgraph(sg *SubgraphInfo) Status {
+	switch {
+	case sg.ErrorKind == GraphQLErrorIndexingFailed:
+		return StatusFailed
+	case sg.ErrorKind == ErrorKindRateLimited:
+		return StatusRateLimited
+	case sg.ConsecutiveFailures >= max(sg.ErrorTolerance, 1) || sg.CurrentBlock == 0:
+		return StatusError
+	case !lagKnown(sg):
+		// The subgraph answered but its lag is unknown; WARN and CRIT wait
+		// for the chain head. While the head is stale they are kept, as the
+		// lag behind them may still stand.
+		if sg.ChainHeadSource == HeadSourceStale && (sg.Status == StatusWarn || sg.Status == StatusCrit) {
+			return sg.Status
+		}
+		return StatusOK
+	case sg.Severity != nil:
+		return sg.Severity.classify(sg)
+	case sg.CritBlocksBehind > 0 && sg.BlocksBehind >= sg.CritBlocksBehind:
+		return StatusCrit
+	case sg.WarnBlocksBehind > 0 && sg.BlocksBehind >= sg.WarnBlocksBehind:
+		return StatusWarn
+	default:
+		return StatusOK
+	}
+}
+
+// statusTrigger describes the value classifySubgraph based the subgraph's
+// status on.
+func statusTrigger(sg *SubgraphInfo) string {
+	switch sg.Status {
+	case StatusFailed:
+		return "indexing failed: " + sg.LastError
+	case StatusRateLimited:
+		return sg.LastError
+	case StatusError:
+		if sg.ConsecutiveFailures == 0 {
+			return "no block indexed"
+		}
+		return fmt.Sprintf("consecutiveFailures %d >= errorTolerance %d: %s", sg.ConsecutiveFailures, max(sg.ErrorTolerance, 1), sg.LastError)
+	case StatusCrit:
+		if sg.Severity != nil {
+			return fmt.Sprintf("severity.crit %s (blocksBehind %d)", sg.Severity.Crit, sg.BlocksBehind)
+		}
+		return fmt.Sprintf("blocksBehind %d >= critBlocksBehind %d", sg.BlocksBehind, sg.CritBlocksBehind)
+	case StatusWarn:
+		if sg.Severity != nil {
+			return fmt.Sprintf("severity.warn %s (blocksBehind %d)", sg.Severity.Warn, sg.BlocksBehind)
+		}
+		return fmt.Sprintf("blocksBehind %d >= warnBlocksBehind %d", sg.BlocksBehind, sg.WarnBlocksBehind)
+	}
+	return fmt.Sprintf("blocksBehind %d", sg.BlocksBehind)
+}
+
+type SubgraphStatus struct {
+	Name               string            `json:"name"`
+	Chain              string            `json:"chain"`
+	Tenant             string            `json:"tenant,omitempty"`
+	URL                string            `json:"url"`
+	Status             Status            `json:"status"`
+	ChainBlock         int64             `json:"chainBlock"`
+	ChainHeadSource    string            `json:"chainHeadSource,omitempty"`
+	ChainHeadPolicy    string            `json:"chainHeadPolicy,omitempty"`
+	ChainHeadAge       float64           `json:"chainHeadAgeSeconds,omitempty"`
+	ChainHalted        bool              `json:"chainHalted,omitempty"`
+	StartBlock         int64             `json:"startBlock"`
+	CurrentBlock       int64             `json:"currentBlock"`
+	BlocksBehind       int64             `json:"blocksBehind"`
+	SyncSpeed          float64           `json:"syncSpeed"`
+	ChainSpeed         float64           `json:"chainSpeed"`
+	BlockTime          float64           `json:"blockTimeSeconds,omitempty"`
+	TimeBehind         float64           `json:"timeBehindSeconds,omitempty"`
+	BlocksIndexed      int64             `json:"blocksIndexed"`
+	BlocksIndexedIn    float64           `json:"blocksIndexedSeconds"`
+	BlocksIndexedTotal int64             `json:"blocksIndexedTotal"`
+	ETASeconds         float64           `json:"etaSeconds"`
+	ETARanges          []BlockRange      `json:"etaRanges,omitempty"`
+	Progress           float64           `json:"progress"`
+	ProgressBaseline   string            `json:"progressBaseline,omitempty"`
+	Deployment         string            `json:"deployment,omitempty"`
+	Graft              *GraftInfo        `json:"graft,omitempty"`
+	Reindex            *ReindexInfo      `json:"reindex,omitempty"`
+	NodeChainHead      int64             `json:"nodeChainHead,omitempty"`
+	Node               string            `json:"node,omitempty"`
+	Networks           []NetworkProgress `json:"networks,omitempty"`
+	NodeError          string            `json:"nodeError,omitempty"`
+	LagCause           string            `json:"lagCause,omitempty"`
+	HealthScore        float64           `json:"healthScore"`
+	SLO                *SLOStatus        `json:"slo,omitempty"`
+	HasIndexingErrors  bool              `json:"hasIndexingErrors"`
+	QueryLatencyMs     float64           `json:"queryLatencyMs"`
+	ActiveURL          string            `json:"activeUrl,omitempty"`
+	Replicas           []ReplicaStatus   `json:"replicas,omitempty"`
+	ReplicaDivergence  string            `json:"replicaDivergence,omitempty"`
+	StalledSeconds     float64           `json:"stalledSeconds,omitempty"`
+	ExpectedSyncSpeed  float64           `json:"expectedSyncSpeed,omitempty"`
+	SlowSync           bool              `json:"slowSync,omitempty"`
+	Availability       *float64          `json:"availability,omitempty"`
+	AvailabilityChecks int               `json:"availabilityChecks"`
+	AvailabilityStatus Status            `json:"availabilityStatus,omitempty"`
+	InhibitedBy        string            `json:"inhibitedBy,omitempty"`
+	Remediation        *RemediationInfo  `json:"remediation,omitempty"`
+	Failures           int               `json:"consecutiveFailures,omitempty"`
+	Unknown            []string          `json:"unknown,omitempty"`
+	Stale              bool              `json:"stale,omitempty"`
+	StaleSeconds       float64           `json:"staleSeconds,omitempty"`
+	Error              string            `json:"error,omitempty"`
+	ErrorKind          string            `json:"errorKind,omitempty"`
+	CheckedAt          time.Time         `json:"checkedAt"`
+	CheckID            string            `json:"checkId,omitempty"`
+}
+
+func newSubgraphStatus(sg *SubgraphInfo) SubgraphStatus {
+	return SubgraphStatus{
+		Name:               sg.Name,
+		Chain:              sg.Chain,
+		Tenant:             sg.Tenant,
+		URL:                sg.URL,
+		Status:             sg.Status,
+		ChainBlock:         sg.LastBlock,
+		ChainHeadSource:    sg.ChainHeadSource,
+		ChainHeadPolicy:    sg.ChainHeadPolicy,
+		ChainHeadAge:       sg.ChainHeadAge.Seconds(),
+		ChainHalted:        sg.ChainHalted,
+		StartBlock:         sg.StartBlock,
+		CurrentBlock:       sg.CurrentBlock,
+		BlocksBehind:       sg.BlocksBehind,
+		SyncSpeed:          sg.SyncSpeed,
+		ChainSpeed:         sg.ChainSpeed,
+		BlockTime:          sg.BlockTime.Seconds(),
+		TimeBehind:         float64(sg.BlocksBehind) * sg.BlockTime.Seconds(),
+		BlocksIndexed:      sg.BlocksIndexed,
+		BlocksIndexedIn:    sg.BlocksIndexedIn.Seconds(),
+		BlocksIndexedTotal: sg.BlocksIndexedTotal,
+		ETASeconds:         sg.EstimatedTimeLeft.Seconds(),
+		ETARanges:          remainingRanges(etaRanges(sg), sg.CurrentBlock, sg.LastBlock),
+		Progress:           calculateProgressPercentage(sg),
+		ProgressBaseline:   sg.ProgressBaseline,
+		Deployment:         sg.Deployment,
+		Graft:              copyGraftInfo(sg.Graft),
+		Reindex:            copyReindexInfo(sg.Reindex),
+		NodeChainHead:      sg.NodeChainHead,
+		Node:               sg.Node,
+		Networks:           append([]NetworkProgress(nil), sg.Networks...),
+		NodeError:          sg.NodeError,
+		LagCause:           sg.LagCause,
+		HealthScore:        sg.HealthScore,
+		SLO:                sg.SLO,
+		HasIndexingErrors:  sg.HasIndexingErrors,
+		QueryLatencyMs:     float64(sg.QueryLatency) / float64(time.Millisecond),
+		ActiveURL:          sg.ActiveURL,
+		Replicas:           replicaStatuses(sg),
+		ReplicaDivergence:  sg.ReplicaDivergence,
+		StalledSeconds:     stalledFor(sg).Seconds(),
+		ExpectedSyncSpeed:  sg.ExpectedSyncSpeed,
+		SlowSync:           sg.SlowSync,
+		Availability:       availabilityRatio(sg),
+		AvailabilityChecks: len(sg.AvailabilityChecks),
+		AvailabilityStatus: sg.AvailabilityStatus,
+		InhibitedBy:        sg.InhibitedBy,
+		Remediation:        copyRemediationInfo(sg.Remediated),
+		Failures:           sg.ConsecutiveFailures,
+		Unknown:            unknownSignals(sg),
+		Stale:              staleFor(sg) > 0,
+		StaleSeconds:       staleFor(sg).Seconds(),
+		Error:              sg.LastError,
+		ErrorKind:          sg.ErrorKind,
+		CheckedAt:          sg.CheckedAt,
+		CheckID:            sg.CheckID,
+	}
+}
+
+func copyGraftInfo(g *GraftInfo) *GraftInfo {
+	if g == nil {
+		return nil
+	}
+	c := *g
+	return &c
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+const StorageMemory = "memory"
+
+type StorageConfig struct {
+	// Type selects the backend in storageBackends. Read at startup.
+	Type string `json:"type"`
+}
+
+func (c StorageConfig) validate() error {
+	if _, ok := storageBackends[c.Type]; !ok {
+		return fmt.Errorf("unknown storage.type %q, expected one of %s", c.Type, storageTypes())
+	}
+	return nil
+}
+
+// Store keeps what the monitor records over time: history samples, state
+// transitions (the incident record) and audit entries. The checker only
+// talks to a Store, so a backend is added by registering it in
+// storageBackends.
+type Store interface {
+	SaveSample(s Sample)
+	// LoadHistory returns the samples of one subgraph taken in [from, to],
+	// ordered by time.
+	LoadHistory(subgraph string, from, to time.Time) []Sample
+	// RangeHistory returns every subgraph's samples taken in [from, to),
+	// ordered by time.
+	RangeHistory(from, to time.Time) []Sample
+	// CompactHistory applies history retention and downsampling as of now.
+	CompactHistory(now time.Time)
+	SaveIncident(t StateTransition)
+	LoadIncidents(f EventFilter) []StateTransition
+	SaveAudit(e AuditEntry)
+	LoadAudit(f AuditFilter) []AuditEntry
+}
+
+// storageBackends creates the Store of each storage.type.
+var storageBackends = map[string]func(cfg *Config) (Store, error){
+	StorageMemory: newMemoryStore,
+}
+
+func storageTypes() string {
+	types := make([]string, 0, len(storageBackends))
+	for t := range storageBackends {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return strings.Join(types, ", ")
+}
+
+func newStore(cfg *Config) (Store, error) {
+	create, ok := storageBackends[cfg.Storage.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown storage.type %q", cfg.Storage.Type)
+	}
+	return create(cfg)
+}
+
+// memoryStore keeps everything in memory, each kind optionally appended to
+// its JSON lines file (history.path, eventLog.path, audit.path), which the
+// report, events and audit commands also read.
+type memoryStore struct {
+	history *HistoryStore
+	events  *EventLog
+	audit   *AuditLog
+}
+
+func newMemoryStore(cfg *Config) (Store, error) {
+	s := &memoryStore{
+		history: NewHistoryStore(cfg.History),
+		events:  NewEventLog(cfg.EventLog.Retention.Duration),
+		audit:   NewAuditLog(cfg.Audit.Retention.Duration),
+	}
+	if cfg.History.Path != "" {
+		if err := s.history.Persist(cfg.History.Path); err != nil {
+			log.Printf("History persistence to %s disabled: %v", cfg.History.Path, err)
+		}
+	}
+	if cfg.EventLog.Path != "" {
+		if err := s.events.Open(cfg.EventLog.Path); err != nil {
+			log.Printf("Event log persistence to %s disabled: %v", cfg.EventLog.Path, err)
+		}
+	}
+	if cfg.Audit.Path != "" {
+		if err := s.audit.Open(cfg.Audit.Path); err != nil {
+			log.Printf("Audit log persistence to %s disabled: %v", cfg.Audit.Path, err)
+		}
+	}
+	return s, nil
+}
+
+func (s *memoryStore) SaveSample(sample Sample) {
+	s.history.Add(sample)
+}
+
+func (s *memoryStore) LoadHistory(subgraph string, from, to time.Time) []Sample {
+	return s.history.Query(subgraph, from, to)
+}
+
+func (s *memoryStore) RangeHistory(from, to time.Time) []Sample {
+	return s.history.Range(from, to)
+}
+
+func (s *memoryStore) CompactHistory(now time.Time) {
+	s.history.Compact(now)
+}
+
+func (s *memoryStore) SaveIncident(t StateTransition) {
+	s.events.Add(t)
+}
+
+func (s *memoryStore) LoadIncidents(f EventFilter) []StateTransition {
+	return s.events.Query(f)
+}
+
+func (s *memoryStore) SaveAudit(e AuditEntry) {
+	s.audit.Add(e)
+}
+
+func (s *memoryStore) LoadAudit(f AuditFilter) []AuditEntry {
+	return s.audit.Query(f)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// TenantConfig configures a team owning a subset of the subgraphs (those
+// with a matching tenant). Its notifiers receive only its subgraphs'
+// transitions; the global notifiers receive every transition.
+type TenantConfig struct {
+	Notifiers []NotifierConfig `json:"notifiers"`
+}
+
+func (c *Config) validateTenants() error {
+	for name, t := range c.Tenants {
+		if err := validateNotifiers(t.Notifiers); err != nil {
+			return fmt.Errorf("tenant %s: %v", name, err)
+		}
+	}
+	for i, u := range c.Server.Auth.Users {
+		if err := validateCredentialTenant(u.Tenant, u.Scopes, c.Tenants); err != nil {
+			return fmt.Errorf("server.auth.users[%d]: %v", i, err)
+		}
+	}
+	if err := validateTokenTenants(c.Server.Auth.Tokens, c.Tenants); err != nil {
+		return fmt.Errorf("server.auth.%v", err)
+	}
+	for i, h := range c.Server.Auth.Webhooks {
+		if err := validateCredentialTenant(h.Tenant, h.Scopes, c.Tenants); err != nil {
+			return fmt.Errorf("server.auth.webhooks[%d]: %v", i, err)
+		}
+	}
+	for i, u := range c.SlackBot.Users {
+		if err := validateCredentialTenant(u.Tenant, nil, c.Tenants); err != nil {
+			return fmt.Errorf("slackBot.users[%d]: %v", i, err)
+		}
+	}
+	for i, ch := range c.SlackBot.Channels {
+		if err := validateCredentialTenant(ch.Tenant, nil, c.Tenants); err != nil {
+			return fmt.Errorf("slackBot.channels[%d]: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func validateTokenTenants(tokens []BearerToken, tenants map[string]TenantConfig) error {
+	for i, t := range tokens {
+		if err := validateCredentialTenant(t.Tenant, t.Scopes, tenants); err != nil {
+			return fmt.Errorf("tokens[%d]: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// validateCredentialTenant checks that a credential's tenant exists and
+// that tenant credentials do not ask for the heads scope, which they are
+// never granted.
+func validateCredentialTenant(tenant string, scopes []string, tenants map[string]TenantConfig) error {
+	if tenant == "" {
+		return nil
+	}
+	if _, ok := tenants[tenant]; !ok {
+		return fmt.Errorf("unknown tenant %q", tenant)
+	}
+	for _, s := range scopes {
+		if s == ScopeHeads {
+			return fmt.Errorf("scope %q is not available to tenant credentials", ScopeHeads)
+		}
+	}
+	return nil
+}
+
+func (c *Config) tenantNames() []string {
+	names := make([]string, 0, len(c.Tenants))
+	for name := range c.Tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// principalTenant is the tenant the request's credentials belong to, ""
+// for admins and when authentication is disabled.
+func principalTenant(r *http.Request) string {
+	if p, ok := principalFromContext(r.Context()); ok {
+		return p.Tenant
+	}
+	return ""
+}
+
+// viewTenant is the tenant whose subgraphs a request may see: the
+// principal's own tenant, or for admins an optional ?tenant= filter. ""
+// means every subgraph.
+func viewTenant(r *http.Request) string {
+	if t := principalTenant(r); t != "" {
+		return t
+	}
+	return r.URL.Query().Get("tenant")
+}
+
+func tenantVisible(view, tenant string) bool {
+	return view == "" || view == tenant
+}
+
+// subgraphVisible reports whether the subgraph exists and belongs to view.
+func (s *Snapshot) subgraphVisible(name, view string) bool {
+	for _, st := range s.Subgraphs {
+		if st.Name == name {
+			return tenantVisible(view, st.Tenant)
+		}
+	}
+	return false
+}
+
+func filterStatuses(statuses []SubgraphStatus, view string) []SubgraphStatus {
+	if view == "" {
+		return statuses
+	}
+	filtered := []SubgraphStatus{}
+	for _, s := range statuses {
+		if s.Tenant == view {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered
+}
+
+// notifiersFor returns the global notifiers followed by those of tenant.
+func (c *Config) notifiersFor(tenant string) []NotifierConfig {
+	if tenant == "" {
+		return c.Notifiers
+	}
+	return append(c.Notifiers[:len(c.Notifiers):len(c.Notifiers)], c.Tenants[tenant].Notifiers...)
+}
+
+// subgraphTenant returns the tenant of a subgraph, "" if it has none or
+// does not exist.
+func (s *Snapshot) subgraphTenant(name string) string {
+	for _, st := range s.Subgraphs {
+		if st.Name == name {
+			return st.Tenant
+		}
+	}
+	return ""
+}
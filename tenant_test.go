@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFirehoseVisibleToDependentTenant(t *testing.T) {
+	m := &Monitor{cfg: newConfig()}
+	m.subgraphs = []*SubgraphInfo{
+		{Name: "a", Tenant: "team-a", DependsOn: []string{"firehose:fh-a"}},
+		{Name: "b", Tenant: "team-b", DependsOn: []string{"firehose:fh-b"}},
+	}
+	m.firehose = []*FirehoseInfo{{Name: "fh-a"}, {Name: "fh-b"}}
+	m.publishSnapshot()
+
+	for _, tc := range []struct {
+		tenant string
+		want   []string
+	}{
+		{"team-a", []string{"fh-a"}},
+		{"team-b", []string{"fh-b"}},
+		{"", []string{"fh-a", "fh-b"}},
+	} {
+		r := httptest.NewRequest("GET", "/api/v1/firehose", nil)
+		if tc.tenant != "" {
+			r = r.WithContext(context.WithValue(r.Context(), principalKey{}, Principal{Name: "t", Tenant: tc.tenant}))
+		}
+		w := httptest.NewRecorder()
+		m.handleFirehose(w, r)
+		var got []FirehoseStatus
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("tenant %q: %v", tc.tenant, err)
+		}
+		if len(got) != len(tc.want) {
+			t.Fatalf("tenant %q: got %d endpoints, want %v", tc.tenant, len(got), tc.want)
+		}
+		for i, fh := range got {
+			if fh.Name != tc.want[i] {
+				t.Errorf("tenant %q: endpoint %d is %s, want %s", tc.tenant, i, fh.Name, tc.want[i])
+			}
+		}
+	}
+}
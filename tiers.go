@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// TierConfig holds the check interval and default thresholds for a priority
+// tier. Zero fields fall back to the global checkInterval and thresholds.
+type TierConfig struct {
+	CheckInterval Duration `json:"checkInterval"`
+	Thresholds
+}
+
+func defaultTiers() map[string]TierConfig {
+	return map[string]TierConfig{
+		"P1": {
+			CheckInterval: Duration{time.Minute},
+			Thresholds:    Thresholds{WarnBlocksBehind: 25, CritBlocksBehind: 250},
+		},
+		"P2": {},
+		"P3": {
+			CheckInterval: Duration{30 * time.Minute},
+			Thresholds:    Thresholds{WarnBlocksBehind: 1000, CritBlocksBehind: 10000},
+		},
+	}
+}
+
+// resolveTiers fills unset tier fields from the built-in tier defaults and
+// then from the global settings.
+func (c *Config) resolveTiers() {
+	if c.Tiers == nil {
+		c.Tiers = make(map[string]TierConfig)
+	}
+	for name, builtin := range defaultTiers() {
+		tier, ok := c.Tiers[name]
+		if !ok {
+			tier = builtin
+		}
+		if tier.CheckInterval.Duration == 0 {
+			tier.CheckInterval = builtin.CheckInterval
+		}
+		if tier.WarnBlocksBehind == 0 {
+			tier.WarnBlocksBehind = builtin.WarnBlocksBehind
+		}
+		if tier.CritBlocksBehind == 0 {
+			tier.CritBlocksBehind = builtin.CritBlocksBehind
+		}
+		c.Tiers[name] = tier
+	}
+	for name, tier := range c.Tiers {
+		if tier.CheckInterval.Duration == 0 {
+			tier.CheckInterval = c.CheckInterval
+		}
+		if tier.WarnBlocksBehind == 0 {
+			tier.WarnBlocksBehind = c.Thresholds.WarnBlocksBehind
+		}
+		if tier.CritBlocksBehind == 0 {
+			tier.CritBlocksBehind = c.Thresholds.CritBlocksBehind
+		}
+		if tier.ErrorTolerance == 0 {
+			tier.ErrorTolerance = c.Thresholds.ErrorTolerance
+		}
+		c.Tiers[name] = tier
+	}
+}
+
+func (c *Config) validateTiers() error {
+	for name, tier := range c.Tiers {
+		if tier.CheckInterval.Duration <= 0 {
+			return fmt.Errorf("tiers.%s.checkInterval must be positive", name)
+		}
+		if tier.ErrorTolerance < 0 {
+			return fmt.Errorf("tiers.%s.errorTolerance must not be negative", name)
+		}
+		if err := tier.Thresholds.validate(); err != nil {
+			return fmt.Errorf("tiers.%s: %v", name, err)
+		}
+	}
+	return nil
+}
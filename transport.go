@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultMaxIdleConns        = 100
+	DefaultMaxIdleConnsPerHost = 10
+	DefaultIdleConnTimeout     = 90 * time.Second
+	DefaultMaxResponseSize     = 10 << 20
+	// maxPooledBufferSize keeps buffers grown by rare large responses out
+	// of the pool.
+	maxPooledBufferSize = 64 << 10
+)
+
+// maxResponseSize caps the (decompressed) size of response bodies read by
+// readBody. It is replaced together with the transport.
+// defaultHTTPClient is the client of all outbound requests and
+// maxResponseSize the largest body read. A config reload publishes new
+// values rather than changing the ones requests in flight use.
+var (
+	defaultHTTPClient atomic.Pointer[http.Client]
+	maxResponseSize   atomic.Int64
+)
+
+func init() {
+	defaultHTTPClient.Store(&http.Client{Timeout: HTTPTimeout})
+	maxResponseSize.Store(DefaultMaxResponseSize)
+}
+
+func httpClient() *http.Client {
+	return defaultHTTPClient.Load()
+}
+
+// HTTPConfig tunes the transport shared by all outbound checks.
+type HTTPConfig struct {
+	MaxIdleConns        int      `json:"maxIdleConns"`
+	MaxIdleConnsPerHost int      `json:"maxIdleConnsPerHost"`
+	IdleConnTimeout     Duration `json:"idleConnTimeout"`
+	DisableKeepAlives   bool     `json:"disableKeepAlives"`
+	DisableHTTP2        bool     `json:"disableHttp2"`
+	// Responses are requested with Accept-Encoding: gzip and decompressed
+	// transparently unless DisableCompression is set.
+	DisableCompression bool  `json:"disableCompression"`
+	MaxResponseSize    int64 `json:"maxResponseSize"`
+	// DNSCacheTTL caches resolved addresses for this long; 0 disables the
+	// cache and resolves on every new connection.
+	DNSCacheTTL Duration `json:"dnsCacheTtl"`
+	// DNSServer and IPFamily apply to all hosts without an entry in Hosts.
+	DNSServer string                `json:"dnsServer"`
+	IPFamily  string                `json:"ipFamily"`
+	Hosts     map[string]HostConfig `json:"hosts"`
+	// UserAgent defaults to subgraph-monitor/<version>. Headers are added to
+	// every outbound request that does not already set them.
+	UserAgent string            `json:"userAgent"`
+	Headers   map[string]string `json:"headers"`
+}
+
+func defaultHTTPConfig() HTTPConfig {
+	return HTTPConfig{
+		MaxIdleConns:        DefaultMaxIdleConns,
+		MaxIdleConnsPerHost: DefaultMaxIdleConnsPerHost,
+		IdleConnTimeout:     Duration{DefaultIdleConnTimeout},
+		MaxResponseSize:     DefaultMaxResponseSize,
+	}
+}
+
+func (c *HTTPConfig) validate() error {
+	if c.MaxIdleConns < 0 || c.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("http.maxIdleConns and http.maxIdleConnsPerHost must not be negative")
+	}
+	if c.IdleConnTimeout.Duration < 0 || c.DNSCacheTTL.Duration < 0 {
+		return fmt.Errorf("http.idleConnTimeout and http.dnsCacheTtl must not be negative")
+	}
+	if c.MaxResponseSize <= 0 {
+		return fmt.Errorf("http.maxResponseSize must be positive")
+	}
+	if err := validateIPFamily(c.IPFamily); err != nil {
+		return fmt.Errorf("http.ipFamily: %v", err)
+	}
+	for host, hc := range c.Hosts {
+		if err := validateIPFamily(hc.IPFamily); err != nil {
+			return fmt.Errorf("http.hosts.%s.ipFamily: %v", host, err)
+		}
+	}
+	return nil
+}
+
+func newTransport(cfg HTTPConfig) *http.Transport {
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           newHostDialer(cfg).DialContext,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout.Duration,
+		DisableKeepAlives:     cfg.DisableKeepAlives,
+		DisableCompression:    cfg.DisableCompression,
+		ForceAttemptHTTP2:     !cfg.DisableHTTP2,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	if cfg.DisableHTTP2 {
+		// A non-nil, empty map turns off the transport's HTTP/2 support.
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return t
+}
+
+// applyHTTPConfig installs a new client with its own transport and releases
+// the idle connections of the previous one.
+func applyHTTPConfig(cfg *Config) {
+	old := defaultHTTPClient.Swap(&http.Client{
+		Timeout:   cfg.HTTPTimeout.Duration,
+		Transport: &rateLimitTransport{base: withHeaders(cfg.HTTP, &certTransport{base: newTransport(cfg.HTTP)})},
+	})
+	maxResponseSize.Store(cfg.HTTP.MaxResponseSize)
+	if old, ok := old.Transport.(interface{ CloseIdleConnections() }); ok {
+		old.CloseIdleConnections()
+	}
+}
+
+func defaultUserAgent() string {
+	ua := "subgraph-monitor/" + version
+	if commit != "" {
+		ua += " (" + shortCommit(commit) + ")"
+	}
+	return ua
+}
+
+// headerTransport sets the User-Agent and the configured extra headers on
+// outbound requests, leaving headers already set by the caller untouched.
+type headerTransport struct {
+	base      http.RoundTripper
+	userAgent string
+	headers   map[string]string
+}
+
+func withHeaders(cfg HTTPConfig, base http.RoundTripper) http.RoundTripper {
+	userAgent := cfg.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent()
+	}
+	return &headerTransport{base: base, userAgent: userAgent, headers: cfg.Headers}
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+	for k, v := range t.headers {
+		if req.Header.Get(k) == "" {
+			req.Header.Set(k, v)
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+func (t *headerTransport) CloseIdleConnections() {
+	if c, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+var bodyBuffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// readBody reads a response body, failing instead of buffering responses
+// larger than maxResponseSize. Bodies are read into pooled buffers and
+// copied out at their final size, so checks do not leave the garbage of a
+// growing buffer behind.
+func readBody(resp *http.Response) ([]byte, error) {
+	buf := bodyBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBufferSize {
+			bodyBuffers.Put(buf)
+		}
+	}()
+	limit := maxResponseSize.Load()
+	if _, err := buf.ReadFrom(io.LimitReader(resp.Body, limit+1)); err != nil {
+		return nil, err
+	}
+	if int64(buf.Len()) > limit {
+		return nil, fmt.Errorf("response larger than %d bytes", limit)
+	}
+	return bytes.Clone(buf.Bytes()), nil
+}
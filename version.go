@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Set at build time with
+// -ldflags "-X main.version=v1.2.3 -X main.commit=abc123 -X main.buildDate=2024-01-01T00:00:00Z".
+// commit and buildDate fall back to the VCS stamp of the Go toolchain.
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+const DefaultReleaseURL = "https://api.github.com/repos/nikola43/subgrahpSyncChecker/releases/latest"
+
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, s := range info.Settings {
+		switch {
+		case s.Key == "vcs.revision" && commit == "":
+			commit = s.Value
+		case s.Key == "vcs.time" && buildDate == "":
+			buildDate = s.Value
+		}
+	}
+}
+
+func versionString() string {
+	s := version
+	if commit != "" {
+		s += " (" + shortCommit(commit)
+		if buildDate != "" {
+			s += ", built " + buildDate
+		}
+		s += ")"
+	}
+	return s
+}
+
+func shortCommit(c string) string {
+	if len(c) > 12 {
+		return c[:12]
+	}
+	return c
+}
+
+// UpdateCheckConfig enables periodic checks of a GitHub-compatible
+// "latest release" endpoint for newer versions.
+type UpdateCheckConfig struct {
+	Enabled  bool     `json:"enabled"`
+	URL      string   `json:"url"`
+	Interval Duration `json:"interval"`
+}
+
+type updateStatus struct {
+	mu        sync.RWMutex
+	latest    string
+	available bool
+}
+
+var updates updateStatus
+
+func (u *updateStatus) get() (string, bool) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.latest, u.available
+}
+
+func fetchLatestRelease(url string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := readBody(resp)
+	if err != nil {
+		return "", fmt.Errorf("read response failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.Unmarshal(body, &release); err != nil {
+		return "", fmt.Errorf("JSON error: %v", err)
+	}
+	if release.TagName == "" {
+		return "", fmt.Errorf("release has no tag_name")
+	}
+	return release.TagName, nil
+}
+
+func checkForUpdate(url string) (string, bool, error) {
+	latest, err := fetchLatestRelease(url)
+	if err != nil {
+		return "", false, err
+	}
+	return latest, newerVersion(latest, version), nil
+}
+
+// runUpdateChecks logs when a newer release is published and keeps the
+// result for the build info metric.
+func runUpdateChecks(cfg UpdateCheckConfig) {
+	for {
+		latest, available, err := checkForUpdate(cfg.URL)
+		if err != nil {
+			log.Printf("Update check failed: %v", err)
+		} else {
+			updates.mu.Lock()
+			updates.latest, updates.available = latest, available
+			updates.mu.Unlock()
+			if available {
+				log.Printf("A newer version is available: %s (running %s)", latest, version)
+			}
+		}
+		time.Sleep(cfg.Interval.Duration)
+	}
+}
+
+// newerVersion reports whether latest is a higher vMAJOR.MINOR.PATCH than
+// current. Development builds are never considered outdated.
+func newerVersion(latest, current string) bool {
+	l, ok1 := parseVersion(latest)
+	c, ok2 := parseVersion(current)
+	if !ok1 || !ok2 {
+		return false
+	}
+	for i := range l {
+		if l[i] != c[i] {
+			return l[i] > c[i]
+		}
+	}
+	return false
+}
+
+func parseVersion(v string) ([3]int, bool) {
+	var out [3]int
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return out, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return out, false
+		}
+		out[i] = n
+	}
+	return out, true
+}
+
+// runVersion implements "version".
+func runVersion(args []string) error {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	check := fs.Bool("check", false, "check the release endpoint for a newer version")
+	releaseURL := fs.String("release-url", DefaultReleaseURL, "GitHub-compatible latest release endpoint")
+	fs.Parse(args)
+
+	fmt.Printf("subgraph-monitor %s\n", version)
+	fmt.Printf("  commit:     %s\n", orUnknown(commit))
+	fmt.Printf("  built:      %s\n", orUnknown(buildDate))
+	fmt.Printf("  go version: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	if !*check {
+		return nil
+	}
+	latest, available, err := checkForUpdate(*releaseURL)
+	if err != nil {
+		return err
+	}
+	if available {
+		fmt.Printf("A newer version is available: %s\n", latest)
+	} else {
+		fmt.Printf("Up to date (latest release %s)\n", latest)
+	}
+	return nil
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+)
+
+// Exit codes of "wait" besides 0 (ready), 1 (error) and 2 (usage).
+const (
+	waitExitTimeout = 3
+	waitExitFailed  = 4
+)
+
+// waitProgress is one observation of the subgraph being waited for.
+type waitProgress struct {
+	Block  int64
+	Head   int64
+	Status Status
+}
+
+// statusWaitProgress reads the progress from a running monitor's status.
+// When needLag, a status whose lag is unknown is an error rather than
+// progress: against a stale head every subgraph soon looks in sync.
+func statusWaitProgress(s SubgraphStatus, needLag bool) (waitProgress, error) {
+	if s.Error != "" {
+		return waitProgress{Status: s.Status}, fmt.Errorf("%s", s.Error)
+	}
+	if needLag && (slices.Contains(s.Unknown, UnknownBlocksBehind) || s.ChainHeadSource == HeadSourceStale) {
+		return waitProgress{Status: s.Status}, fmt.Errorf("lag is unknown, the monitor has no fresh chain head")
+	}
+	return waitProgress{Block: s.CurrentBlock, Head: s.ChainBlock, Status: s.Status}, nil
+}
+
+// runWait implements "wait": it blocks until a subgraph is within -within
+// blocks of its chain head, or has indexed -block, for deploy pipelines to
+// gate on. It checks the subgraph itself from the config, or asks a running
+// monitor with -server.
+func runWait(args []string) error {
+	fs := flag.NewFlagSet("wait", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	kubeConfigMap := fs.String("k8s-configmap", "", "load config from a ConfigMap ([namespace/]name)")
+	kubeSecret := fs.String("k8s-secret", "", "load config from a Secret ([namespace/]name)")
+	kubeKey := fs.String("k8s-key", defaultKubeDataKey, "ConfigMap/Secret data key holding the config")
+	server := fs.String("server", "", "base URL of a running monitor's HTTP API to ask instead of checking directly")
+	token := fs.String("token", os.Getenv("SUBGRAPH_MONITOR_TOKEN"), "bearer token for -server (default $SUBGRAPH_MONITOR_TOKEN)")
+	within := fs.Int64("within", 10, "ready when at most this many blocks behind the chain head")
+	block := fs.Int64("block", 0, "ready when this block is indexed, instead of -within")
+	timeout := fs.Duration("timeout", 30*time.Minute, "give up after this long")
+	interval := fs.Duration("interval", 10*time.Second, "time between checks")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s wait [flags] <subgraph>\n", os.Args[0])
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "Exit codes: 0 ready, 1 error, 2 usage, %d timed out, %d subgraph failed\n", waitExitTimeout, waitExitFailed)
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *within < 0 || *block < 0 {
+		return fmt.Errorf("-within and -block must not be negative")
+	}
+	if *interval < minDebugInterval {
+		return fmt.Errorf("-interval must be at least %s", minDebugInterval)
+	}
+	name := fs.Arg(0)
+
+	var check func(n int) (waitProgress, error)
+	if *server != "" {
+		check = func(int) (waitProgress, error) {
+			statuses, err := fetchStatuses(*server, *token)
+			if err != nil {
+				return waitProgress{}, err
+			}
+			for _, s := range statuses {
+				if s.Name == name {
+					return statusWaitProgress(s, *block == 0)
+				}
+			}
+			return waitProgress{}, fmt.Errorf("the monitor has no subgraph named %q", name)
+		}
+	} else {
+		cfg, _, err := loadConfig(*configPath, *kubeConfigMap, *kubeSecret, *kubeKey)
+		if err != nil {
+			return err
+		}
+		applyHTTPConfig(cfg)
+		sg := cfg.findSubgraph(name)
+		if sg == nil {
+			return fmt.Errorf("no subgraph named %q", name)
+		}
+		chain := cfg.Chains[sg.Chain]
+		if chain == nil && *block == 0 {
+			return fmt.Errorf("subgraph %s: unknown chain %q, pass -block", name, sg.Chain)
+		}
+		cycleID := newCycleID()
+		check = func(n int) (waitProgress, error) {
+			checkID := newCheckID(cycleID, n)
+			meta, err := fetchSubgraphMetaRetrying(sg.URL, checkID, sg.ResponseSchema, sg.GraphQLRequest)
+			if err != nil {
+				if graphQLErrorKind(err) == GraphQLErrorIndexingFailed {
+					return waitProgress{Status: StatusFailed}, err
+				}
+				return waitProgress{}, err
+			}
+			p := waitProgress{Block: meta.Block}
+			failed := meta.HasIndexingErrors
+			if sg.IndexNodeURL != "" && meta.Deployment != "" {
+				// The index node tells a failed deployment from one that
+				// only has non-fatal errors.
+				if st, err := fetchIndexingStatus(sg.IndexNodeURL, meta.Deployment, checkID); err == nil {
+					failed = st.Health == "failed"
+				}
+			}
+			if failed {
+				p.Status = StatusFailed
+				return p, nil
+			}
+			if *block == 0 {
+				if p.Head, err = getHeadBlockFromChain(chain.RpcURL, chain.HeadPolicy, checkID); err != nil {
+					return p, fmt.Errorf("chain %s: %v", sg.Chain, err)
+				}
+			}
+			return p, nil
+		}
+	}
+
+	target := fmt.Sprintf("within %d blocks of the chain head", *within)
+	if *block > 0 {
+		target = fmt.Sprintf("at block %d", *block)
+	}
+	fmt.Printf("Waiting up to %s for %s to be %s\n", *timeout, name, target)
+	start := time.Now()
+	deadline := start.Add(*timeout)
+	for n := 1; ; n++ {
+		p, err := check(n)
+		elapsed := time.Since(start).Round(time.Second)
+		switch {
+		case p.Status == StatusFailed:
+			if err != nil {
+				fmt.Printf("%s FAILED after %s: %v\n", name, elapsed, err)
+			} else {
+				fmt.Printf("%s FAILED after %s\n", name, elapsed)
+			}
+			os.Exit(waitExitFailed)
+		case err != nil:
+			fmt.Printf("[%s] check failed: %v\n", elapsed, err)
+		case *block > 0 && p.Block >= *block:
+			fmt.Printf("%s reached block %d (at %d) after %s\n", name, *block, p.Block, elapsed)
+			return nil
+		case *block > 0:
+			fmt.Printf("[%s] at block %d, %d to go\n", elapsed, p.Block, *block-p.Block)
+		case p.Head > 0 && p.Head-p.Block <= *within:
+			fmt.Printf("%s is %d blocks behind the chain head (%d) after %s\n", name, max(0, p.Head-p.Block), p.Head, elapsed)
+			return nil
+		default:
+			fmt.Printf("[%s] at block %d, %d blocks behind %d\n", elapsed, p.Block, p.Head-p.Block, p.Head)
+		}
+		if time.Now().Add(*interval).After(deadline) {
+			fmt.Printf("Timed out after %s waiting for %s to be %s\n", *timeout, name, target)
+			os.Exit(waitExitTimeout)
+		}
+		time.Sleep(*interval)
+	}
+}
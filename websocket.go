@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	websocketGUID       = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	websocketMaxPayload = 64 << 10
+	websocketPingPeriod = 30 * time.Second
+	websocketWriteWait  = 10 * time.Second
+
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xA
+)
+
+// wsConn is a minimal RFC 6455 connection, enough to exchange text messages
+// and keep the connection alive. Client connections mask their frames.
+type wsConn struct {
+	conn       net.Conn
+	rw         *bufio.ReadWriter
+	mu         sync.Mutex
+	client     bool
+	maxPayload uint64
+	// readTimeout, when set, fails reads once the peer has sent nothing,
+	// not even a pong, for that long.
+	readTimeout time.Duration
+}
+
+var errWebSocketOrigin = errors.New("websocket origin not allowed")
+
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") &&
+		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+}
+
+// websocketOriginAllowed reports whether a browser page from the request's
+// Origin may open the WebSocket. Browsers send cookies and basic auth
+// credentials along with any page's handshake, so only the API's own host
+// and origins listed by name in cors are accepted; "*" does not count.
+// Requests without an Origin do not come from a browser.
+func websocketOriginAllowed(r *http.Request, cors CORSConfig) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	_, listed := cors.allows(origin)
+	return listed
+}
+
+// upgradeWebSocket completes the handshake of a WebSocket request whose
+// Origin cors allows.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request, cors CORSConfig) (*wsConn, error) {
+	if !isWebSocketUpgrade(r) {
+		return nil, fmt.Errorf("not a websocket upgrade request")
+	}
+	if !websocketOriginAllowed(r, cors) {
+		return nil, errWebSocketOrigin
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, fmt.Errorf("unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, fmt.Errorf("missing Sec-WebSocket-Key")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, fmt.Errorf("connection does not support hijacking")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(sum[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, rw: rw, maxPayload: websocketMaxPayload}, nil
+}
+
+// dialWebSocket opens a client connection to a ws:// or wss:// URL.
+func dialWebSocket(rawURL string, maxPayload uint64) (*wsConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "wss" {
+			host += ":443"
+		} else {
+			host += ":80"
+		}
+	}
+	dialer := &net.Dialer{Timeout: HTTPTimeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "wss":
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	case "ws":
+		conn, err = dialer.Dial("tcp", host)
+	default:
+		return nil, fmt.Errorf("unsupported websocket scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce [16]byte
+	rand.Read(nonce[:])
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    u,
+		Host:   u.Host,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+			"User-Agent":            {defaultUserAgent()},
+		},
+	}
+	conn.SetDeadline(time.Now().Add(HTTPTimeout))
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	resp, err := http.ReadResponse(rw.Reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		conn.Close()
+		return nil, fmt.Errorf("websocket handshake failed: %s", resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+	return &wsConn{conn: conn, rw: rw, client: true, maxPayload: maxPayload}, nil
+}
+
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *wsConn) WriteText(payload []byte) error {
+	return c.writeFrame(wsOpText, payload)
+}
+
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, maskBit|byte(n))
+	case n <= 0xFFFF:
+		header = append(header, maskBit|126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, maskBit|127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	if c.client {
+		var mask [4]byte
+		rand.Read(mask[:])
+		header = append(header, mask[:]...)
+		masked := make([]byte, len(payload))
+		for i := range payload {
+			masked[i] = payload[i] ^ mask[i%4]
+		}
+		payload = masked
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(websocketWriteWait))
+	if _, err := c.rw.Write(header); err != nil {
+		return err
+	}
+	if _, err := c.rw.Write(payload); err != nil {
+		return err
+	}
+	return c.rw.Flush()
+}
+
+// readLoop consumes client frames, answering pings and close requests, and
+// returns once the client goes away. Data frames from clients are ignored.
+func (c *wsConn) readLoop() error {
+	for {
+		if _, err := c.ReadMessage(); err != nil {
+			return err
+		}
+	}
+}
+
+// ReadMessage returns the next data message, reassembling fragments and
+// answering pings and close requests on the way.
+func (c *wsConn) ReadMessage() ([]byte, error) {
+	header := make([]byte, 2)
+	var message []byte
+	for {
+		if c.readTimeout > 0 {
+			c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+		}
+		if _, err := io.ReadFull(c.rw, header); err != nil {
+			return nil, err
+		}
+		fin := header[0]&0x80 != 0
+		opcode := header[0] & 0x0F
+		masked := header[1]&0x80 != 0
+		length := uint64(header[1] & 0x7F)
+
+		switch length {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+				return nil, err
+			}
+			length = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+				return nil, err
+			}
+			length = binary.BigEndian.Uint64(ext[:])
+		}
+		if length > c.maxPayload || uint64(len(message))+length > c.maxPayload {
+			c.writeFrame(wsOpClose, []byte{0x03, 0xF1}) // 1009: message too big
+			return nil, fmt.Errorf("message too large: %d bytes", uint64(len(message))+length)
+		}
+
+		var mask [4]byte
+		if masked {
+			if _, err := io.ReadFull(c.rw, mask[:]); err != nil {
+				return nil, err
+			}
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.rw, payload); err != nil {
+			return nil, err
+		}
+		if masked {
+			for i := range payload {
+				payload[i] ^= mask[i%4]
+			}
+		}
+
+		switch opcode {
+		case wsOpClose:
+			c.writeFrame(wsOpClose, payload)
+			return nil, io.EOF
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return nil, err
+			}
+		case wsOpPong:
+		default:
+			message = append(message, payload...)
+			if fin {
+				return message, nil
+			}
+		}
+	}
+}